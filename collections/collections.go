@@ -1,21 +1,40 @@
 package collections
 
+import (
+	"maps"
+	"slices"
+)
+
 type OrderedMap[K comparable, V comparable] struct {
+	keys  []K
 	slice []V
-	m     map[K]V
+	// m indexes the values by key. A clone only builds it when it's first used.
+	m map[K]V
 }
 
 func NewOrderedMap[K comparable, V comparable]() *OrderedMap[K, V] {
 	return &OrderedMap[K, V]{
+		keys:  make([]K, 0, 10),
 		slice: make([]V, 0, 10),
 		m:     make(map[K]V, 10),
 	}
 }
 
+func (o *OrderedMap[K, V]) index() map[K]V {
+	if o.m == nil {
+		o.m = make(map[K]V, len(o.keys))
+		for i, k := range o.keys {
+			o.m[k] = o.slice[i]
+		}
+	}
+	return o.m
+}
+
 func (o *OrderedMap[K, V]) Add(key K, value V) {
-	if _, ok := o.m[key]; ok {
+	if _, ok := o.index()[key]; ok {
 		return
 	}
+	o.keys = append(o.keys, key)
 	o.slice = append(o.slice, value)
 	o.m[key] = value
 }
@@ -24,27 +43,53 @@ func (o *OrderedMap[K, V]) List() []V {
 	return o.slice
 }
 
+// Clone returns a copy of the map, with each value replaced by f(value).
+// If f is nil, the values are kept and the copy shares its lists with the map
+// until either is changed.
+func (o *OrderedMap[K, V]) Clone(f func(V) V) *OrderedMap[K, V] {
+	if f == nil {
+		return &OrderedMap[K, V]{keys: slices.Clip(o.keys), slice: slices.Clip(o.slice)}
+	}
+	ret := &OrderedMap[K, V]{
+		keys:  slices.Clone(o.keys),
+		slice: make([]V, 0, len(o.slice)),
+	}
+	for _, v := range o.slice {
+		ret.slice = append(ret.slice, f(v))
+	}
+	return ret
+}
+
 func (o *OrderedMap[K, V]) Get(key K) (v V, ok bool) {
-	v, ok = o.m[key]
+	v, ok = o.index()[key]
 	return
 }
 
-func (o *OrderedMap[K, V]) Remove(key K) {
-	value, ok := o.m[key]
+// Rekey moves the value stored under oldKey to newKey, keeping its position.
+func (o *OrderedMap[K, V]) Rekey(oldKey, newKey K) bool {
+	value, ok := o.index()[oldKey]
 	if !ok {
+		return false
+	}
+	if _, ok := o.m[newKey]; ok {
+		return false
+	}
+	delete(o.m, oldKey)
+	o.m[newKey] = value
+	// The lists may be shared with a clone, so they aren't changed in place
+	o.keys = slices.Clone(o.keys)
+	o.keys[slices.Index(o.keys, oldKey)] = newKey
+	return true
+}
+
+func (o *OrderedMap[K, V]) Remove(key K) {
+	if _, ok := o.index()[key]; !ok {
 		return
 	}
 	delete(o.m, key)
-	for i, v := range o.slice {
-		if v == value {
-			if i == len(o.slice)-1 {
-				o.slice = o.slice[:i]
-			} else {
-				o.slice = append(o.slice[:i], o.slice[i+1:]...)
-			}
-			return
-		}
-	}
+	i := slices.Index(o.keys, key)
+	o.keys = append(o.keys[:i:i], o.keys[i+1:]...)
+	o.slice = append(o.slice[:i:i], o.slice[i+1:]...)
 }
 
 type Multimap[K comparable, V comparable] struct {
@@ -75,7 +120,8 @@ func (m *Multimap[K, V]) RemoveValue(key K, value V) {
 	}
 	for i, v := range s {
 		if v == value {
-			s = append(s[:i], s[min(i+1, len(s)):]...)
+			// The values may be shared with a clone, so they aren't changed in place
+			s = append(s[:i:i], s[i+1:]...)
 			if len(s) == 0 {
 				delete(m.m, key)
 			} else {
@@ -86,6 +132,35 @@ func (m *Multimap[K, V]) RemoveValue(key K, value V) {
 	}
 }
 
+// Clone returns a copy of the multimap, with each key replaced by fk(key)
+// and each value by fv(value). A nil fk or fv keeps the keys or values as
+// they are. If both are nil, the copy shares its lists of values with the
+// multimap until either is changed.
+func (m *Multimap[K, V]) Clone(fk func(K) K, fv func(V) V) *Multimap[K, V] {
+	if fk == nil && fv == nil {
+		ret := &Multimap[K, V]{m: maps.Clone(m.m)}
+		for k, vs := range ret.m {
+			ret.m[k] = slices.Clip(vs)
+		}
+		return ret
+	}
+	if fk == nil {
+		fk = func(k K) K { return k }
+	}
+	if fv == nil {
+		fv = func(v V) V { return v }
+	}
+	ret := &Multimap[K, V]{m: make(map[K][]V, len(m.m))}
+	for k, vs := range m.m {
+		copied := make([]V, 0, len(vs))
+		for _, v := range vs {
+			copied = append(copied, fv(v))
+		}
+		ret.m[fk(k)] = copied
+	}
+	return ret
+}
+
 func (m *Multimap[K, V]) Get(key K) ([]V, bool) {
 
 	value, ok := m.m[key]
@@ -2,54 +2,103 @@ package main
 
 import (
 	_ "embed"
+	"flag"
 	"fmt"
-	"io/fs"
 	"os"
-	"path/filepath"
-	"strings"
 
+	"github.com/alexrjones/pgmodelparse/migrations"
 	"github.com/alexrjones/pgmodelparse/pgmodelparse"
 	"github.com/davecgh/go-spew/spew"
 	"github.com/rs/zerolog/log"
 )
 
+const usage = `Usage: pgmodelparse [-format name] <dir>
+       pgmodelparse verify-down [-format name] <dir>
+
+The first form applies the migrations in dir and prints the resulting catalog.
+verify-down checks that each down migration reverses its up migration, and
+exits with status 1 if any doesn't.
+`
+
 func main() {
 
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: pgmodelparse <dir>")
-		os.Exit(1)
+	if len(os.Args) > 1 && os.Args[1] == "verify-down" {
+		verifyDown(os.Args[2:])
+		return
+	}
+	migs := loadMigrations("pgmodelparse", os.Args[1:])
+	compiler := pgmodelparse.NewCompiler()
+	err := migrations.Migrate(compiler, migs)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+		return
 	}
+	spew.Dump(compiler.Catalog)
+}
 
-	var migrations []string
-	err := filepath.WalkDir(os.Args[1], func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		if !strings.HasSuffix(path, ".sql") {
-			return nil
-		}
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
-		migrations = append(migrations, string(data))
-		return nil
-	})
+func verifyDown(args []string) {
+
+	migs := loadMigrations("verify-down", args)
+	mismatches, err := migrations.VerifyDown(migs)
 	if err != nil {
 		log.Fatal().Err(err).Send()
 		return
 	}
+	for _, m := range migs {
+		if !m.Repeatable() && !m.HasDown() {
+			log.Warn().Msgf("migration %s has no down migration", m)
+		}
+	}
+	for _, m := range mismatches {
+		fmt.Fprintln(os.Stderr, m.Error())
+	}
+	if len(mismatches) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%d down migrations verified\n", countDown(migs))
+}
 
-	compiler := pgmodelparse.NewCompiler()
-	for _, mig := range migrations {
-		err = compiler.ParseRaw(mig)
-		if err != nil {
-			log.Fatal().Err(err).Send()
-			return
+func countDown(migs []*migrations.Migration) int {
+
+	n := 0
+	for _, m := range migs {
+		if m.HasDown() {
+			n++
 		}
 	}
-	spew.Dump(compiler.Catalog)
+	return n
+}
+
+// loadMigrations parses the -format flag and directory argument,
+// and loads the migrations from the directory.
+func loadMigrations(name string, args []string) []*migrations.Migration {
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	formatName := flags.String("format", "", "migration file convention: golang-migrate, goose, dbmate or flyway (detected if empty)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+
+	fsys := os.DirFS(flags.Arg(0))
+	var format migrations.Format
+	var err error
+	if *formatName == "" {
+		format, err = migrations.DetectFormat(fsys)
+	} else {
+		format, err = migrations.ParseFormat(*formatName)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	migs, err := migrations.Load(fsys, format)
+	if err != nil {
+		log.Fatal().Err(err).Send()
+	}
+	return migs
 }
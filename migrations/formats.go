@@ -0,0 +1,295 @@
+package migrations
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Format is the convention a migration tool uses to name and lay out migrations.
+type Format int
+
+const (
+	// GolangMigrate is golang-migrate's layout: NNN_name.up.sql and NNN_name.down.sql.
+	GolangMigrate Format = iota
+	// Goose is goose's layout: NNN_name.sql, divided by -- +goose Up and -- +goose Down.
+	Goose
+	// Dbmate is dbmate's layout: NNN_name.sql, divided by -- migrate:up and -- migrate:down.
+	Dbmate
+	// Flyway is Flyway's layout: V1__name.sql, with U1__name.sql undoing it,
+	// and R__name.sql for repeatable migrations.
+	Flyway
+)
+
+var formatNames = map[Format]string{
+	GolangMigrate: "golang-migrate",
+	Goose:         "goose",
+	Dbmate:        "dbmate",
+	Flyway:        "flyway",
+}
+
+func (f Format) String() string {
+
+	if name, ok := formatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format with the given name, e.g. "golang-migrate".
+func ParseFormat(name string) (Format, error) {
+
+	for f, n := range formatNames {
+		if strings.EqualFold(name, n) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown migration format %s", name)
+}
+
+var (
+	golangMigrateFile = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql$`)
+	gooseFile         = regexp.MustCompile(`^([0-9]+)_(.*)\.sql$`)
+	dbmateFile        = regexp.MustCompile(`^([0-9]+)_?(.*)\.sql$`)
+	flywayFile        = regexp.MustCompile(`^([VUR])([0-9._]*)__(.*)\.sql$`)
+	gooseAnnotation   = regexp.MustCompile(`(?i)^--\s*\+goose\s+(.*\S)`)
+	dbmateAnnotation  = regexp.MustCompile(`^--\s*migrate:(up|down)\b`)
+)
+
+// DetectFormat guesses the format of the migrations in a directory tree from
+// the names and contents of its files.
+func DetectFormat(fsys fs.FS) (Format, error) {
+
+	var names []string
+	var contents []string
+	err := walkSQLFiles(fsys, func(p, content string) error {
+		names = append(names, path.Base(p))
+		contents = append(contents, content)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range names {
+		switch {
+		case golangMigrateFile.MatchString(name):
+			return GolangMigrate, nil
+		case flywayFile.MatchString(name):
+			return Flyway, nil
+		}
+	}
+	for _, content := range contents {
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			switch {
+			case gooseAnnotation.MatchString(line):
+				return Goose, nil
+			case dbmateAnnotation.MatchString(line):
+				return Dbmate, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("couldn't detect the migration format")
+}
+
+// parseFile reads the version and name of a migration file from its file
+// name, and its up and down migrations from its contents.
+func (f Format) parseFile(name, content string) (migrationFile, error) {
+
+	switch f {
+	case GolangMigrate:
+		m := golangMigrateFile.FindStringSubmatch(name)
+		if m == nil {
+			return migrationFile{}, fmt.Errorf("file name doesn't match NNN_name.up.sql or NNN_name.down.sql")
+		}
+		version, err := ParseVersion(m[1])
+		if err != nil {
+			return migrationFile{}, err
+		}
+		file := migrationFile{version: version, name: m[2]}
+		if m[3] == "up" {
+			file.up = &content
+		} else {
+			file.down = &content
+		}
+		return file, nil
+	case Goose, Dbmate:
+		pattern, annotation, up, down := gooseFile, gooseAnnotation, "up", "down"
+		if f == Dbmate {
+			pattern, annotation = dbmateFile, dbmateAnnotation
+		}
+		m := pattern.FindStringSubmatch(name)
+		if m == nil {
+			return migrationFile{}, fmt.Errorf("file name doesn't match NNN_name.sql")
+		}
+		version, err := ParseVersion(m[1])
+		if err != nil {
+			return migrationFile{}, err
+		}
+		sections := splitSections(content, func(line string) string {
+			if m := annotation.FindStringSubmatch(line); m != nil {
+				// Other goose annotations, such as StatementBegin, are left in place,
+				// as they are comments to the compiler
+				if section := strings.ToLower(m[1]); section == up || section == down {
+					return section
+				}
+			}
+			return ""
+		})
+		file := migrationFile{version: version, name: m[2]}
+		if f == Goose {
+			noTransaction, err := checkGooseStatements(content)
+			if err != nil {
+				return migrationFile{}, err
+			}
+			file.transactional = !noTransaction
+		}
+		upSQL, ok := sections[up]
+		if !ok {
+			return migrationFile{}, fmt.Errorf("no up migration annotation found")
+		}
+		file.up = &upSQL
+		if downSQL, ok := sections[down]; ok {
+			file.down = &downSQL
+		}
+		return file, nil
+	case Flyway:
+		m := flywayFile.FindStringSubmatch(name)
+		if m == nil {
+			return migrationFile{}, fmt.Errorf("file name doesn't match V1__name.sql, U1__name.sql or R__name.sql")
+		}
+		file := migrationFile{name: m[3]}
+		if m[1] == "R" {
+			if m[2] != "" {
+				return migrationFile{}, fmt.Errorf("repeatable migrations can't have a version")
+			}
+			file.up = &content
+			return file, nil
+		}
+		version, err := ParseVersion(m[2])
+		if err != nil {
+			return migrationFile{}, err
+		}
+		file.version = version
+		if m[1] == "V" {
+			file.up = &content
+		} else {
+			file.down = &content
+		}
+		return file, nil
+	}
+	return migrationFile{}, fmt.Errorf("unknown migration format %d", int(f))
+}
+
+// checkGooseStatements follows goose's division of a file into statements,
+// returning an error where goose couldn't run it. Outside a StatementBegin
+// and StatementEnd block, goose ends a statement at each line ending with a
+// semicolon, so one ending a line of a function body or string splits the
+// statement in two. It also reports whether the file is annotated NO TRANSACTION.
+func checkGooseStatements(content string) (noTransaction bool, err error) {
+
+	var section string
+	var blockStart, statementStart int
+	var statement []string
+	unfinished := func() error {
+		if blockStart > 0 {
+			return fmt.Errorf("line %d: -- +goose StatementBegin has no StatementEnd", blockStart)
+		}
+		if len(statement) > 0 {
+			return fmt.Errorf("line %d: statement doesn't end with a semicolon", statementStart)
+		}
+		return nil
+	}
+	for i, line := range strings.Split(content, "\n") {
+		lineNo := i + 1
+		trimmed := strings.TrimSpace(line)
+		if m := gooseAnnotation.FindStringSubmatch(trimmed); m != nil {
+			switch annotation := strings.ToLower(m[1]); annotation {
+			case "up", "down":
+				if err := unfinished(); err != nil {
+					return false, err
+				}
+				section = annotation
+			case "statementbegin":
+				if section == "" {
+					return false, fmt.Errorf("line %d: -- +goose StatementBegin before -- +goose Up", lineNo)
+				}
+				if err := unfinished(); err != nil {
+					return false, err
+				}
+				blockStart = lineNo
+			case "statementend":
+				if blockStart == 0 {
+					return false, fmt.Errorf("line %d: -- +goose StatementEnd has no StatementBegin", lineNo)
+				}
+				blockStart = 0
+			case "no transaction":
+				noTransaction = true
+			default:
+				return false, fmt.Errorf("line %d: unsupported goose annotation %s", lineNo, m[1])
+			}
+			continue
+		}
+		// Blocks are run as they are, and goose ignores comments between statements
+		if section == "" || blockStart > 0 || (len(statement) == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--"))) {
+			continue
+		}
+		if len(statement) == 0 {
+			statementStart = lineNo
+		}
+		statement = append(statement, line)
+		if !gooseStatementEnds(line) {
+			continue
+		}
+		if _, err := pg_query.Scan(strings.Join(statement, "\n")); err != nil {
+			return false, fmt.Errorf("line %d: goose ends the statement from line %d here, but it is incomplete (%w); "+
+				"put it between -- +goose StatementBegin and StatementEnd", lineNo, statementStart, err)
+		}
+		statement = nil
+	}
+	return noTransaction, unfinished()
+}
+
+// gooseStatementEnds reports whether goose ends a statement at a line: whether
+// its last word, ignoring a trailing comment, ends with a semicolon.
+func gooseStatementEnds(line string) bool {
+
+	last := ""
+	for _, word := range strings.Fields(line) {
+		if strings.HasPrefix(word, "--") {
+			break
+		}
+		last = word
+	}
+	return strings.HasSuffix(last, ";")
+}
+
+// splitSections splits a file into the sections begun by the lines for which
+// sectionOf returns a section name. Each section keeps the file's line numbers,
+// with the lines of the rest of the file left empty.
+func splitSections(content string, sectionOf func(line string) string) map[string]string {
+
+	lines := strings.Split(content, "\n")
+	sections := make(map[string][]string)
+	current := ""
+	for i, line := range lines {
+		if section := sectionOf(strings.TrimSpace(line)); section != "" {
+			current = section
+			if _, ok := sections[current]; !ok {
+				sections[current] = make([]string, len(lines))
+			}
+		}
+		if current != "" {
+			sections[current][i] = line
+		}
+	}
+	ret := make(map[string]string, len(sections))
+	for section, lines := range sections {
+		ret[section] = strings.Join(lines, "\n")
+	}
+	return ret
+}
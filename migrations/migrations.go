@@ -0,0 +1,336 @@
+// Package migrations loads the migration files of a directory laid out
+// according to one of the common migration tools' conventions.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/alexrjones/pgmodelparse/pgmodelparse"
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+var (
+	// ErrDuplicateVersion is returned when two migrations have the same version.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrMissingVersion is returned when sequentially numbered migrations skip a
+	// version, or a down migration has no up migration.
+	ErrMissingVersion = errors.New("missing migration version")
+	// ErrMismatchedName is returned when the up and down migrations of a
+	// version have different names.
+	ErrMismatchedName = errors.New("mismatched migration name")
+)
+
+// Version is a migration version. Versions are compared numerically part by
+// part, so Flyway's 1.10 comes after 1.9; most tools use a single part.
+type Version []uint64
+
+// ParseVersion parses a version whose parts are separated by dots or underscores.
+func ParseVersion(s string) (Version, error) {
+
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	var v Version
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '_' }) {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %s", s)
+		}
+		v = append(v, n)
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 as v is less than, equal to or greater than o.
+// Missing parts count as zero, so 1 and 1.0 are the same version.
+func (v Version) Compare(o Version) int {
+
+	for i := 0; i < max(len(v), len(o)); i++ {
+		var a, b uint64
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(o) {
+			b = o[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) String() string {
+
+	parts := make([]string, 0, len(v))
+	for _, n := range v {
+		parts = append(parts, strconv.FormatUint(n, 10))
+	}
+	return strings.Join(parts, ".")
+}
+
+// key returns the version without trailing zero parts, so that versions
+// which compare equal have the same key.
+func (v Version) key() string {
+
+	for len(v) > 1 && v[len(v)-1] == 0 {
+		v = v[:len(v)-1]
+	}
+	return v.String()
+}
+
+// Migration is one step of a migration set: the SQL that migrates up to a
+// version, and the SQL that migrates back down from it if there is any.
+type Migration struct {
+	// Version is nil for a Flyway repeatable migration.
+	Version Version
+	Name    string
+	// Up and Down are the SQL to apply. For formats that keep both in one
+	// file, the other section is blanked out so that line numbers still match the file.
+	Up   string
+	Down string
+	// UpFile and DownFile are the paths of the files the SQL came from.
+	// DownFile is empty if there is no down migration.
+	UpFile   string
+	DownFile string
+	// Transactional is set if the migration tool runs each migration in a
+	// transaction, as goose does unless a file is annotated NO TRANSACTION.
+	Transactional bool
+}
+
+// Repeatable reports whether this is a Flyway repeatable migration, which
+// is applied after the versioned migrations.
+func (m *Migration) Repeatable() bool {
+	return m.Version == nil
+}
+
+// HasDown reports whether the migration can be reversed.
+func (m *Migration) HasDown() bool {
+	return m.DownFile != ""
+}
+
+// ApplyUp applies the up migration to the compiler's catalog.
+func (m *Migration) ApplyUp(c *pgmodelparse.Compiler) error {
+	return m.apply(c, m.UpFile, m.Up)
+}
+
+// ApplyDown applies the down migration to the compiler's catalog.
+func (m *Migration) ApplyDown(c *pgmodelparse.Compiler) error {
+
+	if !m.HasDown() {
+		return fmt.Errorf("migration %s has no down migration", m)
+	}
+	return m.apply(c, m.DownFile, m.Down)
+}
+
+// apply applies the SQL of a file, within a transaction if the migration
+// tool would use one, so that statements such as CREATE INDEX CONCURRENTLY
+// fail as they would when migrating, and a failure leaves nothing behind.
+func (m *Migration) apply(c *pgmodelparse.Compiler, file, sql string) error {
+
+	if !m.Transactional {
+		return c.ParseFile(file, sql)
+	}
+	err := c.ParseStatement(transactionStmt(pg_query.TransactionStmtKind_TRANS_STMT_BEGIN))
+	if err != nil {
+		return err
+	}
+	err = c.ParseFile(file, sql)
+	end := pg_query.TransactionStmtKind_TRANS_STMT_COMMIT
+	if err != nil {
+		end = pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK
+	}
+	if endErr := c.ParseStatement(transactionStmt(end)); err == nil {
+		err = endErr
+	}
+	return err
+}
+
+func transactionStmt(kind pg_query.TransactionStmtKind) *pg_query.RawStmt {
+
+	return &pg_query.RawStmt{Stmt: &pg_query.Node{
+		Node: &pg_query.Node_TransactionStmt{TransactionStmt: &pg_query.TransactionStmt{Kind: kind}},
+	}}
+}
+
+func (m *Migration) String() string {
+
+	if m.Repeatable() {
+		return m.Name
+	}
+	return m.Version.String() + "_" + m.Name
+}
+
+// Load finds the migrations in a directory tree, returning them in the order
+// they are applied. Every problem found is returned, joined into one error.
+func Load(fsys fs.FS, format Format) ([]*Migration, error) {
+
+	var files []migrationFile
+	var errs []error
+	err := walkSQLFiles(fsys, func(p, content string) error {
+		file, err := format.parseFile(path.Base(p), content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p, err))
+			return nil
+		}
+		file.path = p
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := pairFiles(files)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return migrations, nil
+}
+
+// walkSQLFiles calls fn with the path and contents of each .sql file in a
+// directory tree. Like the go tool, it skips testdata directories, so that
+// fixtures kept alongside migrations aren't taken for them.
+func walkSQLFiles(fsys fs.FS, fn func(p, content string) error) error {
+
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "testdata" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".sql") {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return fn(p, string(data))
+	})
+}
+
+// Migrate applies the up migrations in order.
+func Migrate(c *pgmodelparse.Compiler, migrations []*Migration) error {
+
+	for _, m := range migrations {
+		err := m.ApplyUp(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrationFile is what a file contributes to a migration: its up
+// migration, down migration or both.
+type migrationFile struct {
+	path          string
+	version       Version
+	name          string
+	up            *string
+	down          *string
+	transactional bool
+}
+
+// pairFiles combines the up and down migrations of each version and sorts
+// them, checking for duplicate and missing versions, and that the files
+// of each version agree on its name.
+func pairFiles(files []migrationFile) ([]*Migration, error) {
+
+	var errs []error
+	var versioned, repeatable []*Migration
+	byVersion := make(map[string]*Migration)
+	for _, f := range files {
+		if f.version == nil {
+			if f.up != nil {
+				repeatable = append(repeatable, &Migration{Name: f.name, Up: *f.up, UpFile: f.path})
+			}
+			continue
+		}
+		key := f.version.key()
+		m, ok := byVersion[key]
+		if !ok {
+			m = &Migration{Version: f.version, Name: f.name, Transactional: f.transactional}
+			byVersion[key] = m
+			versioned = append(versioned, m)
+		}
+		if f.up != nil && m.UpFile != "" {
+			errs = append(errs, fmt.Errorf("%w %s: %s and %s", ErrDuplicateVersion, f.version, m.UpFile, f.path))
+			continue
+		}
+		if f.down != nil && m.DownFile != "" {
+			errs = append(errs, fmt.Errorf("%w %s: %s and %s", ErrDuplicateVersion, f.version, m.DownFile, f.path))
+			continue
+		}
+		if f.name != m.Name {
+			other := m.UpFile
+			if other == "" {
+				other = m.DownFile
+			}
+			// The files are still paired, so this is the only error for the version
+			errs = append(errs, fmt.Errorf("%w %s: %s and %s", ErrMismatchedName, f.version, other, f.path))
+		}
+		if f.up != nil {
+			m.Up, m.UpFile = *f.up, f.path
+		}
+		if f.down != nil {
+			m.Down, m.DownFile = *f.down, f.path
+		}
+	}
+	for _, m := range versioned {
+		if m.UpFile == "" {
+			errs = append(errs, fmt.Errorf("%w %s: %s has no up migration", ErrMissingVersion, m.Version, m.DownFile))
+		}
+	}
+	slices.SortFunc(versioned, func(a, b *Migration) int { return a.Version.Compare(b.Version) })
+	errs = append(errs, checkSequence(versioned)...)
+	// Flyway applies repeatable migrations in order of their descriptions
+	slices.SortFunc(repeatable, func(a, b *Migration) int { return strings.Compare(a.Name, b.Name) })
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return append(versioned, repeatable...), nil
+}
+
+// maxSequentialVersion is the largest version treated as a sequence number.
+// Larger versions are taken to be timestamps, which are expected to have gaps.
+const maxSequentialVersion = 1000000
+
+// checkSequence reports the versions missing from sequentially numbered migrations.
+func checkSequence(migrations []*Migration) []error {
+
+	for _, m := range migrations {
+		if len(m.Version) != 1 || m.Version[0] >= maxSequentialVersion {
+			return nil
+		}
+	}
+	var errs []error
+	for i := 1; i < len(migrations); i++ {
+		prev, next := migrations[i-1].Version[0], migrations[i].Version[0]
+		switch {
+		case next == prev+2:
+			errs = append(errs, fmt.Errorf("%w %d: between %s and %s", ErrMissingVersion,
+				prev+1, migrations[i-1].UpFile, migrations[i].UpFile))
+		case next > prev+2:
+			errs = append(errs, fmt.Errorf("%w %d to %d: between %s and %s", ErrMissingVersion,
+				prev+1, next-1, migrations[i-1].UpFile, migrations[i].UpFile))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,366 @@
+package migrations
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexrjones/pgmodelparse/pgmodelparse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mapFS(files map[string]string) fstest.MapFS {
+	fsys := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+func assertLoad(t *testing.T, format Format, files map[string]string) []*Migration {
+	migrations, err := Load(mapFS(files), format)
+	require.Nil(t, err)
+	return migrations
+}
+
+func assertLoadError(t *testing.T, format Format, files map[string]string, target error, messageContains ...string) {
+	_, err := Load(mapFS(files), format)
+	require.NotNil(t, err)
+	if target != nil {
+		assert.ErrorIs(t, err, target)
+	}
+	for _, m := range messageContains {
+		assert.Contains(t, err.Error(), m)
+	}
+}
+
+func migrationNames(migrations []*Migration) []string {
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.String())
+	}
+	return names
+}
+
+func TestLoad_GolangMigrate(t *testing.T) {
+
+	migrations := assertLoad(t, GolangMigrate, map[string]string{
+		"10_add_index.up.sql":        "CREATE INDEX ON users (name);",
+		"10_add_index.down.sql":      "DROP INDEX users_name_idx;",
+		"9_create_users.up.sql":      "CREATE TABLE users (name text);",
+		"9_create_users.down.sql":    "DROP TABLE users;",
+		"8_create_schema.up.sql":     "CREATE SCHEMA app;",
+		"README.md":                  "not a migration",
+		"sub/11_add_column.up.sql":   "ALTER TABLE users ADD COLUMN email text;",
+		"sub/11_add_column.down.sql": "ALTER TABLE users DROP COLUMN email;",
+	})
+	assert.Equal(t, []string{"8_create_schema", "9_create_users", "10_add_index", "11_add_column"}, migrationNames(migrations))
+	assert.False(t, migrations[0].HasDown())
+	assert.Equal(t, "9_create_users.up.sql", migrations[1].UpFile)
+	assert.Equal(t, "9_create_users.down.sql", migrations[1].DownFile)
+	assert.Equal(t, "DROP TABLE users;", migrations[1].Down)
+	assert.Equal(t, "sub/11_add_column.up.sql", migrations[3].UpFile)
+
+	assertLoadError(t, GolangMigrate, map[string]string{"create_users.sql": ""}, nil,
+		"create_users.sql: file name doesn't match")
+}
+
+func TestLoad_Goose(t *testing.T) {
+
+	migrations := assertLoad(t, Goose, map[string]string{
+		"00002_add_function.sql": `-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION f();
+`,
+		"00001_create_users.sql": `-- comment before the annotations
+-- +goose Up
+CREATE TABLE users (name text);
+`,
+	})
+	require.Len(t, migrations, 2)
+	assert.Equal(t, "create_users", migrations[0].Name)
+	assert.Equal(t, "\n-- +goose Up\nCREATE TABLE users (name text);\n", migrations[0].Up)
+	assert.False(t, migrations[0].HasDown())
+	// Both sections keep the file's line numbers
+	assert.Equal(t, "\n\n\n\n\n-- +goose Down\nDROP FUNCTION f();\n", migrations[1].Down)
+	assert.Contains(t, migrations[1].Up, "-- +goose StatementBegin\nCREATE FUNCTION")
+	assert.NotContains(t, migrations[1].Up, "DROP FUNCTION")
+	assert.Equal(t, "00002_add_function.sql", migrations[1].UpFile)
+	assert.Equal(t, "00002_add_function.sql", migrations[1].DownFile)
+
+	assertLoadError(t, Goose, map[string]string{"00001_create_users.sql": "CREATE TABLE users ();"}, nil,
+		"no up migration annotation found")
+
+	// Goose would split a function body at the semicolons ending its lines
+	assertLoadError(t, Goose, map[string]string{"00001_add_function.sql": `-- +goose Up
+CREATE FUNCTION f() RETURNS int AS $$
+BEGIN
+    RETURN 1;
+END $$ LANGUAGE plpgsql;
+`}, nil, "00001_add_function.sql: line 4: goose ends the statement from line 2 here, but it is incomplete",
+		"put it between -- +goose StatementBegin and StatementEnd")
+	assertLoadError(t, Goose, map[string]string{"00001_create_users.sql": "-- +goose Up\nCREATE TABLE users ()\n"}, nil,
+		"line 2: statement doesn't end with a semicolon")
+	assertLoadError(t, Goose, map[string]string{"00001_add_function.sql": `-- +goose Up
+-- +goose StatementBegin
+CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+-- +goose Down
+`}, nil, "line 2: -- +goose StatementBegin has no StatementEnd")
+	assertLoadError(t, Goose, map[string]string{"00001_create_users.sql": "-- +goose Up\n-- +goose StatementEnd\n"}, nil,
+		"line 2: -- +goose StatementEnd has no StatementBegin")
+	assertLoadError(t, Goose, map[string]string{"00001_create_users.sql": "-- +goose ENVSUB ON\n-- +goose Up\n"}, nil,
+		"line 1: unsupported goose annotation ENVSUB ON")
+}
+
+func TestLoad_GooseTestdata(t *testing.T) {
+
+	migrations, err := Load(os.DirFS("testdata/goose"), Goose)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1_create_users", "2_index_users_name"}, migrationNames(migrations))
+	assert.True(t, migrations[0].Transactional)
+	assert.False(t, migrations[1].Transactional)
+
+	c := pgmodelparse.NewCompiler()
+	require.Nil(t, Migrate(c, migrations))
+	_, err = c.FindIndex("", "users_name_idx")
+	assert.Nil(t, err)
+	require.Nil(t, migrations[1].ApplyDown(c))
+	require.Nil(t, migrations[0].ApplyDown(c))
+
+	// Without NO TRANSACTION, goose runs the migration in a transaction,
+	// where CREATE INDEX CONCURRENTLY fails, and the whole migration is undone
+	migrations = assertLoad(t, Goose, map[string]string{
+		"00001_create_users.sql": `-- +goose Up
+CREATE TABLE users (name text);
+CREATE INDEX CONCURRENTLY users_name_idx ON users (name);
+`,
+	})
+	c = pgmodelparse.NewCompiler()
+	err = Migrate(c, migrations)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "00001_create_users.sql:3:1: CREATE INDEX CONCURRENTLY cannot run inside a transaction block")
+	schema, _ := c.Catalog.Schemas.Get("public")
+	_, ok := schema.Tables.Get("users")
+	assert.False(t, ok)
+}
+
+func TestLoad_Dbmate(t *testing.T) {
+
+	migrations := assertLoad(t, Dbmate, map[string]string{
+		"20240102000000_add_email.sql": `-- migrate:up transaction:false
+ALTER TABLE users ADD COLUMN email text;
+
+-- migrate:down
+ALTER TABLE users DROP COLUMN email;
+`,
+		"20240101000000_create_users.sql": `-- migrate:up
+CREATE TABLE users (name text);
+
+-- migrate:down
+DROP TABLE users;
+`,
+	})
+	// Timestamped versions aren't checked for gaps
+	assert.Equal(t, []string{"20240101000000_create_users", "20240102000000_add_email"}, migrationNames(migrations))
+	assert.Equal(t, "-- migrate:up transaction:false\nALTER TABLE users ADD COLUMN email text;\n\n\n\n", migrations[1].Up)
+	assert.Equal(t, "\n\n\n-- migrate:down\nALTER TABLE users DROP COLUMN email;\n", migrations[1].Down)
+}
+
+func TestLoad_Flyway(t *testing.T) {
+
+	migrations := assertLoad(t, Flyway, map[string]string{
+		"V1.10__add_index.sql":     "CREATE INDEX ON users (name);",
+		"V1.9__add_email.sql":      "ALTER TABLE users ADD COLUMN email text;",
+		"V1__create_users.sql":     "CREATE TABLE users (name text);",
+		"U1__create_users.sql":     "DROP TABLE users;",
+		"R__users_view.sql":        "CREATE OR REPLACE VIEW v AS SELECT * FROM users;",
+		"R__active_users_view.sql": "CREATE OR REPLACE VIEW a AS SELECT * FROM users;",
+		"V2_1__add_orders.sql":     "CREATE TABLE orders (id int);",
+		"sub/V3__add_products.sql": "CREATE TABLE products (id int);",
+	})
+	assert.Equal(t, []string{
+		"1_create_users", "1.9_add_email", "1.10_add_index", "2.1_add_orders", "3_add_products",
+		"active_users_view", "users_view",
+	}, migrationNames(migrations))
+	assert.True(t, migrations[0].HasDown())
+	assert.Equal(t, "U1__create_users.sql", migrations[0].DownFile)
+	assert.True(t, migrations[5].Repeatable())
+
+	assertLoadError(t, Flyway, map[string]string{"R1__view.sql": ""}, nil,
+		"repeatable migrations can't have a version")
+	assertLoadError(t, Flyway, map[string]string{"V1__a.sql": "", "V1.0__b.sql": ""}, ErrDuplicateVersion,
+		"duplicate migration version 1: V1.0__b.sql and V1__a.sql")
+}
+
+func TestLoad_VersionErrors(t *testing.T) {
+
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":  "",
+		"1_create_orders.up.sql": "",
+	}, ErrDuplicateVersion, "duplicate migration version 1: 1_create_orders.up.sql and 1_create_users.up.sql")
+
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":    "",
+		"2_create_orders.up.sql":   "",
+		"5_create_products.up.sql": "",
+	}, ErrMissingVersion, "missing migration version 3 to 4: between 2_create_orders.up.sql and 5_create_products.up.sql")
+
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":  "",
+		"3_create_orders.up.sql": "",
+	}, ErrMissingVersion, "missing migration version 2: between")
+
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":    "",
+		"2_create_orders.down.sql": "",
+	}, ErrMissingVersion, "missing migration version 2: 2_create_orders.down.sql has no up migration")
+
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":    "",
+		"1_create_people.down.sql": "",
+	}, ErrMismatchedName, "mismatched migration name 1: 1_create_people.down.sql and 1_create_users.up.sql")
+
+	assertLoadError(t, Flyway, map[string]string{
+		"V1__create_users.sql":  "",
+		"U1__create_people.sql": "",
+	}, ErrMismatchedName, "mismatched migration name 1: U1__create_people.sql and V1__create_users.sql")
+
+	// Every problem is reported
+	assertLoadError(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":  "",
+		"1_create_orders.up.sql": "",
+		"4_create_items.up.sql":  "",
+		"invalid.sql":            "",
+	}, nil, "duplicate migration version 1", "missing migration version 2 to 3", "invalid.sql")
+}
+
+func TestParseFormat(t *testing.T) {
+
+	for _, f := range []Format{GolangMigrate, Goose, Dbmate, Flyway} {
+		parsed, err := ParseFormat(f.String())
+		assert.Nil(t, err)
+		assert.Equal(t, f, parsed)
+	}
+	_, err := ParseFormat("liquibase")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Format(99)", Format(99).String())
+}
+
+func TestDetectFormat(t *testing.T) {
+
+	for format, files := range map[Format]map[string]string{
+		GolangMigrate: {"1_a.up.sql": ""},
+		Goose:         {"1_a.sql": "-- +goose Up\nCREATE TABLE a ();"},
+		Dbmate:        {"1_a.sql": "-- migrate:up\nCREATE TABLE a ();"},
+		Flyway:        {"V1__a.sql": ""},
+	} {
+		detected, err := DetectFormat(mapFS(files))
+		assert.Nil(t, err)
+		assert.Equal(t, format, detected)
+	}
+	_, err := DetectFormat(mapFS(map[string]string{"a.sql": ""}))
+	assert.NotNil(t, err)
+}
+
+func usersTable(t *testing.T, c *pgmodelparse.Compiler) *pgmodelparse.Table {
+	schema, ok := c.Catalog.Schemas.Get("public")
+	require.True(t, ok)
+	table, ok := schema.Tables.Get("users")
+	require.True(t, ok)
+	return table
+}
+
+func TestMigrate(t *testing.T) {
+
+	migrations := assertLoad(t, Goose, map[string]string{
+		"001_create_users.sql": `-- +goose Up
+CREATE TABLE users (id bigserial primary key, name text);
+
+-- +goose Down
+DROP TABLE users;
+`,
+		"002_add_email.sql": `-- +goose Up
+ALTER TABLE users ADD COLUMN email text;
+-- +goose Down
+ALTER TABLE users DROP COLUMN email;
+`,
+	})
+	c := pgmodelparse.NewCompiler()
+	require.Nil(t, Migrate(c, migrations))
+	assert.Len(t, usersTable(t, c).Columns.List(), 3)
+
+	require.Nil(t, migrations[1].ApplyDown(c))
+	assert.Len(t, usersTable(t, c).Columns.List(), 2)
+
+	// Errors are located in the migration's file, on the line of the file
+	c = pgmodelparse.NewCompiler()
+	err := migrations[1].ApplyUp(c)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "002_add_email.sql:2:1: ")
+}
+
+func TestMigrate_Testdata(t *testing.T) {
+
+	fsys := os.DirFS("testdata/golang-migrate")
+	format, err := DetectFormat(fsys)
+	require.Nil(t, err)
+	assert.Equal(t, GolangMigrate, format)
+	migrations, err := Load(fsys, format)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"1_Create_table"}, migrationNames(migrations))
+	require.Nil(t, Migrate(pgmodelparse.NewCompiler(), migrations))
+
+	// The sample migrations alongside the package leave out the fixtures in testdata
+	migrations, err = Load(os.DirFS("."), GolangMigrate)
+	require.Nil(t, err)
+	assert.Equal(t, "0001_Create_table.up.sql", migrations[0].UpFile)
+	assert.Len(t, migrations, 1)
+}
+
+func TestVerifyDown(t *testing.T) {
+
+	migrations := assertLoad(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":   "CREATE TABLE users (id bigserial primary key, name text not null);",
+		"1_create_users.down.sql": "DROP TABLE users;",
+		"2_add_email.up.sql":      "ALTER TABLE users ADD COLUMN email text; ALTER TABLE users ALTER COLUMN name DROP NOT NULL;",
+		"2_add_email.down.sql":    "ALTER TABLE users DROP COLUMN email;",
+		"3_add_orders.up.sql":     "CREATE TABLE orders (id int);",
+		"4_add_index.up.sql":      "CREATE INDEX ON orders (id);",
+		"4_add_index.down.sql":    "DROP INDEX missing_idx;",
+		"5_add_status.up.sql":     "CREATE TYPE status AS ENUM ('open'); ALTER TABLE orders ADD COLUMN status status;",
+		"5_add_status.down.sql":   "ALTER TABLE orders DROP COLUMN status; DROP TYPE status;",
+		"6_add_default.up.sql":    "ALTER TABLE orders ALTER COLUMN id SET DEFAULT 1+1;",
+		"6_add_default.down.sql":  "-- Nothing to undo",
+	})
+	mismatches, err := VerifyDown(migrations)
+	require.Nil(t, err)
+	require.Len(t, mismatches, 3)
+
+	assert.Equal(t, "2_add_email", mismatches[0].Migration.String())
+	assert.Nil(t, mismatches[0].Err)
+	assert.Equal(t, "column public.users.name: not null changed from true to false", mismatches[0].Differences.String())
+	assert.Equal(t, "down migration 2_add_email doesn't reverse its up migration:\n"+
+		"column public.users.name: not null changed from true to false", mismatches[0].Error())
+
+	assert.Equal(t, "4_add_index", mismatches[1].Migration.String())
+	require.NotNil(t, mismatches[1].Err)
+	assert.Contains(t, mismatches[1].Error(), "down migration 4_add_index failed: 4_add_index.down.sql:1:1: ")
+
+	assert.Equal(t, "6_add_default", mismatches[2].Migration.String())
+	assert.Equal(t, "column public.orders.id: has default changed from false to true\n"+
+		"column public.orders.id: default changed from none to 1 + 1", mismatches[2].Differences.String())
+
+	// A failing up migration stops the verification
+	migrations = assertLoad(t, GolangMigrate, map[string]string{
+		"1_create_users.up.sql":   "CREATE TABLE users (id int);",
+		"1_create_users.down.sql": "DROP TABLE users;",
+		"2_add_email.up.sql":      "ALTER TABLE missing ADD COLUMN email text;",
+	})
+	_, err = VerifyDown(migrations)
+	assert.ErrorContains(t, err, "2_add_email.up.sql:1:1: ")
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/alexrjones/pgmodelparse/pgmodelparse"
+)
+
+// Mismatch is a down migration that doesn't return the catalog to the state
+// its up migration started from.
+type Mismatch struct {
+	Migration *Migration
+	// Err is set if the down migration failed to apply.
+	Err error
+	// Differences lists how the catalog after the down migration differs from
+	// the catalog before the up migration.
+	Differences pgmodelparse.Differences
+}
+
+func (m *Mismatch) Error() string {
+
+	if m.Err != nil {
+		return fmt.Sprintf("down migration %s failed: %v", m.Migration, m.Err)
+	}
+	return fmt.Sprintf("down migration %s doesn't reverse its up migration:\n%s", m.Migration, m.Differences)
+}
+
+// VerifyDown checks that each down migration reverses its up migration. For
+// every version N with a down migration, it compiles the migrations up to N,
+// applies up N+1 then down N+1, and compares the catalog with the one at N.
+// Migrations without a down migration, and repeatable migrations, aren't checked.
+// An error is returned if an up migration fails, as the later migrations
+// can't be checked without it.
+func VerifyDown(migrations []*Migration) ([]*Mismatch, error) {
+
+	var ret []*Mismatch
+	c := pgmodelparse.NewCompiler()
+	for _, m := range migrations {
+		if m.Repeatable() {
+			break
+		}
+		if m.HasDown() {
+			// Go up and down on a copy, keeping c at the version before
+			after := c.Clone()
+			err := m.ApplyUp(after)
+			if err != nil {
+				return nil, err
+			}
+			err = m.ApplyDown(after)
+			if err != nil {
+				ret = append(ret, &Mismatch{Migration: m, Err: err})
+			} else if diffs := pgmodelparse.Compare(c, after); len(diffs) > 0 {
+				ret = append(ret, &Mismatch{Migration: m, Differences: diffs})
+			}
+		}
+		err := m.ApplyUp(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
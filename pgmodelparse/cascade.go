@@ -0,0 +1,146 @@
+package pgmodelparse
+
+import (
+	"errors"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// failedObject identifies an object that a failed statement would have defined.
+type failedObject struct {
+	kind string
+	// table is the qualified name of the table a column or constraint belongs to.
+	table string
+	name  string
+}
+
+func newFailedObject(kind, table, name string) failedObject {
+
+	switch kind {
+	case "table", "view", "sequence", "index":
+		// These share a namespace, and lookups of one may report another
+		kind = "relation"
+	}
+	// Errors name objects with varying qualification, so compare unqualified names
+	return failedObject{kind: kind, table: table, name: name[strings.LastIndexByte(name, '.')+1:]}
+}
+
+// recordFailure adds a failure to the diagnostics. If the statement failed
+// because an object it needs wasn't defined by an earlier failed statement,
+// the failure is marked as cascading from that one.
+func (c *Compiler) recordFailure(stmt *pg_query.Node, diag *Diagnostic) {
+
+	var notFound *NotFoundError
+	if errors.Is(diag.Err, ErrTransactionAborted) {
+		diag.Cause = c.abortedBy
+	} else if errors.As(diag.Err, &notFound) {
+		diag.Cause = c.failedObjects[newFailedObject(notFound.Kind, notFound.Table, notFound.Name)]
+	}
+	root := diag
+	if diag.Cause != nil {
+		root = diag.Cause
+	}
+	if c.transactionAborted && c.abortedBy == nil {
+		c.abortedBy = root
+	}
+	if c.failedObjects == nil {
+		c.failedObjects = make(map[failedObject]*Diagnostic)
+	}
+	for _, obj := range c.definedObjects(stmt) {
+		c.failedObjects[obj] = root
+	}
+	c.Diagnostics = append(c.Diagnostics, diag)
+}
+
+// forgetFailures forgets failures to define the objects a statement has
+// successfully defined.
+func (c *Compiler) forgetFailures(stmt *pg_query.Node) {
+
+	if len(c.failedObjects) == 0 {
+		return
+	}
+	for _, obj := range c.definedObjects(stmt) {
+		delete(c.failedObjects, obj)
+	}
+}
+
+// definedObjects returns the objects a statement creates, or gives a new name to.
+func (c *Compiler) definedObjects(stmt *pg_query.Node) []failedObject {
+
+	switch p := stmt.Node.(type) {
+	case *pg_query.Node_CreateSchemaStmt:
+		return []failedObject{newFailedObject("schema", "", p.CreateSchemaStmt.Schemaname)}
+	case *pg_query.Node_CreateStmt:
+		return []failedObject{newFailedObject("relation", "", p.CreateStmt.Relation.GetRelname())}
+	case *pg_query.Node_CreateTableAsStmt:
+		return []failedObject{newFailedObject("relation", "", p.CreateTableAsStmt.Into.GetRel().GetRelname())}
+	case *pg_query.Node_ViewStmt:
+		return []failedObject{newFailedObject("relation", "", p.ViewStmt.View.GetRelname())}
+	case *pg_query.Node_CreateSeqStmt:
+		return []failedObject{newFailedObject("relation", "", p.CreateSeqStmt.Sequence.GetRelname())}
+	case *pg_query.Node_IndexStmt:
+		return []failedObject{newFailedObject("relation", "", p.IndexStmt.Idxname)}
+	case *pg_query.Node_CreateEnumStmt:
+		return []failedObject{typeObject(p.CreateEnumStmt.TypeName)}
+	case *pg_query.Node_CreateDomainStmt:
+		return []failedObject{typeObject(p.CreateDomainStmt.Domainname)}
+	case *pg_query.Node_CreateRangeStmt:
+		return []failedObject{typeObject(p.CreateRangeStmt.TypeName)}
+	case *pg_query.Node_CompositeTypeStmt:
+		return []failedObject{newFailedObject("type", "", p.CompositeTypeStmt.Typevar.GetRelname())}
+	case *pg_query.Node_AlterTableStmt:
+		var ret []failedObject
+		table := c.relationName(p.AlterTableStmt.Relation)
+		for _, n := range p.AlterTableStmt.Cmds {
+			cmd := n.GetAlterTableCmd()
+			switch cmd.GetSubtype() {
+			case pg_query.AlterTableType_AT_AddColumn:
+				ret = append(ret, newFailedObject("column", table, cmd.Def.GetColumnDef().GetColname()))
+			case pg_query.AlterTableType_AT_AddConstraint:
+				if name := cmd.Def.GetConstraint().GetConname(); name != "" {
+					ret = append(ret, newFailedObject("constraint", table, name))
+				}
+			}
+		}
+		return ret
+	case *pg_query.Node_RenameStmt:
+		switch p.RenameStmt.RenameType {
+		case pg_query.ObjectType_OBJECT_TABLE, pg_query.ObjectType_OBJECT_INDEX, pg_query.ObjectType_OBJECT_SEQUENCE,
+			pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_MATVIEW:
+			return []failedObject{newFailedObject("relation", "", p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_COLUMN:
+			return []failedObject{newFailedObject("column", c.relationName(p.RenameStmt.Relation), p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_TABCONSTRAINT:
+			return []failedObject{newFailedObject("constraint", c.relationName(p.RenameStmt.Relation), p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_ATTRIBUTE:
+			// The attributes of composite types aren't in a table
+			return []failedObject{newFailedObject("column", "", p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_DOMCONSTRAINT:
+			// Nor are the constraints of domains
+			return []failedObject{newFailedObject("constraint", "", p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_SCHEMA:
+			return []failedObject{newFailedObject("schema", "", p.RenameStmt.Newname)}
+		case pg_query.ObjectType_OBJECT_TYPE, pg_query.ObjectType_OBJECT_DOMAIN:
+			return []failedObject{newFailedObject("type", "", p.RenameStmt.Newname)}
+		}
+	}
+	return nil
+}
+
+// relationName returns the qualified name of the relation, the way
+// Table.FQName gives it.
+func (c *Compiler) relationName(rv *pg_query.RangeVar) string {
+
+	schema, err := c.RelationSchema(rv.GetSchemaname(), rv.GetRelname())
+	if err != nil {
+		return rv.GetRelname()
+	}
+	return schema + "." + rv.GetRelname()
+}
+
+func typeObject(names []*pg_query.Node) failedObject {
+
+	_, name := ObjectNameFromNodeList(names)
+	return newFailedObject("type", "", name)
+}
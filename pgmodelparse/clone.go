@@ -0,0 +1,318 @@
+package pgmodelparse
+
+import (
+	"maps"
+	"slices"
+)
+
+// Clone returns a deep copy of the compiler, so that changes to one don't
+// affect the other.
+func (c *Compiler) Clone() *Compiler {
+
+	cp := &copier{copies: make(map[any]any)}
+	ret := &Compiler{
+		SearchPath:        slices.Clone(c.SearchPath),
+		Catalog:           copyObject(cp, c.Catalog, fillCatalog),
+		TypeRegistry:      copyObject(cp, c.TypeRegistry, fillTypeRegistry),
+		inTransaction:     c.inTransaction,
+		sessionSearchPath: slices.Clone(c.sessionSearchPath),
+		localSearchPath:   c.localSearchPath,
+		ContinueOnError:   c.ContinueOnError,
+		Unsupported:       c.Unsupported,
+		Diagnostics:       slices.Clone(c.Diagnostics),
+		Skipped:           slices.Clone(c.Skipped),
+		failedObjects:     maps.Clone(c.failedObjects),
+	}
+	// Rolling back the clone must undo the changes to the copied objects
+	ret.undo = c.undo.copy(cp)
+	ret.transactionStart = c.transactionStart
+	ret.savepoints = slices.Clone(c.savepoints)
+	ret.transactionAborted, ret.abortedBy = c.transactionAborted, c.abortedBy
+	return ret
+}
+
+// copier copies the objects of a catalog and type registry. Each object is
+// copied once, however many objects refer to it, and built-in types, which
+// are never modified, are shared.
+type copier struct {
+	// copies maps the objects copied so far to their copies. If it is nil,
+	// objects aren't copied, only the slices and maps that hold them.
+	copies map[any]any
+}
+
+// keep is the copier that keeps objects as they are, copying only the
+// collections and maps that hold them. Slices are only ever replaced or
+// appended to, so they are shared.
+var keep = &copier{}
+
+// copyObject returns a copy of src, made by copying its value into a new
+// object and calling fill to replace the slices, maps and pointers it
+// shares with src.
+func copyObject[T any](cp *copier, src *T, fill func(cp *copier, v *T)) *T {
+
+	if src == nil || cp.copies == nil {
+		return src
+	}
+	if dst, ok := cp.copies[src]; ok {
+		return dst.(*T)
+	}
+	dst := new(T)
+	*dst = *src
+	cp.copies[src] = dst
+	fill(cp, dst)
+	return dst
+}
+
+// copyAll returns a slice holding copies of the elements of s.
+func copyAll[S ~[]*T, T any](cp *copier, s S, fill func(cp *copier, v *T)) S {
+
+	if s == nil {
+		return nil
+	}
+	if cp.copies == nil {
+		return slices.Clip(s)
+	}
+	ret := make(S, 0, len(s))
+	for _, e := range s {
+		ret = append(ret, copyObject(cp, e, fill))
+	}
+	return ret
+}
+
+// copySlice returns a copy of a slice of values.
+func copySlice[S ~[]E, E any](cp *copier, s S) S {
+
+	if cp.copies == nil {
+		return slices.Clip(s)
+	}
+	return slices.Clone(s)
+}
+
+// copyFunc returns f, or nil when objects are kept, to pass to the
+// Clone methods of collections.
+func copyFunc[T any](cp *copier, f func(*T) *T) func(*T) *T {
+
+	if cp.copies == nil {
+		return nil
+	}
+	return f
+}
+
+func (cp *copier) schema(s *Schema) *Schema {
+	return copyObject(cp, s, fillSchema)
+}
+
+func (cp *copier) table(t *Table) *Table {
+	return copyObject(cp, t, fillTable)
+}
+
+func (cp *copier) column(col *Column) *Column {
+	return copyObject(cp, col, fillColumn)
+}
+
+func (cp *copier) constraint(con *Constraint) *Constraint {
+	return copyObject(cp, con, fillConstraint)
+}
+
+func (cp *copier) index(idx *Index) *Index {
+	return copyObject(cp, idx, fillIndex)
+}
+
+func (cp *copier) view(v *View) *View {
+	return copyObject(cp, v, fillView)
+}
+
+func (cp *copier) sequence(seq *Sequence) *Sequence {
+	return copyObject(cp, seq, fillSequence)
+}
+
+func (cp *copier) postgresType(t *PostgresType) *PostgresType {
+
+	if t == nil || t.Schema == "" {
+		// Built-in types, and arrays of them
+		return t
+	}
+	return copyObject(cp, t, fillPostgresType)
+}
+
+func fillCatalog(cp *copier, c *Catalog) {
+
+	c.Schemas = c.Schemas.Clone(copyFunc(cp, cp.schema))
+	c.PgConstraint = copyObject(cp, c.PgConstraint, fillPgConstraint)
+}
+
+func fillPgConstraint(cp *copier, d *PgConstraint) {
+
+	column, constraint := copyFunc(cp, cp.column), copyFunc(cp, cp.constraint)
+	d.ByColumn = d.ByColumn.Clone(column, constraint)
+	d.Constrains = d.Constrains.Clone(column, constraint)
+	d.Refers = d.Refers.Clone(column, constraint)
+	if cp.copies == nil {
+		d.ByName = maps.Clone(d.ByName)
+		return
+	}
+	byName := make(map[string]*Constraint, len(d.ByName))
+	for name, con := range d.ByName {
+		byName[name] = cp.constraint(con)
+	}
+	d.ByName = byName
+}
+
+func fillSchema(cp *copier, s *Schema) {
+
+	s.Tables = s.Tables.Clone(copyFunc(cp, cp.table))
+	s.Indexes = s.Indexes.Clone(copyFunc(cp, cp.index))
+	s.Views = s.Views.Clone(copyFunc(cp, cp.view))
+	s.Sequences = s.Sequences.Clone(copyFunc(cp, cp.sequence))
+}
+
+func fillTable(cp *copier, t *Table) {
+
+	t.Columns = t.Columns.Clone(copyFunc(cp, cp.column))
+	t.PartitionKey = copyObject(cp, t.PartitionKey, fillPartitionKey)
+	t.PartitionOf = cp.table(t.PartitionOf)
+	t.PartitionBound = copyObject(cp, t.PartitionBound, fillPartitionBound)
+	t.Inherits = copyAll(cp, t.Inherits, fillTable)
+}
+
+func fillPartitionKey(cp *copier, k *PartitionKey) {
+
+	k.Keys = copyAll(cp, k.Keys, fillPartitionKeyElem)
+}
+
+func fillPartitionKeyElem(cp *copier, e *PartitionKeyElem) {
+
+	e.Column = cp.column(e.Column)
+	e.Columns = copyAll(cp, e.Columns, fillColumn)
+}
+
+func fillPartitionBound(cp *copier, b *PartitionBound) {
+
+	b.In = copySlice(cp, b.In)
+	b.From = copySlice(cp, b.From)
+	b.To = copySlice(cp, b.To)
+}
+
+func fillColumn(cp *copier, col *Column) {
+
+	col.Table = cp.table(col.Table)
+	col.Type = cp.postgresType(col.Type)
+	col.Attrs = copyObject(cp, col.Attrs, fillColumnAttributes)
+}
+
+func fillColumnAttributes(cp *copier, a *ColumnAttributes) {
+
+	a.IdentitySequence = cp.sequence(a.IdentitySequence)
+	a.GeneratedFrom = copyAll(cp, a.GeneratedFrom, fillColumn)
+	a.Domain = cp.postgresType(a.Domain)
+}
+
+func fillConstraint(cp *copier, con *Constraint) {
+
+	con.Table = cp.table(con.Table)
+	con.RefersTable = cp.table(con.RefersTable)
+	con.Refers = copyAll(cp, con.Refers, fillColumn)
+	con.Constrains = copyAll(cp, con.Constrains, fillColumn)
+	con.OnDeleteColumns = copyAll(cp, con.OnDeleteColumns, fillColumn)
+	con.InheritedFrom = cp.constraint(con.InheritedFrom)
+}
+
+func fillIndex(cp *copier, idx *Index) {
+
+	idx.Table = cp.table(idx.Table)
+	idx.View = cp.view(idx.View)
+	idx.Keys = copyAll(cp, idx.Keys, fillIndexKey)
+	idx.Include = copyAll(cp, idx.Include, fillColumn)
+	idx.ViewInclude = copyAll(cp, idx.ViewInclude, fillViewColumn)
+	idx.PredicateColumns = copyAll(cp, idx.PredicateColumns, fillColumn)
+	idx.Constraint = cp.constraint(idx.Constraint)
+}
+
+func fillIndexKey(cp *copier, key *IndexKey) {
+
+	key.Column = cp.column(key.Column)
+	key.ViewColumn = copyObject(cp, key.ViewColumn, fillViewColumn)
+	key.Columns = copyAll(cp, key.Columns, fillColumn)
+}
+
+func fillView(cp *copier, v *View) {
+
+	v.Columns = copyAll(cp, v.Columns, fillViewColumn)
+	v.Tables = copyAll(cp, v.Tables, fillTable)
+	v.DependsOnColumns = copyAll(cp, v.DependsOnColumns, fillColumn)
+	v.Views = copyAll(cp, v.Views, fillView)
+}
+
+func fillViewColumn(cp *copier, col *ViewColumn) {
+
+	col.Type = cp.postgresType(col.Type)
+	col.Source = cp.column(col.Source)
+}
+
+func fillSequence(cp *copier, seq *Sequence) {
+
+	seq.Type = cp.postgresType(seq.Type)
+	seq.OwnedBy = cp.column(seq.OwnedBy)
+}
+
+func fillPostgresType(cp *copier, t *PostgresType) {
+
+	t.NonSerialType = cp.postgresType(t.NonSerialType)
+	t.EnumValues = copySlice(cp, t.EnumValues)
+	t.SimpleMatches = copySlice(cp, t.SimpleMatches)
+	t.PatternMatches = copySlice(cp, t.PatternMatches)
+	t.ElementType = cp.postgresType(t.ElementType)
+	t.Domain = copyObject(cp, t.Domain, fillDomain)
+	t.Composite = copyObject(cp, t.Composite, fillComposite)
+	t.Range = copyObject(cp, t.Range, fillRange)
+	t.MultirangeOf = cp.postgresType(t.MultirangeOf)
+}
+
+func fillDomain(cp *copier, d *Domain) {
+
+	d.BaseType = cp.postgresType(d.BaseType)
+	d.Checks = copyAll(cp, d.Checks, fillDomainCheck)
+}
+
+func fillDomainCheck(*copier, *DomainCheck) {}
+
+func fillComposite(cp *copier, c *Composite) {
+
+	c.Attributes = copyAll(cp, c.Attributes, fillTypeAttribute)
+}
+
+func fillTypeAttribute(cp *copier, attr *TypeAttribute) {
+
+	attr.Type = cp.postgresType(attr.Type)
+}
+
+func fillRange(cp *copier, r *Range) {
+
+	r.Subtype = cp.postgresType(r.Subtype)
+	r.Multirange = cp.postgresType(r.Multirange)
+}
+
+func fillTypeRegistry(cp *copier, r *TypeRegistry) {
+
+	if cp.copies == nil {
+		r.patternMatches = slices.Clip(r.patternMatches)
+		r.simpleMatches = maps.Clone(r.simpleMatches)
+		r.arrays = maps.Clone(r.arrays)
+		return
+	}
+	patternMatches := make([]patternMatch, 0, len(r.patternMatches))
+	for _, pm := range r.patternMatches {
+		patternMatches = append(patternMatches, patternMatch{regex: pm.regex, typ: cp.postgresType(pm.typ)})
+	}
+	r.patternMatches = patternMatches
+	simpleMatches := make(map[string]*PostgresType, len(r.simpleMatches))
+	for name, t := range r.simpleMatches {
+		simpleMatches[name] = cp.postgresType(t)
+	}
+	r.simpleMatches = simpleMatches
+	arrays := make(map[arrayKey]*PostgresType, len(r.arrays))
+	for key, t := range r.arrays {
+		arrays[arrayKey{elem: cp.postgresType(key.elem), dims: key.dims}] = cp.postgresType(t)
+	}
+	r.arrays = arrays
+}
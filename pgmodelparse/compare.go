@@ -0,0 +1,433 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Change says how an object differs between two catalogs.
+type Change int
+
+const (
+	// ChangeAdded is an object that only exists in the new catalog.
+	ChangeAdded Change = iota
+	// ChangeRemoved is an object that only exists in the old catalog.
+	ChangeRemoved
+	// ChangeAltered is an object whose attribute differs between the catalogs.
+	ChangeAltered
+)
+
+func (c Change) String() string {
+
+	switch c {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeAltered:
+		return "altered"
+	}
+	return fmt.Sprintf("Change(%d)", int(c))
+}
+
+// Difference is an object that differs between two catalogs.
+type Difference struct {
+	Change Change
+	// Kind is the kind of object, e.g. "table", "column", "constraint" or "type".
+	Kind string
+	// Name is the qualified name of the object.
+	Name string
+	// Attribute is the attribute that differs, e.g. "not null", for ChangeAltered.
+	Attribute string
+	// Old and New are the values of the attribute in each catalog.
+	Old string
+	New string
+}
+
+func (d *Difference) String() string {
+
+	switch d.Change {
+	case ChangeAdded, ChangeRemoved:
+		return fmt.Sprintf("%s %s was %s", d.Kind, d.Name, d.Change)
+	}
+	return fmt.Sprintf("%s %s: %s changed from %s to %s", d.Kind, d.Name, d.Attribute, valueString(d.Old), valueString(d.New))
+}
+
+func valueString(v string) string {
+
+	if v == "" {
+		return "none"
+	}
+	return v
+}
+
+// Differences lists the differences between two catalogs, in catalog order.
+type Differences []*Difference
+
+func (ds Differences) String() string {
+
+	lines := make([]string, 0, len(ds))
+	for _, d := range ds {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Compare structurally compares the catalogs and user-defined types of two
+// compilers, returning every schema, type, table, column, constraint, index,
+// view and sequence that was added, removed or altered going from old to new.
+// Objects are matched by name, so a renamed object is reported as removed and added.
+func Compare(old, new *Compiler) Differences {
+
+	oldObjects, newObjects := describeCatalog(old), describeCatalog(new)
+	byKey := make(map[string]*describedObject, len(newObjects))
+	for _, obj := range newObjects {
+		byKey[obj.key()] = obj
+	}
+	var ret Differences
+	seen := make(map[string]bool, len(oldObjects))
+	for _, o := range oldObjects {
+		seen[o.key()] = true
+		n, ok := byKey[o.key()]
+		if !ok {
+			ret = append(ret, &Difference{Change: ChangeRemoved, Kind: o.kind, Name: o.name})
+			continue
+		}
+		for i, attr := range o.attrs {
+			if n.attrs[i].value != attr.value {
+				ret = append(ret, &Difference{
+					Change:    ChangeAltered,
+					Kind:      o.kind,
+					Name:      o.name,
+					Attribute: attr.name,
+					Old:       attr.value,
+					New:       n.attrs[i].value,
+				})
+			}
+		}
+	}
+	for _, n := range newObjects {
+		if !seen[n.key()] {
+			ret = append(ret, &Difference{Change: ChangeAdded, Kind: n.kind, Name: n.name})
+		}
+	}
+	return ret
+}
+
+// describedObject is an object of a catalog with its attributes rendered as
+// strings, which refer to other objects by name so that they can be compared
+// across compilers. Objects of the same kind always have the same attributes
+// in the same order.
+type describedObject struct {
+	kind  string
+	name  string
+	attrs []describedAttribute
+}
+
+type describedAttribute struct {
+	name  string
+	value string
+}
+
+func (o *describedObject) key() string {
+	return o.kind + " " + o.name
+}
+
+func (o *describedObject) attr(name string, value any) {
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	default:
+		s = fmt.Sprint(v)
+	}
+	o.attrs = append(o.attrs, describedAttribute{name: name, value: s})
+}
+
+// describeCatalog lists the objects of the compiler's catalog, each
+// followed by the objects that belong to it.
+func describeCatalog(c *Compiler) []*describedObject {
+
+	var ret []*describedObject
+	add := func(kind, name string) *describedObject {
+		// Room for the attributes of any kind of object
+		obj := &describedObject{kind: kind, name: name, attrs: make([]describedAttribute, 0, 16)}
+		ret = append(ret, obj)
+		return obj
+	}
+	for _, sch := range c.Catalog.Schemas.List() {
+		add("schema", sch.Name)
+	}
+	for _, typ := range c.TypeRegistry.Types() {
+		if typ.Schema != "" {
+			describeType(add("type", typ.Name), typ)
+		}
+	}
+	// Group the constraints by table once, rather than looking through them
+	// all for each table
+	constraints := make(map[*Table]Constraints)
+	for _, con := range c.Catalog.PgConstraint.ByName {
+		constraints[con.Table] = append(constraints[con.Table], con)
+	}
+	for _, sch := range c.Catalog.Schemas.List() {
+		for _, tab := range sch.Tables.List() {
+			describeTable(add("table", tab.FQName()), tab)
+			for _, col := range tab.Columns.List() {
+				describeColumn(add("column", col.FQName()), col)
+			}
+			cons := constraints[tab]
+			slices.SortFunc(cons, func(a, b *Constraint) int { return strings.Compare(a.Name, b.Name) })
+			for _, con := range cons {
+				describeConstraint(add("constraint", con.FQName()), con)
+			}
+		}
+		for _, idx := range sch.Indexes.List() {
+			describeIndex(add("index", idx.FQName()), idx)
+		}
+		for _, view := range sch.Views.List() {
+			describeView(add("view", view.FQName()), view)
+		}
+		for _, seq := range sch.Sequences.List() {
+			describeSequence(add("sequence", seq.FQName()), seq)
+		}
+	}
+	return ret
+}
+
+func describeType(obj *describedObject, typ *PostgresType) {
+
+	obj.attr("enum values", strings.Join(typ.EnumValues, ", "))
+	var domain Domain
+	if typ.IsDomain() {
+		domain = *typ.Domain
+	}
+	obj.attr("domain base type", typeName(domain.BaseType))
+	obj.attr("domain type modifiers", describeModifiers(domain.Modifiers))
+	obj.attr("domain not null", domain.NotNull)
+	obj.attr("domain default", domain.Default)
+	var checks []string
+	for _, check := range domain.Checks {
+		s := check.Name + " " + check.Expression
+		if check.NotValid {
+			s += " NOT VALID"
+		}
+		checks = append(checks, s)
+	}
+	obj.attr("domain checks", strings.Join(checks, ", "))
+	var attrs []string
+	if typ.IsComposite() {
+		for _, attr := range typ.Composite.Attributes {
+			attrs = append(attrs, strings.TrimSpace(attr.Name+" "+typeName(attr.Type)+" "+describeModifiers(attr.Modifiers)))
+		}
+	}
+	obj.attr("composite attributes", strings.Join(attrs, ", "))
+	var rng Range
+	if typ.IsRange() {
+		rng = *typ.Range
+	}
+	obj.attr("range subtype", typeName(rng.Subtype))
+	obj.attr("multirange of", typeName(typ.MultirangeOf))
+}
+
+func describeTable(obj *describedObject, tab *Table) {
+
+	obj.attr("columns", Columns(tab.Columns.List()).JoinColumnNames(", "))
+	var key []string
+	if tab.PartitionKey != nil {
+		for _, elem := range tab.PartitionKey.Keys {
+			if elem.Column != nil {
+				key = append(key, elem.Column.Name)
+			} else {
+				key = append(key, elem.Expression)
+			}
+		}
+		obj.attr("partition key", fmt.Sprintf("%s (%s)", tab.PartitionKey.Strategy, strings.Join(key, ", ")))
+	} else {
+		obj.attr("partition key", "")
+	}
+	obj.attr("partition of", tableName(tab.PartitionOf))
+	obj.attr("partition bound", describePartitionBound(tab.PartitionBound))
+	var inherits []string
+	for _, parent := range tab.Inherits {
+		inherits = append(inherits, parent.FQName())
+	}
+	obj.attr("inherits", strings.Join(inherits, ", "))
+}
+
+func describePartitionBound(b *PartitionBound) string {
+
+	switch {
+	case b == nil:
+		return ""
+	case b.IsDefault:
+		return "DEFAULT"
+	case b.In != nil:
+		return fmt.Sprintf("IN (%s)", strings.Join(b.In, ", "))
+	case b.From != nil:
+		return fmt.Sprintf("FROM (%s) TO (%s)", strings.Join(b.From, ", "), strings.Join(b.To, ", "))
+	}
+	return fmt.Sprintf("WITH (MODULUS %d, REMAINDER %d)", b.Modulus, b.Remainder)
+}
+
+func describeColumn(obj *describedObject, col *Column) {
+
+	attrs := col.Attrs
+	obj.attr("type", typeName(col.Type))
+	obj.attr("type modifiers", describeModifiers(attrs.Modifiers))
+	obj.attr("not null", attrs.NotNull)
+	obj.attr("primary key", attrs.Pkey)
+	obj.attr("sequence", attrs.SequenceName)
+	obj.attr("has default", attrs.HasExplicitDefault)
+	obj.attr("default", attrs.ColumnDefault)
+	obj.attr("identity", attrs.Identity)
+	obj.attr("identity sequence", sequenceName(attrs.IdentitySequence))
+	obj.attr("generated expression", attrs.GeneratedExpression)
+	obj.attr("inherited", attrs.Inherited)
+	obj.attr("merged local", attrs.MergedLocal)
+	obj.attr("domain", typeName(attrs.Domain))
+}
+
+func describeConstraint(obj *describedObject, con *Constraint) {
+
+	obj.attr("type", con.Type)
+	obj.attr("columns", con.Constrains.JoinColumnNames(", "))
+	obj.attr("references table", tableName(con.RefersTable))
+	obj.attr("references columns", con.Refers.JoinColumnNames(", "))
+	obj.attr("expression", con.Expression)
+	obj.attr("no inherit", con.NoInherit)
+	obj.attr("not valid", con.NotValid)
+	obj.attr("on delete", con.OnDelete)
+	obj.attr("on delete columns", con.OnDeleteColumns.JoinColumnNames(", "))
+	obj.attr("on update", con.OnUpdate)
+	obj.attr("match", con.Match)
+	obj.attr("deferrable", con.Deferrable)
+	obj.attr("initially deferred", con.InitiallyDeferred)
+	inheritedFrom := ""
+	if con.InheritedFrom != nil {
+		inheritedFrom = con.InheritedFrom.FQName()
+	}
+	obj.attr("inherited from", inheritedFrom)
+}
+
+func describeIndex(obj *describedObject, idx *Index) {
+
+	obj.attr("table", tableName(idx.Table))
+	obj.attr("view", viewName(idx.View))
+	obj.attr("method", string(idx.Method))
+	obj.attr("unique", idx.Unique)
+	obj.attr("primary", idx.Primary)
+	obj.attr("nulls not distinct", idx.NullsNotDistinct)
+	var keys []string
+	for _, key := range idx.Keys {
+		s := key.Expression
+		if key.Column != nil {
+			s = key.Column.Name
+		}
+		if key.ViewColumn != nil {
+			s = key.ViewColumn.Name
+		}
+		if key.Descending {
+			s += " DESC"
+		}
+		if key.NullsFirst {
+			s += " NULLS FIRST"
+		}
+		keys = append(keys, s)
+	}
+	obj.attr("keys", strings.Join(keys, ", "))
+	include := idx.Include.Names()
+	for _, col := range idx.ViewInclude {
+		include = append(include, col.Name)
+	}
+	obj.attr("include", strings.Join(include, ", "))
+	obj.attr("predicate", idx.Predicate)
+	constraint := ""
+	if idx.Constraint != nil {
+		constraint = idx.Constraint.FQName()
+	}
+	obj.attr("constraint", constraint)
+}
+
+func describeView(obj *describedObject, view *View) {
+
+	obj.attr("materialized", view.Materialized)
+	obj.attr("query", view.Query)
+	var cols []string
+	for _, col := range view.Columns {
+		cols = append(cols, strings.TrimSpace(col.Name+" "+typeName(col.Type)))
+	}
+	obj.attr("columns", strings.Join(cols, ", "))
+}
+
+func describeSequence(obj *describedObject, seq *Sequence) {
+
+	obj.attr("type", typeName(seq.Type))
+	obj.attr("start", seq.Start)
+	obj.attr("increment", seq.Increment)
+	obj.attr("min value", seq.MinValue)
+	obj.attr("max value", seq.MaxValue)
+	obj.attr("cache", seq.Cache)
+	obj.attr("cycle", seq.Cycle)
+	ownedBy := ""
+	if seq.OwnedBy != nil {
+		ownedBy = seq.OwnedBy.FQName()
+	}
+	obj.attr("owned by", ownedBy)
+}
+
+func describeModifiers(m TypeModifiers) string {
+
+	var parts []string
+	if m.Length != 0 {
+		parts = append(parts, fmt.Sprintf("length %d", m.Length))
+	}
+	if m.HasPrecision || m.Precision != 0 {
+		parts = append(parts, fmt.Sprintf("precision %d", m.Precision))
+	}
+	if m.Scale != 0 {
+		parts = append(parts, fmt.Sprintf("scale %d", m.Scale))
+	}
+	if m.IntervalFields != "" {
+		parts = append(parts, string(m.IntervalFields))
+	}
+	return strings.Join(parts, " ")
+}
+
+func typeName(typ *PostgresType) string {
+
+	if typ == nil {
+		return ""
+	}
+	return typ.Name
+}
+
+func tableName(tab *Table) string {
+
+	if tab == nil {
+		return ""
+	}
+	return tab.FQName()
+}
+
+func viewName(v *View) string {
+
+	if v == nil {
+		return ""
+	}
+	return v.FQName()
+}
+
+func sequenceName(seq *Sequence) string {
+
+	if seq == nil {
+		return ""
+	}
+	return seq.FQName()
+}
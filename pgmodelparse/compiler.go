@@ -11,14 +11,49 @@ import (
 )
 
 type Compiler struct {
-	SearchPath   string
+	// SearchPath lists the schemas searched for unqualified names, in order.
+	SearchPath   []string
 	Catalog      *Catalog
 	TypeRegistry *TypeRegistry
+	// inTransaction is set between BEGIN and COMMIT or ROLLBACK.
+	inTransaction bool
+	// transactionStart marks the point before the BEGIN that started the
+	// current transaction.
+	transactionStart undoMark
+	savepoints       []savepoint
+	// transactionAborted is set when a statement in the transaction fails,
+	// after which only rolling back is allowed. abortedBy is the failure, if
+	// it was recorded with ContinueOnError.
+	transactionAborted bool
+	abortedBy          *Diagnostic
+	// sessionSearchPath is the search path to restore at the end of
+	// the transaction, if SET LOCAL has changed it.
+	sessionSearchPath []string
+	localSearchPath   bool
+	// undo records the changes made by the current statement, and by the
+	// current transaction, so that they can be undone.
+	undo undoLog
+	// ContinueOnError makes ParseRaw, ParseFile and ParseStatements skip statements that fail
+	// and carry on with the rest, recording each failure in Diagnostics.
+	ContinueOnError bool
+	// Unsupported is the policy for statements the compiler can't apply.
+	Unsupported UnsupportedPolicy
+	// Diagnostics lists, in order, the failures skipped with ContinueOnError
+	// and the warnings given for unsupported statements.
+	Diagnostics Diagnostics
+	// Skipped lists every unsupported statement or subcommand that was
+	// skipped, whatever the policy.
+	Skipped Diagnostics
+	// skipped holds what was skipped while applying the current statement.
+	skipped []error
+	// failedObjects maps the objects failed statements would have defined to
+	// their failures, to find the failures that cascade from them.
+	failedObjects map[failedObject]*Diagnostic
 }
 
 func NewCompiler() *Compiler {
 	c := &Compiler{
-		SearchPath: "public",
+		SearchPath: []string{DefaultSchema},
 		Catalog: &Catalog{
 			Schemas: collections.NewOrderedMap[string, *Schema](),
 			PgConstraint: &PgConstraint{
@@ -30,122 +65,460 @@ func NewCompiler() *Compiler {
 		},
 		TypeRegistry: NewTypeRegistry(),
 	}
-	defaultSchema := &Schema{
-		Name:   "public",
-		Tables: collections.NewOrderedMap[string, *Table](),
-	}
+	defaultSchema := NewSchema(DefaultSchema)
 	c.Catalog.Schemas.Add(defaultSchema.Name, defaultSchema)
 	return c
 }
 
-func (c *Compiler) ParseRaw(sqlFile string) error {
+// ParseRaw applies the statements of some SQL to the catalog. Errors are
+// returned as a *Diagnostic giving the position in the SQL, or with
+// ContinueOnError, as the Diagnostics of every statement that failed.
+func (c *Compiler) ParseRaw(sql string) error {
+
+	return c.ParseFile("", sql)
+}
+
+// ParseFile is like ParseRaw, but names the file the SQL came from in errors.
+func (c *Compiler) ParseFile(fileName, sql string) error {
 
-	parse, err := pg_query.Parse(sqlFile)
+	parse, err := pg_query.Parse(sql)
 	if err != nil {
-		return err
+		diag := syntaxDiagnostic(fileName, sql, err)
+		if !c.ContinueOnError {
+			return diag
+		}
+		c.Diagnostics = append(c.Diagnostics, diag)
+		return Diagnostics{diag}
 	}
-	return c.ParseStatements(parse)
+	return c.parseStatements(parse.Stmts, func(stmt *pg_query.RawStmt, err error) *Diagnostic {
+		return statementDiagnostic(fileName, sql, stmt, err)
+	})
 }
 
+// ParseStatements applies statements that have already been parsed. Without
+// the SQL, errors are returned as a *Diagnostic giving only the offset of the
+// statement, or with ContinueOnError, as the Diagnostics of every statement
+// that failed.
 func (c *Compiler) ParseStatements(parse *pg_query.ParseResult) error {
 
-	for _, stmt := range parse.Stmts {
-		switch p := stmt.Stmt.Node.(type) {
-		case *pg_query.Node_CreateSchemaStmt:
-			{
-				err := c.CreateSchema(p.CreateSchemaStmt)
+	return c.parseStatements(parse.Stmts, func(stmt *pg_query.RawStmt, err error) *Diagnostic {
+		return &Diagnostic{Severity: SeverityError, Offset: int(stmt.StmtLocation), Err: err}
+	})
+}
+
+// parseStatements applies statements in order, using locate to turn errors,
+// and what was skipped, into diagnostics. Unless ContinueOnError is set, it
+// stops at the first statement that fails. A transaction begun by the
+// statements must end with them; if it doesn't, it is rolled back.
+func (c *Compiler) parseStatements(stmts []*pg_query.RawStmt, locate func(stmt *pg_query.RawStmt, err error) *Diagnostic) error {
+
+	// begun is the statement that began the current transaction, if it is one of these
+	var begun *pg_query.RawStmt
+	var failures Diagnostics
+	for _, stmt := range stmts {
+		wasInTransaction := c.inTransaction
+		err := c.ParseStatement(stmt)
+		if err == nil {
+			if !wasInTransaction && c.inTransaction {
+				begun = stmt
+			}
+			c.forgetFailures(stmt.Stmt)
+			c.reportSkipped(func(err error) *Diagnostic {
+				return locate(stmt, err)
+			})
+			continue
+		}
+		diag := locate(stmt, err)
+		if !c.ContinueOnError {
+			if begun != nil && c.inTransaction {
+				c.rollback()
+			}
+			return diag
+		}
+		c.recordFailure(stmt.Stmt, diag)
+		failures = append(failures, diag)
+	}
+	if begun != nil && c.inTransaction {
+		c.rollback()
+		diag := locate(begun, ErrTransactionNotCommitted)
+		if !c.ContinueOnError {
+			return diag
+		}
+		c.Diagnostics = append(c.Diagnostics, diag)
+		failures = append(failures, diag)
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+// ParseStatement applies a single statement to the catalog. The statement is
+// applied atomically: if it fails, the catalog and the objects in it are left
+// as they were before.
+func (c *Compiler) ParseStatement(stmt *pg_query.RawStmt) error {
+
+	// The statement may fail part way through, so mark where to undo back to
+	before := c.mark()
+	err := c.applyStatement(stmt)
+	if err != nil {
+		c.undoTo(before)
+		// Nothing was skipped, as nothing was applied
+		c.skipped = nil
+		if c.inTransaction {
+			c.transactionAborted = true
+		}
+		return err
+	}
+	if !c.inTransaction {
+		c.forgetChanges()
+	}
+	return nil
+}
+
+func (c *Compiler) applyStatement(stmt *pg_query.RawStmt) error {
+
+	if c.transactionAborted && !endsAbortedTransaction(stmt.Stmt) {
+		return ErrTransactionAborted
+	}
+	if c.inTransaction {
+		err := transactionBlockError(stmt.Stmt)
+		if err != nil {
+			return err
+		}
+	}
+	switch p := stmt.Stmt.Node.(type) {
+	case *pg_query.Node_CreateSchemaStmt:
+		{
+			err := c.CreateSchema(p.CreateSchemaStmt)
+			if err != nil {
+				return fmt.Errorf("while creating schema: %w", err)
+			}
+		}
+	case *pg_query.Node_CreateStmt:
+		{
+			err := c.CreateTable(p.CreateStmt)
+			if err != nil {
+				return fmt.Errorf("while creating table: %w", err)
+			}
+		}
+	case *pg_query.Node_AlterTableStmt:
+		{
+			if p.AlterTableStmt.Objtype == pg_query.ObjectType_OBJECT_SEQUENCE {
+				err := c.AlterSequenceCmds(p.AlterTableStmt)
 				if err != nil {
-					return fmt.Errorf("while creating schema: %w", err)
+					return fmt.Errorf("while altering sequence: %w", err)
 				}
+				return nil
 			}
-		case *pg_query.Node_CreateStmt:
-			{
-				err := c.CreateTable(p.CreateStmt)
+			if p.AlterTableStmt.Objtype == pg_query.ObjectType_OBJECT_TYPE {
+				err := c.AlterCompositeType(p.AlterTableStmt)
 				if err != nil {
-					return fmt.Errorf("while creating table: %w", err)
+					return fmt.Errorf("while altering type: %w", err)
 				}
+				return nil
 			}
-		case *pg_query.Node_AlterTableStmt:
-			{
-				err := c.AlterTable(p.AlterTableStmt)
+			if p.AlterTableStmt.Objtype == pg_query.ObjectType_OBJECT_INDEX {
+				err := c.AlterIndex(p.AlterTableStmt)
 				if err != nil {
-					return fmt.Errorf("while altering table: %w", err)
+					return fmt.Errorf("while altering index: %w", err)
 				}
+				return nil
 			}
-		case *pg_query.Node_DropStmt:
-			{
-				dropBehaviour := DropBehaviourRestrict
-				if p.DropStmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
-					dropBehaviour = DropBehaviourCascade
-				}
-				switch p.DropStmt.RemoveType {
-				case pg_query.ObjectType_OBJECT_TABLE:
-					{
-						for _, tgt := range p.DropStmt.Objects {
-							l := tgt.Node.(*pg_query.Node_List)
-							schema, table := ObjectNameFromList(l.List)
-							err := c.DropTable(schema, table, dropBehaviour)
-							if err != nil {
-								return err
-							}
+			err := c.AlterTable(p.AlterTableStmt)
+			if err != nil {
+				return fmt.Errorf("while altering table: %w", err)
+			}
+		}
+	case *pg_query.Node_IndexStmt:
+		{
+			err := c.CreateIndex(p.IndexStmt)
+			if err != nil {
+				return fmt.Errorf("while creating index: %w", err)
+			}
+		}
+	case *pg_query.Node_ViewStmt:
+		{
+			err := c.CreateView(p.ViewStmt)
+			if err != nil {
+				return fmt.Errorf("while creating view: %w", err)
+			}
+		}
+	case *pg_query.Node_CreateTableAsStmt:
+		{
+			err := c.CreateTableAs(p.CreateTableAsStmt)
+			if err != nil {
+				return fmt.Errorf("while creating %s: %w", objectTypeName(p.CreateTableAsStmt.Objtype), err)
+			}
+		}
+	case *pg_query.Node_CreateSeqStmt:
+		{
+			err := c.CreateSequence(p.CreateSeqStmt)
+			if err != nil {
+				return fmt.Errorf("while creating sequence: %w", err)
+			}
+		}
+	case *pg_query.Node_AlterSeqStmt:
+		{
+			err := c.AlterSequence(p.AlterSeqStmt)
+			if err != nil {
+				return fmt.Errorf("while altering sequence: %w", err)
+			}
+		}
+	case *pg_query.Node_ReindexStmt:
+		{
+			err := c.Reindex(p.ReindexStmt)
+			if err != nil {
+				return fmt.Errorf("while reindexing: %w", err)
+			}
+		}
+	case *pg_query.Node_DropStmt:
+		{
+			dropBehaviour := DropBehaviourRestrict
+			if p.DropStmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+				dropBehaviour = DropBehaviourCascade
+			}
+			switch p.DropStmt.RemoveType {
+			case pg_query.ObjectType_OBJECT_TABLE:
+				{
+					for _, tgt := range p.DropStmt.Objects {
+						l, ok := tgt.Node.(*pg_query.Node_List)
+						if !ok {
+							return &UnexpectedNodeError{Expected: "List", Node: tgt}
+						}
+						schema, table := ObjectNameFromList(l.List)
+						err := c.DropTable(schema, table, dropBehaviour)
+						if err != nil {
+							return err
 						}
 					}
 				}
-			}
-		case *pg_query.Node_RenameStmt:
-			{
-				tab, err := c.FindTableFromRangeVar(p.RenameStmt.Relation)
-				if err != nil {
-					return err
+			case pg_query.ObjectType_OBJECT_INDEX:
+				{
+					err := c.DropIndexes(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping index: %w", err)
+					}
 				}
-				err = c.RenameTable(tab, p.RenameStmt.Newname)
-				if err != nil {
-					return err
+			case pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_MATVIEW:
+				{
+					err := c.DropViews(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping view: %w", err)
+					}
 				}
-			}
-		case *pg_query.Node_CreateEnumStmt:
-			{
-				err := c.CreateEnum(p.CreateEnumStmt)
-				if err != nil {
-					return err
+			case pg_query.ObjectType_OBJECT_SEQUENCE:
+				{
+					err := c.DropSequences(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping sequence: %w", err)
+					}
+				}
+			case pg_query.ObjectType_OBJECT_SCHEMA:
+				{
+					err := c.DropSchemas(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping schema: %w", err)
+					}
 				}
+			case pg_query.ObjectType_OBJECT_TYPE:
+				{
+					err := c.DropTypes(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping type: %w", err)
+					}
+				}
+			case pg_query.ObjectType_OBJECT_DOMAIN:
+				{
+					err := c.DropDomains(p.DropStmt)
+					if err != nil {
+						return fmt.Errorf("while dropping domain: %w", err)
+					}
+				}
+			default:
+				return c.unsupported("DROP " + strings.ToUpper(objectTypeName(p.DropStmt.RemoveType)))
+			}
+		}
+	case *pg_query.Node_VariableSetStmt:
+		{
+			err := c.SetVariable(p.VariableSetStmt)
+			if err != nil {
+				return fmt.Errorf("while setting %s: %w", p.VariableSetStmt.Name, err)
+			}
+		}
+	case *pg_query.Node_SelectStmt:
+		{
+			err := c.Select(p.SelectStmt)
+			if err != nil {
+				return fmt.Errorf("while setting configuration: %w", err)
+			}
+		}
+	case *pg_query.Node_TransactionStmt:
+		{
+			err := c.Transaction(p.TransactionStmt)
+			if err != nil {
+				return err
+			}
+		}
+	case *pg_query.Node_AlterObjectSchemaStmt:
+		{
+			err := c.AlterObjectSchema(p.AlterObjectSchemaStmt)
+			if err != nil {
+				return fmt.Errorf("while altering %s: %w", objectTypeName(p.AlterObjectSchemaStmt.ObjectType), err)
 			}
-		default:
-			//fmt.Printf("unknown how to process type %T\n", p)
+		}
+	case *pg_query.Node_RenameStmt:
+		{
+			err := c.Rename(p.RenameStmt)
+			if err != nil {
+				return fmt.Errorf("while renaming %s: %w", objectTypeName(p.RenameStmt.RenameType), err)
+			}
+		}
+	case *pg_query.Node_CreateEnumStmt:
+		{
+			err := c.CreateEnum(p.CreateEnumStmt)
+			if err != nil {
+				return err
+			}
+		}
+	case *pg_query.Node_AlterEnumStmt:
+		{
+			err := c.AlterEnum(p.AlterEnumStmt)
+			if err != nil {
+				return fmt.Errorf("while altering type: %w", err)
+			}
+		}
+	case *pg_query.Node_CompositeTypeStmt:
+		{
+			err := c.CreateCompositeType(p.CompositeTypeStmt)
+			if err != nil {
+				return fmt.Errorf("while creating type: %w", err)
+			}
+		}
+	case *pg_query.Node_CreateRangeStmt:
+		{
+			err := c.CreateRange(p.CreateRangeStmt)
+			if err != nil {
+				return fmt.Errorf("while creating type: %w", err)
+			}
+		}
+	case *pg_query.Node_CreateDomainStmt:
+		{
+			err := c.CreateDomain(p.CreateDomainStmt)
+			if err != nil {
+				return fmt.Errorf("while creating domain: %w", err)
+			}
+		}
+	case *pg_query.Node_AlterDomainStmt:
+		{
+			err := c.AlterDomain(p.AlterDomainStmt)
+			if err != nil {
+				return fmt.Errorf("while altering domain: %w", err)
+			}
+		}
+	default:
+		if !isIgnoredStatement(stmt.Stmt) {
+			return c.unsupported(statementKind(stmt.Stmt) + " statement")
 		}
 	}
-
 	return nil
 }
 
 func (c *Compiler) CreateSchema(stmt *pg_query.CreateSchemaStmt) error {
 	_, exists := c.Catalog.Schemas.Get(stmt.Schemaname)
 	if exists && !stmt.IfNotExists {
-		return fmt.Errorf("schema already exists")
+		return duplicateObjectError("schema", stmt.Schemaname, "schema already exists")
 	} else if exists && stmt.IfNotExists {
 		return nil
 	}
-	sch := &Schema{
-		Name:   stmt.Schemaname,
-		Tables: collections.NewOrderedMap[string, *Table](),
-	}
+	sch := NewSchema(stmt.Schemaname)
+	c.changing(c.Catalog)
 	c.Catalog.Schemas.Add(sch.Name, sch)
 	return nil
 }
 
 func (c *Compiler) CreateTable(stmt *pg_query.CreateStmt) error {
 	name := stmt.Relation.Relname
-	schemaName := c.SchemaOrSearchPath(stmt.Relation.Schemaname)
+	schemaName, err := c.CreationSchema(stmt.Relation.Schemaname)
+	if err != nil {
+		return err
+	}
 	table := NewTable(name, schemaName)
-	err := c.Catalog.AddTable(table)
+	var parent *Table
+	if stmt.Partbound != nil {
+		parent, err = c.FindTableFromRangeVar(stmt.InhRelations[0].GetRangeVar())
+		if err != nil {
+			return err
+		}
+		table.PartitionBound, err = c.PartitionBoundFromSpec(parent, table.Name, stmt.Partbound)
+		if err != nil {
+			return err
+		}
+		table.PartitionOf = parent
+		for _, col := range parent.Columns.List() {
+			inheritColumn(table, col)
+		}
+		c.matchGeneratedFrom(table)
+	}
+	var defaultConflicts map[string]bool
+	if parent == nil && len(stmt.InhRelations) > 0 {
+		if stmt.Partspec != nil {
+			return fmt.Errorf("cannot create partitioned table as inheritance child")
+		}
+		defaultConflicts, err = c.InheritParents(table, stmt.InhRelations)
+		if err != nil {
+			return err
+		}
+	}
+	c.changingSchema(table.Schema)
+	err = c.Catalog.AddTable(table)
 	if err != nil {
 		return err
 	}
+	// As in Postgres, all columns are added before any constraints are
+	// defined, so that constraints can refer to columns defined after them
+	var likes []*pg_query.TableLikeClause
 	for _, n := range stmt.TableElts {
 		switch p := n.Node.(type) {
 		case *pg_query.Node_ColumnDef:
 			{
-				err = c.DefineColumn(table, p.ColumnDef)
+				if parent != nil {
+					err = c.overrideInheritedColumn(table, p.ColumnDef)
+				} else if _, ok := table.Columns.Get(p.ColumnDef.Colname); ok && len(table.Inherits) > 0 {
+					err = c.MergeInheritedColumn(table, p.ColumnDef, defaultConflicts)
+				} else {
+					err = c.AddColumnDef(table, p.ColumnDef)
+				}
+				if err != nil {
+					return fmt.Errorf("defining column on table %s.%s: %w", table.Schema, table.Name, err)
+				}
+			}
+		case *pg_query.Node_TableLikeClause:
+			{
+				err = c.AddLikeColumns(table, p.TableLikeClause)
+				if err != nil {
+					return fmt.Errorf("copying columns to table %s.%s: %w", table.Schema, table.Name, err)
+				}
+				likes = append(likes, p.TableLikeClause)
+			}
+		}
+	}
+	for _, col := range table.Columns.List() {
+		if defaultConflicts[col.Name] {
+			return fmt.Errorf("column %s inherits conflicting default values", col.Name)
+		}
+	}
+	if stmt.Partspec != nil {
+		table.PartitionKey, err = c.PartitionKeyFromSpec(table, stmt.Partspec)
+		if err != nil {
+			return fmt.Errorf("defining partition key on table %s.%s: %w", table.Schema, table.Name, err)
+		}
+	}
+	for _, n := range stmt.TableElts {
+		switch p := n.Node.(type) {
+		case *pg_query.Node_ColumnDef:
+			{
+				err = c.DefineConstraints(table, p.ColumnDef.Colname, p.ColumnDef.Constraints)
 				if err != nil {
 					return fmt.Errorf("defining column on table %s.%s: %w", table.Schema, table.Name, err)
 				}
@@ -159,6 +532,21 @@ func (c *Compiler) CreateTable(stmt *pg_query.CreateStmt) error {
 			}
 		}
 	}
+	for _, like := range likes {
+		err = c.AddLikeConstraints(table, like)
+		if err != nil {
+			return fmt.Errorf("copying constraints to table %s.%s: %w", table.Schema, table.Name, err)
+		}
+	}
+	if parent != nil {
+		return c.inheritConstraints(table, parent, false)
+	}
+	for _, p := range table.Inherits {
+		err = c.inheritConstraints(table, p, false)
+		if err != nil {
+			return fmt.Errorf("inheriting constraints of table %s.%s: %w", p.Schema, p.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -178,20 +566,77 @@ func (c *Compiler) DropTable(schema, table string, behav DropBehaviour) error {
 			if con.Type == ConstraintTypeForeignKey &&
 				slices.Contains(con.Refers, col) &&
 				behav != DropBehaviourCascade {
-				return fmt.Errorf("can't drop table %s because constraint %s refers to it and cascade was not specified",
+				return dependencyError(tab.Name, con.Name, "can't drop table %s because constraint %s refers to it and cascade was not specified",
 					tab.Name, con.Name)
 			}
 			consToRemove = append(consToRemove, con)
 		}
 	}
+	err = c.dropDependentViews("table "+tab.Name, c.Catalog.DependentViews(tab), behav)
+	if err != nil {
+		return err
+	}
+	// Partitions are always dropped along with their parent,
+	// but tables that inherit from it only with CASCADE
+	for _, child := range c.Catalog.Children(tab) {
+		if child.PartitionOf != tab && behav != DropBehaviourCascade {
+			return dependencyError(tab.Name, child.Name, "can't drop table %s because table %s inherits from it and cascade was not specified",
+				tab.Name, child.Name)
+		}
+	}
+	for _, child := range c.Catalog.Children(tab) {
+		err = c.DropTable(child.Schema, child.Name, behav)
+		if err != nil {
+			return err
+		}
+	}
 	for _, con := range consToRemove {
-		c.Catalog.PgConstraint.RemoveConstraint(con)
+		c.removeConstraint(con)
+	}
+	// Constraints that don't involve any columns, such as CHECK (true)
+	for _, con := range c.Catalog.TableConstraints(tab) {
+		c.removeConstraint(con)
+	}
+	for _, idx := range c.Catalog.TableIndexes(tab) {
+		c.removeIndex(idx)
+	}
+	for _, col := range tab.Columns.List() {
+		err = c.dropOwnedSequences(col, tab.Columns.List(), behav)
+		if err != nil {
+			return err
+		}
 	}
 	sch, _ := c.Catalog.Schemas.Get(tab.Schema) // Must be ok
+	c.changing(sch)
 	sch.Tables.Remove(tab.Name)
 	return nil
 }
 
+// removeConstraint removes a constraint along with the index
+// that backs it, if any, and the copies inherited by partitions.
+func (c *Compiler) removeConstraint(cons *Constraint) {
+
+	c.changingConstraint(cons)
+	c.Catalog.PgConstraint.RemoveConstraint(cons)
+	for _, idx := range c.Catalog.TableIndexes(cons.Table) {
+		if idx.Constraint == cons {
+			c.removeIndex(idx)
+		}
+	}
+	for _, other := range c.Catalog.PgConstraint.ByName {
+		if other.InheritedFrom == cons {
+			c.removeConstraint(other)
+		}
+	}
+}
+
+// addConstraint adds a constraint to PgConstraint.
+func (c *Compiler) addConstraint(cons *Constraint) {
+
+	c.changingConstraint(cons)
+	c.Catalog.PgConstraint.AddConstraint(cons)
+}
+
 func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 
 	tab, err := c.FindTableFromRangeVar(stmt.Relation)
@@ -202,14 +647,17 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 	for _, cmd := range stmt.Cmds {
 		atc, ok := cmd.Node.(*pg_query.Node_AlterTableCmd)
 		if !ok {
-			return fmt.Errorf("expected AlterTableCmd but got %T", cmd.Node)
+			return &UnexpectedNodeError{Expected: "AlterTableCmd", Node: cmd}
 		}
 		switch atc.AlterTableCmd.Subtype {
 		case pg_query.AlterTableType_AT_AddColumn:
 			{
 				col, ok := atc.AlterTableCmd.Def.Node.(*pg_query.Node_ColumnDef)
 				if !ok {
-					return fmt.Errorf("expected ColumnDef but got %T", atc.AlterTableCmd.Def.Node)
+					return &UnexpectedNodeError{Expected: "ColumnDef", Node: atc.AlterTableCmd.Def}
+				}
+				if tab.PartitionOf != nil {
+					return fmt.Errorf("cannot add column to a partition")
 				}
 				err = c.DefineColumn(tab, col.ColumnDef)
 				if err != nil {
@@ -225,7 +673,11 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 			}
 		case pg_query.AlterTableType_AT_AlterColumnType:
 			{
-				err = c.AlterColumnType(tab, atc.AlterTableCmd.Name, atc.AlterTableCmd.Def.Node.(*pg_query.Node_ColumnDef).ColumnDef)
+				def, ok := atc.AlterTableCmd.Def.Node.(*pg_query.Node_ColumnDef)
+				if !ok {
+					return &UnexpectedNodeError{Expected: "ColumnDef", Node: atc.AlterTableCmd.Def}
+				}
+				err = c.AlterColumnType(tab, atc.AlterTableCmd.Name, def.ColumnDef)
 				if err != nil {
 					return err
 				}
@@ -234,7 +686,7 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 			{
 				conDef, ok := atc.AlterTableCmd.Def.Node.(*pg_query.Node_Constraint)
 				if !ok {
-					return fmt.Errorf("expected Constraint but got %T", atc.AlterTableCmd.Def.Node)
+					return &UnexpectedNodeError{Expected: "Constraint", Node: atc.AlterTableCmd.Def}
 				}
 				err = c.DefineConstraint(tab, "", conDef.Constraint)
 				if err != nil {
@@ -248,6 +700,11 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 					if err != nil {
 						return err
 					}
+					continue
+				}
+				err = c.AlterColumnSetDefault(tab, atc.AlterTableCmd.Name, atc.AlterTableCmd.Def)
+				if err != nil {
+					return err
 				}
 			}
 		case pg_query.AlterTableType_AT_DropConstraint:
@@ -255,9 +712,65 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 				fqname := ConstraintFQName(tab, atc.AlterTableCmd.Name)
 				cons, ok := c.Catalog.PgConstraint.ByName[fqname]
 				if !ok {
-					return fmt.Errorf("while dropping constraint: constraint %s not found", fqname)
+					return notFoundInTableError("constraint", tab, atc.AlterTableCmd.Name, "while dropping constraint: constraint %s not found", fqname)
+				}
+				if cons.InheritedFrom != nil {
+					return fmt.Errorf("cannot drop inherited constraint %s of relation %s", cons.Name, tab.Name)
+				}
+				c.removeConstraint(cons)
+			}
+		case pg_query.AlterTableType_AT_AlterConstraint:
+			{
+				conDef, ok := atc.AlterTableCmd.Def.Node.(*pg_query.Node_Constraint)
+				if !ok {
+					return &UnexpectedNodeError{Expected: "Constraint", Node: atc.AlterTableCmd.Def}
+				}
+				err = c.AlterConstraint(tab, conDef.Constraint)
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_ValidateConstraint:
+			{
+				fqname := ConstraintFQName(tab, atc.AlterTableCmd.Name)
+				cons, ok := c.Catalog.PgConstraint.ByName[fqname]
+				if !ok {
+					return notFoundInTableError("constraint", tab, atc.AlterTableCmd.Name, "while validating constraint: constraint %s not found", fqname)
+				}
+				c.changing(cons)
+				cons.NotValid = false
+			}
+		case pg_query.AlterTableType_AT_AddIdentity:
+			{
+				conDef, ok := atc.AlterTableCmd.Def.Node.(*pg_query.Node_Constraint)
+				if !ok {
+					return &UnexpectedNodeError{Expected: "Constraint", Node: atc.AlterTableCmd.Def}
+				}
+				err = c.AddIdentity(tab, atc.AlterTableCmd.Name, conDef.Constraint)
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_SetIdentity:
+			{
+				err = c.SetIdentity(tab, atc.AlterTableCmd.Name, atc.AlterTableCmd.Def.GetList().GetItems())
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_DropIdentity:
+			{
+				err = c.DropIdentity(tab, atc.AlterTableCmd.Name, atc.AlterTableCmd.MissingOk)
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_DropExpression:
+			{
+				err = c.DropExpression(tab, atc.AlterTableCmd.Name, atc.AlterTableCmd.MissingOk)
+				if err != nil {
+					return err
 				}
-				c.Catalog.PgConstraint.RemoveConstraint(cons)
 			}
 		case pg_query.AlterTableType_AT_DropNotNull:
 			{
@@ -268,9 +781,13 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 				if col.Attrs.Pkey {
 					return fmt.Errorf("can't drop not null constraint from primary key column %s.%s", tab.Name, col.Name)
 				}
+				if col.Attrs.Identity != IdentityNone {
+					return fmt.Errorf("column %s of relation %s is an identity column", col.Name, tab.Name)
+				}
 				if !col.Attrs.NotNull {
 					return fmt.Errorf("can't drop not null constraint from nullable column %s.%s", tab.Name, col.Name)
 				}
+				c.changing(col.Attrs)
 				col.Attrs.NotNull = false
 			}
 		case pg_query.AlterTableType_AT_SetNotNull:
@@ -279,30 +796,77 @@ func (c *Compiler) AlterTable(stmt *pg_query.AlterTableStmt) error {
 				if err != nil {
 					return err
 				}
+				c.changing(col.Attrs)
 				col.Attrs.NotNull = true
 			}
+		case pg_query.AlterTableType_AT_AttachPartition:
+			{
+				err = c.AttachPartition(tab, atc.AlterTableCmd.Def.GetPartitionCmd())
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_DetachPartition:
+			{
+				err = c.DetachPartition(tab, atc.AlterTableCmd.Def.GetPartitionCmd())
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			if !slices.Contains(ignoredAlterTableTypes, atc.AlterTableCmd.Subtype) {
+				err = c.unsupported("ALTER TABLE subcommand " + strings.TrimPrefix(atc.AlterTableCmd.Subtype.String(), "AT_"))
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
-	return nil
+	// Columns and constraints added to a partitioned table apply to its partitions too
+	return c.syncChildren(tab)
 }
 
 func (c *Compiler) DefineColumn(t *Table, def *pg_query.ColumnDef) error {
+	err := c.AddColumnDef(t, def)
+	if err != nil {
+		return err
+	}
+	return c.DefineConstraints(t, def.Colname, def.Constraints)
+}
+
+// AddColumnDef adds the column to the table without applying its constraints.
+func (c *Compiler) AddColumnDef(t *Table, def *pg_query.ColumnDef) error {
 	name := def.Colname
-	pgType := c.TypeFromNode(def.TypeName)
-	seqName := c.DetermineAutomaticSequenceName(t.Name, name, pgType)
-	err := t.AddColumn(&Column{
+	pgType, err := c.FindTypeFromNode(def.TypeName)
+	if err != nil {
+		return err
+	}
+	if pgType.IsArray() && pgType.ElementType.IsSerial {
+		return fmt.Errorf("array of serial is not implemented")
+	}
+	mods, err := TypeModifiersFromNode(def.TypeName, pgType)
+	if err != nil {
+		return err
+	}
+	col := &Column{
 		Table: t,
 		Name:  name,
 		Type:  pgType,
-		Attrs: &ColumnAttributes{HasSequence: pgType.IsSerial, SequenceName: seqName},
-	})
-	if err != nil {
-		return err
+		Attrs: &ColumnAttributes{Modifiers: mods, Domain: domainOf(pgType)},
 	}
-	err = c.DefineConstraints(t, name, def.Constraints)
+	c.changing(t)
+	err = t.AddColumn(col)
 	if err != nil {
 		return err
 	}
+	if pgType.IsSerial {
+		seq, err := c.CreateOwnedSequence(col, pgType.NonSerialType, nil)
+		if err != nil {
+			return err
+		}
+		col.Attrs.HasSequence = true
+		col.Attrs.SequenceName = seq.Name
+	}
 	return nil
 }
 
@@ -310,86 +874,271 @@ func (c *Compiler) RenameTable(t *Table, newName string) error {
 
 	sch, ok := c.Catalog.Schemas.Get(t.Schema)
 	if !ok {
-		return fmt.Errorf("did not find schema %s", t.Schema)
+		return notFoundError("schema", t.Schema, "did not find schema %s", t.Schema)
+	}
+	if sch.HasRelation(newName) {
+		return duplicateObjectError("relation", newName, "relation %s already exists in schema %s", newName, t.Schema)
+	}
+	for _, v := range c.Catalog.DependentViews(t) {
+		err := c.rewriteViewQuery(v, &queryAnalyzer{c: c, renamingTable: t}, newName)
+		if err != nil {
+			return err
+		}
+	}
+	c.changing(sch, t)
+	sch.Tables.Rekey(t.Name, newName)
+	t.Name = newName
+	c.refreshConstraintNames()
+	return nil
+}
+
+// DetermineAutomaticSequenceName picks a name for the sequence backing a serial or
+// identity column, avoiding the names of existing relations in the table's schema.
+func (c *Compiler) DetermineAutomaticSequenceName(t *Table, colName string) string {
+
+	sch, ok := c.Catalog.Schemas.Get(t.Schema)
+	if !ok {
+		return MakeObjectName(t.Name, colName, "seq")
+	}
+	return ChooseRelationName(sch, t.Name, colName, "seq")
+}
+
+func (c *Compiler) AlterColumnDropDefault(t *Table, colName string) error {
+
+	v, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s not found on table %s", colName, t.FQName())
+	}
+	if v.Attrs.Identity != IdentityNone {
+		return fmt.Errorf("column %s of relation %s is an identity column", colName, t.Name)
+	}
+	if !(v.Attrs.HasSequence || v.Attrs.HasExplicitDefault) {
+		return fmt.Errorf("column %s on table %s does not have a default to drop", colName, t.FQName())
+	}
+	c.clearColumnDefault(v)
+	return nil
+}
+
+func (c *Compiler) AlterColumnSetDefault(t *Table, colName string, expr *pg_query.Node) error {
+
+	col, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s not found on table %s", colName, t.FQName())
+	}
+	if col.Attrs.Identity != IdentityNone {
+		return fmt.Errorf("column %s of relation %s is an identity column", col.Name, t.Name)
+	}
+	if col.Attrs.GeneratedExpression != "" {
+		return fmt.Errorf("column %s of relation %s is a generated column", col.Name, t.Name)
+	}
+	return c.SetColumnDefault(col, expr)
+}
+
+// SetColumnDefault validates a default expression and records it on the column,
+// replacing any existing default. A nextval() default also records the sequence.
+func (c *Compiler) SetColumnDefault(col *Column, expr *pg_query.Node) error {
+
+	var err error
+	WalkNodes(expr, func(n *pg_query.Node) bool {
+		switch n.Node.(type) {
+		case *pg_query.Node_ColumnRef:
+			err = fmt.Errorf("cannot use column reference in DEFAULT expression")
+		case *pg_query.Node_SubLink:
+			err = fmt.Errorf("cannot use subquery in DEFAULT expression")
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	a := &queryAnalyzer{c: c}
+	colType := col.Type
+	if colType.IsSerial {
+		colType = colType.NonSerialType
+	}
+	if isUntypedLiteral(expr) {
+		if lit := expr.GetAConst().GetSval(); lit != nil {
+			err = checkLiteral(lit.Sval, colType)
+			if err != nil {
+				return err
+			}
+		}
+	} else if typ := a.inferType(expr, &queryScope{}); typ != nil && !CanAssign(typ, colType) {
+		return fmt.Errorf("column %s is of type %s but default expression is of type %s", col.Name, colType.Name, typ.Name)
+	}
+	str, err := c.ExprToString(expr)
+	if err != nil {
+		return err
+	}
+
+	var seq *Sequence
+	if seqName, ok := NextvalSequenceName(expr); ok {
+		schema, name := ObjectNameFromStrings(strings.Split(seqName, "."))
+		seq, err = c.FindSequence(schema, name)
+		if err != nil {
+			return err
+		}
+	}
+	// Replacing a serial's default leaves an ordinary column with an owned sequence
+	c.clearColumnDefault(col)
+	if aConst := expr.GetAConst(); aConst != nil && aConst.Isnull {
+		// Postgres doesn't store a default of NULL
+		return nil
 	}
-	if _, ok = sch.Tables.Get(newName); ok {
-		return fmt.Errorf("schema %s already has table %s", t.Schema, newName)
+	col.Attrs.HasExplicitDefault = true
+	col.Attrs.ColumnDefault = str
+	if seq != nil {
+		col.Attrs.HasSequence = true
+		col.Attrs.SequenceName = SequenceReference(col.Table, seq)
 	}
-	sch.Tables.Remove(t.Name)
-	t.Name = newName
-	sch.Tables.Add(newName, t)
 	return nil
 }
 
-func (c *Compiler) DetermineAutomaticSequenceName(tabName, colName string, typ *PostgresType) string {
+// isUntypedLiteral reports whether the expression is a string constant,
+// which Postgres will try to convert to whatever type is required.
+func isUntypedLiteral(n *pg_query.Node) bool {
 
-	if !typ.IsSerial {
-		return ""
+	aConst := n.GetAConst()
+	if aConst == nil {
+		return false
 	}
-	return strings.Join([]string{tabName, colName, "seq"}, "_")
+	_, ok := aConst.Val.(*pg_query.A_Const_Sval)
+	return ok || aConst.Isnull
 }
 
-func (c *Compiler) AlterColumnDropDefault(t *Table, colName string) error {
+func (c *Compiler) DropColumn(t *Table, colName string, behavior pg_query.DropBehavior) error {
 
-	v, ok := t.Columns.Get(colName)
-	if !ok {
-		return fmt.Errorf("column %s not found on table %s", colName, t.FQName())
-	}
-	if !(v.Attrs.HasSequence || v.Attrs.HasExplicitDefault) {
-		return fmt.Errorf("column %s on table %s does not have a default to drop", colName, t.FQName())
-	}
-	if v.Attrs.HasSequence {
-		v.Attrs.HasSequence = false
-		v.Attrs.SequenceName = ""
-		if v.Type.IsSerial {
-			v.Type = v.Type.NonSerialType
-		}
-		return nil
+	if col, ok := t.Columns.Get(colName); ok && col.Attrs.Inherited {
+		return fmt.Errorf("cannot drop inherited column %s", colName)
 	}
-	if v.Attrs.HasExplicitDefault {
-		v.Attrs.HasExplicitDefault = false
-		v.Attrs.ColumnDefault = ""
-	}
-	return nil
+	return c.dropColumn(t, colName, behavior)
 }
 
-func (c *Compiler) DropColumn(t *Table, colName string, behavior pg_query.DropBehavior) error {
+// dropColumn drops the column from the table and any partitions.
+func (c *Compiler) dropColumn(t *Table, colName string, behavior pg_query.DropBehavior) error {
 
 	col, ok := t.Columns.Get(colName)
 	if !ok {
-		return fmt.Errorf("column %s does not exist", colName)
+		return notFoundInTableError("column", t, colName, "column %s does not exist", colName)
+	}
+	if isPartitionKeyColumn(col) {
+		return dependencyError(col.Name, t.Name, "cannot drop column %s because it is part of the partition key of relation %s", col.Name, t.Name)
 	}
 	depends, _ := c.Catalog.PgConstraint.ByColumn.Get(col)
 	var funcs []func()
 	for _, con := range depends {
 		if con.DropBehaviour == DropBehaviourRestrict {
 			if behavior != pg_query.DropBehavior_DROP_CASCADE && !con.Constrains.IsExactlyColumn(col) {
-				return fmt.Errorf("can't drop %s because %s depends on it", col.Name, con.Name)
+				return dependencyError(col.Name, con.Name, "can't drop %s because %s depends on it", col.Name, con.Name)
 			}
 		}
 		funcs = append(funcs, func() {
-			c.Catalog.PgConstraint.RemoveConstraint(con)
+			c.removeConstraint(con)
 		})
 	}
+	generated := generatedDependents(col)
+	if len(generated) > 0 && behavior != pg_query.DropBehavior_DROP_CASCADE {
+		return dependencyError(col.Name, generated[0].Name, "can't drop %s because column %s depends on it", col.Name, generated[0].Name)
+	}
+	viewBehaviour := DropBehaviourRestrict
+	if behavior == pg_query.DropBehavior_DROP_CASCADE {
+		viewBehaviour = DropBehaviourCascade
+	}
+	err := c.dropDependentViews("column "+col.Name, c.Catalog.ColumnDependentViews(col), viewBehaviour)
+	if err != nil {
+		return err
+	}
 
 	for _, fn := range funcs {
 		fn()
 	}
+	err = c.dropOwnedSequences(col, Columns{col}, viewBehaviour)
+	if err != nil {
+		return err
+	}
+	// Indexes that use the column are dropped along with it
+	for _, idx := range c.Catalog.TableIndexes(t) {
+		if slices.Contains(idx.Depends(), col) {
+			c.removeIndex(idx)
+		}
+	}
+	c.changingColumnConstraints(col)
 	c.Catalog.PgConstraint.ByColumn.Remove(col)
+	c.changing(t)
 	t.Columns.Remove(col.Name)
+	for _, gen := range generated {
+		err = c.dropColumn(t, gen.Name, behavior)
+		if err != nil {
+			return err
+		}
+	}
+	for _, child := range c.Catalog.Children(t) {
+		childCol, _ := child.Columns.Get(colName) // Must be ok
+		if slices.ContainsFunc(tableParents(child), func(p *Table) bool {
+			_, ok := p.Columns.Get(colName)
+			return ok
+		}) {
+			// Still inherited from another parent
+			continue
+		}
+		if childCol.Attrs.MergedLocal {
+			c.changing(childCol.Attrs)
+			childCol.Attrs.Inherited = false
+			childCol.Attrs.MergedLocal = false
+			continue
+		}
+		err = c.dropColumn(child, colName, behavior)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (c *Compiler) AlterColumnType(t *Table, colName string, def *pg_query.ColumnDef) error {
+	if col, ok := t.Columns.Get(colName); ok && col.Attrs.Inherited {
+		return fmt.Errorf("cannot alter inherited column %s", colName)
+	}
+	return c.alterColumnType(t, colName, def)
+}
+
+// alterColumnType changes the type of the column in the table and any partitions.
+func (c *Compiler) alterColumnType(t *Table, colName string, def *pg_query.ColumnDef) error {
 	col, ok := t.Columns.Get(colName)
 	if !ok {
-		return fmt.Errorf("column %s not found on table %s", colName, t.FQName())
+		return notFoundInTableError("column", t, colName, "column %s not found on table %s", colName, t.FQName())
+	}
+	if isPartitionKeyColumn(col) {
+		return dependencyError(col.Name, t.Name, "cannot alter column %s because it is part of the partition key of relation %s", col.Name, t.Name)
+	}
+	if views := c.Catalog.ColumnDependentViews(col); len(views) > 0 {
+		return dependencyError(col.Name, views[0].Name, "can't alter type of column %s because %s %s uses it", col.Name, views[0].Kind(), views[0].Name)
+	}
+	if generated := generatedDependents(col); len(generated) > 0 {
+		return dependencyError(col.Name, generated[0].Name, "cannot alter type of a column used by a generated column: column %s is used by %s", col.Name, generated[0].Name)
+	}
+	newType, err := c.FindTypeFromNode(def.TypeName)
+	if err != nil {
+		return err
+	}
+	mods, err := TypeModifiersFromNode(def.TypeName, newType)
+	if err != nil {
+		return err
 	}
-	newType := c.TypeFromNode(def.TypeName)
-	if !CanCast(col.Type, newType) {
+	// Changing only the modifiers, e.g. the length of a varchar, is still a type change
+	if newType != col.Type && !CanCast(col.Type, newType) {
 		return fmt.Errorf("can't alter column type: can't cast from type %s to type %s (or not implemented)", col.Type.Name, newType.Name)
 	}
+	c.changing(col, col.Attrs)
 	col.Type = newType
+	col.Attrs.Modifiers = mods
+	col.Attrs.Domain = domainOf(newType)
+	for _, child := range c.Catalog.Children(t) {
+		err = c.alterColumnType(child, colName, def)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -402,36 +1151,137 @@ func (c *Compiler) FindTableFromRangeVar(r *pg_query.RangeVar) (*Table, error) {
 }
 
 func (c *Compiler) FindTableFromSchemaAndName(schemaName, name string) (*Table, error) {
-	schemaName = c.SchemaOrSearchPath(schemaName)
+	schemaName, err := c.RelationSchema(schemaName, name)
+	if err != nil {
+		return nil, err
+	}
 	sch, ok := c.Catalog.Schemas.Get(schemaName)
 	if !ok {
-		return nil, fmt.Errorf("couldn't find schema %s", schemaName)
+		return nil, notFoundError("schema", schemaName, "couldn't find schema %s", schemaName)
 	}
 	tab, ok := sch.Tables.Get(name)
 	if !ok {
-		return nil, fmt.Errorf("couldn't find table %s", name)
+		return nil, notFoundError("table", name, "couldn't find table %s", name)
 	}
 	return tab, nil
 }
 
+// TypeFromNode is like FindTypeFromNode, but panics if the type doesn't exist.
+//
+// Deprecated: Use FindTypeFromNode instead.
 func (c *Compiler) TypeFromNode(tn *pg_query.TypeName) *PostgresType {
 
-	var parts []string
-	for _, n := range tn.Names {
-		val := StringOrPanic(n)
-		if val == "pg_catalog" { // TODO is this correct
-			continue
+	typ, err := c.FindTypeFromNode(tn)
+	if err != nil {
+		panic(err)
+	}
+	return typ
+}
+
+// FindTypeFromNode looks up the type named by a TypeName, including any array bounds.
+func (c *Compiler) FindTypeFromNode(tn *pg_query.TypeName) (*PostgresType, error) {
+
+	schema, name := ObjectNameFromNodeList(tn.Names)
+	typ, ok := c.lookupType(schema, name)
+	if !ok {
+		if schema == "pg_catalog" {
+			schema = ""
 		}
-		parts = append(parts, val)
+		typeName := qualifiedTypeName(schema, name)
+		return nil, notFoundError("type", typeName, "type %s does not exist", typeName)
 	}
-	return c.TypeRegistry.MatchType(strings.Join(parts, "."))
+	if len(tn.ArrayBounds) > 0 {
+		// Postgres doesn't enforce the declared bounds, so only the number of dimensions is kept
+		typ = c.TypeRegistry.ArrayOf(typ, len(tn.ArrayBounds))
+	}
+	return typ, nil
+}
+
+// TypeModifiersFromNode reads and validates the modifiers given with a type, such as varchar(50).
+func TypeModifiersFromNode(tn *pg_query.TypeName, typ *PostgresType) (TypeModifiers, error) {
+
+	var mods TypeModifiers
+	vals := make([]int32, 0, len(tn.Typmods))
+	for _, n := range tn.Typmods {
+		ival, ok := n.GetAConst().GetVal().(*pg_query.A_Const_Ival)
+		if !ok {
+			return mods, fmt.Errorf("type modifiers must be simple constants or identifiers")
+		}
+		vals = append(vals, ival.Ival.Ival)
+	}
+	if len(vals) == 0 {
+		return mods, nil
+	}
+	if typ.IsArray() {
+		typ = typ.ElementType
+	}
+	switch typ {
+	case Character, CharacterVarying, Bit, BitVarying:
+		if len(vals) != 1 {
+			return mods, fmt.Errorf("invalid type modifier")
+		}
+		if vals[0] < 1 {
+			return mods, fmt.Errorf("length for type %s must be at least 1", typ.Name)
+		}
+		if vals[0] > 10485760 {
+			return mods, fmt.Errorf("length for type %s cannot exceed 10485760", typ.Name)
+		}
+		mods.Length = int(vals[0])
+	case Numeric:
+		if len(vals) > 2 {
+			return mods, fmt.Errorf("invalid NUMERIC type modifier")
+		}
+		if vals[0] < 1 || vals[0] > 1000 {
+			return mods, fmt.Errorf("NUMERIC precision %d must be between 1 and 1000", vals[0])
+		}
+		mods.Precision, mods.HasPrecision = int(vals[0]), true
+		if len(vals) == 2 {
+			if vals[1] < -1000 || vals[1] > 1000 {
+				return mods, fmt.Errorf("NUMERIC scale %d must be between -1000 and 1000", vals[1])
+			}
+			mods.Scale = int(vals[1])
+		}
+	case Time, Timetz, Timestamp, Timestamptz:
+		if len(vals) != 1 {
+			return mods, fmt.Errorf("invalid type modifier")
+		}
+		if vals[0] < 0 {
+			return mods, fmt.Errorf("%s(%d) precision must not be negative", strings.ToUpper(typ.Name), vals[0])
+		}
+		// Postgres reduces larger precisions to the maximum with a warning
+		mods.Precision, mods.HasPrecision = int(min(vals[0], 6)), true
+	case Interval:
+		if len(vals) > 2 {
+			return mods, fmt.Errorf("invalid INTERVAL type modifier")
+		}
+		if vals[0] != intervalFullRange {
+			fields, ok := intervalFieldMasks[vals[0]]
+			if !ok {
+				return mods, fmt.Errorf("invalid INTERVAL type modifier")
+			}
+			mods.IntervalFields = fields
+		}
+		if len(vals) == 2 {
+			if vals[1] < 0 {
+				return mods, fmt.Errorf("INTERVAL(%d) precision must not be negative", vals[1])
+			}
+			mods.Precision, mods.HasPrecision = int(min(vals[1], 6)), true
+		}
+	default:
+		return mods, fmt.Errorf("type modifier is not allowed for type %s", typ.Name)
+	}
+	return mods, nil
 }
 
 func (c *Compiler) DefineConstraints(t *Table, colName string, constraints []*pg_query.Node) error {
+	err := transformConstraintAttrs(constraints)
+	if err != nil {
+		return err
+	}
 	for _, n := range constraints {
 		v, ok := n.Node.(*pg_query.Node_Constraint)
 		if !ok {
-			panic("unknown how to parse node " + n.String())
+			return &UnexpectedNodeError{Expected: "Constraint", Node: n}
 		}
 		err := c.DefineConstraint(t, colName, v.Constraint)
 		if err != nil {
@@ -441,6 +1291,74 @@ func (c *Compiler) DefineConstraints(t *Table, colName string, constraints []*pg
 	return nil
 }
 
+// transformConstraintAttrs applies the DEFERRABLE and INITIALLY clauses of column
+// constraints, which the parser gives as separate nodes, to the constraint they follow.
+func transformConstraintAttrs(constraints []*pg_query.Node) error {
+
+	var last *pg_query.Constraint
+	var sawDeferrability, sawInitially bool
+	for _, n := range constraints {
+		con := n.GetConstraint()
+		if con == nil {
+			continue
+		}
+		switch con.Contype {
+		case pg_query.ConstrType_CONSTR_ATTR_DEFERRABLE, pg_query.ConstrType_CONSTR_ATTR_NOT_DEFERRABLE:
+			if last == nil {
+				return fmt.Errorf("misplaced DEFERRABLE clause")
+			}
+			if sawDeferrability {
+				return fmt.Errorf("multiple DEFERRABLE/NOT DEFERRABLE clauses not allowed")
+			}
+			sawDeferrability = true
+			last.Deferrable = con.Contype == pg_query.ConstrType_CONSTR_ATTR_DEFERRABLE
+			if !last.Deferrable && last.Initdeferred {
+				return fmt.Errorf("constraint declared INITIALLY DEFERRED must be DEFERRABLE")
+			}
+		case pg_query.ConstrType_CONSTR_ATTR_DEFERRED, pg_query.ConstrType_CONSTR_ATTR_IMMEDIATE:
+			if last == nil {
+				return fmt.Errorf("misplaced INITIALLY clause")
+			}
+			if sawInitially {
+				return fmt.Errorf("multiple INITIALLY IMMEDIATE/DEFERRED clauses not allowed")
+			}
+			sawInitially = true
+			last.Initdeferred = con.Contype == pg_query.ConstrType_CONSTR_ATTR_DEFERRED
+			if last.Initdeferred {
+				if sawDeferrability && !last.Deferrable {
+					return fmt.Errorf("constraint declared INITIALLY DEFERRED must be DEFERRABLE")
+				}
+				// INITIALLY DEFERRED on its own implies DEFERRABLE
+				last.Deferrable = true
+			}
+		case pg_query.ConstrType_CONSTR_PRIMARY, pg_query.ConstrType_CONSTR_UNIQUE,
+			pg_query.ConstrType_CONSTR_EXCLUSION, pg_query.ConstrType_CONSTR_FOREIGN:
+			last = con
+			sawDeferrability, sawInitially = false, false
+		default:
+			last = nil
+		}
+	}
+	return nil
+}
+
+func foreignKeyAction(code string) (ForeignKeyAction, error) {
+
+	switch code {
+	case "a", "":
+		return ForeignKeyActionNoAction, nil
+	case "r":
+		return ForeignKeyActionRestrict, nil
+	case "c":
+		return ForeignKeyActionCascade, nil
+	case "n":
+		return ForeignKeyActionSetNull, nil
+	case "d":
+		return ForeignKeyActionSetDefault, nil
+	}
+	return 0, fmt.Errorf("unknown foreign key action %q", code)
+}
+
 func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constraint) error {
 
 	switch v.Contype {
@@ -448,7 +1366,11 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 		{
 			var cols Columns
 			for _, k := range v.Keys {
-				col, err := ColumnFromColName(t, StringOrPanic(k))
+				name, err := StringFromNode(k)
+				if err != nil {
+					return err
+				}
+				col, err := ColumnFromColName(t, name)
 				if err != nil {
 					return err
 				}
@@ -461,13 +1383,18 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 				}
 				cols = append(cols, col)
 			}
+			err := checkPartitionedUnique(t, ConstraintTypePrimary, cols)
+			if err != nil {
+				return err
+			}
 			name := v.Conname
 			if name == "" {
 				name = t.Name + "_" + "pkey"
 			}
-			con := &Constraint{Table: t, Name: name, Type: ConstraintTypePrimary, Constrains: cols}
-			c.Catalog.PgConstraint.AddConstraint(con)
-			return nil
+			con := &Constraint{Table: t, Name: name, Type: ConstraintTypePrimary, Constrains: cols,
+				Deferrable: v.Deferrable, InitiallyDeferred: v.Initdeferred}
+			c.addConstraint(con)
+			return c.AddConstraintIndex(con)
 		}
 	case pg_query.ConstrType_CONSTR_NOTNULL:
 		{
@@ -475,6 +1402,7 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 			if err != nil {
 				return err
 			}
+			c.changing(col.Attrs)
 			col.Attrs.NotNull = true
 			return nil
 		}
@@ -484,13 +1412,16 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 			if err != nil {
 				return err
 			}
-			expr, err := c.ExprToString(v.RawExpr)
-			if err != nil {
-				return err
+			if col.Attrs.Identity != IdentityNone {
+				return fmt.Errorf("both default and identity specified for column %s of table %s", col.Name, t.Name)
 			}
-			col.Attrs.HasExplicitDefault = true
-			col.Attrs.ColumnDefault = expr
-			return nil
+			if col.Attrs.GeneratedExpression != "" {
+				return fmt.Errorf("both default and generation expression specified for column %s of table %s", col.Name, t.Name)
+			}
+			if col.Attrs.HasExplicitDefault || col.Attrs.HasSequence {
+				return fmt.Errorf("multiple default values specified for column %s of table %s", col.Name, t.Name)
+			}
+			return c.SetColumnDefault(col, v.RawExpr)
 		}
 	case pg_query.ConstrType_CONSTR_UNIQUE:
 		{
@@ -503,24 +1434,34 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 				constrainsCols = append(constrainsCols, col)
 			} else {
 				for _, colRef := range v.Keys {
-					colName := StringOrPanic(colRef)
+					colName, err := StringFromNode(colRef)
+					if err != nil {
+						return err
+					}
 					col, ok := t.Columns.Get(colName)
 					if !ok {
-						return fmt.Errorf("column %s not found", colName)
+						return notFoundInTableError("column", t, colName, "column %s not found", colName)
 					}
 					constrainsCols = append(constrainsCols, col)
 				}
 			}
+			err := checkPartitionedUnique(t, ConstraintTypeUnique, constrainsCols)
+			if err != nil {
+				return err
+			}
 			name := v.Conname
 			if name == "" {
 				name = strings.Join([]string{t.Name, constrainsCols.JoinColumnNames("_"), "key"}, "_")
 			}
-			c.Catalog.PgConstraint.AddConstraint(&Constraint{Table: t,
-				Name:       name,
-				Type:       ConstraintTypeUnique,
-				Constrains: constrainsCols,
-			})
-			return nil
+			con := &Constraint{Table: t,
+				Name:              name,
+				Type:              ConstraintTypeUnique,
+				Constrains:        constrainsCols,
+				Deferrable:        v.Deferrable,
+				InitiallyDeferred: v.Initdeferred,
+			}
+			c.addConstraint(con)
+			return c.AddConstraintIndex(con)
 		}
 	case pg_query.ConstrType_CONSTR_FOREIGN:
 		{
@@ -533,10 +1474,16 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 				return err
 			}
 			for _, colRef := range v.PkAttrs {
-				colName := StringOrPanic(colRef)
+				colName, err := StringFromNode(colRef)
+				if err != nil {
+					return err
+				}
 				col, err := c.FindColumn(schema, table, colName)
 				if err != nil {
-					return fmt.Errorf("couldn't find column '%s' in table '%s'", colName, table)
+					if refTable, err := c.FindTable(schema, table); err == nil {
+						return notFoundInTableError("column", refTable, colName, "couldn't find column '%s' in table '%s'", colName, table)
+					}
+					return notFoundError("column", colName, "couldn't find column '%s' in table '%s'", colName, table)
 				}
 				refers = append(refers, col)
 			}
@@ -551,10 +1498,13 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 			}
 			constrainsCols := make(Columns, 0, len(refers))
 			for _, colRef := range v.FkAttrs {
-				colName := StringOrPanic(colRef)
+				colName, err := StringFromNode(colRef)
+				if err != nil {
+					return err
+				}
 				col, ok := t.Columns.Get(colName)
 				if !ok {
-					return fmt.Errorf("column %s not found", colName)
+					return notFoundInTableError("column", t, colName, "column %s not found", colName)
 				}
 				constrainsCols = append(constrainsCols, col)
 			}
@@ -572,15 +1522,44 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 			if name == "" && len(constrainsCols) > 0 {
 				name = strings.Join([]string{t.Name, constrainsCols.JoinColumnNames("_"), "fkey"}, "_")
 			}
-			c.Catalog.PgConstraint.AddConstraint(&Constraint{
-				Table:         t,
-				Type:          ConstraintTypeForeignKey,
-				DropBehaviour: DropBehaviourRestrict,
-				Name:          name,
-				RefersTable:   tableObj,
-				Refers:        refers,
-				Constrains:    constrainsCols,
-			})
+			con := &Constraint{
+				Table:             t,
+				Type:              ConstraintTypeForeignKey,
+				DropBehaviour:     DropBehaviourRestrict,
+				Name:              name,
+				RefersTable:       tableObj,
+				Refers:            refers,
+				Constrains:        constrainsCols,
+				NotValid:          v.SkipValidation,
+				Deferrable:        v.Deferrable,
+				InitiallyDeferred: v.Initdeferred,
+			}
+			con.OnDelete, err = foreignKeyAction(v.FkDelAction)
+			if err != nil {
+				return err
+			}
+			con.OnUpdate, err = foreignKeyAction(v.FkUpdAction)
+			if err != nil {
+				return err
+			}
+			switch v.FkMatchtype {
+			case "f":
+				con.Match = ForeignKeyMatchFull
+			case "p":
+				return fmt.Errorf("MATCH PARTIAL not yet implemented")
+			}
+			for _, n := range v.FkDelSetCols {
+				colName, err := StringFromNode(n)
+				if err != nil {
+					return err
+				}
+				idx := slices.IndexFunc(constrainsCols, func(col *Column) bool { return col.Name == colName })
+				if idx < 0 {
+					return fmt.Errorf("column %s referenced in ON DELETE SET action must be part of foreign key", colName)
+				}
+				con.OnDeleteColumns = append(con.OnDeleteColumns, constrainsCols[idx])
+			}
+			c.addConstraint(con)
 			return nil
 		}
 	case pg_query.ConstrType_CONSTR_NULL:
@@ -588,59 +1567,113 @@ func (c *Compiler) DefineConstraint(t *Table, colName string, v *pg_query.Constr
 			// Nothing to do? That's the default
 			return nil
 		}
-	case pg_query.ConstrType_CONSTR_CHECK, pg_query.ConstrType_CONSTR_ATTR_DEFERRABLE:
+	case pg_query.ConstrType_CONSTR_CHECK:
 		{
-			// Nothing to do for checked constraints yet
+			return c.DefineCheckConstraint(t, colName, v)
+		}
+	case pg_query.ConstrType_CONSTR_ATTR_DEFERRABLE, pg_query.ConstrType_CONSTR_ATTR_NOT_DEFERRABLE,
+		pg_query.ConstrType_CONSTR_ATTR_DEFERRED, pg_query.ConstrType_CONSTR_ATTR_IMMEDIATE:
+		{
+			// Already applied to the preceding constraint by transformConstraintAttrs
 			return nil
 		}
 	case pg_query.ConstrType_CONSTR_IDENTITY:
 		{
-			constrainsCols := make(Columns, 0, len(v.FkAttrs))
-			for _, colRef := range v.FkAttrs {
-				colName := StringOrPanic(colRef)
-				col, ok := t.Columns.Get(colName)
-				if !ok {
-					return fmt.Errorf("column %s not found", colName)
-				}
-				constrainsCols = append(constrainsCols, col)
+			col, err := ColumnFromColName(t, colName)
+			if err != nil {
+				return err
 			}
-			if len(constrainsCols) == 0 {
-				// For syntax like:
-				// CREATE TABLE example (user_id INTEGER REFERENCES users(id));
-				// the name of the constrained column is not in the node, and is provided
-				// by the caller instead
-				col, err := ColumnFromColName(t, colName)
-				if err != nil {
-					return err
-				}
-				constrainsCols = append(constrainsCols, col)
+			return c.DefineIdentity(col, v)
+		}
+	case pg_query.ConstrType_CONSTR_GENERATED:
+		{
+			col, err := ColumnFromColName(t, colName)
+			if err != nil {
+				return err
 			}
-			name := strings.Join([]string{t.Name, constrainsCols.JoinColumnNames("_"), "identity"}, "_")
-			c.Catalog.PgConstraint.AddConstraint(&Constraint{
-				Table: t,
-				// TODO: What does postgres call it?
-				Name:          name,
-				Type:          ConstraintTypeIdentity,
-				Constrains:    constrainsCols,
-				DropBehaviour: DropBehaviourCascade,
-			})
-			return nil
+			return c.DefineGenerated(col, v)
 		}
 	default:
 		return fmt.Errorf("not yet able to process constraint type %v", v.Contype)
 	}
 }
 
+// AlterConstraint handles ALTER CONSTRAINT, which can only change when a foreign key is checked.
+func (c *Compiler) AlterConstraint(t *Table, v *pg_query.Constraint) error {
+
+	cons, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(t, v.Conname)]
+	if !ok {
+		return notFoundInTableError("constraint", t, v.Conname, "constraint %s of relation %s does not exist", v.Conname, t.Name)
+	}
+	if cons.Type != ConstraintTypeForeignKey {
+		return fmt.Errorf("constraint %s of relation %s is not a foreign key constraint", v.Conname, t.Name)
+	}
+	c.changing(cons)
+	cons.Deferrable = v.Deferrable
+	cons.InitiallyDeferred = v.Initdeferred
+	return nil
+}
+
+func (c *Compiler) DefineCheckConstraint(t *Table, colName string, v *pg_query.Constraint) error {
+
+	if v.IsNoInherit && t.PartitionKey != nil {
+		return fmt.Errorf("cannot add NO INHERIT constraint to partitioned table %s", t.Name)
+	}
+	var err error
+	WalkNodes(v.RawExpr, func(n *pg_query.Node) bool {
+		if _, ok := n.Node.(*pg_query.Node_SubLink); ok {
+			err = fmt.Errorf("cannot use subquery in check constraint")
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	cols, err := ColumnsFromExpr(t, v.RawExpr)
+	if err != nil {
+		return err
+	}
+	expr, err := DeparseExpr(v.RawExpr)
+	if err != nil {
+		return err
+	}
+	name := v.Conname
+	if name == "" {
+		// Postgres names the check after its column only if it references exactly one
+		colPart := ""
+		if len(cols) == 1 {
+			colPart = cols[0].Name
+		}
+		name = ChooseConstraintName(c.Catalog.PgConstraint, t.Schema, t.Name, colPart, "check")
+	} else if _, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(t, name)]; ok {
+		return duplicateObjectError("constraint", name, "constraint %s for relation %s already exists", name, t.Name)
+	}
+	c.addConstraint(&Constraint{
+		Table:         t,
+		Name:          name,
+		Type:          ConstraintTypeCheck,
+		Constrains:    cols,
+		Expression:    expr,
+		NoInherit:     v.IsNoInherit,
+		NotValid:      v.SkipValidation,
+		DropBehaviour: DropBehaviourCascade,
+	})
+	return nil
+}
+
 func (c *Compiler) FindTable(schema, table string) (*Table, error) {
 
-	schema = c.SchemaOrSearchPath(schema)
+	schema, err := c.RelationSchema(schema, table)
+	if err != nil {
+		return nil, err
+	}
 	s, ok := c.Catalog.Schemas.Get(schema)
 	if !ok {
-		return nil, fmt.Errorf("schema %s not found", schema)
+		return nil, notFoundError("schema", schema, "schema %s not found", schema)
 	}
 	t, ok := s.Tables.Get(table)
 	if !ok {
-		return nil, fmt.Errorf("table %s not found", table)
+		return nil, notFoundError("table", table, "table %s not found", table)
 	}
 	return t, nil
 }
@@ -653,20 +1686,23 @@ func (c *Compiler) FindColumn(schema, table, name string) (*Column, error) {
 	}
 	col, ok := t.Columns.Get(name)
 	if !ok {
-		return nil, fmt.Errorf("column %s not found", name)
+		return nil, notFoundInTableError("column", t, name, "column %s not found", name)
 	}
 	return col, nil
 }
 
 func (c *Compiler) FindPrimaryKeyColumns(schema, table string) ([]*Column, error) {
-	schema = c.SchemaOrSearchPath(schema)
+	schema, err := c.RelationSchema(schema, table)
+	if err != nil {
+		return nil, err
+	}
 	s, ok := c.Catalog.Schemas.Get(schema)
 	if !ok {
-		return nil, fmt.Errorf("schema %s not found", schema)
+		return nil, notFoundError("schema", schema, "schema %s not found", schema)
 	}
 	t, ok := s.Tables.Get(table)
 	if !ok {
-		return nil, fmt.Errorf("table %s not found", table)
+		return nil, notFoundError("table", table, "table %s not found", table)
 	}
 	ret := make([]*Column, 0, 1)
 	for _, col := range t.Columns.List() {
@@ -689,16 +1725,22 @@ func (c *Compiler) ExprToString(n *pg_query.Node) (string, error) {
 	case *pg_query.Node_FuncCall:
 		{
 			// Function invocation e.g. NOW()
-			//fmt.Println(StringsOrPanic(x.FuncCall.Funcname))
-			// TODO: x.FuncCall.Args...
-			return fmt.Sprintf("%s(%s)", strings.Join(StringsOrPanic(x.FuncCall.Funcname), "."), strings.Join(StringsOrPanic(x.FuncCall.Args), ", ")), nil
+			args := make([]string, 0, len(x.FuncCall.Args))
+			for _, arg := range x.FuncCall.Args {
+				s, err := c.ExprToString(arg)
+				if err != nil {
+					return "", err
+				}
+				args = append(args, s)
+			}
+			return fmt.Sprintf("%s(%s)", strings.Join(nameStrings(x.FuncCall.Funcname), "."), strings.Join(args, ", ")), nil
 		}
 	case *pg_query.Node_TypeCast:
 		{
-			typeName := strings.Join(StringsOrPanic(x.TypeCast.TypeName.Names), ".")
+			typeName := strings.Join(nameStrings(x.TypeCast.TypeName.Names), ".")
 			aConst, ok := x.TypeCast.Arg.Node.(*pg_query.Node_AConst)
 			if !ok {
-				return "", nil
+				return DeparseExpr(n)
 			}
 			val, err := c.ConstantAsString(aConst.AConst)
 			if err != nil {
@@ -712,7 +1754,9 @@ func (c *Compiler) ExprToString(n *pg_query.Node) (string, error) {
 		}
 	}
 
-	return "", nil
+	// Anything else, such as an operator or ARRAY constructor, is
+	// rendered as SQL
+	return DeparseExpr(n)
 }
 
 func (c *Compiler) ConstantAsString(aConst *pg_query.A_Const) (string, error) {
@@ -755,12 +1799,14 @@ func (c *Compiler) ConstantAsString(aConst *pg_query.A_Const) (string, error) {
 
 func (c *Compiler) CreateEnum(ces *pg_query.CreateEnumStmt) error {
 
-	schema, name := ObjectNameFromNodeList(ces.TypeName)
-	typeName := name
-	if schema != "" {
-		typeName = schema + "." + typeName
+	schema, typeName, err := c.typeName(ces.TypeName)
+	if err != nil {
+		return err
+	}
+	vals, err := StringsFromNodes(ces.Vals)
+	if err != nil {
+		return err
 	}
-	vals := StringsOrPanic(ces.Vals)
 	typ := &PostgresType{
 		Name:           typeName,
 		Schema:         schema,
@@ -770,14 +1816,7 @@ func (c *Compiler) CreateEnum(ces *pg_query.CreateEnumStmt) error {
 		PatternMatches: nil,
 		EnumValues:     vals,
 	}
-	return c.TypeRegistry.RegisterType(typ)
-}
-
-func (c *Compiler) SchemaOrSearchPath(schema string) string {
-	if schema == "" {
-		return c.SearchPath
-	}
-	return schema
+	return c.registerType(typ)
 }
 
 func ObjectNameFromList(l *pg_query.List) (schema string, object string) {
@@ -787,39 +1826,85 @@ func ObjectNameFromList(l *pg_query.List) (schema string, object string) {
 
 func ObjectNameFromNodeList(l []*pg_query.Node) (schema string, object string) {
 
+	return ObjectNameFromStrings(nameStrings(l))
+}
+
+func ObjectNameFromStrings(l []string) (schema string, object string) {
+
 	if len(l) == 1 {
-		object = StringOrPanic(l[0])
+		object = l[0]
 		return
 	}
 	if len(l) == 2 {
-		schema = StringOrPanic(l[0])
-		object = StringOrPanic(l[1])
+		schema = l[0]
+		object = l[1]
 	}
 	return
 }
 
-func StringsOrPanic(ns []*pg_query.Node) []string {
+// StringsFromNodes returns the values of a list of String nodes.
+func StringsFromNodes(ns []*pg_query.Node) ([]string, error) {
 
 	ret := make([]string, 0, len(ns))
 	for _, n := range ns {
-		ret = append(ret, StringOrPanic(n))
+		s, err := StringFromNode(n)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
 	}
-	return ret
+	return ret, nil
 }
 
-func StringOrPanic(n *pg_query.Node) string {
+// StringFromNode returns the value of a String node.
+func StringFromNode(n *pg_query.Node) (string, error) {
 
 	s, ok := n.Node.(*pg_query.Node_String_)
 	if !ok {
-		panic("unknown how to parse node " + n.String())
+		return "", &UnexpectedNodeError{Expected: "String", Node: n}
+	}
+	return s.String_.Sval, nil
+}
+
+// StringsOrPanic is like StringsFromNodes, but panics if a node isn't a String.
+//
+// Deprecated: Use StringsFromNodes instead.
+func StringsOrPanic(ns []*pg_query.Node) []string {
+
+	ret, err := StringsFromNodes(ns)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// StringOrPanic is like StringFromNode, but panics if the node isn't a String.
+//
+// Deprecated: Use StringFromNode instead.
+func StringOrPanic(n *pg_query.Node) string {
+
+	s, err := StringFromNode(n)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// nameStrings returns the parts of a name. The parser gives names as
+// String nodes, so any other node is read as an empty string.
+func nameStrings(ns []*pg_query.Node) []string {
+
+	ret := make([]string, 0, len(ns))
+	for _, n := range ns {
+		ret = append(ret, n.GetString_().GetSval())
 	}
-	return s.String_.Sval
+	return ret
 }
 
 func ColumnFromColName(t *Table, name string) (*Column, error) {
 	col, ok := t.Columns.Get(name)
 	if !ok {
-		return nil, fmt.Errorf("column %s not found", name)
+		return nil, notFoundInTableError("column", t, name, "column %s not found", name)
 	}
 	return col, nil
 }
@@ -1,6 +1,7 @@
 package pgmodelparse
 
 import (
+	"math"
 	"strings"
 	"testing"
 
@@ -32,8 +33,8 @@ func assertParseError(t *testing.T, stmts string, messageContains ...string) {
 }
 
 func assertTable(t *testing.T, c *Compiler, path string) *Table {
-	schemaName := c.SearchPath
 	tableName := path
+	schemaName, _ := c.RelationSchema("", tableName)
 	split := strings.Split(path, ".")
 	if len(split) > 1 {
 		schemaName = split[0]
@@ -102,7 +103,7 @@ func TestCompiler_CreateTable(t *testing.T) {
 		})
 	}
 	{
-		col := assertColumn(t, table, "username", CharacterVarying, ColumnAttributes{NotNull: true})
+		col := assertColumn(t, table, "username", CharacterVarying, ColumnAttributes{NotNull: true, Modifiers: TypeModifiers{Length: 50}})
 		assertConstraints(t, c, col, Constraint{
 			Table:      table,
 			Name:       "users_username_key",
@@ -111,7 +112,7 @@ func TestCompiler_CreateTable(t *testing.T) {
 		})
 	}
 	{
-		col := assertColumn(t, table, "email", CharacterVarying, ColumnAttributes{NotNull: true})
+		col := assertColumn(t, table, "email", CharacterVarying, ColumnAttributes{NotNull: true, Modifiers: TypeModifiers{Length: 100}})
 		assertConstraints(t, c, col)
 	}
 	{
@@ -373,8 +374,65 @@ func TestCompiler_AlterTable_AddDefault(t *testing.T) {
 `
 
 	c := assertParse(t, test)
-	_ = c
-	// TODO
+	tab := assertTable(t, c, "seqtest")
+	txt := assertColumn(t, tab, "txt", Text, ColumnAttributes{NotNull: true, HasExplicitDefault: true, ColumnDefault: `""`})
+	assert.False(t, txt.Attrs.IsRequired())
+
+	c = assertParse(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN txt SET DEFAULT 'x';`))
+	assertColumn(t, assertTable(t, c, "seqtest"), "txt", Text, ColumnAttributes{NotNull: true, HasExplicitDefault: true, ColumnDefault: `"x"`})
+
+	c = assertParse(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN txt SET DEFAULT NULL;`))
+	assertColumn(t, assertTable(t, c, "seqtest"), "txt", Text, ColumnAttributes{NotNull: true})
+
+	// Replacing a serial's default leaves the sequence behind, owned by the column
+	c = assertParse(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN id SET DEFAULT 0;`))
+	id := assertColumn(t, assertTable(t, c, "seqtest"), "id", Bigint, ColumnAttributes{Pkey: true, HasExplicitDefault: true, ColumnDefault: "0"})
+	assert.Same(t, id, assertSequence(t, c, "seqtest_id_seq").OwnedBy)
+
+	c = assertParse(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN id SET DEFAULT 0, ALTER COLUMN id SET DEFAULT nextval('seqtest_id_seq');`))
+	assertColumn(t, assertTable(t, c, "seqtest"), "id", Bigint, ColumnAttributes{
+		Pkey: true, HasExplicitDefault: true, ColumnDefault: `nextval("seqtest_id_seq")`,
+		HasSequence: true, SequenceName: "seqtest_id_seq",
+	})
+
+	assertParseError(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN missing SET DEFAULT '';`),
+		"column missing not found on table public.seqtest")
+	assertParseError(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN id SET DEFAULT true;`),
+		"column id is of type bigint but default expression is of type boolean")
+	assertParseError(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN txt SET DEFAULT id;`),
+		"cannot use column reference in DEFAULT expression")
+	assertParseError(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN txt SET DEFAULT (SELECT 'a');`),
+		"cannot use subquery in DEFAULT expression")
+	assertParseError(t, `CREATE TABLE things (id int GENERATED ALWAYS AS IDENTITY); ALTER TABLE things ALTER COLUMN id SET DEFAULT 1;`,
+		"column id of relation things is an identity column")
+	assertParseError(t, `CREATE TABLE things (id serial DEFAULT 1);`,
+		"multiple default values specified for column id of table things")
+
+	// String literals must be valid input for numeric and boolean columns
+	c = assertParse(t, `
+	CREATE TABLE things (id int DEFAULT ' 42 ', big bigint DEFAULT '0x1F', price numeric DEFAULT '1.5e3', ok boolean DEFAULT 'yes');
+	ALTER TABLE things ALTER COLUMN ok SET DEFAULT 'F';`)
+	assertColumn(t, assertTable(t, c, "things"), "ok", Boolean, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: `"F"`})
+	assertParseError(t, joinNewline(test, `ALTER TABLE seqtest ALTER COLUMN id SET DEFAULT 'abc';`),
+		`invalid input syntax for type bigint: "abc"`)
+	assertParseError(t, `CREATE TABLE things (n smallint DEFAULT '40000');`,
+		`value "40000" is out of range for type smallint`)
+	assertParseError(t, `CREATE TABLE things (price numeric DEFAULT '1.5.0');`,
+		`invalid input syntax for type numeric: "1.5.0"`)
+	assertParseError(t, `CREATE TABLE things (ok boolean DEFAULT 'maybe');`,
+		`invalid input syntax for type boolean: "maybe"`)
+
+	// Other expressions are recorded as SQL
+	c = assertParse(t, `
+	CREATE TABLE things (n int, due timestamptz, tags text[], code text DEFAULT lower('A' || 'B'));
+	ALTER TABLE things ALTER COLUMN n SET DEFAULT 1+1;
+	ALTER TABLE things ALTER COLUMN due SET DEFAULT now() + interval '1 day';
+	ALTER TABLE things ALTER COLUMN tags SET DEFAULT ARRAY[]::text[];`)
+	things := assertTable(t, c, "things")
+	assertColumn(t, things, "n", Integer, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "1 + 1"})
+	assertColumn(t, things, "due", Timestamptz, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "now() + '1 day'::interval"})
+	assertColumn(t, things, "tags", assertType(t, c.TypeRegistry, "text[]"), ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "ARRAY[]::text[]"})
+	assertColumn(t, things, "code", Text, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: `lower('A' || 'B')`})
 }
 
 func TestCompiler_AlterTable_ChangePk(t *testing.T) {
@@ -423,6 +481,20 @@ func TestCompiler_AlterTable_RenameTo(t *testing.T) {
 		Constrains:    Columns{col},
 		DropBehaviour: DropBehaviourRestrict,
 	})
+
+	// The queries of views that use the table refer to it by its new name
+	c = assertParse(t, `
+	CREATE SCHEMA app;
+	CREATE TABLE app.test (id int, name text);
+	CREATE VIEW app.direct AS SELECT test.id, app.test.name FROM app.test WHERE test.id > 0;
+	CREATE VIEW app.everything AS SELECT test.* FROM app.test JOIN app.test AS other USING (id);
+	CREATE VIEW app.aliased AS SELECT test.id FROM app.test AS test;
+	CREATE VIEW app.shadowed AS WITH test AS (SELECT 1 AS id) SELECT test.id FROM test, app.test t;
+	ALTER TABLE app.test RENAME TO test2;`)
+	assert.Equal(t, "SELECT test2.id, app.test2.name FROM app.test2 WHERE test2.id > 0", assertView(t, c, "app.direct").Query)
+	assert.Equal(t, "SELECT test2.* FROM app.test2 JOIN app.test2 other USING (id)", assertView(t, c, "app.everything").Query)
+	assert.Equal(t, "SELECT test.id FROM app.test2 test", assertView(t, c, "app.aliased").Query)
+	assert.Equal(t, "WITH test AS (SELECT 1 AS id) SELECT test.id FROM test, app.test2 t", assertView(t, c, "app.shadowed").Query)
 }
 
 // TODO:
@@ -430,3 +502,2159 @@ func TestCompiler_AlterTable_RenameTo(t *testing.T) {
 // CREATE TABLE (... col int null ...)
 
 //func TestCompiler_
+
+func assertIndex(t *testing.T, c *Compiler, path string) *Index {
+	schemaName, _ := c.RelationSchema("", path)
+	indexName := path
+	split := strings.Split(path, ".")
+	if len(split) > 1 {
+		schemaName = split[0]
+		indexName = split[1]
+	}
+	schema, ok := c.Catalog.Schemas.Get(schemaName)
+	require.True(t, ok)
+	idx, ok := schema.Indexes.Get(indexName)
+	require.True(t, ok, "no index with name %s found", indexName)
+	return idx
+}
+
+func assertNoIndex(t *testing.T, c *Compiler, path string) {
+	schemaName, _ := c.RelationSchema("", path)
+	indexName := path
+	split := strings.Split(path, ".")
+	if len(split) > 1 {
+		schemaName = split[0]
+		indexName = split[1]
+	}
+	schema, ok := c.Catalog.Schemas.Get(schemaName)
+	require.True(t, ok)
+	_, ok = schema.Indexes.Get(indexName)
+	assert.False(t, ok, "expected index %s not to exist", indexName)
+}
+
+func TestCompiler_CreateIndex(t *testing.T) {
+	const sql = `
+	CREATE TABLE docs (
+		id bigint primary key,
+		owner_id bigint not null,
+		title text not null,
+		body jsonb,
+		deleted_at timestamptz
+	);
+
+	CREATE INDEX ON docs (owner_id);
+	CREATE INDEX ON docs (owner_id);
+	CREATE UNIQUE INDEX docs_title_uq ON docs (lower(title) DESC) INCLUDE (owner_id) WHERE deleted_at IS NULL;
+	CREATE INDEX CONCURRENTLY docs_body_gin ON docs USING gin (body);
+	CREATE INDEX IF NOT EXISTS docs_body_gin ON docs (title);
+	`
+	c := assertParse(t, sql)
+	tab := assertTable(t, c, "docs")
+	ownerId := assertColumn(t, tab, "owner_id", Bigint, ColumnAttributes{NotNull: true})
+	title := assertColumn(t, tab, "title", Text, ColumnAttributes{NotNull: true})
+
+	pkey := assertIndex(t, c, "docs_pkey")
+	assert.True(t, pkey.Primary)
+	assert.True(t, pkey.Unique)
+	assert.Equal(t, c.Catalog.PgConstraint.ByName["public.docs.docs_pkey"], pkey.Constraint)
+
+	first := assertIndex(t, c, "docs_owner_id_idx")
+	assert.Equal(t, IndexMethodBtree, first.Method)
+	assert.Equal(t, []*IndexKey{{Column: ownerId, Columns: Columns{ownerId}}}, first.Keys)
+	assertIndex(t, c, "docs_owner_id_idx1")
+
+	uq := assertIndex(t, c, "docs_title_uq")
+	assert.True(t, uq.Unique)
+	assert.Equal(t, []*IndexKey{{Expression: "lower(title)", Columns: Columns{title}, Descending: true, NullsFirst: true}}, uq.Keys)
+	assert.Equal(t, Columns{ownerId}, uq.Include)
+	assert.Equal(t, "deleted_at IS NULL", uq.Predicate)
+
+	gin := assertIndex(t, c, "docs_body_gin")
+	assert.Equal(t, IndexMethodGin, gin.Method)
+	assert.True(t, gin.Concurrently)
+	require.Len(t, gin.Keys, 1)
+	assert.Equal(t, "body", gin.Keys[0].Column.Name)
+}
+
+func TestCompiler_CreateIndex_MaterializedView(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA archive;
+	CREATE TABLE docs (id bigint primary key, title text);
+	CREATE MATERIALIZED VIEW doc_titles AS SELECT id, title FROM docs;
+	CREATE UNIQUE INDEX doc_titles_id ON doc_titles (id);
+	CREATE INDEX ON doc_titles (lower(title)) INCLUDE (id) WHERE title <> '';
+	`
+	c := assertParse(t, sql)
+	mv := assertView(t, c, "doc_titles")
+	uq := assertIndex(t, c, "doc_titles_id")
+	assert.Nil(t, uq.Table)
+	assert.Same(t, mv, uq.View)
+	assert.True(t, uq.Unique)
+	assert.Equal(t, []*IndexKey{{ViewColumn: mv.Columns[0]}}, uq.Keys)
+	lower := assertIndex(t, c, "doc_titles_lower_id_idx")
+	assert.Equal(t, []*IndexKey{{Expression: "lower(title)"}}, lower.Keys)
+	assert.Equal(t, []*ViewColumn{mv.Columns[0]}, lower.ViewInclude)
+	assert.Equal(t, "title <> ''", lower.Predicate)
+
+	// The indexes follow the view when its columns are renamed, it moves
+	// schema or it is dropped
+	c = assertParse(t, joinNewline(sql, `ALTER MATERIALIZED VIEW doc_titles RENAME COLUMN title TO name;`))
+	lower = assertIndex(t, c, "doc_titles_lower_id_idx")
+	assert.Equal(t, "lower(name)", lower.Keys[0].Expression)
+	assert.Equal(t, "name <> ''", lower.Predicate)
+	c = assertParse(t, joinNewline(sql, `ALTER MATERIALIZED VIEW doc_titles SET SCHEMA archive;`))
+	assert.Equal(t, "archive.doc_titles_id", assertIndex(t, c, "archive.doc_titles_id").FQName())
+	assertNoIndex(t, c, "doc_titles_id")
+	assertParse(t, joinNewline(sql, `REINDEX TABLE doc_titles;`))
+	c = assertParse(t, joinNewline(sql, `DROP MATERIALIZED VIEW doc_titles;`))
+	assertNoIndex(t, c, "doc_titles_id")
+	assertNoIndex(t, c, "doc_titles_lower_id_idx")
+
+	assertParseError(t, joinNewline(sql, `CREATE INDEX ON doc_titles (missing);`), "column missing does not exist")
+	assertParseError(t, joinNewline(sql, `CREATE INDEX ON doc_titles (lower(missing));`), "column missing does not exist")
+	assertParseError(t, joinNewline(sql, `CREATE VIEW plain AS SELECT id FROM docs; CREATE INDEX ON plain (id);`),
+		"cannot create index on view plain")
+	assertParseError(t, joinNewline(sql, `CREATE INDEX ON missing (id);`), "couldn't find table missing")
+}
+
+func TestCompiler_CreateIndex_Errors(t *testing.T) {
+	const table = `CREATE TABLE docs (id bigint, body jsonb);`
+	assertParseError(t, joinNewline(table, `CREATE INDEX ON docs (missing);`), "column missing not found")
+	assertParseError(t, joinNewline(table, `CREATE UNIQUE INDEX ON docs USING gin (body);`), "does not support unique indexes")
+	assertParseError(t, joinNewline(table, `CREATE INDEX docs ON docs (id);`), "relation docs already exists")
+	assertParseError(t, joinNewline(table, `CREATE INDEX ON docs USING foo (id);`), "access method foo does not exist")
+}
+
+func TestCompiler_DropIndex(t *testing.T) {
+	const sql = `
+	CREATE TABLE docs (id bigint primary key, owner_id bigint, title text);
+	CREATE INDEX docs_owner_idx ON docs (owner_id);
+	CREATE INDEX docs_title_idx ON docs (title);
+	DROP INDEX docs_owner_idx;
+	DROP INDEX IF EXISTS docs_owner_idx, missing;
+	ALTER TABLE docs DROP COLUMN title;
+	`
+	c := assertParse(t, sql)
+	assertNoIndex(t, c, "docs_owner_idx")
+	assertNoIndex(t, c, "docs_title_idx")
+	assertIndex(t, c, "docs_pkey")
+
+	assertParseError(t, joinNewline(`CREATE TABLE docs (id bigint primary key);`, `DROP INDEX docs_pkey;`),
+		"because constraint docs_pkey on table docs requires it")
+	assertParseError(t, joinNewline(`CREATE TABLE docs (id bigint);`, `CREATE INDEX a ON docs (id);`, `CREATE INDEX b ON docs (id);`,
+		`DROP INDEX CONCURRENTLY a, b;`), "does not support dropping multiple objects")
+}
+
+func TestCompiler_DropTable_DropsIndexes(t *testing.T) {
+	const sql = `
+	CREATE TABLE docs (id bigint primary key, title text unique);
+	CREATE INDEX docs_title_idx ON docs (title);
+	DROP TABLE docs;
+	`
+	c := assertParse(t, sql)
+	sch, ok := c.Catalog.Schemas.Get("public")
+	require.True(t, ok)
+	assert.Len(t, sch.Indexes.List(), 0)
+}
+
+func TestCompiler_AlterIndex_Rename(t *testing.T) {
+	const sql = `
+	CREATE TABLE docs (id bigint primary key, title text);
+	CREATE INDEX docs_title_idx ON docs (title);
+	ALTER INDEX docs_title_idx RENAME TO docs_by_title;
+	ALTER INDEX docs_pkey RENAME TO docs_id_pkey;
+	REINDEX INDEX docs_by_title;
+	`
+	c := assertParse(t, sql)
+	assertNoIndex(t, c, "docs_title_idx")
+	assertIndex(t, c, "docs_by_title")
+	pkey := assertIndex(t, c, "docs_id_pkey")
+	assert.Equal(t, "docs_id_pkey", pkey.Constraint.Name)
+	assert.Same(t, pkey.Constraint, c.Catalog.PgConstraint.ByName["public.docs.docs_id_pkey"])
+
+	assertParseError(t, joinNewline(sql, `ALTER INDEX docs_by_title RENAME TO docs;`), "relation docs already exists")
+}
+
+func assertView(t *testing.T, c *Compiler, path string) *View {
+	schemaName, _ := c.RelationSchema("", path)
+	viewName := path
+	split := strings.Split(path, ".")
+	if len(split) > 1 {
+		schemaName = split[0]
+		viewName = split[1]
+	}
+	schema, ok := c.Catalog.Schemas.Get(schemaName)
+	require.True(t, ok)
+	view, ok := schema.Views.Get(viewName)
+	require.True(t, ok, "no view with name %s found", viewName)
+	return view
+}
+
+const createOrdersTables = `
+CREATE TABLE customers (
+	id bigserial primary key,
+	name text not null
+);
+
+CREATE TABLE orders (
+	id bigserial primary key,
+	customer_id bigint not null references customers (id),
+	total numeric(10, 2) not null,
+	placed_at timestamptz not null default now()
+);
+`
+
+func TestCompiler_CreateView(t *testing.T) {
+	const sql = `
+	CREATE VIEW customer_totals AS
+		SELECT c.id, c.name AS customer, count(*), sum(o.total) AS spent, max(o.placed_at) AS last_order, 'x'::text AS tag
+		FROM customers c
+		JOIN orders o ON o.customer_id = c.id
+		GROUP BY c.id, customer;
+
+	CREATE VIEW big_spenders (customer_id, customer_name) AS
+		WITH ranked AS (SELECT id, customer, spent FROM customer_totals)
+		SELECT id, customer FROM ranked WHERE spent > 1000;
+
+	CREATE MATERIALIZED VIEW all_orders AS SELECT * FROM orders WITH NO DATA;
+	`
+	c := assertParse(t, joinNewline(createOrdersTables, sql))
+	customers := assertTable(t, c, "customers")
+	orders := assertTable(t, c, "orders")
+	customerId, _ := customers.Columns.Get("id")
+	customerName, _ := customers.Columns.Get("name")
+
+	totals := assertView(t, c, "customer_totals")
+	assert.False(t, totals.Materialized)
+	assert.Equal(t, []*ViewColumn{
+		{Name: "id", Type: Bigint, Source: customerId},
+		{Name: "customer", Type: Text, Source: customerName},
+		{Name: "count", Type: Bigint},
+		{Name: "spent", Type: Numeric},
+		{Name: "last_order", Type: Timestamptz},
+		{Name: "tag", Type: Text},
+	}, totals.Columns)
+	assert.ElementsMatch(t, []*Table{customers, orders}, totals.Tables)
+	assert.Contains(t, totals.Query, "FROM customers c JOIN orders o ON o.customer_id = c.id")
+
+	spenders := assertView(t, c, "big_spenders")
+	assert.Equal(t, []*ViewColumn{
+		{Name: "customer_id", Type: Bigint, Source: customerId},
+		{Name: "customer_name", Type: Text, Source: customerName},
+	}, spenders.Columns)
+	assert.Equal(t, []*View{totals}, spenders.Views)
+	assert.Empty(t, spenders.Tables)
+
+	all := assertView(t, c, "all_orders")
+	assert.True(t, all.Materialized)
+	assert.Equal(t, []string{"id", "customer_id", "total", "placed_at"}, lo.Map(all.Columns, func(item *ViewColumn, index int) string {
+		return item.Name
+	}))
+}
+
+func TestCompiler_CreateOrReplaceView(t *testing.T) {
+	const sql = `
+	CREATE VIEW names AS SELECT id FROM customers;
+	CREATE OR REPLACE VIEW names AS SELECT id, name FROM customers;
+	`
+	c := assertParse(t, joinNewline(createOrdersTables, sql))
+	names := assertView(t, c, "names")
+	assert.Len(t, names.Columns, 2)
+
+	assertParseError(t, joinNewline(createOrdersTables, sql, `CREATE OR REPLACE VIEW names AS SELECT name, id FROM customers;`),
+		"cannot change name of view column id to name")
+	assertParseError(t, joinNewline(createOrdersTables, sql, `CREATE VIEW names AS SELECT 1;`),
+		"relation already exists: names")
+	assertParseError(t, joinNewline(createOrdersTables, `CREATE VIEW broken AS SELECT missing FROM customers;`),
+		"column missing does not exist")
+}
+
+func TestCompiler_DropView(t *testing.T) {
+	const views = `
+	CREATE VIEW customer_names AS SELECT id, name FROM customers;
+	CREATE VIEW customer_ids AS SELECT id FROM customer_names;
+	`
+	assertParseError(t, joinNewline(createOrdersTables, views, `DROP VIEW customer_names;`),
+		"can't drop view customer_names because view customer_ids depends on it")
+	assertParseError(t, joinNewline(createOrdersTables, views, `ALTER TABLE customers DROP COLUMN name;`),
+		"can't drop column name because view customer_names depends on it")
+	assertParseError(t, joinNewline(createOrdersTables, views, `DROP MATERIALIZED VIEW customer_names;`),
+		"customer_names is not a materialized view")
+
+	c := assertParse(t, joinNewline(createOrdersTables, views, `
+	ALTER TABLE customers DROP COLUMN name CASCADE;
+	DROP VIEW IF EXISTS customer_names;
+	`))
+	sch, _ := c.Catalog.Schemas.Get("public")
+	assert.Len(t, sch.Views.List(), 0)
+
+	c = assertParse(t, joinNewline(createOrdersTables, views, `
+	DROP TABLE orders;
+	DROP TABLE customers CASCADE;
+	`))
+	sch, _ = c.Catalog.Schemas.Get("public")
+	assert.Len(t, sch.Views.List(), 0)
+	assert.Len(t, sch.Tables.List(), 0)
+}
+
+func TestCompiler_CreateTableAs(t *testing.T) {
+	const sql = `CREATE TABLE order_summary AS SELECT customer_id, sum(total) AS total FROM orders GROUP BY customer_id;`
+	c := assertParse(t, joinNewline(createOrdersTables, sql))
+	tab := assertTable(t, c, "order_summary")
+	assertColumn(t, tab, "customer_id", Bigint, ColumnAttributes{})
+	assertColumn(t, tab, "total", Numeric, ColumnAttributes{})
+
+	// A serial column gives its integer type, without a sequence
+	c = assertParse(t, joinNewline(createOrdersTables, `CREATE TABLE order_ids AS SELECT id FROM orders;`))
+	assertColumn(t, assertTable(t, c, "order_ids"), "id", Bigint, ColumnAttributes{})
+	_, err := c.FindSequence("public", "order_ids_id_seq")
+	assert.Error(t, err)
+}
+
+func assertSequence(t *testing.T, c *Compiler, name string) *Sequence {
+	t.Helper()
+	schemaName, seqName := "", name
+	if split := strings.Split(name, "."); len(split) > 1 {
+		schemaName, seqName = split[0], split[1]
+	}
+	seq, err := c.FindSequence(schemaName, seqName)
+	assert.NoError(t, err)
+	if seq == nil {
+		t.FailNow()
+	}
+	return seq
+}
+
+func TestCompiler_SerialCreatesSequence(t *testing.T) {
+	c := assertParse(t, createUsersTable)
+	tab := assertTable(t, c, "users")
+	id, _ := tab.Columns.Get("id")
+
+	seq := assertSequence(t, c, "users_id_seq")
+	assert.Equal(t, Integer, seq.Type)
+	assert.Equal(t, int64(1), seq.Start)
+	assert.Equal(t, int64(math.MaxInt32), seq.MaxValue)
+	assert.Same(t, id, seq.OwnedBy)
+
+	assertParseError(t, joinNewline(createUsersTable, `CREATE SEQUENCE users_id_seq;`),
+		"relation users_id_seq already exists")
+}
+
+func TestCompiler_CreateSequence(t *testing.T) {
+	const sql = `
+	CREATE SEQUENCE counter AS smallint INCREMENT BY -2 CACHE 10 CYCLE;
+	CREATE SEQUENCE IF NOT EXISTS counter;
+	CREATE SEQUENCE big START 100 MINVALUE 10 MAXVALUE 1000;
+	`
+	c := assertParse(t, sql)
+	counter := assertSequence(t, c, "counter")
+	assert.Equal(t, Smallint, counter.Type)
+	assert.Equal(t, int64(-2), counter.Increment)
+	assert.Equal(t, int64(math.MinInt16), counter.MinValue)
+	assert.Equal(t, int64(-1), counter.MaxValue)
+	assert.Equal(t, int64(-1), counter.Start)
+	assert.Equal(t, int64(10), counter.Cache)
+	assert.True(t, counter.Cycle)
+
+	big := assertSequence(t, c, "big")
+	assert.Equal(t, Bigint, big.Type)
+	assert.Equal(t, int64(100), big.Start)
+	assert.Equal(t, int64(10), big.MinValue)
+	assert.Equal(t, int64(1000), big.MaxValue)
+
+	assertParseError(t, `CREATE SEQUENCE bad AS text;`, "sequence type must be smallint, integer, or bigint")
+	assertParseError(t, `CREATE SEQUENCE bad INCREMENT 0;`, "INCREMENT must not be zero")
+	assertParseError(t, `CREATE SEQUENCE bad MINVALUE 10 MAXVALUE 5;`, "MINVALUE (10) must be less than MAXVALUE (5)")
+	assertParseError(t, `CREATE SEQUENCE bad START 5 MINVALUE 10;`, "START value (5) cannot be less than MINVALUE (10)")
+	assertParseError(t, `CREATE SEQUENCE bad AS smallint MAXVALUE 100000;`, "MAXVALUE (100000) is out of range for sequence data type smallint")
+}
+
+func TestCompiler_AlterSequence(t *testing.T) {
+	const sql = `
+	CREATE SEQUENCE counter;
+	CREATE TABLE things (id integer DEFAULT nextval('counter'));
+	ALTER SEQUENCE counter AS integer INCREMENT 5 OWNED BY things.id;
+	`
+	c := assertParse(t, sql)
+	counter := assertSequence(t, c, "counter")
+	assert.Equal(t, Integer, counter.Type)
+	assert.Equal(t, int64(5), counter.Increment)
+	assert.Equal(t, int64(math.MaxInt32), counter.MaxValue)
+	tab := assertTable(t, c, "things")
+	id := assertColumn(t, tab, "id", Integer, ColumnAttributes{
+		HasSequence:        true,
+		SequenceName:       "counter",
+		HasExplicitDefault: true,
+		ColumnDefault:      `nextval("counter")`,
+	})
+	assert.Same(t, id, counter.OwnedBy)
+
+	c = assertParse(t, joinNewline(sql, `ALTER SEQUENCE counter OWNED BY NONE;`))
+	assert.Nil(t, assertSequence(t, c, "counter").OwnedBy)
+
+	// NO MINVALUE and NO MAXVALUE go back to the defaults for the type and direction
+	c = assertParse(t, `CREATE SEQUENCE s MINVALUE 5 MAXVALUE 100;
+	ALTER SEQUENCE s NO MINVALUE NO MAXVALUE;
+	CREATE SEQUENCE d INCREMENT -1 MINVALUE -100 MAXVALUE -5;
+	ALTER SEQUENCE d NO MINVALUE;`)
+	s := assertSequence(t, c, "s")
+	assert.Equal(t, int64(1), s.MinValue)
+	assert.Equal(t, int64(math.MaxInt64), s.MaxValue)
+	assert.Equal(t, int64(5), s.Start)
+	d := assertSequence(t, c, "d")
+	assert.Equal(t, int64(math.MinInt64), d.MinValue)
+	assert.Equal(t, int64(-5), d.MaxValue)
+
+	// Changing direction keeps the bounds; changing type resets those
+	// that were the limits of the old type
+	c = assertParse(t, `CREATE SEQUENCE up;
+	ALTER SEQUENCE up INCREMENT -1;
+	CREATE SEQUENCE down INCREMENT -1;
+	ALTER SEQUENCE down AS integer;`)
+	up := assertSequence(t, c, "up")
+	assert.Equal(t, int64(-1), up.Increment)
+	assert.Equal(t, int64(1), up.MinValue)
+	assert.Equal(t, int64(math.MaxInt64), up.MaxValue)
+	down := assertSequence(t, c, "down")
+	assert.Equal(t, int64(math.MinInt32), down.MinValue)
+	assert.Equal(t, int64(-1), down.MaxValue)
+
+	assertParseError(t, `ALTER SEQUENCE missing RESTART;`, "sequence missing not found")
+	assertParse(t, `ALTER SEQUENCE IF EXISTS missing RESTART;`)
+	assertParseError(t, `CREATE TABLE things (id integer DEFAULT nextval('missing'::regclass));`, "sequence missing not found")
+}
+
+func TestCompiler_DropSequence(t *testing.T) {
+	const sql = `
+	CREATE SEQUENCE counter;
+	CREATE TABLE things (id integer DEFAULT nextval('counter'::regclass));
+	`
+	assertParseError(t, joinNewline(sql, `DROP SEQUENCE counter;`),
+		"can't drop sequence counter because default value for column id of table things depends on it")
+
+	c := assertParse(t, joinNewline(sql, `DROP SEQUENCE counter CASCADE; DROP SEQUENCE IF EXISTS counter;`))
+	tab := assertTable(t, c, "things")
+	assertColumn(t, tab, "id", Integer, ColumnAttributes{})
+
+	c = assertParse(t, joinNewline(createUsersTable, `ALTER TABLE users DROP COLUMN id;`))
+	_, err := c.FindSequence("", "users_id_seq")
+	assert.Error(t, err)
+
+	c = assertParse(t, joinNewline(createUsersTable, `DROP TABLE users;`))
+	_, err = c.FindSequence("", "users_id_seq")
+	assert.Error(t, err)
+
+	// An owned sequence that other columns' defaults use is only dropped
+	// with its column if the drop cascades
+	shared := joinNewline(createUsersTable, `CREATE TABLE other (n int DEFAULT nextval('users_id_seq'));`)
+	assertParseError(t, joinNewline(shared, `ALTER TABLE users DROP COLUMN id;`),
+		"can't drop sequence users_id_seq owned by column id because default value for column n of table other depends on it")
+	assertParseError(t, joinNewline(shared, `DROP TABLE users;`),
+		"can't drop sequence users_id_seq owned by column id because default value for column n of table other depends on it")
+	c = assertParse(t, joinNewline(shared, `DROP TABLE users CASCADE;`))
+	assertColumn(t, assertTable(t, c, "other"), "n", Integer, ColumnAttributes{})
+	_, err = c.FindSequence("", "users_id_seq")
+	assert.Error(t, err)
+}
+
+func TestCompiler_IdentityCreatesSequence(t *testing.T) {
+	const sql = `CREATE TABLE things (id bigint GENERATED ALWAYS AS IDENTITY (START WITH 10 SEQUENCE NAME thing_ids));`
+	c := assertParse(t, sql)
+	seq := assertSequence(t, c, "thing_ids")
+	assert.Equal(t, Bigint, seq.Type)
+	assert.Equal(t, int64(10), seq.Start)
+
+	assertParseError(t, `CREATE TABLE things (id text GENERATED ALWAYS AS IDENTITY);`,
+		"identity column type must be smallint, integer, or bigint")
+}
+
+func TestCompiler_RenameColumn(t *testing.T) {
+	c := assertParse(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME COLUMN username TO login;`))
+	users := assertTable(t, c, "users")
+	assert.Equal(t, []string{"id", "login", "email", "created_at"}, Columns(users.Columns.List()).Names())
+	login := assertColumn(t, users, "login", CharacterVarying, ColumnAttributes{NotNull: true, Modifiers: TypeModifiers{Length: 50}})
+	assertConstraints(t, c, login, Constraint{
+		Table:      users,
+		Name:       "users_username_key",
+		Type:       ConstraintTypeUnique,
+		Constrains: Columns{login},
+	})
+
+	assertParseError(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME COLUMN username TO email;`),
+		"column email of relation users already exists")
+	assertParseError(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME COLUMN missing TO other;`),
+		"column missing does not exist")
+
+	// Expressions that use the column refer to it by its new name
+	c = assertParse(t, `
+	CREATE TABLE items (id int, name text CHECK (length(name) > 0), price numeric) PARTITION BY LIST (lower(name));
+	CREATE INDEX items_lower_name_idx ON items (lower(name)) WHERE name <> '' AND price > 0;
+	ALTER TABLE items RENAME COLUMN name TO title;`)
+	items := assertTable(t, c, "items")
+	assert.Equal(t, "length(title) > 0", c.Catalog.PgConstraint.ByName[ConstraintFQName(items, "items_name_check")].Expression)
+	idx := assertIndex(t, c, "items_lower_name_idx")
+	assert.Equal(t, "lower(title)", idx.Keys[0].Expression)
+	assert.Equal(t, "title <> '' AND price > 0", idx.Predicate)
+	assert.Equal(t, "lower(title)", items.PartitionKey.Keys[0].Expression)
+
+	// So do the queries of views, whose columns keep their names
+	c = assertParse(t, `
+	CREATE TABLE items (id int, name text, price numeric);
+	CREATE VIEW named AS SELECT i.name, upper(name) AS shout FROM items i WHERE name <> '' ORDER BY name;
+	CREATE VIEW everything AS SELECT * FROM items;
+	CREATE VIEW aliased AS SELECT x.b FROM items AS x (a, b) WHERE x.a > 0;
+	CREATE VIEW nested AS SELECT name FROM (SELECT name FROM items) s;
+	ALTER TABLE items RENAME COLUMN name TO title;`)
+	assert.Equal(t, "SELECT i.title AS name, upper(title) AS shout FROM items i WHERE title <> '' ORDER BY title",
+		assertView(t, c, "named").Query)
+	assert.Equal(t, "SELECT items.id, items.title AS name, items.price FROM items", assertView(t, c, "everything").Query)
+	assert.Equal(t, "SELECT x.b FROM items x(a, b) WHERE x.a > 0", assertView(t, c, "aliased").Query)
+	assert.Equal(t, "SELECT name FROM (SELECT title AS name FROM items) s", assertView(t, c, "nested").Query)
+	assert.Equal(t, []string{"id", "name", "price"}, lo.Map(assertView(t, c, "everything").Columns, func(col *ViewColumn, _ int) string { return col.Name }))
+}
+
+func TestCompiler_RenameConstraint(t *testing.T) {
+	c := assertParse(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME CONSTRAINT users_username_key TO users_login_key;`))
+	users := assertTable(t, c, "users")
+	con, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(users, "users_login_key")]
+	assert.True(t, ok)
+	assert.Equal(t, "users_login_key", con.Name)
+	_, ok = c.Catalog.PgConstraint.ByName[ConstraintFQName(users, "users_username_key")]
+	assert.False(t, ok)
+	assertIndex(t, c, "users_login_key")
+
+	assertParseError(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME CONSTRAINT users_username_key TO users_pkey;`),
+		"constraint users_pkey for relation users already exists")
+	assertParseError(t, joinNewline(createUsersTable, `ALTER TABLE users RENAME CONSTRAINT missing TO other;`),
+		"constraint missing for table users does not exist")
+}
+
+func TestCompiler_RenameSchema(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA app;
+	CREATE TYPE app.mood AS ENUM ('happy', 'sad');
+	CREATE TABLE app.people (id serial PRIMARY KEY, mood app.mood);
+	CREATE TABLE refs (id int DEFAULT nextval('app.people_id_seq') REFERENCES app.people (id));
+	ALTER SCHEMA app RENAME TO application;
+	`
+	c := assertParse(t, sql)
+	_, ok := c.Catalog.Schemas.Get("app")
+	assert.False(t, ok)
+	people := assertTable(t, c, "application.people")
+	assert.Equal(t, "application", people.Schema)
+	assert.Equal(t, "application.mood", people.Columns.List()[1].Type.Name)
+	assertSequence(t, c, "application.people_id_seq")
+	refs := assertTable(t, c, "refs")
+	id, _ := refs.Columns.Get("id")
+	assert.Equal(t, "application.people_id_seq", id.Attrs.SequenceName)
+	_, ok = c.Catalog.PgConstraint.ByName[ConstraintFQName(people, "people_pkey")]
+	assert.True(t, ok)
+
+	assertParse(t, joinNewline(sql, `CREATE TABLE application.other (m application.mood);`))
+
+	// The queries of views that use relations in the schema refer to it by
+	// its new name, so that later renames can rewrite them again
+	c = assertParse(t, joinNewline(sql, `
+	CREATE VIEW app_people AS SELECT application.people.id, p.mood FROM application.people JOIN application.people p USING (id);
+	SET search_path = application, public;
+	CREATE VIEW app_ids AS SELECT people.id FROM people;
+	ALTER SCHEMA application RENAME TO app;
+	ALTER TABLE app.people RENAME TO persons;`))
+	assert.Equal(t, "SELECT app.persons.id, p.mood FROM app.persons JOIN app.persons p USING (id)",
+		assertView(t, c, "public.app_people").Query)
+	assert.Equal(t, "SELECT persons.id FROM app.persons", assertView(t, c, "app.app_ids").Query)
+
+	assertParseError(t, joinNewline(sql, `CREATE SCHEMA app; ALTER SCHEMA app RENAME TO application;`),
+		"schema application already exists")
+}
+
+func TestCompiler_RenameObjects(t *testing.T) {
+	const sql = `
+	CREATE TYPE mood AS ENUM ('happy', 'sad');
+	CREATE SEQUENCE counter;
+	CREATE TABLE things (id int DEFAULT nextval('counter'), m mood);
+	CREATE VIEW thing_ids AS SELECT id FROM things;
+	ALTER TYPE mood RENAME TO feeling;
+	ALTER SEQUENCE counter RENAME TO thing_counter;
+	ALTER VIEW thing_ids RENAME TO ids;
+	ALTER VIEW ids RENAME COLUMN id TO thing_id;
+	`
+	c := assertParse(t, sql)
+	things := assertTable(t, c, "things")
+	assert.Equal(t, "feeling", things.Columns.List()[1].Type.Name)
+	assertSequence(t, c, "thing_counter")
+	assertColumn(t, things, "id", Integer, ColumnAttributes{
+		HasSequence:        true,
+		SequenceName:       "thing_counter",
+		HasExplicitDefault: true,
+		ColumnDefault:      `nextval("thing_counter")`,
+	})
+	ids := assertView(t, c, "ids")
+	assert.Equal(t, "thing_id", ids.Columns[0].Name)
+
+	assertParseError(t, joinNewline(sql, `ALTER SEQUENCE thing_counter RENAME TO things;`),
+		"relation things already exists in schema public")
+	assertParseError(t, joinNewline(sql, `CREATE TYPE mood AS ENUM ('x'); ALTER TYPE mood RENAME TO feeling;`),
+		"type feeling already exists")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE things RENAME TO ids;`),
+		"relation ids already exists in schema public")
+
+	// The queries of views that use a renamed view or view column refer to
+	// it by its new name, so that later renames can rewrite them again
+	c = assertParse(t, `
+	CREATE TABLE t (a int);
+	CREATE VIEW v1 AS SELECT a FROM t;
+	CREATE VIEW v3 AS SELECT v1.a FROM v1 JOIN t ON true;
+	ALTER VIEW v1 RENAME TO v2;
+	ALTER TABLE t RENAME TO t2;`)
+	assert.Equal(t, "SELECT v2.a FROM v2 JOIN t2 ON true", assertView(t, c, "v3").Query)
+	c = assertParse(t, `
+	CREATE TABLE t (a int);
+	CREATE VIEW v1 AS SELECT a FROM t;
+	CREATE VIEW v3 AS SELECT a, v1.a AS b FROM v1 WHERE v1.a > 0;
+	ALTER VIEW v1 RENAME COLUMN a TO c;
+	ALTER TABLE t RENAME COLUMN a TO d;`)
+	assert.Equal(t, "SELECT c AS a, v1.c AS b FROM v1 WHERE v1.c > 0", assertView(t, c, "v3").Query)
+	assert.Equal(t, "SELECT d AS a FROM t", assertView(t, c, "v1").Query)
+}
+
+func TestCompiler_CheckConstraints(t *testing.T) {
+	const sql = `
+	CREATE TABLE products (
+		price numeric CHECK (price > 0),
+		discount numeric CONSTRAINT sane_discount CHECK (discount >= 0) NO INHERIT,
+		CHECK (discount < price),
+		CHECK (true)
+	);
+	ALTER TABLE products ADD CHECK (price < 1000) NOT VALID;
+	`
+	c := assertParse(t, sql)
+	products := assertTable(t, c, "products")
+	price, _ := products.Columns.Get("price")
+	discount, _ := products.Columns.Get("discount")
+
+	cons := c.Catalog.TableConstraints(products)
+	assert.Equal(t, []string{"products_check", "products_check1", "products_price_check", "products_price_check1", "sane_discount"},
+		lo.Map(cons, func(item *Constraint, index int) string { return item.Name }))
+	byName := c.Catalog.PgConstraint.ByName
+	assert.Equal(t, &Constraint{
+		Table:      products,
+		Name:       "products_check",
+		Type:       ConstraintTypeCheck,
+		Constrains: Columns{discount, price},
+		Expression: "discount < price",
+	}, byName[ConstraintFQName(products, "products_check")])
+	assert.Empty(t, byName[ConstraintFQName(products, "products_check1")].Constrains)
+	assert.Equal(t, "price > 0", byName[ConstraintFQName(products, "products_price_check")].Expression)
+	assert.True(t, byName[ConstraintFQName(products, "products_price_check1")].NotValid)
+	assert.True(t, byName[ConstraintFQName(products, "sane_discount")].NoInherit)
+
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE products VALIDATE CONSTRAINT products_price_check1;`))
+	products = assertTable(t, c, "products")
+	assert.False(t, c.Catalog.PgConstraint.ByName[ConstraintFQName(products, "products_price_check1")].NotValid)
+
+	// Dropping a column drops the checks that reference it
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE products DROP COLUMN discount;`))
+	products = assertTable(t, c, "products")
+	assert.Equal(t, []string{"products_check1", "products_price_check", "products_price_check1"},
+		lo.Map(c.Catalog.TableConstraints(products), func(item *Constraint, index int) string { return item.Name }))
+
+	c = assertParse(t, joinNewline(sql, `DROP TABLE products;`))
+	assert.Empty(t, c.Catalog.PgConstraint.ByName)
+
+	assertParseError(t, `CREATE TABLE t (a int CHECK (b > 0));`, "column b not found")
+	assertParseError(t, `CREATE TABLE t (a int CHECK (a > (SELECT 1)));`, "cannot use subquery in check constraint")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE products ADD CONSTRAINT sane_discount CHECK (discount < 100);`),
+		"constraint sane_discount for relation products already exists")
+}
+
+func TestCompiler_ForeignKeyActions(t *testing.T) {
+	const sql = `
+	CREATE TABLE parents (id int PRIMARY KEY, tenant int, UNIQUE (id, tenant));
+	CREATE TABLE children (
+		parent_id int REFERENCES parents ON DELETE CASCADE ON UPDATE RESTRICT DEFERRABLE INITIALLY DEFERRED,
+		tenant int,
+		other_id int,
+		FOREIGN KEY (other_id, tenant) REFERENCES parents (id, tenant) MATCH FULL ON DELETE SET NULL (other_id) ON UPDATE SET DEFAULT
+	);
+	`
+	c := assertParse(t, sql)
+	parents := assertTable(t, c, "parents")
+	children := assertTable(t, c, "children")
+	byName := c.Catalog.PgConstraint.ByName
+
+	parentFk := byName[ConstraintFQName(children, "children_parent_id_fkey")]
+	assert.Equal(t, ForeignKeyActionCascade, parentFk.OnDelete)
+	assert.Equal(t, ForeignKeyActionRestrict, parentFk.OnUpdate)
+	assert.Equal(t, ForeignKeyMatchSimple, parentFk.Match)
+	assert.True(t, parentFk.Deferrable)
+	assert.True(t, parentFk.InitiallyDeferred)
+
+	otherId, _ := children.Columns.Get("other_id")
+	otherFk := byName[ConstraintFQName(children, "children_other_id_tenant_fkey")]
+	assert.Same(t, parents, otherFk.RefersTable)
+	assert.Equal(t, ForeignKeyActionSetNull, otherFk.OnDelete)
+	assert.Equal(t, Columns{otherId}, otherFk.OnDeleteColumns)
+	assert.Equal(t, ForeignKeyActionSetDefault, otherFk.OnUpdate)
+	assert.Equal(t, ForeignKeyMatchFull, otherFk.Match)
+	assert.False(t, otherFk.Deferrable)
+
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TABLE children ALTER CONSTRAINT children_parent_id_fkey NOT DEFERRABLE;
+	ALTER TABLE children ALTER CONSTRAINT children_other_id_tenant_fkey DEFERRABLE;
+	`))
+	children = assertTable(t, c, "children")
+	parentFk = c.Catalog.PgConstraint.ByName[ConstraintFQName(children, "children_parent_id_fkey")]
+	assert.False(t, parentFk.Deferrable)
+	assert.False(t, parentFk.InitiallyDeferred)
+	assert.True(t, c.Catalog.PgConstraint.ByName[ConstraintFQName(children, "children_other_id_tenant_fkey")].Deferrable)
+
+	c = assertParse(t, `CREATE TABLE things (id int UNIQUE INITIALLY DEFERRED);`)
+	things := assertTable(t, c, "things")
+	assert.True(t, c.Catalog.PgConstraint.ByName[ConstraintFQName(things, "things_id_key")].Deferrable)
+
+	assertParseError(t, joinNewline(sql, `ALTER TABLE parents ALTER CONSTRAINT parents_pkey DEFERRABLE;`),
+		"constraint parents_pkey of relation parents is not a foreign key constraint")
+	assertParseError(t, `CREATE TABLE things (id int NOT NULL DEFERRABLE);`, "misplaced DEFERRABLE clause")
+	assertParseError(t, `CREATE TABLE things (id int UNIQUE NOT DEFERRABLE INITIALLY DEFERRED);`,
+		"constraint declared INITIALLY DEFERRED must be DEFERRABLE")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE children ADD FOREIGN KEY (other_id) REFERENCES parents ON DELETE SET NULL (tenant);`),
+		"column tenant referenced in ON DELETE SET action must be part of foreign key")
+}
+
+func TestCompiler_GeneratedColumns(t *testing.T) {
+	const sql = `
+	CREATE TABLE boxes (
+		id bigint GENERATED BY DEFAULT AS IDENTITY (INCREMENT BY 10) PRIMARY KEY,
+		area numeric GENERATED ALWAYS AS (width * height) STORED NOT NULL,
+		width numeric NOT NULL,
+		height numeric NOT NULL
+	);
+	`
+	c := assertParse(t, sql)
+	boxes := assertTable(t, c, "boxes")
+	seq := assertSequence(t, c, "boxes_id_seq")
+	assert.Equal(t, int64(10), seq.Increment)
+	id := assertColumn(t, boxes, "id", Bigint, ColumnAttributes{
+		NotNull:          true,
+		Pkey:             true,
+		HasSequence:      true,
+		SequenceName:     "boxes_id_seq",
+		Identity:         IdentityByDefault,
+		IdentitySequence: seq,
+	})
+	assert.False(t, id.Attrs.IsRequired())
+	width, _ := boxes.Columns.Get("width")
+	height, _ := boxes.Columns.Get("height")
+	area := assertColumn(t, boxes, "area", Numeric, ColumnAttributes{NotNull: true, GeneratedExpression: "width * height",
+		GeneratedFrom: Columns{width, height}})
+	assert.False(t, area.Attrs.IsRequired())
+	assert.Empty(t, c.Catalog.TableConstraints(boxes)[1:])
+
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TABLE boxes ALTER COLUMN id SET GENERATED ALWAYS SET INCREMENT BY 5;
+	ALTER TABLE boxes ALTER COLUMN area DROP EXPRESSION;
+	`))
+	boxes = assertTable(t, c, "boxes")
+	id, _ = boxes.Columns.Get("id")
+	assert.Equal(t, IdentityAlways, id.Attrs.Identity)
+	assert.Equal(t, int64(5), id.Attrs.IdentitySequence.Increment)
+	area, _ = boxes.Columns.Get("area")
+	assert.True(t, area.Attrs.IsRequired())
+
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TABLE boxes ALTER COLUMN id DROP IDENTITY;
+	ALTER TABLE boxes ALTER COLUMN id DROP IDENTITY IF EXISTS;
+	ALTER TABLE boxes ADD COLUMN serial_no int NOT NULL;
+	ALTER TABLE boxes ALTER COLUMN serial_no ADD GENERATED ALWAYS AS IDENTITY;
+	`))
+	boxes = assertTable(t, c, "boxes")
+	assertColumn(t, boxes, "id", Bigint, ColumnAttributes{NotNull: true, Pkey: true})
+	_, err := c.FindSequence("", "boxes_id_seq")
+	assert.Error(t, err)
+	serialNo, _ := boxes.Columns.Get("serial_no")
+	assert.Equal(t, IdentityAlways, serialNo.Attrs.Identity)
+	assert.Same(t, assertSequence(t, c, "boxes_serial_no_seq"), serialNo.Attrs.IdentitySequence)
+
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes DROP COLUMN width;`),
+		"can't drop width because column area depends on it")
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE boxes DROP COLUMN width CASCADE;`))
+	assert.Equal(t, []string{"id", "height"}, Columns(assertTable(t, c, "boxes").Columns.List()).Names())
+
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ALTER COLUMN height TYPE int;`),
+		"cannot alter type of a column used by a generated column")
+
+	// A renamed column is still found in the expressions that use it
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE boxes RENAME COLUMN width TO w;`))
+	area, _ = assertTable(t, c, "boxes").Columns.Get("area")
+	assert.Equal(t, "w * height", area.Attrs.GeneratedExpression)
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes RENAME COLUMN width TO w; ALTER TABLE boxes DROP COLUMN w;`),
+		"can't drop w because column area depends on it")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes RENAME COLUMN height TO h; ALTER TABLE boxes ALTER COLUMN h TYPE int;`),
+		"cannot alter type of a column used by a generated column")
+
+	// Partitions use their own columns
+	c = assertParse(t, `
+	CREATE TABLE sizes (kind text, width numeric, height numeric, area numeric GENERATED ALWAYS AS (width * height) STORED) PARTITION BY LIST (kind);
+	CREATE TABLE sizes_small PARTITION OF sizes FOR VALUES IN ('small');`)
+	small := assertTable(t, c, "sizes_small")
+	smallWidth, _ := small.Columns.Get("width")
+	smallHeight, _ := small.Columns.Get("height")
+	smallArea, _ := small.Columns.Get("area")
+	assert.Equal(t, Columns{smallWidth, smallHeight}, smallArea.Attrs.GeneratedFrom)
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ADD COLUMN perimeter numeric GENERATED ALWAYS AS (area * 2) STORED;`),
+		"cannot use generated column area in column generation expression")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ADD COLUMN x int DEFAULT 1 GENERATED ALWAYS AS (1) STORED;`),
+		"both default and generation expression specified for column x of table boxes")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY;`),
+		"column id of relation boxes is already an identity column")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ADD COLUMN n int; ALTER TABLE boxes ALTER COLUMN n ADD GENERATED ALWAYS AS IDENTITY;`),
+		"column n of relation boxes must be declared NOT NULL before identity can be added")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ALTER COLUMN height DROP IDENTITY;`),
+		"column height of relation boxes is not an identity column")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ALTER COLUMN height DROP EXPRESSION;`),
+		"column height of relation boxes is not a stored generated column")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE boxes ADD COLUMN n int GENERATED ALWAYS AS IDENTITY; ALTER TABLE boxes ALTER COLUMN n DROP NOT NULL;`),
+		"column n of relation boxes is an identity column")
+	assertParseError(t, joinNewline(sql, `DROP SEQUENCE boxes_id_seq CASCADE;`),
+		"can't drop sequence boxes_id_seq because column id of table boxes requires it")
+}
+
+func assertType(t *testing.T, reg *TypeRegistry, name string) *PostgresType {
+	t.Helper()
+	typ, err := reg.MatchType(name)
+	require.NoError(t, err)
+	return typ
+}
+
+func TestCompiler_ArrayTypes(t *testing.T) {
+	const sql = `
+	CREATE TYPE mood AS ENUM ('happy', 'sad');
+	CREATE TABLE posts (
+		tags text[] NOT NULL,
+		grid integer[][],
+		scores int ARRAY[3],
+		moods mood[],
+		plain text
+	);
+	CREATE VIEW post_tags AS SELECT tags, tags[1] AS first_tag, tags[1:2] AS some_tags, ARRAY[plain] AS wrapped, array_agg(plain) AS all_plain FROM posts GROUP BY tags;
+	`
+	c := assertParse(t, sql)
+	reg := c.TypeRegistry
+	posts := assertTable(t, c, "posts")
+	tags := assertColumn(t, posts, "tags", reg.ArrayOf(Text, 1), ColumnAttributes{NotNull: true})
+	assert.Equal(t, "text[]", tags.Type.Name)
+	assert.Same(t, Text, tags.Type.ElementType)
+	grid := assertColumn(t, posts, "grid", reg.ArrayOf(Integer, 2), ColumnAttributes{})
+	assert.Equal(t, "integer[][]", grid.Type.Name)
+	assert.Equal(t, 2, grid.Type.Dimensions)
+	assertColumn(t, posts, "scores", reg.ArrayOf(Integer, 1), ColumnAttributes{})
+	moods := assertColumn(t, posts, "moods", reg.ArrayOf(assertType(t, reg, "mood"), 1), ColumnAttributes{})
+	assert.Equal(t, []string{"happy", "sad"}, moods.Type.ElementType.EnumValues)
+	assert.Same(t, reg.ArrayOf(Text, 1), assertType(t, reg, "text[]"))
+
+	view := assertView(t, c, "post_tags")
+	assert.Equal(t, []*PostgresType{reg.ArrayOf(Text, 1), Text, reg.ArrayOf(Text, 1), reg.ArrayOf(Text, 1), reg.ArrayOf(Text, 1)},
+		lo.Map(view.Columns, func(item *ViewColumn, index int) *PostgresType { return item.Type }))
+
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE posts ALTER COLUMN grid TYPE bigint[];`))
+	assertColumn(t, assertTable(t, c, "posts"), "grid", c.TypeRegistry.ArrayOf(Bigint, 1), ColumnAttributes{})
+	c = assertParse(t, joinNewline(sql, `DROP VIEW post_tags; ALTER TYPE mood RENAME TO feeling;`))
+	moods, _ = assertTable(t, c, "posts").Columns.Get("moods")
+	assert.Equal(t, "feeling[]", moods.Type.Name)
+
+	assertParseError(t, joinNewline(sql, `DROP VIEW post_tags; ALTER TABLE posts ALTER COLUMN tags TYPE text;`), "can't cast from type text[] to type text")
+	assertParseError(t, `CREATE TABLE t (ids serial[]);`, "array of serial is not implemented")
+}
+
+func TestCompiler_TypeModifiers(t *testing.T) {
+	const sql = `
+	CREATE TABLE measurements (
+		code char,
+		label varchar(50),
+		notes character varying,
+		amount numeric(10,2),
+		ratio decimal(5),
+		elapsed interval DAY TO SECOND(3),
+		span interval YEAR,
+		taken_at timestamp(0) with time zone,
+		flags varbit(8)
+	);
+	`
+	c := assertParse(t, sql)
+	tab := assertTable(t, c, "measurements")
+	assertColumn(t, tab, "code", Character, ColumnAttributes{Modifiers: TypeModifiers{Length: 1}})
+	assertColumn(t, tab, "label", CharacterVarying, ColumnAttributes{Modifiers: TypeModifiers{Length: 50}})
+	assertColumn(t, tab, "notes", CharacterVarying, ColumnAttributes{})
+	assertColumn(t, tab, "amount", Numeric, ColumnAttributes{Modifiers: TypeModifiers{Precision: 10, Scale: 2, HasPrecision: true}})
+	assertColumn(t, tab, "ratio", Numeric, ColumnAttributes{Modifiers: TypeModifiers{Precision: 5, HasPrecision: true}})
+	assertColumn(t, tab, "elapsed", Interval, ColumnAttributes{Modifiers: TypeModifiers{IntervalFields: PostgresIntervalDayToSecond, Precision: 3, HasPrecision: true}})
+	assertColumn(t, tab, "span", Interval, ColumnAttributes{Modifiers: TypeModifiers{IntervalFields: PostgresIntervalYear}})
+	assertColumn(t, tab, "taken_at", Timestamptz, ColumnAttributes{Modifiers: TypeModifiers{HasPrecision: true}})
+	assertColumn(t, tab, "flags", BitVarying, ColumnAttributes{Modifiers: TypeModifiers{Length: 8}})
+
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE measurements ALTER COLUMN label TYPE varchar(100), ALTER COLUMN amount TYPE numeric;`))
+	tab = assertTable(t, c, "measurements")
+	assertColumn(t, tab, "label", CharacterVarying, ColumnAttributes{Modifiers: TypeModifiers{Length: 100}})
+	assertColumn(t, tab, "amount", Numeric, ColumnAttributes{})
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE measurements ALTER COLUMN label TYPE text;`))
+	assertColumn(t, assertTable(t, c, "measurements"), "label", Text, ColumnAttributes{})
+
+	assertParseError(t, joinNewline(sql, `CREATE VIEW labels AS SELECT label FROM measurements; ALTER TABLE measurements ALTER COLUMN label TYPE varchar(10);`),
+		"can't alter type of column label")
+	assertParseError(t, `CREATE TABLE t (v varchar(0));`, "length for type character varying must be at least 1")
+	assertParseError(t, `CREATE TABLE t (n numeric(1001));`, "NUMERIC precision 1001 must be between 1 and 1000")
+	assertParseError(t, `CREATE TABLE t (n numeric(10, 2000));`, "NUMERIC scale 2000 must be between -1000 and 1000")
+	assertParseError(t, `CREATE TABLE t (n text(5));`, "type modifier is not allowed for type text")
+}
+
+func TestCompiler_Partitioning(t *testing.T) {
+	const sql = `
+	CREATE TABLE events (
+		id bigint NOT NULL,
+		happened_at date NOT NULL,
+		kind text DEFAULT 'other',
+		PRIMARY KEY (id, happened_at),
+		CONSTRAINT events_kind_check CHECK (kind <> '')
+	) PARTITION BY RANGE (happened_at);
+	CREATE TABLE events_2024 PARTITION OF events FOR VALUES FROM ('2024-01-01') TO ('2025-01-01');
+	CREATE TABLE events_old PARTITION OF events (kind DEFAULT 'legacy') FOR VALUES FROM (MINVALUE) TO ('2024-01-01');
+	CREATE TABLE events_other PARTITION OF events DEFAULT;
+	`
+	c := assertParse(t, sql)
+	events := assertTable(t, c, "events")
+	happenedAt, _ := events.Columns.Get("happened_at")
+	assert.Equal(t, &PartitionKey{
+		Strategy: PartitionStrategyRange,
+		Keys:     []*PartitionKeyElem{{Column: happenedAt, Columns: Columns{happenedAt}}},
+	}, events.PartitionKey)
+	assert.Equal(t, []string{"events_2024", "events_old", "events_other"},
+		lo.Map(c.Catalog.Partitions(events), func(item *Table, index int) string { return item.Name }))
+
+	p2024 := assertTable(t, c, "events_2024")
+	assert.Same(t, events, p2024.PartitionOf)
+	assert.Equal(t, &PartitionBound{From: []string{"'2024-01-01'"}, To: []string{"'2025-01-01'"}}, p2024.PartitionBound)
+	assert.Equal(t, []string{"id", "happened_at", "kind"}, Columns(p2024.Columns.List()).Names())
+	id := assertColumn(t, p2024, "id", Bigint, ColumnAttributes{Inherited: true, NotNull: true, Pkey: true})
+	at := assertColumn(t, p2024, "happened_at", Date, ColumnAttributes{Inherited: true, NotNull: true, Pkey: true})
+	kind := assertColumn(t, p2024, "kind", Text, ColumnAttributes{Inherited: true, HasExplicitDefault: true, ColumnDefault: `"other"`})
+	parentPkey := c.Catalog.PgConstraint.ByName[ConstraintFQName(events, "events_pkey")]
+	parentCheck := c.Catalog.PgConstraint.ByName[ConstraintFQName(events, "events_kind_check")]
+	assertConstraints(t, c, id, Constraint{Table: p2024, Name: "events_2024_pkey", Type: ConstraintTypePrimary,
+		Constrains: Columns{id, at}, InheritedFrom: parentPkey})
+	assertConstraints(t, c, kind, Constraint{Table: p2024, Name: "events_kind_check", Type: ConstraintTypeCheck,
+		Constrains: Columns{kind}, Expression: "kind <> ''", InheritedFrom: parentCheck})
+	assertIndex(t, c, "events_2024_pkey")
+
+	old := assertTable(t, c, "events_old")
+	assert.Equal(t, []string{"MINVALUE"}, old.PartitionBound.From)
+	assertColumn(t, old, "kind", Text, ColumnAttributes{Inherited: true, HasExplicitDefault: true, ColumnDefault: `"legacy"`})
+	assert.True(t, assertTable(t, c, "events_other").PartitionBound.IsDefault)
+
+	// Changes to the parent reach its partitions
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TABLE events ADD COLUMN payload jsonb, ADD CONSTRAINT events_id_check CHECK (id > 0);
+	ALTER TABLE events RENAME COLUMN kind TO category;
+	ALTER TABLE events DROP CONSTRAINT events_kind_check;`))
+	p2024 = assertTable(t, c, "events_2024")
+	assert.Equal(t, []string{"id", "happened_at", "category", "payload"}, Columns(p2024.Columns.List()).Names())
+	assert.Contains(t, c.Catalog.PgConstraint.ByName, ConstraintFQName(p2024, "events_id_check"))
+	assert.NotContains(t, c.Catalog.PgConstraint.ByName, ConstraintFQName(p2024, "events_kind_check"))
+
+	// Attaching and detaching
+	c = assertParse(t, joinNewline(sql, `
+	CREATE TABLE events_2025 (id bigint NOT NULL, happened_at date NOT NULL, kind text, CONSTRAINT events_kind_check CHECK (kind <> ''));
+	ALTER TABLE events ATTACH PARTITION events_2025 FOR VALUES FROM ('2025-01-01') TO ('2026-01-01');
+	ALTER TABLE events DETACH PARTITION events_old;`))
+	p2025 := assertTable(t, c, "events_2025")
+	assert.Equal(t, "events", p2025.PartitionOf.Name)
+	assert.Contains(t, c.Catalog.PgConstraint.ByName, ConstraintFQName(p2025, "events_2025_pkey"))
+	old = assertTable(t, c, "events_old")
+	assert.Nil(t, old.PartitionOf)
+	assert.Nil(t, old.PartitionBound)
+	assert.Nil(t, c.Catalog.PgConstraint.ByName[ConstraintFQName(old, "events_kind_check")].InheritedFrom)
+
+	// Dropping the parent drops its partitions
+	c = assertParse(t, joinNewline(sql, `DROP TABLE events;`))
+	sch, _ := c.Catalog.Schemas.Get("public")
+	assert.Empty(t, sch.Tables.List())
+	assert.Empty(t, sch.Indexes.List())
+	assert.Empty(t, c.Catalog.PgConstraint.ByName)
+
+	assertParse(t, `
+	CREATE TABLE readings (sensor int, region text, val numeric) PARTITION BY LIST (region);
+	CREATE TABLE readings_eu PARTITION OF readings FOR VALUES IN ('de', 'fr') PARTITION BY HASH (sensor);
+	CREATE TABLE readings_eu_0 PARTITION OF readings_eu FOR VALUES WITH (MODULUS 2, REMAINDER 0);
+	ALTER TABLE readings ADD COLUMN unit text;
+	`)
+
+	assertParseError(t, joinNewline(sql, `CREATE TABLE events_dup PARTITION OF events DEFAULT;`),
+		"partition events_dup conflicts with existing default partition events_other")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE events_bad PARTITION OF events FOR VALUES IN ('2024-01-01');`),
+		"invalid bound specification for a range partition")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE events_bad PARTITION OF events_2024 DEFAULT;`),
+		"table events_2024 is not partitioned")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE events_2024 ADD COLUMN x int;`), "cannot add column to a partition")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE events_2024 DROP COLUMN kind;`), "cannot drop inherited column kind")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE events DROP COLUMN happened_at;`),
+		"cannot drop column happened_at because it is part of the partition key of relation events")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE events_2024 DROP CONSTRAINT events_kind_check;`),
+		"cannot drop inherited constraint events_kind_check of relation events_2024")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE loose (id bigint NOT NULL, happened_at date NOT NULL, kind text);
+	ALTER TABLE events ATTACH PARTITION loose FOR VALUES FROM ('2030-01-01') TO ('2031-01-01');`),
+		"child table is missing constraint events_kind_check")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE loose (id bigint NOT NULL, happened_at date NOT NULL);
+	ALTER TABLE events ATTACH PARTITION loose FOR VALUES FROM ('2030-01-01') TO ('2031-01-01');`),
+		"child table is missing column kind")
+	assertParseError(t, `CREATE TABLE p (id int PRIMARY KEY, region text) PARTITION BY LIST (region);`,
+		"unique constraint on partitioned table must include all partitioning columns")
+	assertParseError(t, `CREATE TABLE p (a int, b int) PARTITION BY LIST (a, b);`,
+		`cannot use "list" partition strategy with more than one column`)
+	assertParseError(t, `CREATE TABLE p (a int) PARTITION BY HASH (a); CREATE TABLE p1 PARTITION OF p FOR VALUES WITH (MODULUS 2, REMAINDER 2);`,
+		"remainder for hash partition must be less than modulus")
+}
+
+func TestCompiler_Inherits(t *testing.T) {
+	const sql = `
+	CREATE TABLE cities (
+		name text NOT NULL,
+		population int DEFAULT 0,
+		CONSTRAINT cities_population_check CHECK (population >= 0)
+	);
+	CREATE TABLE landmarks (name text, height int);
+	CREATE TABLE capitals (
+		population int DEFAULT 1000,
+		country char(2) NOT NULL
+	) INHERITS (cities, landmarks);
+	`
+	c := assertParse(t, sql)
+	cities := assertTable(t, c, "cities")
+	landmarks := assertTable(t, c, "landmarks")
+	capitals := assertTable(t, c, "capitals")
+	assert.Equal(t, []*Table{cities, landmarks}, capitals.Inherits)
+	assert.Equal(t, []string{"name", "population", "height", "country"}, Columns(capitals.Columns.List()).Names())
+	assertColumn(t, capitals, "name", Text, ColumnAttributes{NotNull: true, Inherited: true})
+	population := assertColumn(t, capitals, "population", Integer,
+		ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "1000", Inherited: true, MergedLocal: true})
+	assertColumn(t, capitals, "height", Integer, ColumnAttributes{Inherited: true})
+	assertColumn(t, capitals, "country", Character, ColumnAttributes{NotNull: true, Modifiers: TypeModifiers{Length: 2}})
+	assertConstraints(t, c, population, Constraint{Table: capitals, Name: "cities_population_check", Type: ConstraintTypeCheck,
+		Constrains: Columns{population}, Expression: "population >= 0", DropBehaviour: DropBehaviourCascade,
+		InheritedFrom: c.Catalog.PgConstraint.ByName[ConstraintFQName(cities, "cities_population_check")]})
+
+	// Columns added to or dropped from the parent reach the child,
+	// unless the child also declared the column itself
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TABLE cities ADD COLUMN founded date;
+	ALTER TABLE cities DROP COLUMN population;
+	ALTER TABLE landmarks DROP COLUMN height;`))
+	capitals = assertTable(t, c, "capitals")
+	assert.Equal(t, []string{"name", "population", "country", "founded"}, Columns(capitals.Columns.List()).Names())
+	assertColumn(t, capitals, "population", Integer, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "1000"})
+
+	c = assertParse(t, joinNewline(sql, `DROP TABLE cities CASCADE;`))
+	_, err := c.FindTable("", "capitals")
+	assert.Error(t, err)
+
+	assertParseError(t, joinNewline(sql, `DROP TABLE cities;`),
+		"can't drop table cities because table capitals inherits from it and cascade was not specified")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE capitals DROP COLUMN name;`), "cannot drop inherited column name")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE capitals RENAME COLUMN name TO title;`), "cannot rename inherited column name")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE towns (population bigint) INHERITS (cities);`), "column population has a type conflict")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE odd (x int) INHERITS (cities, cities);`), "relation cities would be inherited from more than once")
+	assertParseError(t, `
+	CREATE TABLE a (v int DEFAULT 1);
+	CREATE TABLE b (v int DEFAULT 2);
+	CREATE TABLE ab () INHERITS (a, b);`, "column v inherits conflicting default values")
+	assertParseError(t, `
+	CREATE TABLE a (v int);
+	CREATE TABLE b (v text);
+	CREATE TABLE ab () INHERITS (a, b);`, "inherited column v has a type conflict")
+}
+
+func TestCompiler_CreateTableLike(t *testing.T) {
+	const sql = `
+	CREATE TABLE items (
+		id serial PRIMARY KEY,
+		code varchar(10) NOT NULL UNIQUE,
+		qty int DEFAULT 1 CHECK (qty > 0),
+		total int GENERATED ALWAYS AS (qty * 2) STORED,
+		ref bigint GENERATED BY DEFAULT AS IDENTITY (START WITH 100)
+	);
+	CREATE INDEX items_lower_code_idx ON items (lower(code));
+	`
+	c := assertParse(t, joinNewline(sql, `CREATE TABLE items_plain (LIKE items, note text);`))
+	plain := assertTable(t, c, "items_plain")
+	assert.Equal(t, []string{"id", "code", "qty", "total", "ref", "note"}, Columns(plain.Columns.List()).Names())
+	assertColumn(t, plain, "id", Integer, ColumnAttributes{NotNull: true})
+	assertColumn(t, plain, "code", CharacterVarying, ColumnAttributes{NotNull: true, Modifiers: TypeModifiers{Length: 10}})
+	assertColumn(t, plain, "qty", Integer, ColumnAttributes{})
+	assertColumn(t, plain, "total", Integer, ColumnAttributes{})
+	assertColumn(t, plain, "ref", Bigint, ColumnAttributes{NotNull: true})
+	assert.Empty(t, c.Catalog.TableConstraints(plain))
+	assert.Empty(t, c.Catalog.TableIndexes(plain))
+
+	c = assertParse(t, joinNewline(sql, `CREATE TABLE items_copy (LIKE items INCLUDING ALL);`))
+	copied := assertTable(t, c, "items_copy")
+	assertColumn(t, copied, "id", Integer, ColumnAttributes{NotNull: true, Pkey: true, HasSequence: true, SequenceName: "items_id_seq"})
+	qty := assertColumn(t, copied, "qty", Integer, ColumnAttributes{HasExplicitDefault: true, ColumnDefault: "1"})
+	assertColumn(t, copied, "total", Integer, ColumnAttributes{GeneratedExpression: "qty * 2", GeneratedFrom: Columns{qty}})
+	ref := assertColumn(t, copied, "ref", Bigint, ColumnAttributes{NotNull: true, Identity: IdentityByDefault, HasSequence: true,
+		SequenceName: "items_copy_ref_seq", IdentitySequence: assertSequence(t, c, "items_copy_ref_seq")})
+	assert.EqualValues(t, 100, ref.Attrs.IdentitySequence.Start)
+	assertConstraints(t, c, qty, Constraint{Table: copied, Name: "items_qty_check", Type: ConstraintTypeCheck,
+		Constrains: Columns{qty}, Expression: "qty > 0", DropBehaviour: DropBehaviourCascade})
+	assert.Equal(t, []string{"items_copy_pkey", "items_copy_code_key", "items_copy_expr_idx"},
+		lo.Map(c.Catalog.TableIndexes(copied), func(item *Index, index int) string { return item.Name }))
+	assert.Equal(t, "lower(code)", assertIndex(t, c, "items_copy_expr_idx").Keys[0].Expression)
+
+	assertParseError(t, joinNewline(sql, `CREATE TABLE dup (code text, LIKE items);`), "column code specified more than once")
+}
+
+func TestCompiler_Domains(t *testing.T) {
+	const sql = `
+	CREATE DOMAIN email AS varchar(254) NOT NULL CHECK (VALUE LIKE '%@%');
+	CREATE DOMAIN positive_int AS integer DEFAULT 1 CONSTRAINT positive CHECK (VALUE > 0);
+	CREATE DOMAIN work_email AS email CHECK (VALUE NOT LIKE '%@gmail.com');
+	CREATE TABLE contacts (
+		address email,
+		backup email[],
+		work work_email,
+		visits positive_int NOT NULL,
+		score positive_int
+	);
+	`
+	c := assertParse(t, sql)
+	reg := c.TypeRegistry
+	email := assertType(t, reg, "email")
+	require.True(t, email.IsDomain())
+	assert.Equal(t, &Domain{
+		BaseType:  CharacterVarying,
+		Modifiers: TypeModifiers{Length: 254},
+		NotNull:   true,
+		Checks:    []*DomainCheck{{Name: "email_check", Expression: "value LIKE '%@%'"}},
+	}, email.Domain)
+	positive := assertType(t, reg, "positive_int")
+	assert.Equal(t, "1", positive.Domain.Default)
+	assert.Equal(t, "positive", positive.Domain.Checks[0].Name)
+	workEmail := assertType(t, reg, "work_email")
+	assert.Same(t, CharacterVarying, workEmail.UnderlyingType())
+	assert.True(t, workEmail.DomainNotNull())
+
+	contacts := assertTable(t, c, "contacts")
+	address := assertColumn(t, contacts, "address", email, ColumnAttributes{Domain: email})
+	assert.True(t, address.Attrs.IsRequired())
+	backup := assertColumn(t, contacts, "backup", reg.ArrayOf(email, 1), ColumnAttributes{})
+	assert.False(t, backup.Attrs.IsRequired())
+	work := assertColumn(t, contacts, "work", workEmail, ColumnAttributes{Domain: workEmail})
+	assert.True(t, work.Attrs.IsRequired())
+	visits := assertColumn(t, contacts, "visits", positive, ColumnAttributes{NotNull: true, Domain: positive})
+	assert.False(t, visits.Attrs.IsRequired())
+	score := assertColumn(t, contacts, "score", positive, ColumnAttributes{Domain: positive})
+	assert.False(t, score.Attrs.IsNotNull())
+
+	c = assertParse(t, joinNewline(sql, `
+	ALTER DOMAIN positive_int DROP DEFAULT;
+	ALTER DOMAIN positive_int SET NOT NULL;
+	ALTER DOMAIN positive_int ADD CHECK (VALUE < 100) NOT VALID;
+	ALTER DOMAIN positive_int DROP CONSTRAINT positive;
+	ALTER DOMAIN email DROP NOT NULL;
+	ALTER DOMAIN positive_int RENAME CONSTRAINT positive_int_check TO below_100;
+	ALTER TABLE contacts ALTER COLUMN work TYPE text;`))
+	positive = assertType(t, c.TypeRegistry, "positive_int")
+	assert.Equal(t, &Domain{BaseType: Integer, NotNull: true,
+		Checks: []*DomainCheck{{Name: "below_100", Expression: "value < 100", NotValid: true}}}, positive.Domain)
+	contacts = assertTable(t, c, "contacts")
+	score, _ = contacts.Columns.Get("score")
+	assert.True(t, score.Attrs.IsRequired())
+	address, _ = contacts.Columns.Get("address")
+	assert.False(t, address.Attrs.IsNotNull())
+	assertColumn(t, contacts, "work", Text, ColumnAttributes{})
+
+	c = assertParse(t, joinNewline(sql, `DROP DOMAIN email CASCADE; DROP DOMAIN IF EXISTS nothing;`))
+	assert.Equal(t, []string{"visits", "score"}, Columns(assertTable(t, c, "contacts").Columns.List()).Names())
+	_, ok := c.TypeRegistry.FindType("work_email")
+	assert.False(t, ok)
+
+	assertParseError(t, joinNewline(sql, `DROP DOMAIN positive_int;`),
+		"can't drop type positive_int because column visits of table contacts depends on it")
+	assertParseError(t, joinNewline(sql, `DROP DOMAIN email;`), "can't drop type email because type work_email depends on it")
+	assertParseError(t, joinNewline(sql, `CREATE DOMAIN email AS text;`), "type email already exists")
+	assertParseError(t, `CREATE DOMAIN d AS nosuchtype;`, "type nosuchtype does not exist")
+	assertParseError(t, `CREATE DOMAIN d AS int CHECK (other > 0);`, "column other does not exist")
+	assertParseError(t, `CREATE DOMAIN d AS int UNIQUE;`, "unique constraints not possible for domains")
+	assertParseError(t, `CREATE DOMAIN d AS int NULL NOT NULL;`, "conflicting NULL/NOT NULL constraints")
+	assertParseError(t, `CREATE TYPE mood AS ENUM ('ok'); ALTER DOMAIN mood SET NOT NULL;`, "mood is not a domain")
+}
+
+func TestCompiler_CompositeTypes(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA geo;
+	CREATE TYPE geo.coords AS (lat double precision, lng double precision);
+	CREATE TYPE address AS (street varchar(100), city text, location geo.coords, tags text[]);
+	CREATE TABLE shops (name text, addresses address[]);
+	`
+	c := assertParse(t, sql)
+	coords := assertType(t, c.TypeRegistry, "geo.coords")
+	address := assertType(t, c.TypeRegistry, "address")
+	require.True(t, address.IsComposite())
+	assert.Equal(t, "geo", coords.Schema)
+	assert.Equal(t, []*TypeAttribute{
+		{Name: "street", Type: CharacterVarying, Modifiers: TypeModifiers{Length: 100}},
+		{Name: "city", Type: Text},
+		{Name: "location", Type: coords},
+		{Name: "tags", Type: c.TypeRegistry.ArrayOf(Text, 1)},
+	}, address.Composite.Attributes)
+	shops := assertTable(t, c, "shops")
+	assertColumn(t, shops, "addresses", c.TypeRegistry.ArrayOf(address, 1), ColumnAttributes{})
+
+	c = assertParse(t, joinNewline(sql, `DROP TYPE geo.coords CASCADE;`))
+	assert.Nil(t, assertType(t, c.TypeRegistry, "address").Composite.Attribute("location"))
+
+	c = assertParse(t, joinNewline(sql, `
+	ALTER TYPE address ADD ATTRIBUTE postcode varchar(10), DROP ATTRIBUTE IF EXISTS tags, DROP ATTRIBUTE IF EXISTS nothing;
+	ALTER TYPE geo.coords ALTER ATTRIBUTE lat TYPE numeric(9, 6), ALTER ATTRIBUTE lng TYPE numeric(9, 6);
+	ALTER TYPE address RENAME ATTRIBUTE street TO line1;`))
+	address = assertType(t, c.TypeRegistry, "address")
+	assert.Equal(t, []string{"line1", "city", "location", "postcode"}, lo.Map(address.Composite.Attributes, func(attr *TypeAttribute, _ int) string { return attr.Name }))
+	assert.Equal(t, &TypeAttribute{Name: "lat", Type: Numeric, Modifiers: TypeModifiers{Precision: 9, Scale: 6, HasPrecision: true}},
+		assertType(t, c.TypeRegistry, "geo.coords").Composite.Attribute("lat"))
+
+	assertParseError(t, joinNewline(sql, `ALTER TYPE address ALTER ATTRIBUTE city TYPE varchar(50);`),
+		"cannot alter type address because column shops.addresses uses it")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE geo.coords ADD ATTRIBUTE home address;`),
+		"composite type geo.coords cannot be made a member of itself")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE address ADD ATTRIBUTE city text;`), "column city of relation address already exists")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE address DROP ATTRIBUTE nothing;`), "column nothing of relation address does not exist")
+	assertParseError(t, joinNewline(sql, `DROP TYPE geo.coords;`),
+		"can't drop type geo.coords because column location of composite type address depends on it")
+	assertParseError(t, `CREATE TYPE pair AS (a serial);`, "type serial does not exist")
+	assertParseError(t, `CREATE TYPE mood AS ENUM ('ok'); ALTER TYPE mood ADD ATTRIBUTE a int;`, "mood is not a composite type")
+}
+
+func TestCompiler_RangeTypes(t *testing.T) {
+	const sql = `
+	CREATE TYPE floatrange AS RANGE (subtype = float8, subtype_diff = float8mi);
+	CREATE TYPE timespan AS RANGE (subtype = time, multirange_type_name = timespans);
+	CREATE TABLE bookings (
+		during tstzrange NOT NULL,
+		nights int4multirange,
+		prices floatrange[],
+		hours timespans
+	);
+	`
+	c := assertParse(t, sql)
+	floatrange := assertType(t, c.TypeRegistry, "floatrange")
+	floatmultirange := assertType(t, c.TypeRegistry, "floatmultirange")
+	assert.Equal(t, &Range{Subtype: Double, Multirange: floatmultirange}, floatrange.Range)
+	assert.Same(t, floatrange, floatmultirange.MultirangeOf)
+	timespans := assertType(t, c.TypeRegistry, "timespans")
+	assert.Same(t, assertType(t, c.TypeRegistry, "timespan"), timespans.MultirangeOf)
+	assert.Same(t, Timestamptz, TSTZRange.Range.Subtype)
+	assert.Same(t, Int4Multirange, Int4Range.Range.Multirange)
+
+	bookings := assertTable(t, c, "bookings")
+	assertColumn(t, bookings, "during", TSTZRange, ColumnAttributes{NotNull: true})
+	assertColumn(t, bookings, "nights", Int4Multirange, ColumnAttributes{})
+	assertColumn(t, bookings, "prices", c.TypeRegistry.ArrayOf(floatrange, 1), ColumnAttributes{})
+	assertColumn(t, bookings, "hours", timespans, ColumnAttributes{})
+
+	c = assertParse(t, joinNewline(sql, `DROP TYPE timespan CASCADE;`))
+	assert.Equal(t, []string{"during", "nights", "prices"}, Columns(assertTable(t, c, "bookings").Columns.List()).Names())
+	_, ok := c.TypeRegistry.FindType("timespans")
+	assert.False(t, ok)
+
+	assertParseError(t, joinNewline(sql, `DROP TYPE timespan;`), "can't drop type timespans because column hours of table bookings depends on it")
+	assertParseError(t, joinNewline(sql, `DROP TYPE timespans;`), "cannot drop type timespans because type timespan requires it")
+	assertParseError(t, joinNewline(sql, `DROP TYPE tstzrange;`), "cannot drop type tstzrange because it is required by the database system")
+	assertParseError(t, `CREATE TYPE r AS RANGE (subtype_diff = float8mi);`, "type attribute subtype is required")
+	assertParseError(t, `CREATE TYPE r AS RANGE (subtype = int, colour = red);`, "type attribute colour not recognized")
+	assertParseError(t, `CREATE TYPE r AS RANGE (subtype = int, multirange_type_name = int4multirange);`, "type int4multirange already exists")
+}
+
+func TestCompiler_AlterEnum(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA app;
+	CREATE TYPE app.mood AS ENUM ('happy', 'sad');
+	CREATE TYPE status AS ENUM ('active');
+	CREATE TABLE people (name text, mood app.mood, moods app.mood[]);
+	CREATE TABLE accounts (status status);
+	`
+	c := assertParse(t, joinNewline(sql, `
+	ALTER TYPE app.mood ADD VALUE 'ok' BEFORE 'sad';
+	ALTER TYPE app.mood ADD VALUE 'ecstatic' AFTER 'happy';
+	ALTER TYPE app.mood ADD VALUE 'angry';
+	ALTER TYPE app.mood ADD VALUE IF NOT EXISTS 'happy';
+	ALTER TYPE app.mood RENAME VALUE 'sad' TO 'glum';`))
+	assert.Equal(t, []string{"happy", "ecstatic", "ok", "glum", "angry"}, assertType(t, c.TypeRegistry, "app.mood").EnumValues)
+
+	c = assertParse(t, joinNewline(sql, `DROP TYPE IF EXISTS app.mood, nothing CASCADE;`))
+	assert.Equal(t, []string{"name"}, Columns(assertTable(t, c, "people").Columns.List()).Names())
+	_, ok := c.TypeRegistry.FindType("app.mood")
+	assert.False(t, ok)
+	_, ok = c.TypeRegistry.FindType("app.mood[]")
+	assert.False(t, ok)
+
+	c = assertParse(t, joinNewline(sql, `DROP TABLE accounts; DROP TYPE status; CREATE TYPE status AS ENUM ('open', 'closed');`))
+	assert.Equal(t, []string{"open", "closed"}, assertType(t, c.TypeRegistry, "status").EnumValues)
+
+	assertParseError(t, joinNewline(sql, `DROP TYPE status;`), "can't drop type status because column status of table accounts depends on it")
+	assertParseError(t, joinNewline(sql, `DROP TYPE nothing;`), "type nothing does not exist")
+	assertParseError(t, joinNewline(sql, `DROP TYPE integer;`), "cannot drop type integer because it is required by the database system")
+	assertParseError(t, joinNewline(sql, `DROP TYPE status[];`), "cannot drop type status[] because type status requires it")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE status ADD VALUE 'active';`), "enum label active already exists")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE status ADD VALUE 'x' AFTER 'y';`), "y is not an existing enum label")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE status RENAME VALUE 'y' TO 'x';`), "y is not an existing enum label")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE app.mood RENAME VALUE 'sad' TO 'happy';`), "enum label happy already exists")
+	assertParseError(t, `CREATE TYPE pair AS (a int); ALTER TYPE pair ADD VALUE 'x';`, "pair is not an enum")
+}
+
+func TestCompiler_DropSchema(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA billing;
+	CREATE TYPE billing.currency AS ENUM ('usd', 'eur');
+	CREATE SEQUENCE billing.invoice_numbers;
+	CREATE TABLE billing.invoices (id serial PRIMARY KEY, number bigint DEFAULT nextval('billing.invoice_numbers'));
+	CREATE VIEW billing.recent AS SELECT id FROM billing.invoices;
+	CREATE TABLE orders (
+		id serial PRIMARY KEY,
+		invoice_id integer REFERENCES billing.invoices (id),
+		currency billing.currency
+	);
+	CREATE VIEW order_invoices AS SELECT o.id FROM orders o JOIN billing.invoices i ON i.id = o.invoice_id;
+	`
+	c := assertParse(t, joinNewline(sql, `DROP SCHEMA billing CASCADE; DROP SCHEMA IF EXISTS nothing;`))
+	_, ok := c.Catalog.Schemas.Get("billing")
+	assert.False(t, ok)
+	orders := assertTable(t, c, "orders")
+	assert.Equal(t, []string{"id", "invoice_id"}, Columns(orders.Columns.List()).Names())
+	assert.Equal(t, []string{"orders_pkey"}, lo.Map(c.Catalog.TableConstraints(orders), func(con *Constraint, _ int) string { return con.Name }))
+	sch, _ := c.Catalog.Schemas.Get("public")
+	_, ok = sch.Views.Get("order_invoices")
+	assert.False(t, ok)
+	_, ok = c.TypeRegistry.FindType("billing.currency")
+	assert.False(t, ok)
+
+	c = assertParse(t, `CREATE SCHEMA empty; DROP SCHEMA empty;`)
+	_, ok = c.Catalog.Schemas.Get("empty")
+	assert.False(t, ok)
+
+	assertParseError(t, joinNewline(sql, `DROP SCHEMA billing;`),
+		"can't drop schema billing because table invoices depends on it and cascade was not specified")
+	assertParseError(t, `CREATE SCHEMA s; CREATE TYPE s.t AS (a int); DROP SCHEMA s RESTRICT;`,
+		"can't drop schema s because type s.t depends on it and cascade was not specified")
+	assertParseError(t, `DROP SCHEMA nothing;`, "schema nothing does not exist")
+}
+
+func TestCompiler_SetSchema(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA archive;
+	CREATE SEQUENCE shared_numbers;
+	CREATE TABLE users (
+		id serial PRIMARY KEY,
+		email text UNIQUE,
+		ref integer DEFAULT nextval('shared_numbers')
+	);
+	CREATE INDEX users_ref_idx ON users (ref);
+	CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));
+	`
+	c := assertParse(t, joinNewline(sql, `ALTER TABLE users SET SCHEMA archive;`))
+	public, _ := c.Catalog.Schemas.Get("public")
+	archive, _ := c.Catalog.Schemas.Get("archive")
+	_, ok := public.Tables.Get("users")
+	assert.False(t, ok)
+	users := assertTable(t, c, "archive.users")
+	assert.Equal(t, "archive", users.Schema)
+	assert.Equal(t, []string{"users_pkey", "users_email_key", "users_ref_idx"}, lo.Map(archive.Indexes.List(), func(idx *Index, _ int) string { return idx.Name }))
+	assert.Equal(t, []string{"posts_pkey"}, lo.Map(public.Indexes.List(), func(idx *Index, _ int) string { return idx.Name }))
+	assert.Equal(t, []string{"users_id_seq"}, lo.Map(archive.Sequences.List(), func(seq *Sequence, _ int) string { return seq.Name }))
+	assertColumn(t, users, "id", Serial, ColumnAttributes{Pkey: true, HasSequence: true, SequenceName: "users_id_seq"})
+	assertColumn(t, users, "ref", Integer, ColumnAttributes{
+		HasExplicitDefault: true,
+		ColumnDefault:      `nextval("public.shared_numbers")`,
+		HasSequence:        true,
+		SequenceName:       "public.shared_numbers",
+	})
+	assert.NotNil(t, c.Catalog.PgConstraint.ByName["archive.users.users_pkey"])
+	assert.Nil(t, c.Catalog.PgConstraint.ByName["public.users.users_pkey"])
+	fk := c.Catalog.PgConstraint.ByName["public.posts.posts_user_id_fkey"]
+	require.NotNil(t, fk)
+	assert.Same(t, users, fk.Refers[0].Table)
+
+	c = assertParse(t, joinNewline(sql, `ALTER TABLE users SET SCHEMA archive; ALTER SEQUENCE shared_numbers SET SCHEMA archive;`))
+	ref, _ := assertTable(t, c, "archive.users").Columns.Get("ref")
+	assert.Equal(t, "shared_numbers", ref.Attrs.SequenceName)
+
+	c = assertParse(t, joinNewline(sql, `
+	CREATE TYPE mood AS ENUM ('ok');
+	CREATE TYPE span AS RANGE (subtype = int);
+	ALTER TYPE mood SET SCHEMA archive;
+	ALTER TYPE span SET SCHEMA archive;
+	CREATE VIEW names AS SELECT email FROM users;
+	ALTER VIEW names SET SCHEMA archive;
+	ALTER TABLE IF EXISTS nothing SET SCHEMA archive;`))
+	assert.Equal(t, "archive", assertType(t, c.TypeRegistry, "archive.mood").Schema)
+	assert.Same(t, assertType(t, c.TypeRegistry, "archive.span").Range.Multirange, assertType(t, c.TypeRegistry, "archive.span_multirange"))
+	assert.Equal(t, "archive", assertView(t, c, "archive.names").Schema)
+
+	// The queries of views that use a moved relation refer to it in its new
+	// schema, so that later renames can rewrite them again
+	c = assertParse(t, joinNewline(sql, `
+	CREATE VIEW emails AS SELECT public.users.email, users.id FROM users;
+	CREATE VIEW first_email AS SELECT email FROM emails LIMIT 1;
+	ALTER TABLE users SET SCHEMA archive;
+	ALTER VIEW emails SET SCHEMA archive;
+	ALTER TABLE archive.users RENAME COLUMN email TO address;`))
+	assert.Equal(t, "SELECT archive.users.address AS email, users.id FROM archive.users", assertView(t, c, "archive.emails").Query)
+	assert.Equal(t, "SELECT email FROM archive.emails LIMIT 1", assertView(t, c, "first_email").Query)
+
+	assertParseError(t, joinNewline(sql, `ALTER TABLE users SET SCHEMA public;`), "table users is already in schema public")
+	assertParseError(t, joinNewline(sql, `ALTER TABLE users SET SCHEMA nothing;`), "schema nothing does not exist")
+	assertParseError(t, joinNewline(sql, `CREATE TABLE archive.users_email_key (a int); ALTER TABLE users SET SCHEMA archive;`),
+		"relation users_email_key already exists in schema archive")
+	assertParseError(t, joinNewline(sql, `ALTER SEQUENCE users_id_seq SET SCHEMA archive;`), "cannot move an owned sequence into another schema")
+	assertParseError(t, joinNewline(sql, `ALTER TYPE integer SET SCHEMA archive;`), "cannot move built-in type integer")
+}
+
+func TestCompiler_SearchPath(t *testing.T) {
+	const sql = `
+	CREATE SCHEMA app;
+	CREATE TABLE public.settings (key text PRIMARY KEY);
+	CREATE TABLE public.users (id serial PRIMARY KEY);
+	SET search_path TO missing, app, public;
+	CREATE TYPE mood AS ENUM ('ok');
+	CREATE TABLE users (id serial PRIMARY KEY, mood mood);
+	CREATE TABLE posts (user_id integer REFERENCES users (id), setting text REFERENCES settings (key));
+	`
+	c := assertParse(t, sql)
+	assert.Equal(t, []string{"missing", "app", "public"}, c.SearchPath)
+	users := assertTable(t, c, "app.users")
+	mood := assertType(t, c.TypeRegistry, "app.mood")
+	assertColumn(t, users, "mood", mood, ColumnAttributes{})
+	assert.Equal(t, "app", mood.Schema)
+	posts := assertTable(t, c, "app.posts")
+	userID, _ := posts.Columns.Get("user_id")
+	setting, _ := posts.Columns.Get("setting")
+	cons, _ := c.Catalog.PgConstraint.ByColumn.Get(userID)
+	assert.Same(t, users, cons[0].Refers[0].Table)
+	cons, _ = c.Catalog.PgConstraint.ByColumn.Get(setting)
+	assert.Same(t, assertTable(t, c, "public.settings"), cons[0].Refers[0].Table)
+	assert.Same(t, users, assertTable(t, c, "users"))
+
+	c = assertParse(t, joinNewline(sql, `
+	BEGIN;
+	SET LOCAL search_path TO public;
+	CREATE TABLE audit (id int);
+	COMMIT;
+	SET LOCAL search_path TO public;
+	CREATE TABLE log (id int);`))
+	assert.Equal(t, []string{"missing", "app", "public"}, c.SearchPath)
+	assertTable(t, c, "public.audit")
+	assertTable(t, c, "app.log")
+
+	c = assertParse(t, joinNewline(sql, `
+	BEGIN;
+	SET LOCAL search_path TO public;
+	SET search_path TO app;
+	ROLLBACK;
+	RESET search_path;
+	CREATE TABLE log (id int);`))
+	assert.Equal(t, []string{"public"}, c.SearchPath)
+	assertTable(t, c, "public.log")
+
+	c = assertParse(t, `
+	SELECT pg_catalog.set_config('search_path', '', false);
+	CREATE SCHEMA "My Schema";
+	CREATE TABLE "My Schema".accounts (id int);
+	SELECT pg_catalog.set_config('search_path', '"My Schema", public', false);
+	CREATE INDEX accounts_id_idx ON accounts (id);`)
+	assert.Equal(t, []string{"My Schema", "public"}, c.SearchPath)
+	assertIndex(t, c, "My Schema.accounts_id_idx")
+
+	assertParseError(t, `SELECT pg_catalog.set_config('search_path', '', false); CREATE TABLE t (id int);`,
+		"no schema has been selected to create in")
+	assertParseError(t, joinNewline(sql, `SET search_path TO public; CREATE DOMAIN feeling AS mood;`), "type mood does not exist")
+	assertParseError(t, `SET search_path = app; CREATE TYPE mood AS ENUM ('ok');`, "no schema has been selected to create in")
+
+	// Unqualified relations can't be found when no schema on the path exists
+	nowhere := joinNewline(`CREATE TABLE users (id int);`, `SET search_path = nonexistent;`)
+	assertParseError(t, joinNewline(nowhere, `ALTER TABLE users ADD COLUMN name text;`), "relation users does not exist")
+	assertParseError(t, joinNewline(nowhere, `CREATE INDEX ON users (id);`), "relation users does not exist")
+	assertParseError(t, joinNewline(nowhere, `DROP SEQUENCE users_id_seq;`), "relation users_id_seq does not exist")
+	assertParseError(t, joinNewline(nowhere, `CREATE TABLE posts (id int);`), "no schema has been selected to create in")
+	c = assertParse(t, joinNewline(nowhere, `ALTER TABLE public.users ADD COLUMN name text;`))
+	_, err := c.FindTable("", "users")
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	assert.EqualError(t, err, "relation users does not exist")
+}
+
+func TestParseSearchPath(t *testing.T) {
+	path, err := ParseSearchPath(` app,"My Schema" ,PUBLIC, "$user"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app", "My Schema", "public", "$user"}, path)
+	path, err = ParseSearchPath(``)
+	require.NoError(t, err)
+	assert.Empty(t, path)
+	_, err = ParseSearchPath(`app public`)
+	assert.Error(t, err)
+	_, err = ParseSearchPath(`"app`)
+	assert.Error(t, err)
+}
+
+func TestCompiler_Transactions(t *testing.T) {
+	c := assertParse(t, `
+	CREATE TABLE users (id serial PRIMARY KEY);
+	BEGIN;
+	CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));
+	ALTER TABLE users ADD COLUMN email text;
+	CREATE TYPE mood AS ENUM ('ok');
+	SET search_path TO nowhere;
+	ROLLBACK;
+	CREATE TABLE comments (id serial PRIMARY KEY);`)
+	assert.Equal(t, []string{"id"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+	public, _ := c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users", "comments"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+	_, ok := c.TypeRegistry.FindType("mood")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"public"}, c.SearchPath)
+
+	c = assertParse(t, `
+	BEGIN;
+	CREATE TABLE users (id serial PRIMARY KEY);
+	SAVEPOINT with_users;
+	CREATE TABLE posts (id int);
+	SAVEPOINT with_posts;
+	CREATE TABLE comments (id int);
+	ROLLBACK TO SAVEPOINT with_users;
+	CREATE TABLE tags (id int);
+	ROLLBACK TO with_users;
+	CREATE TABLE likes (id int);
+	SAVEPOINT with_likes;
+	RELEASE SAVEPOINT with_likes;
+	COMMIT;`)
+	public, _ = c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users", "likes"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+	assertSequence(t, c, "users_id_seq")
+
+	c = assertParse(t, `
+	BEGIN;
+	CREATE TABLE users (id int);
+	COMMIT AND CHAIN;
+	CREATE TABLE posts (id int);
+	ROLLBACK;
+	ROLLBACK;
+	COMMIT;`)
+	public, _ = c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+
+	// A transaction a file begins is rolled back if the file doesn't end it
+	c = NewCompiler()
+	err := c.ParseFile("001.sql", "CREATE TABLE users (id int);\nBEGIN;\nCREATE TABLE posts (id int);")
+	var diag *Diagnostic
+	require.ErrorAs(t, err, &diag)
+	assert.ErrorIs(t, err, ErrTransactionNotCommitted)
+	assert.Equal(t, "001.sql:2:1: transaction was not committed by the end of the file, so it is rolled back", err.Error())
+	require.NoError(t, c.ParseRaw(`CREATE TABLE comments (id int); ROLLBACK;`))
+	public, _ = c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users", "comments"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+
+	// A transaction the caller begins carries on across files. A search path
+	// set by the caller survives a rollback, and objects obtained before it
+	// stay part of the catalog
+	c = NewCompiler()
+	require.NoError(t, c.ParseRaw(`CREATE SCHEMA app; CREATE TABLE public.users (id int);`))
+	c.SearchPath = []string{"app", "public"}
+	users := assertTable(t, c, "users")
+	parseStatement(t, c, `BEGIN;`)
+	require.NoError(t, c.ParseRaw(`CREATE TABLE posts (id int); ALTER TABLE users ADD COLUMN email text;
+	SAVEPOINT a; SET search_path TO nowhere; ROLLBACK TO a;`))
+	assert.Equal(t, []string{"app", "public"}, c.SearchPath)
+	require.NoError(t, c.ParseRaw(`ROLLBACK;`))
+	assert.Equal(t, []string{"app", "public"}, c.SearchPath)
+	assert.Equal(t, []string{"id"}, Columns(users.Columns.List()).Names())
+	assert.Same(t, users, assertTable(t, c, "users"))
+	_, err = c.FindTable("app", "posts")
+	assert.Error(t, err)
+
+	// A clone made in a transaction rolls back its own objects
+	parseStatement(t, c, `BEGIN;`)
+	require.NoError(t, c.ParseRaw(`ALTER TABLE users ADD COLUMN email text; SAVEPOINT a; CREATE TABLE posts (id int);`))
+	clone := c.Clone()
+	require.NoError(t, clone.ParseRaw(`ROLLBACK TO a; ALTER TABLE users ADD COLUMN name text; ROLLBACK;`))
+	assert.Equal(t, []string{"id"}, Columns(assertTable(t, clone, "users").Columns.List()).Names())
+	assert.Equal(t, []string{"id", "email"}, Columns(users.Columns.List()).Names())
+	assertTable(t, c, "posts")
+
+	assertParse(t, `CREATE TABLE users (id int); CREATE INDEX CONCURRENTLY users_id_idx ON users (id);`)
+	assertParseError(t, `CREATE TABLE users (id int); BEGIN; CREATE INDEX CONCURRENTLY users_id_idx ON users (id);`,
+		"CREATE INDEX CONCURRENTLY cannot run inside a transaction block")
+	assertParseError(t, `CREATE TABLE users (id int); CREATE INDEX users_id_idx ON users (id); BEGIN; DROP INDEX CONCURRENTLY users_id_idx;`,
+		"DROP INDEX CONCURRENTLY cannot run inside a transaction block")
+	assertParseError(t, `BEGIN; VACUUM;`, "VACUUM cannot run inside a transaction block")
+	assertParseError(t, `SAVEPOINT a;`, "SAVEPOINT can only be used in transaction blocks")
+	assertParseError(t, `BEGIN; SAVEPOINT a; RELEASE a; ROLLBACK TO a;`, "savepoint a does not exist")
+}
+
+// parseStatement applies each statement of the SQL on its own, so that a
+// transaction it begins stays open for later calls.
+func parseStatement(t *testing.T, c *Compiler, sql string) {
+	parse, err := pg_query.Parse(sql)
+	require.NoError(t, err)
+	for _, stmt := range parse.Stmts {
+		require.NoError(t, c.ParseStatement(stmt))
+	}
+}
+
+func TestCompiler_AbortedTransactions(t *testing.T) {
+	c := NewCompiler()
+	c.ContinueOnError = true
+	err := c.ParseFile("001.sql", joinNewline(
+		`CREATE TABLE users (id int);`,
+		`BEGIN;`,
+		`CREATE TABLE posts (id int);`,
+		`DROP TABLE missing;`,
+		`CREATE TABLE tags (id int);`,
+		`ROLLBACK TO SAVEPOINT a;`,
+		`COMMIT;`,
+		`CREATE TABLE comments (id int);`,
+	))
+	var diags Diagnostics
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{4, 5, 6}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.Equal(t, "001.sql:5:1: current transaction is aborted, commands ignored until end of transaction block "+
+		"(cascading from the failed statement at 001.sql:4:1)", diags[1].Error())
+	assert.ErrorIs(t, diags[1], ErrTransactionAborted)
+	assert.Same(t, diags[0], diags[1].Cause)
+	// Rolling back to a missing savepoint fails in its own right
+	assert.Nil(t, diags[2].Cause)
+	assert.ErrorIs(t, diags[2], ErrNotFound)
+	// Committing an aborted transaction rolls it back
+	public, _ := c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users", "comments"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+
+	// Rolling back to a savepoint made before the failure ends the abort
+	c = NewCompiler()
+	c.ContinueOnError = true
+	err = c.ParseFile("002.sql", joinNewline(
+		`BEGIN;`,
+		`CREATE TABLE users (id int);`,
+		`SAVEPOINT a;`,
+		`CREATE TABLE posts (id int);`,
+		`DROP TABLE missing;`,
+		`ROLLBACK TO a;`,
+		`CREATE TABLE tags (id int);`,
+		`COMMIT;`,
+	))
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{5}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	public, _ = c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"users", "tags"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+
+	// A failure in a transaction the caller began aborts it across files
+	c = NewCompiler()
+	parseStatement(t, c, `BEGIN; CREATE TABLE users (id int);`)
+	require.ErrorIs(t, c.ParseRaw(`DROP TABLE missing;`), ErrTableNotFound)
+	require.ErrorIs(t, c.ParseRaw(`CREATE TABLE posts (id int);`), ErrTransactionAborted)
+	require.NoError(t, c.ParseRaw(`ROLLBACK; CREATE TABLE tags (id int);`))
+	public, _ = c.Catalog.Schemas.Get("public")
+	assert.Equal(t, []string{"tags"}, lo.Map(public.Tables.List(), func(tab *Table, _ int) string { return tab.Name }))
+}
+
+func TestCompiler_AtomicStatements(t *testing.T) {
+	c := NewCompiler()
+	require.NoError(t, c.ParseRaw(`CREATE TABLE users (id serial PRIMARY KEY);`))
+
+	err := c.ParseRaw(`CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES missing (id));`)
+	require.Error(t, err)
+	_, err = c.FindTable("public", "posts")
+	assert.Error(t, err)
+	_, err = c.FindSequence("public", "posts_id_seq")
+	assert.Error(t, err)
+
+	err = c.ParseRaw(`ALTER TABLE users ADD COLUMN email text, ADD COLUMN name text, ADD COLUMN email text;`)
+	require.ErrorContains(t, err, "column already exists: email")
+	assert.Equal(t, []string{"id"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+
+	// Later statements still apply to the consistent catalog
+	require.NoError(t, c.ParseRaw(`ALTER TABLE users ADD COLUMN email text;
+	CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));`))
+	assert.Equal(t, []string{"id", "email"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+	assertTable(t, c, "posts")
+
+	// Statements before the failing one are kept, but a transaction
+	// begun by the SQL is rolled back
+	err = c.ParseRaw(`CREATE TABLE tags (id int); BEGIN; CREATE TABLE drafts (id int); DROP TABLE users; CREATE TABLE never (id int);`)
+	require.Error(t, err)
+	assertTable(t, c, "users")
+	assertTable(t, c, "tags")
+	for _, name := range []string{"drafts", "never"} {
+		_, err = c.FindTable("public", name)
+		assert.Error(t, err)
+	}
+	require.NoError(t, c.ParseRaw(`CREATE TABLE drafts (id int);`))
+}
+
+func TestCompiler_AtomicStatements_HeldObjects(t *testing.T) {
+	c := NewCompiler()
+	require.NoError(t, c.ParseRaw(joinNewline(
+		`CREATE TYPE mood AS ENUM ('happy');`,
+		`CREATE TABLE a (x int);`,
+	)))
+	catalog, types := c.Catalog, c.TypeRegistry
+	tab := assertTable(t, c, "a")
+	mood := assertType(t, types, "mood")
+
+	err := c.ParseRaw(`ALTER TABLE a ADD COLUMN y int, ADD COLUMN z nosuchtype;`)
+	require.ErrorIs(t, err, ErrTypeNotFound)
+	assert.Equal(t, []string{"x"}, Columns(tab.Columns.List()).Names())
+	assert.Same(t, tab, assertTable(t, c, "a"))
+	err = c.ParseRaw(`ALTER TYPE mood ADD VALUE 'sad'; DROP TABLE a; CREATE TABLE a (x nosuchtype);`)
+	require.ErrorIs(t, err, ErrTypeNotFound)
+
+	// The objects held from before the failures are still those of the compiler,
+	// and only the statements that succeeded have changed them
+	assert.Same(t, catalog, c.Catalog)
+	assert.Same(t, types, c.TypeRegistry)
+	assert.Same(t, mood, assertType(t, c.TypeRegistry, "mood"))
+	assert.Equal(t, []string{"happy", "sad"}, mood.EnumValues)
+	sch, ok := catalog.Schemas.Get("public")
+	require.True(t, ok)
+	_, ok = sch.Tables.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"x"}, Columns(tab.Columns.List()).Names())
+	x, _ := tab.Columns.Get("x")
+	assert.Same(t, tab, x.Table)
+}
+
+func TestCompiler_ErrorTypes(t *testing.T) {
+	parseErr := func(stmts string) error {
+		t.Helper()
+		err := NewCompiler().ParseRaw(`CREATE TABLE users (id serial PRIMARY KEY, name text);
+		CREATE TABLE posts (id serial PRIMARY KEY, user_id integer REFERENCES users (id));` + stmts)
+		require.Error(t, err)
+		return err
+	}
+
+	err := parseErr(`ALTER TABLE missing ADD COLUMN x int;`)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrColumnNotFound)
+	var notFound *NotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "table", notFound.Kind)
+	assert.Equal(t, "missing", notFound.Name)
+
+	err = parseErr(`CREATE VIEW v AS SELECT * FROM missing;`)
+	assert.ErrorIs(t, err, ErrTableNotFound)
+
+	err = parseErr(`ALTER TABLE users DROP COLUMN missing;`)
+	assert.ErrorIs(t, err, ErrColumnNotFound)
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "missing", notFound.Name)
+
+	// Unknown types are reported rather than panicking
+	err = parseErr(`CREATE TABLE comments (id int, body missing_type);`)
+	assert.ErrorIs(t, err, ErrTypeNotFound)
+	assert.ErrorContains(t, err, "type missing_type does not exist")
+	err = parseErr(`ALTER TABLE users ALTER COLUMN name TYPE missing_type;`)
+	assert.ErrorIs(t, err, ErrTypeNotFound)
+	_, err = NewCompiler().TypeRegistry.MatchType("missing_type")
+	assert.ErrorIs(t, err, ErrTypeNotFound)
+
+	err = parseErr(`DROP TABLE users;`)
+	assert.ErrorIs(t, err, ErrDependency)
+	var dependency *DependencyError
+	require.ErrorAs(t, err, &dependency)
+	assert.Equal(t, "users", dependency.Object)
+	assert.Equal(t, "posts_user_id_fkey", dependency.Dependent)
+
+	err = parseErr(`CREATE TABLE users (id int);`)
+	assert.ErrorIs(t, err, ErrDuplicateObject)
+	var duplicate *DuplicateObjectError
+	require.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, "users", duplicate.Name)
+	assert.ErrorIs(t, parseErr(`ALTER TABLE users ADD COLUMN name text;`), ErrDuplicateObject)
+
+	// Unexpected parse tree nodes are reported rather than panicking
+	c := NewCompiler()
+	err = c.ParseStatements(&pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{
+		Stmt: &pg_query.Node{Node: &pg_query.Node_DropStmt{DropStmt: &pg_query.DropStmt{
+			RemoveType: pg_query.ObjectType_OBJECT_TABLE,
+			Objects:    []*pg_query.Node{pg_query.MakeStrNode("users")},
+		}}},
+	}}})
+	assert.ErrorIs(t, err, ErrUnexpectedNode)
+	assert.EqualError(t, err, "offset 0: expected List but got *pg_query.Node_String_")
+	for _, removeType := range []pg_query.ObjectType{pg_query.ObjectType_OBJECT_INDEX, pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_SEQUENCE} {
+		err = NewCompiler().ParseStatements(&pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{
+			Stmt: &pg_query.Node{Node: &pg_query.Node_DropStmt{DropStmt: &pg_query.DropStmt{
+				RemoveType: removeType,
+				Objects:    []*pg_query.Node{pg_query.MakeStrNode("users")},
+			}}},
+		}}})
+		assert.ErrorIs(t, err, ErrUnexpectedNode)
+	}
+
+	// Unknown values print as numbers
+	assert.Equal(t, "IdentityKind(9)", IdentityKind(9).String())
+	assert.Equal(t, "ForeignKeyAction(9)", ForeignKeyAction(9).String())
+	assert.Equal(t, "ForeignKeyMatch(9)", ForeignKeyMatch(9).String())
+	assert.Equal(t, "ConstraintType(9)", ConstraintType(9).String())
+	assert.Equal(t, "Change(9)", Change(9).String())
+	assert.Equal(t, "Severity(9)", Severity(9).String())
+}
+
+func TestCompiler_Diagnostics(t *testing.T) {
+	c := NewCompiler()
+	err := c.ParseFile("migrations/001_init.sql", joinNewline(
+		`CREATE TABLE users (id serial PRIMARY KEY);`,
+		`-- Posts belong to users`,
+		`CREATE TABLE posts (`,
+		`  id serial PRIMARY KEY,`,
+		`  user_id integer REFERENCES users (id)`,
+		`);  /* 'é' */ ALTER TABLE posts`,
+		`  ADD COLUMN title text,`,
+		`  DROP COLUMN missing;`,
+		`CREATE TABLE never (id int);`,
+	))
+	var diag *Diagnostic
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, "migrations/001_init.sql", diag.File)
+	assert.Equal(t, 6, diag.Line)
+	assert.Equal(t, 15, diag.Column)
+	assert.Equal(t, "ALTER TABLE posts\n  ADD COLUMN title text,\n  DROP COLUMN missing", diag.Statement)
+	assert.Equal(t, "migrations/001_init.sql:6:15: while altering table: column missing does not exist", err.Error())
+	assert.Equal(t, "while altering table: column missing does not exist", diag.Message())
+	assert.ErrorIs(t, err, ErrColumnNotFound)
+
+	err = NewCompiler().ParseRaw("CREATE TABLE users (id int);\n\n  CREATE TABLE users (id int)")
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, 3, diag.Line)
+	assert.Equal(t, 3, diag.Column)
+	assert.Equal(t, "CREATE TABLE users (id int)", diag.Statement)
+	assert.Regexp(t, `^3:3: `, err.Error())
+
+	err = NewCompiler().ParseFile("bad.sql", "SELECT 'é';\n  CREAT TABLE users (id int);")
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, `bad.sql:2:3: syntax error at or near "CREAT"`, err.Error())
+	assert.Equal(t, 15, diag.Offset)
+	assert.Empty(t, diag.Statement)
+
+	err = NewCompiler().ParseFile("bad.sql", "SELECT 1;\nCREATE TABLE users (")
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, `bad.sql:2:21: syntax error at end of input`, err.Error())
+
+	// Statements parsed elsewhere are located by their offset
+	parse, err := pg_query.Parse("CREATE TABLE users (id int); ALTER TABLE users DROP COLUMN missing;")
+	require.NoError(t, err)
+	err = NewCompiler().ParseStatements(parse)
+	require.ErrorAs(t, err, &diag)
+	assert.Equal(t, SeverityError, diag.Severity)
+	assert.Equal(t, 28, diag.Offset)
+	assert.Equal(t, "offset 28: while altering table: column missing does not exist", err.Error())
+	assert.ErrorIs(t, err, ErrColumnNotFound)
+}
+
+func TestCompiler_ContinueOnError(t *testing.T) {
+	c := NewCompiler()
+	c.ContinueOnError = true
+	err := c.ParseFile("001.sql", joinNewline(
+		`CREATE TABLE users (id serial PRIMARY KEY, name text);`,
+		`CREATE TABLE posts (id serial PRIMARY KEY, author_id integer REFERENCES authors (id));`,
+		`CREATE INDEX posts_author_id_idx ON posts (author_id);`,
+		`ALTER TABLE users ADD COLUMN email text, ADD COLUMN name text;`,
+		`CREATE UNIQUE INDEX users_email_idx ON users (email);`,
+		`CREATE VIEW post_authors AS SELECT p.id FROM posts p;`,
+		`CREATE VIEW recent_posts AS SELECT * FROM post_authors;`,
+		`ALTER TABLE users DROP COLUMN missing;`,
+		`CREATE TABLE comments (id serial PRIMARY KEY);`,
+	))
+	var diags Diagnostics
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, c.Diagnostics, diags)
+	require.Len(t, diags, 7)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7, 8}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.Nil(t, diags[0].Cause)
+	assert.Same(t, diags[0], diags[1].Cause)
+	assert.Nil(t, diags[2].Cause)
+	assert.Same(t, diags[2], diags[3].Cause)
+	assert.Same(t, diags[0], diags[4].Cause)
+	assert.Same(t, diags[0], diags[5].Cause)
+	assert.Nil(t, diags[6].Cause)
+	assert.Equal(t, "001.sql:3:1: while creating index: couldn't find table posts (cascading from the failed statement at 001.sql:2:1)",
+		diags[1].Error())
+	assert.ErrorIs(t, err, ErrTableNotFound)
+	assert.Empty(t, diags.Warnings())
+	assert.Len(t, diags.Errors(), 7)
+
+	// The statements that succeeded are applied
+	assertTable(t, c, "users")
+	assertTable(t, c, "comments")
+	_, err = c.FindTable("public", "posts")
+	assert.Error(t, err)
+
+	// Defining a failed object later means it's no longer the cause of failures
+	err = c.ParseFile("002.sql", joinNewline(
+		`CREATE TABLE posts (id serial PRIMARY KEY);`,
+		`CREATE INDEX posts_author_id_idx ON posts (author_id);`,
+		`CREATE VIEW post_authors AS SELECT p.id FROM posts p;`,
+	))
+	require.ErrorAs(t, err, &diags)
+	require.Len(t, diags, 1)
+	assert.Nil(t, diags[0].Cause)
+	assert.Len(t, c.Diagnostics, 8)
+	assertView(t, c, "post_authors")
+
+	// Failures only cascade to columns and constraints of the same table
+	err = c.ParseFile("002a.sql", joinNewline(
+		`CREATE TABLE accounts (id int);`,
+		`ALTER TABLE accounts ADD COLUMN region text, ADD COLUMN region text, ADD CONSTRAINT accounts_id_check CHECK (id > 0);`,
+		`CREATE INDEX accounts_region_idx ON accounts (region);`,
+		`CREATE INDEX comments_region_idx ON comments (region);`,
+		`ALTER TABLE accounts DROP CONSTRAINT accounts_id_check;`,
+		`ALTER TABLE comments DROP CONSTRAINT accounts_id_check;`,
+	))
+	require.ErrorAs(t, err, &diags)
+	require.Len(t, diags, 5)
+	assert.Nil(t, diags[0].Cause)
+	assert.Same(t, diags[0], diags[1].Cause)
+	assert.Nil(t, diags[2].Cause)
+	assert.Same(t, diags[0], diags[3].Cause)
+	assert.Nil(t, diags[4].Cause)
+
+	// A file with a syntax error is skipped, and the next is still applied
+	require.Error(t, c.ParseFile("003.sql", `CREAT TABLE tags (id int);`))
+	require.NoError(t, c.ParseFile("004.sql", `CREATE TABLE tags (id int);`))
+	assert.Len(t, c.Diagnostics, 14)
+	assert.Equal(t, "003.sql", c.Diagnostics[13].File)
+	assertTable(t, c, "tags")
+
+	// Statements parsed elsewhere are collected the same way
+	parse, err := pg_query.Parse(joinNewline(
+		`CREATE TABLE posts (id serial PRIMARY KEY, author_id integer REFERENCES authors (id));`,
+		`CREATE INDEX posts_author_id_idx ON posts (author_id);`,
+		`CREATE TABLE comments (id serial PRIMARY KEY);`,
+	))
+	require.NoError(t, err)
+	c = NewCompiler()
+	c.ContinueOnError = true
+	err = c.ParseStatements(parse)
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, c.Diagnostics, diags)
+	assert.Equal(t, []int{0, 86}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Offset }))
+	assert.Nil(t, diags[0].Cause)
+	assert.Same(t, diags[0], diags[1].Cause)
+	assertTable(t, c, "comments")
+}
+
+func TestCompiler_UnsupportedStatements(t *testing.T) {
+	sql := joinNewline(
+		`CREATE TABLE users (id serial PRIMARY KEY);`,
+		`CREATE FUNCTION touch() RETURNS trigger AS $$ BEGIN RETURN NEW; END $$ LANGUAGE plpgsql;`,
+		`INSERT INTO users DEFAULT VALUES;`,
+		`GRANT SELECT ON users TO PUBLIC;`,
+		`ALTER TABLE users ALTER COLUMN id SET STATISTICS 100, ADD COLUMN name text;`,
+		`ALTER TABLE users ADD COLUMN email text, INHERIT people;`,
+		`DROP FUNCTION touch();`,
+	)
+
+	c := NewCompiler()
+	require.NoError(t, c.ParseFile("001.sql", sql))
+	assert.Empty(t, c.Diagnostics)
+	require.Len(t, c.Skipped, 3)
+	assert.Equal(t, "001.sql:2:1: warning: CreateFunctionStmt statement is not supported", c.Skipped[0].Error())
+	assert.Equal(t, "001.sql:6:1: warning: ALTER TABLE subcommand AddInherit is not supported", c.Skipped[1].Error())
+	assert.Equal(t, "ALTER TABLE users ADD COLUMN email text, INHERIT people", c.Skipped[1].Statement)
+	assert.Equal(t, "001.sql:7:1: warning: DROP FUNCTION is not supported", c.Skipped[2].Error())
+	assert.ErrorIs(t, c.Skipped[0], ErrUnsupported)
+	assert.Equal(t, []string{"id", "name", "email"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+
+	c = NewCompiler()
+	c.Unsupported = WarnUnsupported
+	require.NoError(t, c.ParseFile("001.sql", sql))
+	assert.Len(t, c.Skipped, 3)
+	assert.Equal(t, c.Skipped, c.Diagnostics.Warnings())
+	assert.Empty(t, c.Diagnostics.Errors())
+
+	c = NewCompiler()
+	c.Unsupported = FailUnsupported
+	err := c.ParseFile("001.sql", sql)
+	assert.EqualError(t, err, "001.sql:2:1: CreateFunctionStmt statement is not supported")
+	var unsupported *UnsupportedError
+	require.ErrorAs(t, err, &unsupported)
+	assert.Equal(t, "CreateFunctionStmt statement", unsupported.What)
+
+	// A failing subcommand fails the whole statement
+	c = NewCompiler()
+	c.Unsupported = FailUnsupported
+	c.ContinueOnError = true
+	err = c.ParseFile("001.sql", sql)
+	var diags Diagnostics
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{2, 6, 7}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.Equal(t, []string{"id", "name"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+	assert.Empty(t, c.Skipped)
+
+	// Forms of supported statements that the compiler can't apply
+	sql = joinNewline(
+		`CREATE SCHEMA app;`,
+		`ALTER FUNCTION touch() RENAME TO poke;`,
+		`ALTER FUNCTION touch() SET SCHEMA app;`,
+		`ROLLBACK PREPARED 'y';`,
+		`PREPARE TRANSACTION 'x';`,
+		`COMMIT PREPARED 'x';`,
+		`CREATE SEQUENCE counter;`,
+		`ALTER SEQUENCE counter SET UNLOGGED;`,
+		`ALTER SEQUENCE counter OWNER TO admin;`,
+		`CREATE TABLE docs (id int);`,
+		`CREATE INDEX docs_id_idx ON docs (id);`,
+		`ALTER INDEX docs_id_idx SET (fillfactor = 70);`,
+		`ALTER INDEX docs_id_idx ATTACH PARTITION other_idx;`,
+	)
+	c = NewCompiler()
+	require.NoError(t, c.ParseFile("002.sql", sql))
+	assert.Equal(t, []string{
+		"002.sql:2:1: warning: renaming function is not supported",
+		"002.sql:3:1: warning: moving function to another schema is not supported",
+		"002.sql:4:1: warning: ROLLBACK PREPARED is not supported",
+		"002.sql:5:1: warning: PREPARE TRANSACTION is not supported",
+		"002.sql:6:1: warning: COMMIT PREPARED is not supported",
+		"002.sql:8:1: warning: ALTER SEQUENCE subcommand SetUnLogged is not supported",
+		"002.sql:13:1: warning: ALTER INDEX subcommand AttachPartition is not supported",
+	}, lo.Map(c.Skipped, func(d *Diagnostic, _ int) string { return d.Error() }))
+
+	c = NewCompiler()
+	c.Unsupported = FailUnsupported
+	c.ContinueOnError = true
+	err = c.ParseFile("002.sql", sql)
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 8, 13}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.ErrorIs(t, diags[2], ErrUnsupported)
+
+	// What a failed statement skipped isn't reported with the next statement
+	sql = joinNewline(
+		`CREATE TABLE p (id int);`,
+		`CREATE TABLE t (a int);`,
+		`ALTER TABLE t INHERIT p, ADD COLUMN a int;`,
+		`ALTER TABLE t ADD COLUMN b int;`,
+	)
+	c = NewCompiler()
+	c.ContinueOnError = true
+	err = c.ParseFile("003.sql", sql)
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{3}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.Empty(t, c.Skipped)
+	assert.Equal(t, []string{"a", "b"}, Columns(assertTable(t, c, "t").Columns.List()).Names())
+
+	// A SELECT calling a function may change the database in ways the
+	// compiler can't see, unless it only sets configuration or a sequence
+	sql = joinNewline(
+		`CREATE TABLE docs (id int);`,
+		`SELECT pg_catalog.set_config('search_path', 'public', false);`,
+		`SELECT pg_catalog.setval('docs_id_seq', 1, true), 1;`,
+		`SELECT create_hypertable('docs', 'id');`,
+		`SELECT app.migrate(), set_config('search_path', '', false);`,
+		`SELECT id FROM docs;`,
+	)
+	c = NewCompiler()
+	c.Unsupported = WarnUnsupported
+	require.NoError(t, c.ParseFile("004.sql", sql))
+	assert.Equal(t, []string{
+		"004.sql:4:1: warning: SELECT calling function create_hypertable is not supported",
+		"004.sql:5:1: warning: SELECT calling function app.migrate is not supported",
+		"004.sql:6:1: warning: SELECT of anything other than constants and function calls is not supported",
+	}, lo.Map(c.Diagnostics, func(d *Diagnostic, _ int) string { return d.Error() }))
+	assert.Equal(t, c.Skipped, c.Diagnostics.Warnings())
+	assert.Empty(t, c.SearchPath)
+
+	c = NewCompiler()
+	c.Unsupported = FailUnsupported
+	c.ContinueOnError = true
+	err = c.ParseFile("004.sql", sql)
+	require.ErrorAs(t, err, &diags)
+	assert.Equal(t, []int{4, 5, 6}, lo.Map(diags, func(d *Diagnostic, _ int) int { return d.Line }))
+	assert.ErrorIs(t, diags[0], ErrUnsupported)
+	// The failed statement's set_config wasn't applied
+	assert.Equal(t, []string{"public"}, c.SearchPath)
+}
+
+func TestCompiler_Clone(t *testing.T) {
+
+	c := assertParse(t, joinNewline(
+		`CREATE TYPE mood AS ENUM ('happy');`,
+		`CREATE TABLE users (id bigserial primary key, name text, m mood);`,
+		`CREATE TABLE orders (id int, user_id bigint references users (id));`,
+	))
+	clone := c.Clone()
+	require.NoError(t, clone.ParseRaw(joinNewline(
+		`ALTER TABLE users ADD COLUMN email text;`,
+		`ALTER TYPE mood ADD VALUE 'sad';`,
+		`ALTER TABLE orders ALTER COLUMN id SET NOT NULL;`,
+	)))
+	assert.Equal(t, []string{"id", "name", "m"}, Columns(assertTable(t, c, "users").Columns.List()).Names())
+	assert.Equal(t, []string{"id", "name", "m", "email"}, Columns(assertTable(t, clone, "users").Columns.List()).Names())
+	assert.Equal(t, []string{"happy"}, assertType(t, c.TypeRegistry, "mood").EnumValues)
+	origID, _ := assertTable(t, c, "orders").Columns.Get("id")
+	assert.False(t, origID.Attrs.NotNull)
+
+	// The objects of the clone refer to each other, not to those of the original
+	users := assertTable(t, clone, "users")
+	assert.NotSame(t, assertTable(t, c, "users"), users)
+	id, _ := users.Columns.Get("id")
+	assert.Same(t, users, id.Table)
+	m, _ := users.Columns.Get("m")
+	assert.Same(t, assertType(t, clone.TypeRegistry, "mood"), m.Type)
+	fkey := clone.Catalog.PgConstraint.ByName["public.orders.orders_user_id_fkey"]
+	require.NotNil(t, fkey)
+	assert.Same(t, users, fkey.RefersTable)
+	assert.Same(t, id, fkey.Refers[0])
+}
+
+func TestCompare(t *testing.T) {
+
+	old := assertParse(t, joinNewline(
+		`CREATE TYPE mood AS ENUM ('happy', 'sad');`,
+		`CREATE TABLE users (id bigserial primary key, name text not null, email text);`,
+		`CREATE TABLE orders (id int, user_id bigint references users (id) on delete cascade);`,
+		`CREATE INDEX ON users (name);`,
+	))
+	assert.Empty(t, Compare(old, old))
+	assert.Empty(t, Compare(old, old.Clone()))
+
+	new := assertParse(t, joinNewline(
+		`CREATE TYPE mood AS ENUM ('happy', 'sad', 'ok');`,
+		`CREATE TABLE users (id bigserial primary key, name varchar(50), phone text);`,
+		`CREATE TABLE orders (id int, user_id bigint references users (id));`,
+		`CREATE TYPE colour AS ENUM ('red');`,
+	))
+	diffs := Compare(old, new)
+	assert.Equal(t, joinNewline(
+		`type mood: enum values changed from happy, sad to happy, sad, ok`,
+		`table public.users: columns changed from id, name, email to id, name, phone`,
+		`column public.users.name: type changed from text to character varying`,
+		`column public.users.name: type modifiers changed from none to length 50`,
+		`column public.users.name: not null changed from true to false`,
+		`column public.users.email was removed`,
+		`constraint public.orders.orders_user_id_fkey: on delete changed from CASCADE to NO ACTION`,
+		`index public.users_name_idx was removed`,
+		`type colour was added`,
+		`column public.users.phone was added`,
+	), diffs.String())
+	assert.Equal(t, &Difference{
+		Change:    ChangeAltered,
+		Kind:      "column",
+		Name:      "public.users.name",
+		Attribute: "not null",
+		Old:       "true",
+		New:       "false",
+	}, diffs[4])
+
+	// Expression defaults are compared by their SQL
+	old = assertParse(t, `CREATE TABLE t (a int, b int DEFAULT 1+1);`)
+	new = assertParse(t, `CREATE TABLE t (a int DEFAULT 1+1, b int DEFAULT 1+2);`)
+	assert.Equal(t, joinNewline(
+		`column public.t.a: has default changed from false to true`,
+		`column public.t.a: default changed from none to 1 + 1`,
+		`column public.t.b: default changed from 1 + 1 to 1 + 2`,
+	), Compare(old, new).String())
+}
@@ -0,0 +1,181 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+func (c *Compiler) CreateCompositeType(stmt *pg_query.CompositeTypeStmt) error {
+
+	schema, err := c.CreationSchema(stmt.Typevar.Schemaname)
+	if err != nil {
+		return err
+	}
+	typeName := qualifiedTypeName(schema, stmt.Typevar.Relname)
+	if _, ok := c.TypeRegistry.LookupType(typeName); ok {
+		return duplicateObjectError("type", typeName, "type %s already exists", typeName)
+	}
+	typ := &PostgresType{
+		Name:          typeName,
+		Schema:        schema,
+		Description:   "composite type",
+		SimpleMatches: []string{typeName},
+		Composite:     &Composite{},
+	}
+	for _, n := range stmt.Coldeflist {
+		err := c.addTypeAttribute(typ, n.GetColumnDef())
+		if err != nil {
+			return err
+		}
+	}
+	return c.registerType(typ)
+}
+
+func (c *Compiler) addTypeAttribute(typ *PostgresType, def *pg_query.ColumnDef) error {
+
+	if typ.Composite.Attribute(def.Colname) != nil {
+		return duplicateObjectError("column", def.Colname, "column %s of relation %s already exists", def.Colname, typ.Name)
+	}
+	attr, err := c.typeAttributeFromDef(typ, def)
+	if err != nil {
+		return err
+	}
+	attr.Name = def.Colname
+	typ.Composite.Attributes = append(typ.Composite.Attributes, attr)
+	return nil
+}
+
+// typeAttributeFromDef reads the type of an attribute of a composite type.
+func (c *Compiler) typeAttributeFromDef(typ *PostgresType, def *pg_query.ColumnDef) (*TypeAttribute, error) {
+
+	attrType, err := c.FindTypeFromNode(def.TypeName)
+	if err != nil {
+		return nil, err
+	}
+	if attrType.IsSerial {
+		return nil, notFoundError("type", attrType.Name, "type %s does not exist", attrType.Name)
+	}
+	if containsType(attrType, typ) {
+		return nil, fmt.Errorf("composite type %s cannot be made a member of itself", typ.Name)
+	}
+	mods, err := TypeModifiersFromNode(def.TypeName, attrType)
+	if err != nil {
+		return nil, err
+	}
+	return &TypeAttribute{Type: attrType, Modifiers: mods}, nil
+}
+
+// containsType reports whether typ is, or is built from, the given type.
+func containsType(typ, contained *PostgresType) bool {
+
+	switch {
+	case typ == contained:
+		return true
+	case typ.IsArray():
+		return containsType(typ.ElementType, contained)
+	case typ.IsDomain():
+		return containsType(typ.Domain.BaseType, contained)
+	case typ.IsRange():
+		return containsType(typ.Range.Subtype, contained)
+	case typ.IsMultirange():
+		return containsType(typ.MultirangeOf, contained)
+	case typ.IsComposite():
+		return slices.ContainsFunc(typ.Composite.Attributes, func(attr *TypeAttribute) bool {
+			return containsType(attr.Type, contained)
+		})
+	}
+	return false
+}
+
+func (c *Compiler) findCompositeType(rv *pg_query.RangeVar) (*PostgresType, error) {
+
+	typ, ok := c.lookupType(rv.Schemaname, rv.Relname)
+	if !ok {
+		typeName := qualifiedTypeName(rv.Schemaname, rv.Relname)
+		return nil, notFoundError("type", typeName, "type %s does not exist", typeName)
+	}
+	if !typ.IsComposite() {
+		return nil, fmt.Errorf("%s is not a composite type", typ.Name)
+	}
+	return typ, nil
+}
+
+// AlterCompositeType handles the ADD, DROP and ALTER ATTRIBUTE forms of ALTER TYPE.
+func (c *Compiler) AlterCompositeType(stmt *pg_query.AlterTableStmt) error {
+
+	typ, err := c.findCompositeType(stmt.Relation)
+	if err != nil {
+		return err
+	}
+	c.changing(typ.Composite)
+	for _, cmd := range stmt.Cmds {
+		atc := cmd.GetAlterTableCmd()
+		switch atc.Subtype {
+		case pg_query.AlterTableType_AT_AddColumn:
+			{
+				err = c.addTypeAttribute(typ, atc.Def.GetColumnDef())
+				if err != nil {
+					return err
+				}
+			}
+		case pg_query.AlterTableType_AT_DropColumn:
+			{
+				idx := slices.IndexFunc(typ.Composite.Attributes, func(attr *TypeAttribute) bool { return attr.Name == atc.Name })
+				if idx < 0 {
+					if atc.MissingOk {
+						continue
+					}
+					return notFoundError("column", atc.Name, "column %s of relation %s does not exist", atc.Name, typ.Name)
+				}
+				typ.Composite.Attributes = slices.Delete(slices.Clone(typ.Composite.Attributes), idx, idx+1)
+			}
+		case pg_query.AlterTableType_AT_AlterColumnType:
+			{
+				attr := typ.Composite.Attribute(atc.Name)
+				if attr == nil {
+					return notFoundError("column", atc.Name, "column %s of relation %s does not exist", atc.Name, typ.Name)
+				}
+				// Stored values aren't rewritten, so the type can't change while it's in use
+				if users := c.typeUsers(typ); len(users) > 0 {
+					return dependencyError(typ.Name, users[0].FQName(), "cannot alter type %s because column %s.%s uses it", typ.Name, users[0].Table.Name, users[0].Name)
+				}
+				altered, err := c.typeAttributeFromDef(typ, atc.Def.GetColumnDef())
+				if err != nil {
+					return err
+				}
+				c.changing(attr)
+				attr.Type, attr.Modifiers = altered.Type, altered.Modifiers
+			}
+		default:
+			err = c.unsupported("ALTER TYPE subcommand " + strings.TrimPrefix(atc.Subtype.String(), "AT_"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) RenameTypeAttribute(stmt *pg_query.RenameStmt) error {
+
+	typ, err := c.findCompositeType(stmt.Relation)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	attr := typ.Composite.Attribute(stmt.Subname)
+	if attr == nil {
+		return notFoundError("column", stmt.Subname, "column %s does not exist", stmt.Subname)
+	}
+	if typ.Composite.Attribute(stmt.Newname) != nil {
+		return duplicateObjectError("column", stmt.Newname, "column %s of relation %s already exists", stmt.Newname, typ.Name)
+	}
+	c.changing(attr)
+	attr.Name = stmt.Newname
+	return nil
+}
@@ -0,0 +1,216 @@
+package pgmodelparse
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/pganalyze/pg_query_go/v6/parser"
+)
+
+// Severity says whether a Diagnostic is an error or a warning.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Diagnostic is an error located in a SQL file. Its Error method renders it
+// compiler-style as file:line:col: message.
+type Diagnostic struct {
+	Severity Severity
+	// File is the name of the file, or empty if the SQL didn't come from one.
+	File string
+	// Line and Column are the 1-based position of the statement or syntax error,
+	// or zero if the SQL isn't known. Columns count characters rather than bytes.
+	Line   int
+	Column int
+	// Offset is the 0-based byte offset of the position.
+	Offset int
+	// Statement is the text of the statement that failed, if the SQL parsed.
+	Statement string
+	Err       error
+	// Cause is the earlier failure this one cascades from, if the statement
+	// failed because it depends on an object a failed statement would have defined.
+	Cause *Diagnostic
+}
+
+func (d *Diagnostic) Error() string {
+
+	msg := d.Message()
+	if d.Severity == SeverityWarning {
+		msg = "warning: " + msg
+	}
+	if d.Cause != nil {
+		msg += fmt.Sprintf(" (cascading from the failed statement at %s)", d.Cause.Position())
+	}
+	return d.Position() + ": " + msg
+}
+
+// Position returns the location of the diagnostic as file:line:col,
+// or line:col if there is no file name, or as the offset if the line isn't known.
+func (d *Diagnostic) Position() string {
+
+	if d.Line == 0 {
+		return fmt.Sprintf("offset %d", d.Offset)
+	}
+	if d.File == "" {
+		return fmt.Sprintf("%d:%d", d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.Err
+}
+
+// Message returns the error without its position.
+func (d *Diagnostic) Message() string {
+	return d.Err.Error()
+}
+
+// Diagnostics is an ordered list of diagnostics, which can be returned as a
+// single error.
+type Diagnostics []*Diagnostic
+
+func (ds Diagnostics) Error() string {
+
+	msgs := make([]string, 0, len(ds))
+	for _, d := range ds {
+		msgs = append(msgs, d.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (ds Diagnostics) Unwrap() []error {
+
+	errs := make([]error, 0, len(ds))
+	for _, d := range ds {
+		errs = append(errs, d)
+	}
+	return errs
+}
+
+// Errors returns the diagnostics that are errors.
+func (ds Diagnostics) Errors() Diagnostics {
+	return ds.withSeverity(SeverityError)
+}
+
+// Warnings returns the diagnostics that are warnings.
+func (ds Diagnostics) Warnings() Diagnostics {
+	return ds.withSeverity(SeverityWarning)
+}
+
+func (ds Diagnostics) withSeverity(s Severity) Diagnostics {
+
+	var ret Diagnostics
+	for _, d := range ds {
+		if d.Severity == s {
+			ret = append(ret, d)
+		}
+	}
+	return ret
+}
+
+// statementDiagnostic locates an error from applying a statement of the SQL.
+func statementDiagnostic(file, sql string, stmt *pg_query.RawStmt, err error) *Diagnostic {
+
+	start := int(stmt.StmtLocation)
+	end := len(sql)
+	if stmt.StmtLen > 0 {
+		end = start + int(stmt.StmtLen)
+	}
+	// Statements after the first start at the end of the previous
+	// one, so skip the whitespace and comments in between
+	start = skipSpaceAndComments(sql, start, end)
+	d := newDiagnostic(file, sql, start, err)
+	d.Statement = strings.TrimSpace(sql[start:end])
+	return d
+}
+
+// syntaxDiagnostic locates an error from parsing the SQL.
+func syntaxDiagnostic(file, sql string, err error) *Diagnostic {
+
+	offset := 0
+	var parseErr *parser.Error
+	if errors.As(err, &parseErr) && parseErr.Cursorpos > 0 {
+		// The cursor position counts characters from 1, and may be
+		// just past the end for an unexpected end of input
+		offset = len(sql)
+		chars := 0
+		for i := range sql {
+			if chars++; chars == parseErr.Cursorpos {
+				offset = i
+				break
+			}
+		}
+	}
+	return newDiagnostic(file, sql, offset, err)
+}
+
+func newDiagnostic(file, sql string, offset int, err error) *Diagnostic {
+
+	lineStart := strings.LastIndexByte(sql[:offset], '\n') + 1
+	return &Diagnostic{
+		File:   file,
+		Line:   strings.Count(sql[:offset], "\n") + 1,
+		Column: utf8.RuneCountInString(sql[lineStart:offset]) + 1,
+		Offset: offset,
+		Err:    err,
+	}
+}
+
+// skipSpaceAndComments returns the offset of the first character from start
+// that isn't whitespace or part of a comment, or end if there is none.
+func skipSpaceAndComments(sql string, start, end int) int {
+
+	for start < end {
+		rest := sql[start:end]
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			newline := strings.IndexByte(rest, '\n')
+			if newline < 0 {
+				return end
+			}
+			start += newline + 1
+		case strings.HasPrefix(rest, "/*"):
+			// Block comments nest
+			depth, i := 0, 0
+			for i < len(rest) {
+				if strings.HasPrefix(rest[i:], "/*") {
+					depth, i = depth+1, i+2
+				} else if strings.HasPrefix(rest[i:], "*/") {
+					depth, i = depth-1, i+2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			start += i
+		default:
+			r, size := utf8.DecodeRuneInString(rest)
+			if !unicode.IsSpace(r) {
+				return start
+			}
+			start += size
+		}
+	}
+	return end
+}
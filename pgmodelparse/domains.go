@@ -0,0 +1,243 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// domainOf returns the type if it is a domain, or nil.
+func domainOf(typ *PostgresType) *PostgresType {
+	if typ.IsDomain() {
+		return typ
+	}
+	return nil
+}
+
+func (c *Compiler) CreateDomain(stmt *pg_query.CreateDomainStmt) error {
+
+	schema, typeName, err := c.typeName(stmt.Domainname)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.TypeRegistry.LookupType(typeName); ok {
+		return duplicateObjectError("type", typeName, "type %s already exists", typeName)
+	}
+	base, err := c.FindTypeFromNode(stmt.TypeName)
+	if err != nil {
+		return err
+	}
+	if base.IsSerial {
+		return notFoundError("type", base.Name, "type %s does not exist", base.Name)
+	}
+	mods, err := TypeModifiersFromNode(stmt.TypeName, base)
+	if err != nil {
+		return err
+	}
+	typ := &PostgresType{
+		Name:          typeName,
+		Schema:        schema,
+		Description:   "domain over " + base.Name,
+		SimpleMatches: []string{typeName},
+		Domain:        &Domain{BaseType: base, Modifiers: mods},
+	}
+	var sawNull, sawNotNull bool
+	for _, n := range stmt.Constraints {
+		con := n.GetConstraint()
+		switch con.Contype {
+		case pg_query.ConstrType_CONSTR_NOTNULL:
+			sawNotNull = true
+			typ.Domain.NotNull = true
+		case pg_query.ConstrType_CONSTR_NULL:
+			sawNull = true
+		case pg_query.ConstrType_CONSTR_DEFAULT:
+			if typ.Domain.Default != "" {
+				return fmt.Errorf("multiple default expressions")
+			}
+			typ.Domain.Default, err = DeparseExpr(con.RawExpr)
+			if err != nil {
+				return err
+			}
+		case pg_query.ConstrType_CONSTR_CHECK:
+			err = addDomainCheck(typ, con)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s constraints not possible for domains", domainConstraintKind(con.Contype))
+		}
+	}
+	if sawNull && sawNotNull {
+		return fmt.Errorf("conflicting NULL/NOT NULL constraints")
+	}
+	return c.registerType(typ)
+}
+
+// addDomainCheck adds a CHECK constraint to a domain, naming it after the domain if no name was given.
+func addDomainCheck(typ *PostgresType, con *pg_query.Constraint) error {
+
+	var err error
+	WalkNodes(con.RawExpr, func(n *pg_query.Node) bool {
+		if _, ok := n.Node.(*pg_query.Node_SubLink); ok {
+			err = fmt.Errorf("cannot use subquery in check constraint")
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, ref := range ColumnRefNames(con.RawExpr) {
+		if ref != "value" {
+			return notFoundError("column", ref, "column %s does not exist", ref)
+		}
+	}
+	expr, err := DeparseExpr(con.RawExpr)
+	if err != nil {
+		return err
+	}
+	name := con.Conname
+	if name == "" {
+		simpleName := strings.TrimPrefix(typ.Name, typ.Schema+".")
+		name = MakeObjectName(simpleName, "", "check")
+		for pass := 1; findDomainCheck(typ, name) >= 0; pass++ {
+			name = MakeObjectName(simpleName, "", "check"+strconv.Itoa(pass))
+		}
+	} else if findDomainCheck(typ, name) >= 0 {
+		return duplicateObjectError("constraint", name, "constraint %s for domain %s already exists", name, typ.Name)
+	}
+	typ.Domain.Checks = append(typ.Domain.Checks, &DomainCheck{Name: name, Expression: expr, NotValid: con.SkipValidation})
+	return nil
+}
+
+func findDomainCheck(typ *PostgresType, name string) int {
+	return slices.IndexFunc(typ.Domain.Checks, func(check *DomainCheck) bool { return check.Name == name })
+}
+
+func domainConstraintKind(t pg_query.ConstrType) string {
+
+	switch t {
+	case pg_query.ConstrType_CONSTR_PRIMARY:
+		return "primary key"
+	case pg_query.ConstrType_CONSTR_UNIQUE:
+		return "unique"
+	case pg_query.ConstrType_CONSTR_FOREIGN:
+		return "foreign key"
+	case pg_query.ConstrType_CONSTR_EXCLUSION:
+		return "exclusion"
+	case pg_query.ConstrType_CONSTR_GENERATED, pg_query.ConstrType_CONSTR_IDENTITY:
+		return "generated column"
+	}
+	return "specifying constraint deferrability"
+}
+
+func (c *Compiler) findDomain(names []*pg_query.Node) (*PostgresType, error) {
+
+	typ, err := c.findTypeFromNameList(names)
+	if err != nil {
+		return nil, err
+	}
+	if !typ.IsDomain() {
+		return nil, fmt.Errorf("%s is not a domain", typ.Name)
+	}
+	return typ, nil
+}
+
+func (c *Compiler) AlterDomain(stmt *pg_query.AlterDomainStmt) error {
+
+	typ, err := c.findDomain(stmt.TypeName)
+	if err != nil {
+		return err
+	}
+	c.changing(typ.Domain)
+	switch stmt.Subtype {
+	case "T": // SET DEFAULT or DROP DEFAULT
+		if stmt.Def == nil {
+			typ.Domain.Default = ""
+			return nil
+		}
+		typ.Domain.Default, err = DeparseExpr(stmt.Def)
+		return err
+	case "O": // SET NOT NULL
+		typ.Domain.NotNull = true
+	case "N": // DROP NOT NULL
+		typ.Domain.NotNull = false
+	case "C": // ADD CONSTRAINT
+		con := stmt.Def.GetConstraint()
+		switch con.GetContype() {
+		case pg_query.ConstrType_CONSTR_CHECK:
+			return addDomainCheck(typ, con)
+		case pg_query.ConstrType_CONSTR_NOTNULL:
+			typ.Domain.NotNull = true
+		default:
+			return fmt.Errorf("%s constraints not possible for domains", domainConstraintKind(con.GetContype()))
+		}
+	case "X": // DROP CONSTRAINT
+		idx := findDomainCheck(typ, stmt.Name)
+		if idx < 0 {
+			if stmt.MissingOk {
+				return nil
+			}
+			return notFoundError("constraint", stmt.Name, "constraint %s of domain %s does not exist", stmt.Name, typ.Name)
+		}
+		typ.Domain.Checks = slices.Delete(slices.Clone(typ.Domain.Checks), idx, idx+1)
+	case "V": // VALIDATE CONSTRAINT
+		idx := findDomainCheck(typ, stmt.Name)
+		if idx < 0 {
+			return notFoundError("constraint", stmt.Name, "constraint %s of domain %s does not exist", stmt.Name, typ.Name)
+		}
+		c.changing(typ.Domain.Checks[idx])
+		typ.Domain.Checks[idx].NotValid = false
+	default:
+		return fmt.Errorf("unrecognized ALTER DOMAIN subtype %s", stmt.Subtype)
+	}
+	return nil
+}
+
+func (c *Compiler) RenameDomainConstraint(names []*pg_query.Node, oldName, newName string) error {
+
+	typ, err := c.findDomain(names)
+	if err != nil {
+		return err
+	}
+	idx := findDomainCheck(typ, oldName)
+	if idx < 0 {
+		return notFoundError("constraint", oldName, "constraint %s of domain %s does not exist", oldName, typ.Name)
+	}
+	if findDomainCheck(typ, newName) >= 0 {
+		return duplicateObjectError("constraint", newName, "constraint %s for domain %s already exists", newName, typ.Name)
+	}
+	c.changing(typ.Domain.Checks[idx])
+	typ.Domain.Checks[idx].Name = newName
+	return nil
+}
+
+func (c *Compiler) DropDomains(stmt *pg_query.DropStmt) error {
+
+	behav := DropBehaviourRestrict
+	if stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		behav = DropBehaviourCascade
+	}
+	for _, n := range stmt.Objects {
+		typ, err := c.findDomain(n.GetTypeName().GetNames())
+		if err != nil {
+			if stmt.MissingOk && !c.typeExists(n.GetTypeName().GetNames()) {
+				continue
+			}
+			return err
+		}
+		err = c.DropType(typ, behav)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) typeExists(names []*pg_query.Node) bool {
+
+	_, err := c.findTypeFromNameList(names)
+	return err == nil
+}
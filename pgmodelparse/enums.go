@@ -0,0 +1,57 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// AlterEnum handles ALTER TYPE ... ADD VALUE and RENAME VALUE.
+func (c *Compiler) AlterEnum(stmt *pg_query.AlterEnumStmt) error {
+
+	typ, err := c.findTypeFromNameList(stmt.TypeName)
+	if err != nil {
+		return err
+	}
+	if !typ.IsEnum() {
+		return fmt.Errorf("%s is not an enum", typ.Name)
+	}
+	if stmt.OldVal != "" {
+		return c.renameEnumValue(typ, stmt.OldVal, stmt.NewVal)
+	}
+	if slices.Contains(typ.EnumValues, stmt.NewVal) {
+		if stmt.SkipIfNewValExists {
+			return nil
+		}
+		return duplicateObjectError("enum label", stmt.NewVal, "enum label %s already exists", stmt.NewVal)
+	}
+	pos := len(typ.EnumValues)
+	if stmt.NewValNeighbor != "" {
+		pos = slices.Index(typ.EnumValues, stmt.NewValNeighbor)
+		if pos < 0 {
+			return fmt.Errorf("%s is not an existing enum label", stmt.NewValNeighbor)
+		}
+		if stmt.NewValIsAfter {
+			pos++
+		}
+	}
+	c.changing(typ)
+	typ.EnumValues = slices.Insert(slices.Clone(typ.EnumValues), pos, stmt.NewVal)
+	return nil
+}
+
+func (c *Compiler) renameEnumValue(typ *PostgresType, oldVal, newVal string) error {
+
+	pos := slices.Index(typ.EnumValues, oldVal)
+	if pos < 0 {
+		return fmt.Errorf("%s is not an existing enum label", oldVal)
+	}
+	if slices.Contains(typ.EnumValues, newVal) {
+		return duplicateObjectError("enum label", newVal, "enum label %s already exists", newVal)
+	}
+	c.changing(typ)
+	typ.EnumValues = slices.Clone(typ.EnumValues)
+	typ.EnumValues[pos] = newVal
+	return nil
+}
@@ -0,0 +1,148 @@
+package pgmodelparse
+
+import (
+	"errors"
+	"fmt"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Errors returned by the compiler can be classified with errors.Is using
+// these sentinels, or inspected with errors.As using the error types below.
+var (
+	// ErrNotFound matches every NotFoundError.
+	ErrNotFound = errors.New("object not found")
+	// ErrTableNotFound matches a missing table or other relation.
+	ErrTableNotFound = errors.New("table not found")
+	// ErrColumnNotFound matches a missing column.
+	ErrColumnNotFound = errors.New("column not found")
+	// ErrTypeNotFound matches a missing type.
+	ErrTypeNotFound = errors.New("type not found")
+	// ErrDependency matches a DependencyError.
+	ErrDependency = errors.New("dependent objects exist")
+	// ErrDuplicateObject matches a DuplicateObjectError.
+	ErrDuplicateObject = errors.New("object already exists")
+	// ErrUnexpectedNode matches an UnexpectedNodeError.
+	ErrUnexpectedNode = errors.New("unexpected parse tree node")
+	// ErrUnsupported matches an UnsupportedError.
+	ErrUnsupported = errors.New("not supported")
+	// ErrTransactionAborted is returned for the statements of a transaction
+	// after one has failed, until it is rolled back.
+	ErrTransactionAborted = errors.New("current transaction is aborted, commands ignored until end of transaction block")
+	// ErrTransactionNotCommitted is returned when a file ends in a transaction
+	// it began, which is rolled back.
+	ErrTransactionNotCommitted = errors.New("transaction was not committed by the end of the file, so it is rolled back")
+)
+
+// NotFoundError reports that a statement refers to an object that doesn't exist.
+type NotFoundError struct {
+	// Kind is the kind of object, e.g. "table", "column" or "type".
+	Kind string
+	Name string
+	// Table is the qualified name of the table a missing column or
+	// constraint belongs to, if known.
+	Table string
+	msg   string
+}
+
+func notFoundError(kind, name, format string, args ...any) error {
+	return &NotFoundError{Kind: kind, Name: name, msg: fmt.Sprintf(format, args...)}
+}
+
+// notFoundInTableError reports a missing column or constraint of a table.
+func notFoundInTableError(kind string, t *Table, name, format string, args ...any) error {
+	return &NotFoundError{Kind: kind, Name: name, Table: t.FQName(), msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *NotFoundError) Error() string {
+	return e.msg
+}
+
+func (e *NotFoundError) Is(target error) bool {
+
+	switch target {
+	case ErrNotFound:
+		return true
+	case ErrTableNotFound:
+		return e.Kind == "table" || e.Kind == "relation"
+	case ErrColumnNotFound:
+		return e.Kind == "column"
+	case ErrTypeNotFound:
+		return e.Kind == "type"
+	}
+	return false
+}
+
+// DuplicateObjectError reports that an object can't be created or renamed
+// because one with the same name already exists.
+type DuplicateObjectError struct {
+	// Kind is the kind of object, e.g. "relation", "column" or "type".
+	Kind string
+	Name string
+	msg  string
+}
+
+func duplicateObjectError(kind, name, format string, args ...any) error {
+	return &DuplicateObjectError{Kind: kind, Name: name, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *DuplicateObjectError) Error() string {
+	return e.msg
+}
+
+func (e *DuplicateObjectError) Is(target error) bool {
+	return target == ErrDuplicateObject
+}
+
+// DependencyError reports that an object can't be dropped or altered
+// because another object depends on it.
+type DependencyError struct {
+	// Object is the name of the object being dropped or altered.
+	Object string
+	// Dependent is the name of the object that depends on it.
+	Dependent string
+	msg       string
+}
+
+func dependencyError(object, dependent, format string, args ...any) error {
+	return &DependencyError{Object: object, Dependent: dependent, msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *DependencyError) Error() string {
+	return e.msg
+}
+
+func (e *DependencyError) Is(target error) bool {
+	return target == ErrDependency
+}
+
+// UnexpectedNodeError reports a parse tree node of a kind the compiler
+// doesn't handle where it was found.
+type UnexpectedNodeError struct {
+	// Expected describes the kind of node that was expected, e.g. "String".
+	Expected string
+	Node     *pg_query.Node
+}
+
+func (e *UnexpectedNodeError) Error() string {
+	return fmt.Sprintf("expected %s but got %T", e.Expected, e.Node.GetNode())
+}
+
+func (e *UnexpectedNodeError) Is(target error) bool {
+	return target == ErrUnexpectedNode
+}
+
+// UnsupportedError reports a statement, or subcommand of one, that the
+// compiler doesn't know how to apply to the catalog.
+type UnsupportedError struct {
+	// What describes what isn't supported, e.g. "CreateFunctionStmt statement".
+	What string
+}
+
+func (e *UnsupportedError) Error() string {
+	return e.What + " is not supported"
+}
+
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
@@ -0,0 +1,134 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WalkNodes calls fn for every Node reachable from msg, depth first.
+// Returning false from fn skips the children of that node.
+func WalkNodes(msg proto.Message, fn func(n *pg_query.Node) bool) {
+
+	walkMessage(msg.ProtoReflect(), fn)
+}
+
+func walkMessage(m protoreflect.Message, fn func(n *pg_query.Node) bool) {
+
+	if n, ok := m.Interface().(*pg_query.Node); ok {
+		if !fn(n) {
+			return
+		}
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		switch {
+		case fd.IsList():
+			l := v.List()
+			for i := 0; i < l.Len(); i++ {
+				walkMessage(l.Get(i).Message(), fn)
+			}
+		case fd.IsMap():
+		default:
+			walkMessage(v.Message(), fn)
+		}
+		return true
+	})
+}
+
+// ColumnRefNames returns the names of all columns referenced in the expression,
+// in order of first appearance. Qualifiers are discarded.
+func ColumnRefNames(n *pg_query.Node) []string {
+
+	if n == nil {
+		return nil
+	}
+	var ret []string
+	seen := make(map[string]struct{})
+	WalkNodes(n, func(n *pg_query.Node) bool {
+		ref, ok := n.Node.(*pg_query.Node_ColumnRef)
+		if !ok {
+			return true
+		}
+		fields := ref.ColumnRef.Fields
+		if len(fields) == 0 {
+			return false
+		}
+		s, ok := fields[len(fields)-1].Node.(*pg_query.Node_String_)
+		if !ok {
+			return false
+		}
+		if _, ok := seen[s.String_.Sval]; !ok {
+			seen[s.String_.Sval] = struct{}{}
+			ret = append(ret, s.String_.Sval)
+		}
+		return false
+	})
+	return ret
+}
+
+// ColumnsFromExpr resolves every column referenced by the expression against the table.
+func ColumnsFromExpr(t *Table, n *pg_query.Node) (Columns, error) {
+
+	return ColumnsFromColNames(t, ColumnRefNames(n))
+}
+
+// DeparseExpr renders an expression node back into SQL.
+func DeparseExpr(n *pg_query.Node) (string, error) {
+
+	stmt := &pg_query.Node{Node: &pg_query.Node_SelectStmt{SelectStmt: &pg_query.SelectStmt{
+		TargetList: []*pg_query.Node{pg_query.MakeResTargetNodeWithVal(n, 0)},
+	}}}
+	sql, err := pg_query.Deparse(&pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{Stmt: stmt}}})
+	if err != nil {
+		return "", fmt.Errorf("deparsing expression: %w", err)
+	}
+	return strings.TrimPrefix(sql, "SELECT "), nil
+}
+
+// ParseExpr parses an expression previously rendered by DeparseExpr.
+func ParseExpr(expr string) (*pg_query.Node, error) {
+
+	parse, err := pg_query.Parse("SELECT " + expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing expression: %w", err)
+	}
+	if len(parse.Stmts) != 1 {
+		return nil, fmt.Errorf("expected a single expression but got %d statements", len(parse.Stmts))
+	}
+	targets := parse.Stmts[0].Stmt.GetSelectStmt().GetTargetList()
+	if len(targets) != 1 {
+		return nil, fmt.Errorf("expected a single expression: %s", expr)
+	}
+	return targets[0].GetResTarget().GetVal(), nil
+}
+
+// RenameColumnRefs rewrites an expression rendered by DeparseExpr so that its
+// references to the column oldName refer to newName instead.
+func RenameColumnRefs(expr, oldName, newName string) (string, error) {
+
+	n, err := ParseExpr(expr)
+	if err != nil {
+		return "", err
+	}
+	WalkNodes(n, func(n *pg_query.Node) bool {
+		ref, ok := n.Node.(*pg_query.Node_ColumnRef)
+		if !ok {
+			return true
+		}
+		fields := ref.ColumnRef.Fields
+		if len(fields) == 0 {
+			return false
+		}
+		if s, ok := fields[len(fields)-1].Node.(*pg_query.Node_String_); ok && s.String_.Sval == oldName {
+			s.String_.Sval = newName
+		}
+		return false
+	})
+	return DeparseExpr(n)
+}
@@ -0,0 +1,188 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// DefineIdentity makes the column GENERATED ... AS IDENTITY, creating its sequence.
+func (c *Compiler) DefineIdentity(col *Column, v *pg_query.Constraint) error {
+
+	if col.Attrs.Identity != IdentityNone {
+		return fmt.Errorf("multiple identity specifications for column %s of table %s", col.Name, col.Table.Name)
+	}
+	if col.Attrs.HasExplicitDefault || col.Attrs.HasSequence {
+		return fmt.Errorf("both default and identity specified for column %s of table %s", col.Name, col.Table.Name)
+	}
+	if col.Attrs.GeneratedExpression != "" {
+		return fmt.Errorf("both identity and generation expression specified for column %s of table %s", col.Name, col.Table.Name)
+	}
+	if _, ok := sequenceTypeBounds[col.Type]; !ok {
+		return fmt.Errorf("identity column type must be smallint, integer, or bigint")
+	}
+	seq, err := c.CreateOwnedSequence(col, col.Type, v.Options)
+	if err != nil {
+		return err
+	}
+	c.changing(col.Attrs)
+	col.Attrs.Identity = identityKind(v.GeneratedWhen)
+	col.Attrs.IdentitySequence = seq
+	col.Attrs.HasSequence = true
+	col.Attrs.SequenceName = seq.Name
+	// Identity columns are implicitly NOT NULL
+	col.Attrs.NotNull = true
+	return nil
+}
+
+// DefineGenerated makes the column GENERATED ALWAYS AS (expr) STORED.
+func (c *Compiler) DefineGenerated(col *Column, v *pg_query.Constraint) error {
+
+	if col.Attrs.GeneratedExpression != "" {
+		return fmt.Errorf("multiple generation clauses specified for column %s of table %s", col.Name, col.Table.Name)
+	}
+	if col.Attrs.Identity != IdentityNone {
+		return fmt.Errorf("both identity and generation expression specified for column %s of table %s", col.Name, col.Table.Name)
+	}
+	if col.Attrs.HasExplicitDefault || col.Attrs.HasSequence {
+		return fmt.Errorf("both default and generation expression specified for column %s of table %s", col.Name, col.Table.Name)
+	}
+	var err error
+	WalkNodes(v.RawExpr, func(n *pg_query.Node) bool {
+		if _, ok := n.Node.(*pg_query.Node_SubLink); ok {
+			err = fmt.Errorf("cannot use subquery in column generation expression")
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	refs, err := ColumnsFromExpr(col.Table, v.RawExpr)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if ref == col || ref.Attrs.GeneratedExpression != "" {
+			return fmt.Errorf("cannot use generated column %s in column generation expression", ref.Name)
+		}
+	}
+	c.changing(col.Attrs)
+	col.Attrs.GeneratedExpression, err = DeparseExpr(v.RawExpr)
+	col.Attrs.GeneratedFrom = refs
+	return err
+}
+
+func (c *Compiler) AddIdentity(t *Table, colName string, v *pg_query.Constraint) error {
+
+	col, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s of relation %s does not exist", colName, t.Name)
+	}
+	if col.Attrs.Identity != IdentityNone {
+		return fmt.Errorf("column %s of relation %s is already an identity column", col.Name, t.Name)
+	}
+	if !col.Attrs.IsNotNull() {
+		return fmt.Errorf("column %s of relation %s must be declared NOT NULL before identity can be added", col.Name, t.Name)
+	}
+	if col.Attrs.HasExplicitDefault || col.Attrs.HasSequence {
+		return fmt.Errorf("column %s of relation %s already has a default value", col.Name, t.Name)
+	}
+	return c.DefineIdentity(col, v)
+}
+
+// SetIdentity handles ALTER COLUMN SET GENERATED and the sequence options that can accompany it.
+func (c *Compiler) SetIdentity(t *Table, colName string, options []*pg_query.Node) error {
+
+	col, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s of relation %s does not exist", colName, t.Name)
+	}
+	if col.Attrs.Identity == IdentityNone {
+		return fmt.Errorf("column %s of relation %s is not an identity column", col.Name, t.Name)
+	}
+	for _, n := range options {
+		def := n.GetDefElem()
+		if def != nil && def.Defname == "generated" {
+			c.changing(col.Attrs)
+			col.Attrs.Identity = identityKind(string(rune(def.Arg.GetInteger().GetIval())))
+		}
+	}
+	return c.ApplySequenceOptions(col.Attrs.IdentitySequence, options)
+}
+
+func (c *Compiler) DropIdentity(t *Table, colName string, missingOk bool) error {
+
+	col, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s of relation %s does not exist", colName, t.Name)
+	}
+	if col.Attrs.Identity == IdentityNone {
+		if missingOk {
+			return nil
+		}
+		return fmt.Errorf("column %s of relation %s is not an identity column", col.Name, t.Name)
+	}
+	seq := col.Attrs.IdentitySequence
+	if sch, ok := c.Catalog.Schemas.Get(seq.Schema); ok {
+		c.changing(sch)
+		sch.Sequences.Remove(seq.Name)
+	}
+	c.changing(col.Attrs)
+	col.Attrs.Identity = IdentityNone
+	col.Attrs.IdentitySequence = nil
+	col.Attrs.HasSequence = false
+	col.Attrs.SequenceName = ""
+	return nil
+}
+
+// DropExpression turns a generated column into an ordinary one.
+func (c *Compiler) DropExpression(t *Table, colName string, missingOk bool) error {
+
+	col, ok := t.Columns.Get(colName)
+	if !ok {
+		return notFoundInTableError("column", t, colName, "column %s of relation %s does not exist", colName, t.Name)
+	}
+	if col.Attrs.GeneratedExpression == "" {
+		if missingOk {
+			return nil
+		}
+		return fmt.Errorf("column %s of relation %s is not a stored generated column", col.Name, t.Name)
+	}
+	c.changing(col.Attrs)
+	col.Attrs.GeneratedExpression = ""
+	col.Attrs.GeneratedFrom = nil
+	return nil
+}
+
+// generatedDependents returns the generated columns whose expressions use the column.
+func generatedDependents(col *Column) Columns {
+
+	var ret Columns
+	for _, other := range col.Table.Columns.List() {
+		if slices.Contains(other.Attrs.GeneratedFrom, col) {
+			ret = append(ret, other)
+		}
+	}
+	return ret
+}
+
+// matchGeneratedFrom points the generated columns that a table has copied
+// from another at the table's own columns.
+func (c *Compiler) matchGeneratedFrom(t *Table) {
+
+	for _, col := range t.Columns.List() {
+		if len(col.Attrs.GeneratedFrom) > 0 && col.Attrs.GeneratedFrom[0].Table != t {
+			c.changing(col.Attrs)
+			col.Attrs.GeneratedFrom = matchingColumns(t, col.Attrs.GeneratedFrom)
+		}
+	}
+}
+
+func identityKind(generatedWhen string) IdentityKind {
+
+	if generatedWhen == "d" {
+		return IdentityByDefault
+	}
+	return IdentityAlways
+}
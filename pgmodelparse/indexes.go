@@ -0,0 +1,478 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+func (c *Compiler) CreateIndex(stmt *pg_query.IndexStmt) error {
+
+	idx := &Index{
+		Name:             stmt.Idxname,
+		Unique:           stmt.Unique,
+		NullsNotDistinct: stmt.NullsNotDistinct,
+		Concurrently:     stmt.Concurrent,
+	}
+	tab, err := c.FindTableFromRangeVar(stmt.Relation)
+	if err != nil {
+		// Materialized views can be indexed too
+		v, viewErr := c.FindView(stmt.Relation.Schemaname, stmt.Relation.Relname)
+		if viewErr != nil {
+			return err
+		}
+		if !v.Materialized {
+			return fmt.Errorf("cannot create index on view %s", v.Name)
+		}
+		return c.createViewIndex(stmt, idx, v)
+	}
+	idx.Table = tab
+	sch, ok := c.Catalog.Schemas.Get(tab.Schema)
+	if !ok {
+		return notFoundError("schema", tab.Schema, "did not find schema %s", tab.Schema)
+	}
+	exists, err := checkIndexOptions(stmt, sch, idx)
+	if exists || err != nil {
+		return err
+	}
+	for _, n := range stmt.IndexParams {
+		elem, ok := n.Node.(*pg_query.Node_IndexElem)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "IndexElem", Node: n}
+		}
+		key, err := c.IndexKeyFromElem(tab, elem.IndexElem)
+		if err != nil {
+			return err
+		}
+		idx.Keys = append(idx.Keys, key)
+	}
+	for _, n := range stmt.IndexIncludingParams {
+		elem, ok := n.Node.(*pg_query.Node_IndexElem)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "IndexElem", Node: n}
+		}
+		if elem.IndexElem.Expr != nil {
+			return fmt.Errorf("expressions are not supported in included columns")
+		}
+		col, err := ColumnFromColName(tab, elem.IndexElem.Name)
+		if err != nil {
+			return err
+		}
+		idx.Include = append(idx.Include, col)
+	}
+	if stmt.WhereClause != nil {
+		idx.Predicate, err = DeparseExpr(stmt.WhereClause)
+		if err != nil {
+			return err
+		}
+		idx.PredicateColumns, err = ColumnsFromExpr(tab, stmt.WhereClause)
+		if err != nil {
+			return err
+		}
+	}
+	if idx.Name == "" {
+		idx.Name = ChooseRelationName(sch, tab.Name, indexNameAddition(slices.Concat(stmt.IndexParams, stmt.IndexIncludingParams)), "idx")
+	}
+	return c.addIndex(idx)
+}
+
+// checkIndexOptions checks the name and access method of a new index,
+// setting its method. It reports whether an index of the same name exists
+// and the statement says to skip creating it.
+func checkIndexOptions(stmt *pg_query.IndexStmt, sch *Schema, idx *Index) (bool, error) {
+
+	if stmt.Idxname != "" && sch.HasRelation(stmt.Idxname) {
+		if stmt.IfNotExists {
+			return true, nil
+		}
+		return false, duplicateObjectError("relation", stmt.Idxname, "relation %s already exists", stmt.Idxname)
+	}
+	idx.Method = IndexMethod(stmt.AccessMethod)
+	if idx.Method == "" {
+		idx.Method = IndexMethodBtree
+	}
+	if _, ok := indexMethods[idx.Method]; !ok {
+		return false, notFoundError("access method", string(idx.Method), "access method %s does not exist", idx.Method)
+	}
+	if stmt.Unique && idx.Method != IndexMethodBtree {
+		return false, fmt.Errorf("access method %s does not support unique indexes", idx.Method)
+	}
+	if len(stmt.IndexIncludingParams) > 0 && !slices.Contains([]IndexMethod{IndexMethodBtree, IndexMethodGist, IndexMethodSpgist}, idx.Method) {
+		return false, fmt.Errorf("access method %s does not support included columns", idx.Method)
+	}
+	return false, nil
+}
+
+// createViewIndex creates an index on a materialized view. Its keys and
+// included columns refer to the columns of the view.
+func (c *Compiler) createViewIndex(stmt *pg_query.IndexStmt, idx *Index, v *View) error {
+
+	idx.View = v
+	sch, ok := c.Catalog.Schemas.Get(v.Schema)
+	if !ok {
+		return notFoundError("schema", v.Schema, "did not find schema %s", v.Schema)
+	}
+	exists, err := checkIndexOptions(stmt, sch, idx)
+	if exists || err != nil {
+		return err
+	}
+	for _, n := range stmt.IndexParams {
+		elem, ok := n.Node.(*pg_query.Node_IndexElem)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "IndexElem", Node: n}
+		}
+		key, err := viewIndexKeyFromElem(v, elem.IndexElem)
+		if err != nil {
+			return err
+		}
+		idx.Keys = append(idx.Keys, key)
+	}
+	for _, n := range stmt.IndexIncludingParams {
+		elem, ok := n.Node.(*pg_query.Node_IndexElem)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "IndexElem", Node: n}
+		}
+		if elem.IndexElem.Expr != nil {
+			return fmt.Errorf("expressions are not supported in included columns")
+		}
+		col, err := viewColumnFromName(v, elem.IndexElem.Name)
+		if err != nil {
+			return err
+		}
+		idx.ViewInclude = append(idx.ViewInclude, col)
+	}
+	if stmt.WhereClause != nil {
+		idx.Predicate, err = DeparseExpr(stmt.WhereClause)
+		if err != nil {
+			return err
+		}
+		err = checkViewColumnRefs(v, stmt.WhereClause)
+		if err != nil {
+			return err
+		}
+	}
+	if idx.Name == "" {
+		idx.Name = ChooseRelationName(sch, v.Name, indexNameAddition(slices.Concat(stmt.IndexParams, stmt.IndexIncludingParams)), "idx")
+	}
+	return c.addIndex(idx)
+}
+
+// newIndexKey returns a key with the ordering of the element.
+func newIndexKey(elem *pg_query.IndexElem) *IndexKey {
+
+	key := &IndexKey{
+		Descending: elem.Ordering == pg_query.SortByDir_SORTBY_DESC,
+	}
+	switch elem.NullsOrdering {
+	case pg_query.SortByNulls_SORTBY_NULLS_FIRST:
+		key.NullsFirst = true
+	case pg_query.SortByNulls_SORTBY_NULLS_LAST:
+		key.NullsFirst = false
+	default:
+		key.NullsFirst = key.Descending
+	}
+	return key
+}
+
+func viewIndexKeyFromElem(v *View, elem *pg_query.IndexElem) (*IndexKey, error) {
+
+	key := newIndexKey(elem)
+	if elem.Expr == nil {
+		col, err := viewColumnFromName(v, elem.Name)
+		if err != nil {
+			return nil, err
+		}
+		key.ViewColumn = col
+		return key, nil
+	}
+	err := checkViewColumnRefs(v, elem.Expr)
+	if err != nil {
+		return nil, err
+	}
+	key.Expression, err = DeparseExpr(elem.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func viewColumnFromName(v *View, name string) (*ViewColumn, error) {
+
+	idx := slices.IndexFunc(v.Columns, func(vc *ViewColumn) bool { return vc.Name == name })
+	if idx < 0 {
+		return nil, notFoundError("column", name, "column %s does not exist", name)
+	}
+	return v.Columns[idx], nil
+}
+
+// checkViewColumnRefs checks that every column the expression refers to is a column of the view.
+func checkViewColumnRefs(v *View, n *pg_query.Node) error {
+
+	for _, name := range ColumnRefNames(n) {
+		_, err := viewColumnFromName(v, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) IndexKeyFromElem(t *Table, elem *pg_query.IndexElem) (*IndexKey, error) {
+
+	key := newIndexKey(elem)
+	if elem.Expr == nil {
+		col, err := ColumnFromColName(t, elem.Name)
+		if err != nil {
+			return nil, err
+		}
+		key.Column = col
+		key.Columns = Columns{col}
+		return key, nil
+	}
+	expr, err := DeparseExpr(elem.Expr)
+	if err != nil {
+		return nil, err
+	}
+	key.Expression = expr
+	key.Columns, err = ColumnsFromExpr(t, elem.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// indexNameAddition builds the column part of an automatically chosen index name
+// the way Postgres does: column names (or the function name for expressions) joined
+// with underscores, with numbers appended to repeated names.
+func indexNameAddition(elems []*pg_query.Node) string {
+
+	var names []string
+	for _, n := range elems {
+		elem, ok := n.Node.(*pg_query.Node_IndexElem)
+		if !ok {
+			continue
+		}
+		name := indexElemColumnName(elem.IndexElem)
+		orig := name
+		for i := 1; slices.Contains(names, name); i++ {
+			name = orig + strconv.Itoa(i)
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, "_")
+}
+
+func indexElemColumnName(elem *pg_query.IndexElem) string {
+
+	if elem.Indexcolname != "" {
+		return elem.Indexcolname
+	}
+	if elem.Expr == nil {
+		return elem.Name
+	}
+	if name := figureColumnName(elem.Expr); name != "" {
+		return name
+	}
+	return "expr"
+}
+
+// figureColumnName guesses a name for an expression in the manner of
+// Postgres's FigureColname, returning "" if there is no good choice.
+func figureColumnName(n *pg_query.Node) string {
+
+	switch x := n.Node.(type) {
+	case *pg_query.Node_ColumnRef:
+		fields := x.ColumnRef.Fields
+		if len(fields) == 0 {
+			return ""
+		}
+		if s, ok := fields[len(fields)-1].Node.(*pg_query.Node_String_); ok {
+			return s.String_.Sval
+		}
+	case *pg_query.Node_FuncCall:
+		names := x.FuncCall.Funcname
+		if s, ok := names[len(names)-1].Node.(*pg_query.Node_String_); ok {
+			return s.String_.Sval
+		}
+	case *pg_query.Node_TypeCast:
+		if name := figureColumnName(x.TypeCast.Arg); name != "" {
+			return name
+		}
+		names := x.TypeCast.TypeName.Names
+		if s, ok := names[len(names)-1].Node.(*pg_query.Node_String_); ok {
+			return s.String_.Sval
+		}
+	case *pg_query.Node_SqlvalueFunction:
+		return strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(x.SqlvalueFunction.Op.String(), "SVFOP_"), "_N"))
+	case *pg_query.Node_CaseExpr:
+		return "case"
+	case *pg_query.Node_CoalesceExpr:
+		return "coalesce"
+	case *pg_query.Node_MinMaxExpr:
+		if x.MinMaxExpr.Op == pg_query.MinMaxOp_IS_GREATEST {
+			return "greatest"
+		}
+		return "least"
+	case *pg_query.Node_AExpr:
+		if x.AExpr.Kind == pg_query.A_Expr_Kind_AEXPR_NULLIF {
+			return "nullif"
+		}
+	}
+	return ""
+}
+
+// AddConstraintIndex creates the index that Postgres implicitly builds
+// for a primary key or unique constraint.
+func (c *Compiler) AddConstraintIndex(con *Constraint) error {
+
+	idx := &Index{
+		Name:       con.Name,
+		Table:      con.Table,
+		Method:     IndexMethodBtree,
+		Unique:     true,
+		Primary:    con.Type == ConstraintTypePrimary,
+		Constraint: con,
+	}
+	for _, col := range con.Constrains {
+		idx.Keys = append(idx.Keys, &IndexKey{Column: col, Columns: Columns{col}})
+	}
+	return c.addIndex(idx)
+}
+
+func (c *Compiler) FindIndex(schema, name string) (*Index, error) {
+
+	schema, err := c.RelationSchema(schema, name)
+	if err != nil {
+		return nil, err
+	}
+	sch, ok := c.Catalog.Schemas.Get(schema)
+	if !ok {
+		return nil, notFoundError("schema", schema, "schema %s not found", schema)
+	}
+	idx, ok := sch.Indexes.Get(name)
+	if !ok {
+		return nil, notFoundError("index", name, "index %s not found", name)
+	}
+	return idx, nil
+}
+
+func (c *Compiler) DropIndexes(stmt *pg_query.DropStmt) error {
+
+	if stmt.Concurrent && len(stmt.Objects) > 1 {
+		return fmt.Errorf("DROP INDEX CONCURRENTLY does not support dropping multiple objects")
+	}
+	if stmt.Concurrent && stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		return fmt.Errorf("DROP INDEX CONCURRENTLY does not support CASCADE")
+	}
+	for _, tgt := range stmt.Objects {
+		l, ok := tgt.Node.(*pg_query.Node_List)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "List", Node: tgt}
+		}
+		schema, name := ObjectNameFromList(l.List)
+		idx, err := c.FindIndex(schema, name)
+		if err != nil {
+			if stmt.MissingOk {
+				continue
+			}
+			return err
+		}
+		err = c.DropIndex(idx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) DropIndex(idx *Index) error {
+
+	if idx.Constraint != nil {
+		return dependencyError(idx.Name, idx.Constraint.Name, "can't drop index %s because constraint %s on table %s requires it",
+			idx.Name, idx.Constraint.Name, idx.Table.Name)
+	}
+	c.removeIndex(idx)
+	return nil
+}
+
+// addIndex adds an index to the schema of its relation.
+func (c *Compiler) addIndex(idx *Index) error {
+
+	c.changingSchema(idx.Schema())
+	return c.Catalog.AddIndex(idx)
+}
+
+// removeIndex removes an index from the schema of its relation.
+func (c *Compiler) removeIndex(idx *Index) {
+
+	c.changingSchema(idx.Schema())
+	c.Catalog.RemoveIndex(idx)
+}
+
+func (c *Compiler) RenameIndex(r *pg_query.RangeVar, newName string, missingOk bool) error {
+
+	idx, err := c.FindIndex(r.Schemaname, r.Relname)
+	if err != nil {
+		if missingOk {
+			return nil
+		}
+		return err
+	}
+	sch, ok := c.Catalog.Schemas.Get(idx.Schema())
+	if !ok {
+		return notFoundError("schema", idx.Schema(), "did not find schema %s", idx.Schema())
+	}
+	if sch.HasRelation(newName) {
+		return duplicateObjectError("relation", newName, "relation %s already exists in schema %s", newName, sch.Name)
+	}
+	c.changing(sch, idx)
+	sch.Indexes.Rekey(idx.Name, newName)
+	idx.Name = newName
+	if idx.Constraint != nil {
+		// Renaming a constraint's index renames the constraint too
+		c.renameConstraint(idx.Constraint, newName)
+	}
+	return nil
+}
+
+// AlterIndex handles ALTER INDEX statements. None of the index options
+// they can change are tracked, so this verifies that the index exists and
+// reports any other subcommand as unsupported.
+func (c *Compiler) AlterIndex(stmt *pg_query.AlterTableStmt) error {
+
+	_, err := c.FindIndex(stmt.Relation.Schemaname, stmt.Relation.Relname)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	return c.unsupportedAlterCmds("ALTER INDEX", stmt.Cmds)
+}
+
+// Reindex handles REINDEX, which has no effect on the catalog beyond
+// requiring that its target exists.
+func (c *Compiler) Reindex(stmt *pg_query.ReindexStmt) error {
+
+	switch stmt.Kind {
+	case pg_query.ReindexObjectType_REINDEX_OBJECT_INDEX:
+		_, err := c.FindIndex(stmt.Relation.Schemaname, stmt.Relation.Relname)
+		return err
+	case pg_query.ReindexObjectType_REINDEX_OBJECT_TABLE:
+		_, err := c.FindTableFromRangeVar(stmt.Relation)
+		if err != nil {
+			if v, viewErr := c.FindView(stmt.Relation.Schemaname, stmt.Relation.Relname); viewErr == nil && v.Materialized {
+				return nil
+			}
+		}
+		return err
+	case pg_query.ReindexObjectType_REINDEX_OBJECT_SCHEMA:
+		if _, ok := c.Catalog.Schemas.Get(stmt.Name); !ok {
+			return notFoundError("schema", stmt.Name, "schema %s not found", stmt.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Bits of TableLikeClause.Options. The parser gives the options as a
+// bitmask rather than as the values of pg_query.TableLikeOption.
+const (
+	likeIncludingConstraints = 1 << 2
+	likeIncludingDefaults    = 1 << 3
+	likeIncludingGenerated   = 1 << 4
+	likeIncludingIdentity    = 1 << 5
+	likeIncludingIndexes     = 1 << 6
+)
+
+// InheritParents records the parents of a table created with INHERITS and
+// merges their columns. It returns the names of columns that inherit
+// different defaults from different parents, which is an error unless the
+// table declares the column itself with its own default.
+func (c *Compiler) InheritParents(t *Table, parents []*pg_query.Node) (map[string]bool, error) {
+
+	conflicts := make(map[string]bool)
+	for _, n := range parents {
+		parent, err := c.FindTableFromRangeVar(n.GetRangeVar())
+		if err != nil {
+			return nil, err
+		}
+		if parent.PartitionKey != nil {
+			return nil, fmt.Errorf("cannot inherit from partitioned table %s", parent.Name)
+		}
+		if parent.PartitionOf != nil {
+			return nil, fmt.Errorf("cannot inherit from partition %s", parent.Name)
+		}
+		if slices.Contains(t.Inherits, parent) {
+			return nil, fmt.Errorf("relation %s would be inherited from more than once", parent.Name)
+		}
+		t.Inherits = append(t.Inherits, parent)
+		for _, parentCol := range parent.Columns.List() {
+			col, ok := t.Columns.Get(parentCol.Name)
+			if !ok {
+				inheritColumn(t, parentCol)
+				continue
+			}
+			if col.Type != nonSerialType(parentCol.Type) || col.Attrs.Modifiers != parentCol.Attrs.Modifiers {
+				return nil, fmt.Errorf("inherited column %s has a type conflict", col.Name)
+			}
+			col.Attrs.NotNull = col.Attrs.NotNull || parentCol.Attrs.NotNull || parentCol.Attrs.Pkey
+			if col.Attrs.ColumnDefault != parentCol.Attrs.ColumnDefault {
+				conflicts[col.Name] = true
+			}
+		}
+		c.matchGeneratedFrom(t)
+	}
+	return conflicts, nil
+}
+
+// MergeInheritedColumn merges a column declared by a table created with
+// INHERITS into the column of the same name inherited from its parents.
+func (c *Compiler) MergeInheritedColumn(t *Table, def *pg_query.ColumnDef, defaultConflicts map[string]bool) error {
+
+	col, _ := t.Columns.Get(def.Colname) // Must be ok
+	if col.Attrs.MergedLocal {
+		return fmt.Errorf("column %s specified more than once", col.Name)
+	}
+	typ, err := c.FindTypeFromNode(def.TypeName)
+	if err != nil {
+		return err
+	}
+	mods, err := TypeModifiersFromNode(def.TypeName, typ)
+	if err != nil {
+		return err
+	}
+	if typ != col.Type || mods != col.Attrs.Modifiers {
+		return fmt.Errorf("column %s has a type conflict", col.Name)
+	}
+	col.Attrs.MergedLocal = true
+	if slices.ContainsFunc(def.Constraints, func(n *pg_query.Node) bool {
+		return n.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_DEFAULT
+	}) {
+		delete(defaultConflicts, col.Name)
+	}
+	return c.overrideInheritedColumn(t, def)
+}
+
+// tableParents returns the tables a table inherits columns from.
+func tableParents(t *Table) []*Table {
+
+	if t.PartitionOf != nil {
+		return append([]*Table{t.PartitionOf}, t.Inherits...)
+	}
+	return t.Inherits
+}
+
+// AddLikeColumns copies the columns of the table named in a LIKE clause.
+// NOT NULL is always copied; defaults, generation expressions and
+// identity only with the corresponding INCLUDING option.
+func (c *Compiler) AddLikeColumns(t *Table, like *pg_query.TableLikeClause) error {
+
+	source, err := c.FindTableFromRangeVar(like.Relation)
+	if err != nil {
+		return err
+	}
+	for _, sourceCol := range source.Columns.List() {
+		if _, ok := t.Columns.Get(sourceCol.Name); ok {
+			return fmt.Errorf("column %s specified more than once", sourceCol.Name)
+		}
+		col := &Column{
+			Table: t,
+			Name:  sourceCol.Name,
+			Type:  nonSerialType(sourceCol.Type),
+			Attrs: &ColumnAttributes{
+				NotNull:   sourceCol.Attrs.NotNull || sourceCol.Attrs.Pkey,
+				Modifiers: sourceCol.Attrs.Modifiers,
+				Domain:    sourceCol.Attrs.Domain,
+			},
+		}
+		if like.Options&likeIncludingDefaults != 0 && sourceCol.Attrs.Identity == IdentityNone {
+			col.Attrs.HasExplicitDefault = sourceCol.Attrs.HasExplicitDefault
+			col.Attrs.ColumnDefault = sourceCol.Attrs.ColumnDefault
+			col.Attrs.HasSequence = sourceCol.Attrs.HasSequence
+			col.Attrs.SequenceName = sourceCol.Attrs.SequenceName
+		}
+		if like.Options&likeIncludingGenerated != 0 {
+			col.Attrs.GeneratedExpression = sourceCol.Attrs.GeneratedExpression
+			col.Attrs.GeneratedFrom = sourceCol.Attrs.GeneratedFrom
+		}
+		t.Columns.Add(col.Name, col)
+		if like.Options&likeIncludingIdentity != 0 && sourceCol.Attrs.Identity != IdentityNone {
+			// The copy gets its own sequence with the same options
+			seq, err := c.CreateOwnedSequence(col, col.Type, nil)
+			if err != nil {
+				return err
+			}
+			sourceSeq := sourceCol.Attrs.IdentitySequence
+			seq.Type, seq.Start, seq.Increment = sourceSeq.Type, sourceSeq.Start, sourceSeq.Increment
+			seq.MinValue, seq.MaxValue, seq.Cache, seq.Cycle = sourceSeq.MinValue, sourceSeq.MaxValue, sourceSeq.Cache, sourceSeq.Cycle
+			col.Attrs.Identity = sourceCol.Attrs.Identity
+			col.Attrs.IdentitySequence = seq
+			col.Attrs.HasSequence = true
+			col.Attrs.SequenceName = seq.Name
+		}
+	}
+	c.matchGeneratedFrom(t)
+	return nil
+}
+
+// AddLikeConstraints copies the check constraints and indexes of the table
+// named in a LIKE clause, according to its INCLUDING options.
+func (c *Compiler) AddLikeConstraints(t *Table, like *pg_query.TableLikeClause) error {
+
+	source, err := c.FindTableFromRangeVar(like.Relation)
+	if err != nil {
+		return err
+	}
+	if like.Options&likeIncludingConstraints != 0 {
+		for _, con := range c.Catalog.TableConstraints(source) {
+			if con.Type != ConstraintTypeCheck {
+				continue
+			}
+			if _, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(t, con.Name)]; ok {
+				return duplicateObjectError("constraint", con.Name, "constraint %s for relation %s already exists", con.Name, t.Name)
+			}
+			c.addConstraint(&Constraint{
+				Table:         t,
+				Name:          con.Name,
+				Type:          ConstraintTypeCheck,
+				Constrains:    matchingColumns(t, con.Constrains),
+				Expression:    con.Expression,
+				NoInherit:     con.NoInherit,
+				DropBehaviour: con.DropBehaviour,
+			})
+		}
+	}
+	if like.Options&likeIncludingIndexes == 0 {
+		return nil
+	}
+	sch, ok := c.Catalog.Schemas.Get(t.Schema)
+	if !ok {
+		return notFoundError("schema", t.Schema, "did not find schema %s", t.Schema)
+	}
+	for _, idx := range c.Catalog.TableIndexes(source) {
+		if idx.Constraint != nil {
+			con := &Constraint{
+				Table:             t,
+				Type:              idx.Constraint.Type,
+				Constrains:        matchingColumns(t, idx.Constraint.Constrains),
+				Deferrable:        idx.Constraint.Deferrable,
+				InitiallyDeferred: idx.Constraint.InitiallyDeferred,
+			}
+			if con.Type == ConstraintTypePrimary {
+				if slices.ContainsFunc(c.Catalog.TableConstraints(t), func(other *Constraint) bool { return other.Type == ConstraintTypePrimary }) {
+					return fmt.Errorf("multiple primary keys for table %s are not allowed", t.Name)
+				}
+				con.Name = ChooseRelationName(sch, t.Name, "", "pkey")
+			} else {
+				con.Name = ChooseRelationName(sch, t.Name, con.Constrains.JoinColumnNames("_"), "key")
+			}
+			c.addConstraint(con)
+			err = c.AddConstraintIndex(con)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		copied := &Index{
+			Table:            t,
+			Method:           idx.Method,
+			Unique:           idx.Unique,
+			NullsNotDistinct: idx.NullsNotDistinct,
+			Include:          matchingColumns(t, idx.Include),
+			Predicate:        idx.Predicate,
+			PredicateColumns: matchingColumns(t, idx.PredicateColumns),
+		}
+		var names []string
+		for _, key := range idx.Keys {
+			copiedKey := *key
+			copiedKey.Columns = matchingColumns(t, key.Columns)
+			if key.Column != nil {
+				copiedKey.Column = copiedKey.Columns[0]
+				names = append(names, key.Column.Name)
+			} else {
+				names = append(names, "expr")
+			}
+			copied.Keys = append(copied.Keys, &copiedKey)
+		}
+		copied.Name = ChooseRelationName(sch, t.Name, strings.Join(names, "_"), "idx")
+		err = c.addIndex(copied)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package pgmodelparse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxIdentifierLength is the longest identifier Postgres will store (NAMEDATALEN - 1).
+const maxIdentifierLength = 63
+
+// MakeObjectName joins name1, name2 and label with underscores in the way Postgres
+// does for implicitly named objects, truncating name1 and name2 (longest first)
+// so that the result fits within the identifier length limit.
+func MakeObjectName(name1, name2, label string) string {
+
+	overhead := 0
+	if name2 != "" {
+		overhead++
+	}
+	if label != "" {
+		overhead += len(label) + 1
+	}
+	name1chars, name2chars := len(name1), len(name2)
+	avail := maxIdentifierLength - overhead
+	for name1chars+name2chars > avail {
+		if name1chars > name2chars {
+			name1chars--
+		} else {
+			name2chars--
+		}
+	}
+	parts := []string{name1[:name1chars]}
+	if name2 != "" {
+		parts = append(parts, name2[:name2chars])
+	}
+	if label != "" {
+		parts = append(parts, label)
+	}
+	return strings.Join(parts, "_")
+}
+
+// ChooseRelationName returns a name built from name1, name2 and label that is not
+// yet taken by any relation in the schema. As in Postgres, collisions are resolved by
+// appending a number to the label.
+func ChooseRelationName(sch *Schema, name1, name2, label string) string {
+
+	for pass := 0; ; pass++ {
+		modLabel := label
+		if pass > 0 {
+			modLabel = label + strconv.Itoa(pass)
+		}
+		name := MakeObjectName(name1, name2, modLabel)
+		if !sch.HasRelation(name) {
+			return name
+		}
+	}
+}
+
+// ChooseConstraintName is ChooseRelationName for constraints, which must have
+// unique names among the constraints of the schema.
+func ChooseConstraintName(d *PgConstraint, schema, name1, name2, label string) string {
+
+	taken := make(map[string]bool)
+	for _, con := range d.ByName {
+		if con.Table.Schema == schema {
+			taken[con.Name] = true
+		}
+	}
+	for pass := 0; ; pass++ {
+		modLabel := label
+		if pass > 0 {
+			modLabel = label + strconv.Itoa(pass)
+		}
+		name := MakeObjectName(name1, name2, modLabel)
+		if !taken[name] {
+			return name
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+var partitionStrategies = map[pg_query.PartitionStrategy]PartitionStrategy{
+	pg_query.PartitionStrategy_PARTITION_STRATEGY_RANGE: PartitionStrategyRange,
+	pg_query.PartitionStrategy_PARTITION_STRATEGY_LIST:  PartitionStrategyList,
+	pg_query.PartitionStrategy_PARTITION_STRATEGY_HASH:  PartitionStrategyHash,
+}
+
+// partitionBoundStrategies maps the strategy codes used in a PartitionBoundSpec.
+var partitionBoundStrategies = map[string]PartitionStrategy{
+	"r": PartitionStrategyRange,
+	"l": PartitionStrategyList,
+	"h": PartitionStrategyHash,
+}
+
+// PartitionKeyFromSpec reads the PARTITION BY clause of a CREATE TABLE.
+func (c *Compiler) PartitionKeyFromSpec(t *Table, spec *pg_query.PartitionSpec) (*PartitionKey, error) {
+
+	strategy, ok := partitionStrategies[spec.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized partitioning strategy %s", spec.Strategy)
+	}
+	if strategy == PartitionStrategyList && len(spec.PartParams) > 1 {
+		return nil, fmt.Errorf("cannot use \"list\" partition strategy with more than one column")
+	}
+	key := &PartitionKey{Strategy: strategy}
+	for _, n := range spec.PartParams {
+		elem := n.GetPartitionElem()
+		if elem == nil {
+			return nil, &UnexpectedNodeError{Expected: "PartitionElem", Node: n}
+		}
+		if elem.Expr == nil {
+			col, ok := t.Columns.Get(elem.Name)
+			if !ok {
+				return nil, notFoundInTableError("column", t, elem.Name, "column %s named in partition key does not exist", elem.Name)
+			}
+			if col.Attrs.IsGenerated() {
+				return nil, fmt.Errorf("cannot use generated column in partition key")
+			}
+			key.Keys = append(key.Keys, &PartitionKeyElem{Column: col, Columns: Columns{col}})
+			continue
+		}
+		expr, err := DeparseExpr(elem.Expr)
+		if err != nil {
+			return nil, err
+		}
+		cols, err := ColumnsFromExpr(t, elem.Expr)
+		if err != nil {
+			return nil, err
+		}
+		key.Keys = append(key.Keys, &PartitionKeyElem{Expression: expr, Columns: cols})
+	}
+	return key, nil
+}
+
+// PartitionBoundFromSpec validates the FOR VALUES clause of a new partition of parent.
+func (c *Compiler) PartitionBoundFromSpec(parent *Table, name string, spec *pg_query.PartitionBoundSpec) (*PartitionBound, error) {
+
+	key := parent.PartitionKey
+	if key == nil {
+		return nil, fmt.Errorf("table %s is not partitioned", parent.Name)
+	}
+	siblings := c.Catalog.Partitions(parent)
+	bound := &PartitionBound{IsDefault: spec.IsDefault}
+	if spec.IsDefault {
+		if key.Strategy == PartitionStrategyHash {
+			return nil, fmt.Errorf("a hash-partitioned table may not have a default partition")
+		}
+		for _, p := range siblings {
+			if p.PartitionBound.IsDefault {
+				return nil, fmt.Errorf("partition %s conflicts with existing default partition %s", name, p.Name)
+			}
+		}
+		return bound, nil
+	}
+	if partitionBoundStrategies[spec.Strategy] != key.Strategy {
+		return nil, fmt.Errorf("invalid bound specification for a %s partition", key.Strategy)
+	}
+	var err error
+	switch key.Strategy {
+	case PartitionStrategyList:
+		bound.In, err = partitionDatums(spec.Listdatums, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range siblings {
+			for _, v := range bound.In {
+				if slices.Contains(p.PartitionBound.In, v) {
+					return nil, fmt.Errorf("partition %s would overlap partition %s", name, p.Name)
+				}
+			}
+		}
+	case PartitionStrategyRange:
+		bound.From, err = partitionDatums(spec.Lowerdatums, true)
+		if err != nil {
+			return nil, err
+		}
+		bound.To, err = partitionDatums(spec.Upperdatums, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(bound.From) != len(key.Keys) {
+			return nil, fmt.Errorf("FROM must specify exactly one value per partitioning column")
+		}
+		if len(bound.To) != len(key.Keys) {
+			return nil, fmt.Errorf("TO must specify exactly one value per partitioning column")
+		}
+		if cmp, ok := compareRangeBounds(bound.From, bound.To); ok && cmp >= 0 {
+			return nil, fmt.Errorf("empty range bound specified for partition %s", name)
+		}
+		for _, p := range siblings {
+			if p.PartitionBound.IsDefault {
+				continue
+			}
+			// Ranges include their lower bound but not their upper bound
+			below, ok1 := compareRangeBounds(bound.From, p.PartitionBound.To)
+			above, ok2 := compareRangeBounds(p.PartitionBound.From, bound.To)
+			if ok1 && ok2 && below < 0 && above < 0 {
+				return nil, fmt.Errorf("partition %s would overlap partition %s", name, p.Name)
+			}
+		}
+	case PartitionStrategyHash:
+		if spec.Modulus <= 0 {
+			return nil, fmt.Errorf("modulus for hash partition must be an integer value greater than zero")
+		}
+		if spec.Remainder < 0 {
+			return nil, fmt.Errorf("remainder for hash partition must be an integer value greater than or equal to zero")
+		}
+		if spec.Remainder >= spec.Modulus {
+			return nil, fmt.Errorf("remainder for hash partition must be less than modulus")
+		}
+		bound.Modulus = int(spec.Modulus)
+		bound.Remainder = int(spec.Remainder)
+		for _, p := range siblings {
+			// Each modulus must divide the larger ones, so that a row's
+			// remainders for all of them agree
+			smaller, larger := min(bound.Modulus, p.PartitionBound.Modulus), max(bound.Modulus, p.PartitionBound.Modulus)
+			if larger%smaller != 0 {
+				return nil, fmt.Errorf("every hash partition modulus must be a factor of the next larger modulus")
+			}
+			if bound.Remainder%smaller == p.PartitionBound.Remainder%smaller {
+				return nil, fmt.Errorf("partition %s would overlap partition %s", name, p.Name)
+			}
+		}
+	}
+	return bound, nil
+}
+
+// compareRangeBounds compares the bounds of two range partitions column by
+// column. It returns false if it can't tell how they are ordered.
+func compareRangeBounds(a, b []string) (int, bool) {
+
+	for i := range min(len(a), len(b)) {
+		cmp, ok := compareBoundDatums(a[i], b[i])
+		if !ok || cmp != 0 {
+			return cmp, ok
+		}
+		if a[i] == "MINVALUE" || a[i] == "MAXVALUE" {
+			// The values after MINVALUE or MAXVALUE don't count
+			return 0, true
+		}
+	}
+	return 0, true
+}
+
+var quotedDatum = regexp.MustCompile(`^'((?:[^']|'')*)'(::.+)?$`)
+
+// dateTimeLayouts are the forms of dates and times that bounds are compared in.
+var dateTimeLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// compareBoundDatums compares two values of a range partition bound. Only
+// MINVALUE and MAXVALUE, numbers and ISO dates and times can be compared,
+// as the order of other values depends on their type and collation.
+func compareBoundDatums(a, b string) (int, bool) {
+
+	if a == b {
+		return 0, true
+	}
+	switch {
+	case a == "MINVALUE" || b == "MAXVALUE":
+		return -1, true
+	case a == "MAXVALUE" || b == "MINVALUE":
+		return 1, true
+	}
+	if x, ok := new(big.Rat).SetString(a); ok {
+		if y, ok := new(big.Rat).SetString(b); ok {
+			return x.Cmp(y), true
+		}
+		return 0, false
+	}
+	x, ok := parseDateTimeDatum(a)
+	if !ok {
+		return 0, false
+	}
+	y, ok := parseDateTimeDatum(b)
+	if !ok {
+		return 0, false
+	}
+	return x.Compare(y), true
+}
+
+func parseDateTimeDatum(v string) (time.Time, bool) {
+
+	m := quotedDatum.FindStringSubmatch(v)
+	if m == nil {
+		return time.Time{}, false
+	}
+	for _, layout := range dateTimeLayouts {
+		// Parsing also accepts fractional seconds after the seconds
+		t, err := time.Parse(layout, m[1])
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// partitionDatums deparses the values of a partition bound. Range bounds
+// may also use MINVALUE and MAXVALUE, which the parser gives as column references.
+func partitionDatums(nodes []*pg_query.Node, allowUnbounded bool) ([]string, error) {
+
+	var ret []string
+	for _, n := range nodes {
+		if ref := n.GetColumnRef(); ref != nil {
+			fields, err := StringsFromNodes(ref.Fields)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.Join(fields, ".")
+			if !allowUnbounded || (name != "minvalue" && name != "maxvalue") {
+				return nil, fmt.Errorf("cannot use column reference in partition bound expression")
+			}
+			ret = append(ret, strings.ToUpper(name))
+			continue
+		}
+		val, err := DeparseExpr(n)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, val)
+	}
+	return ret, nil
+}
+
+// inheritColumn copies a column of a parent table to a partition or child table.
+func inheritColumn(child *Table, parentCol *Column) *Column {
+
+	attrs := *parentCol.Attrs
+	// The primary key flag is set again if the constraint is inherited
+	attrs.Pkey = false
+	attrs.NotNull = parentCol.Attrs.NotNull || parentCol.Attrs.Pkey
+	attrs.Inherited = true
+	attrs.MergedLocal = false
+	if child.PartitionOf == nil {
+		// Only partitions share the identity of their parent
+		attrs.Identity = IdentityNone
+		attrs.IdentitySequence = nil
+	}
+	col := &Column{Table: child, Name: parentCol.Name, Type: nonSerialType(parentCol.Type), Attrs: &attrs}
+	child.Columns.Add(col.Name, col)
+	return col
+}
+
+func nonSerialType(typ *PostgresType) *PostgresType {
+
+	if typ.IsSerial {
+		return typ.NonSerialType
+	}
+	return typ
+}
+
+// overrideInheritedColumn checks a column given in a PARTITION OF column list or
+// merged with an inherited one, whose options add to or replace the inherited ones.
+func (c *Compiler) overrideInheritedColumn(t *Table, def *pg_query.ColumnDef) error {
+
+	col, ok := t.Columns.Get(def.Colname)
+	if !ok {
+		return notFoundInTableError("column", t, def.Colname, "column %s does not exist", def.Colname)
+	}
+	for _, n := range def.Constraints {
+		if n.GetConstraint().GetContype() == pg_query.ConstrType_CONSTR_DEFAULT {
+			c.clearColumnDefault(col)
+		}
+	}
+	return nil
+}
+
+// inheritConstraints gives a partition or child table the constraints of its parent,
+// linking equivalent constraints the child already has instead of copying them.
+// Tables that inherit without being partitions only inherit check constraints.
+// When attaching an existing table, check constraints must already be present.
+func (c *Compiler) inheritConstraints(child, parent *Table, attaching bool) error {
+
+	existing := c.Catalog.TableConstraints(child)
+	for _, con := range c.Catalog.TableConstraints(parent) {
+		if con.NoInherit || slices.ContainsFunc(existing, func(other *Constraint) bool { return other.InheritedFrom == con }) {
+			continue
+		}
+		if child.PartitionOf != parent && con.Type != ConstraintTypeCheck {
+			continue
+		}
+		idx := slices.IndexFunc(existing, func(other *Constraint) bool {
+			return other.InheritedFrom == nil && equivalentConstraints(con, other)
+		})
+		if idx >= 0 {
+			c.changing(existing[idx])
+			existing[idx].InheritedFrom = con
+			continue
+		}
+		if con.Type == ConstraintTypeCheck {
+			if other, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(child, con.Name)]; ok && other.Type == ConstraintTypeCheck {
+				return fmt.Errorf("child table %s has different definition for check constraint %s", child.Name, con.Name)
+			}
+			if attaching {
+				return fmt.Errorf("child table is missing constraint %s", con.Name)
+			}
+		}
+		clone := *con
+		clone.Table = child
+		clone.InheritedFrom = con
+		clone.Constrains = matchingColumns(child, con.Constrains)
+		clone.OnDeleteColumns = matchingColumns(child, con.OnDeleteColumns)
+		switch con.Type {
+		case ConstraintTypePrimary:
+			clone.Name = child.Name + "_pkey"
+		case ConstraintTypeUnique:
+			clone.Name = strings.Join([]string{child.Name, clone.Constrains.JoinColumnNames("_"), "key"}, "_")
+		}
+		if _, ok := c.Catalog.PgConstraint.ByName[clone.FQName()]; ok {
+			return duplicateObjectError("constraint", clone.Name, "constraint %s for relation %s already exists", clone.Name, child.Name)
+		}
+		c.addConstraint(&clone)
+		if con.Type == ConstraintTypePrimary || con.Type == ConstraintTypeUnique {
+			err := c.AddConstraintIndex(&clone)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func equivalentConstraints(a, b *Constraint) bool {
+
+	if a.Type == ConstraintTypeCheck || a.Type == ConstraintTypeForeignKey {
+		if a.Name != b.Name {
+			return false
+		}
+	}
+	return a.Type == b.Type &&
+		slices.Equal(a.Constrains.Names(), b.Constrains.Names()) &&
+		a.Expression == b.Expression &&
+		a.RefersTable == b.RefersTable &&
+		slices.Equal(a.Refers, b.Refers)
+}
+
+// matchingColumns finds the columns of the table with the same names as the given columns of another table.
+func matchingColumns(t *Table, cols Columns) Columns {
+
+	var ret Columns
+	for _, col := range cols {
+		match, _ := t.Columns.Get(col.Name) // Must be ok
+		ret = append(ret, match)
+	}
+	return ret
+}
+
+// syncChildren copies columns and constraints that were added to a
+// parent table to all of its partitions and child tables.
+func (c *Compiler) syncChildren(t *Table) error {
+
+	for _, child := range c.Catalog.Children(t) {
+		for _, col := range t.Columns.List() {
+			childCol, ok := child.Columns.Get(col.Name)
+			if !ok {
+				c.changing(child)
+				inheritColumn(child, col)
+				continue
+			}
+			if childCol.Attrs.Inherited {
+				continue
+			}
+			// A column added to the parent is merged with an existing column of the child
+			if childCol.Type != nonSerialType(col.Type) || childCol.Attrs.Modifiers != col.Attrs.Modifiers {
+				return fmt.Errorf("child table %s has different type for column %s", child.Name, col.Name)
+			}
+			c.changing(childCol.Attrs)
+			childCol.Attrs.Inherited = true
+			childCol.Attrs.MergedLocal = true
+		}
+		c.matchGeneratedFrom(child)
+		err := c.inheritConstraints(child, t, false)
+		if err != nil {
+			return err
+		}
+		err = c.syncChildren(child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPartitionedUnique checks that a primary key or unique constraint on
+// a partitioned table includes all of its partition key columns.
+func checkPartitionedUnique(t *Table, conType ConstraintType, cols Columns) error {
+
+	if t.PartitionKey == nil {
+		return nil
+	}
+	for _, key := range t.PartitionKey.Keys {
+		if key.Column == nil {
+			kind := "UNIQUE"
+			if conType == ConstraintTypePrimary {
+				kind = "PRIMARY KEY"
+			}
+			return fmt.Errorf("unsupported %s constraint with partition key definition", kind)
+		}
+		if !slices.Contains(cols, key.Column) {
+			return fmt.Errorf("unique constraint on partitioned table must include all partitioning columns")
+		}
+	}
+	return nil
+}
+
+// isPartitionKeyColumn reports whether the column is used by the partition key of its table.
+func isPartitionKeyColumn(col *Column) bool {
+
+	return col.Table.PartitionKey != nil && slices.Contains(col.Table.PartitionKey.Depends(), col)
+}
+
+// AttachPartition handles ALTER TABLE ... ATTACH PARTITION.
+func (c *Compiler) AttachPartition(t *Table, cmd *pg_query.PartitionCmd) error {
+
+	child, err := c.FindTableFromRangeVar(cmd.Name)
+	if err != nil {
+		return err
+	}
+	if t.PartitionKey == nil {
+		return fmt.Errorf("table %s is not partitioned", t.Name)
+	}
+	if child.PartitionOf != nil {
+		return fmt.Errorf("table %s is already a partition", child.Name)
+	}
+	for anc := t; anc != nil; anc = anc.PartitionOf {
+		if anc == child {
+			return fmt.Errorf("circular inheritance not allowed")
+		}
+	}
+	for _, col := range child.Columns.List() {
+		if _, ok := t.Columns.Get(col.Name); !ok {
+			return fmt.Errorf("table %s contains column %s not found in parent %s", child.Name, col.Name, t.Name)
+		}
+	}
+	for _, parentCol := range t.Columns.List() {
+		col, ok := child.Columns.Get(parentCol.Name)
+		if !ok {
+			return fmt.Errorf("child table is missing column %s", parentCol.Name)
+		}
+		if col.Type != nonSerialType(parentCol.Type) || col.Attrs.Modifiers != parentCol.Attrs.Modifiers {
+			return fmt.Errorf("child table %s has different type for column %s", child.Name, col.Name)
+		}
+		if parentCol.Attrs.IsNotNull() && !col.Attrs.IsNotNull() {
+			return fmt.Errorf("column %s in child table must be marked NOT NULL", col.Name)
+		}
+	}
+	bound, err := c.PartitionBoundFromSpec(t, child.Name, cmd.Bound)
+	if err != nil {
+		return err
+	}
+	c.changing(child)
+	child.PartitionOf = t
+	child.PartitionBound = bound
+	for _, col := range child.Columns.List() {
+		c.changing(col.Attrs)
+		col.Attrs.Inherited = true
+		col.Attrs.MergedLocal = true
+	}
+	return c.inheritConstraints(child, t, true)
+}
+
+// DetachPartition handles ALTER TABLE ... DETACH PARTITION. The detached
+// table keeps its columns and constraints as a standalone table.
+func (c *Compiler) DetachPartition(t *Table, cmd *pg_query.PartitionCmd) error {
+
+	child, err := c.FindTableFromRangeVar(cmd.Name)
+	if err != nil {
+		return err
+	}
+	if child.PartitionOf != t {
+		return fmt.Errorf("relation %s is not a partition of relation %s", child.Name, t.Name)
+	}
+	c.changing(child)
+	child.PartitionOf = nil
+	child.PartitionBound = nil
+	for _, col := range child.Columns.List() {
+		c.changing(col.Attrs)
+		col.Attrs.Inherited = false
+		col.Attrs.MergedLocal = false
+	}
+	for _, con := range c.Catalog.TableConstraints(child) {
+		c.changing(con)
+		con.InheritedFrom = nil
+	}
+	return nil
+}
@@ -52,33 +52,270 @@ func (d *PgConstraint) RemoveConstraint(cons *Constraint) {
 	cons.OnRemove()
 }
 
+func (d *PgConstraint) RenameConstraint(cons *Constraint, newName string) {
+
+	delete(d.ByName, cons.FQName())
+	cons.Name = newName
+	d.ByName[cons.FQName()] = cons
+}
+
+// RefreshNames re-keys ByName after renaming a table or schema has
+// changed the fully-qualified names of existing constraints.
+func (d *PgConstraint) RefreshNames() {
+
+	byName := make(map[string]*Constraint, len(d.ByName))
+	for _, cons := range d.ByName {
+		byName[cons.FQName()] = cons
+	}
+	d.ByName = byName
+}
+
 func (c *Catalog) AddTable(t *Table) error {
 
 	schema, ok := c.Schemas.Get(t.Schema)
 	if !ok {
-		return fmt.Errorf("no such schema: %s", t.Schema)
+		return notFoundError("schema", t.Schema, "no such schema: %s", t.Schema)
 	}
 	return schema.AddTable(t)
 }
 
+func (c *Catalog) AddIndex(idx *Index) error {
+
+	schema, ok := c.Schemas.Get(idx.Schema())
+	if !ok {
+		return notFoundError("schema", idx.Schema(), "no such schema: %s", idx.Schema())
+	}
+	return schema.AddIndex(idx)
+}
+
+func (c *Catalog) RemoveIndex(idx *Index) {
+
+	schema, ok := c.Schemas.Get(idx.Schema())
+	if !ok {
+		return
+	}
+	schema.Indexes.Remove(idx.Name)
+}
+
+// TableIndexes returns all indexes defined on the given table,
+// in creation order.
+func (c *Catalog) TableIndexes(t *Table) []*Index {
+
+	schema, ok := c.Schemas.Get(t.Schema)
+	if !ok {
+		return nil
+	}
+	var ret []*Index
+	for _, idx := range schema.Indexes.List() {
+		if idx.Table == t {
+			ret = append(ret, idx)
+		}
+	}
+	return ret
+}
+
+// ViewIndexes returns all indexes defined on the given materialized view,
+// in creation order.
+func (c *Catalog) ViewIndexes(v *View) []*Index {
+
+	schema, ok := c.Schemas.Get(v.Schema)
+	if !ok {
+		return nil
+	}
+	var ret []*Index
+	for _, idx := range schema.Indexes.List() {
+		if idx.View == v {
+			ret = append(ret, idx)
+		}
+	}
+	return ret
+}
+
+// Children returns the partitions of the table and the tables
+// that inherit from it, in creation order.
+func (c *Catalog) Children(t *Table) []*Table {
+
+	var ret []*Table
+	for _, sch := range c.Schemas.List() {
+		for _, tab := range sch.Tables.List() {
+			if tab.PartitionOf == t || slices.Contains(tab.Inherits, t) {
+				ret = append(ret, tab)
+			}
+		}
+	}
+	return ret
+}
+
+// Partitions returns the direct partitions of the table, in creation order.
+func (c *Catalog) Partitions(t *Table) []*Table {
+
+	var ret []*Table
+	for _, sch := range c.Schemas.List() {
+		for _, tab := range sch.Tables.List() {
+			if tab.PartitionOf == t {
+				ret = append(ret, tab)
+			}
+		}
+	}
+	return ret
+}
+
+// TableConstraints returns the constraints defined on the table, ordered by name.
+func (c *Catalog) TableConstraints(t *Table) Constraints {
+
+	var ret Constraints
+	for _, con := range c.PgConstraint.ByName {
+		if con.Table == t {
+			ret = append(ret, con)
+		}
+	}
+	slices.SortFunc(ret, func(a, b *Constraint) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// DependentViews returns the views that directly depend on the given table.
+func (c *Catalog) DependentViews(t *Table) []*View {
+
+	var ret []*View
+	for _, sch := range c.Schemas.List() {
+		for _, v := range sch.Views.List() {
+			if slices.Contains(v.Tables, t) {
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// ColumnDependentViews returns the views that directly depend on the given column.
+func (c *Catalog) ColumnDependentViews(col *Column) []*View {
+
+	var ret []*View
+	for _, sch := range c.Schemas.List() {
+		for _, v := range sch.Views.List() {
+			if slices.Contains(v.DependsOnColumns, col) {
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// ViewDependentViews returns the views that directly depend on the given view.
+func (c *Catalog) ViewDependentViews(view *View) []*View {
+
+	var ret []*View
+	for _, sch := range c.Schemas.List() {
+		for _, v := range sch.Views.List() {
+			if slices.Contains(v.Views, view) {
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
+// SchemaDependentViews returns the views that directly depend on a table
+// or view in the given schema.
+func (c *Catalog) SchemaDependentViews(schema string) []*View {
+
+	var ret []*View
+	for _, sch := range c.Schemas.List() {
+		for _, v := range sch.Views.List() {
+			if slices.ContainsFunc(v.Tables, func(t *Table) bool { return t.Schema == schema }) ||
+				slices.ContainsFunc(v.Views, func(dep *View) bool { return dep.Schema == schema }) {
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret
+}
+
 type Schema struct {
-	Name   string
-	Tables *collections.OrderedMap[string, *Table]
+	Name      string
+	Tables    *collections.OrderedMap[string, *Table]
+	Indexes   *collections.OrderedMap[string, *Index]
+	Views     *collections.OrderedMap[string, *View]
+	Sequences *collections.OrderedMap[string, *Sequence]
+}
+
+func NewSchema(name string) *Schema {
+	return &Schema{
+		Name:      name,
+		Tables:    collections.NewOrderedMap[string, *Table](),
+		Indexes:   collections.NewOrderedMap[string, *Index](),
+		Views:     collections.NewOrderedMap[string, *View](),
+		Sequences: collections.NewOrderedMap[string, *Sequence](),
+	}
+}
+
+// HasRelation returns whether the schema already contains a relation
+// (table, index, ...) with the given name. Postgres keeps all relations
+// of a schema in a single namespace.
+func (s *Schema) HasRelation(name string) bool {
+
+	if _, ok := s.Tables.Get(name); ok {
+		return true
+	}
+	if _, ok := s.Indexes.Get(name); ok {
+		return true
+	}
+	if _, ok := s.Views.Get(name); ok {
+		return true
+	}
+	if _, ok := s.Sequences.Get(name); ok {
+		return true
+	}
+	return false
 }
 
 func (s *Schema) AddTable(t *Table) error {
 	_, ok := s.Tables.Get(t.Name)
 	if ok {
-		return fmt.Errorf("table already exists: %s", t.Name)
+		return duplicateObjectError("table", t.Name, "table already exists: %s", t.Name)
+	}
+	if s.HasRelation(t.Name) {
+		return duplicateObjectError("relation", t.Name, "relation already exists: %s", t.Name)
 	}
 	s.Tables.Add(t.Name, t)
 	return nil
 }
 
+func (s *Schema) AddIndex(idx *Index) error {
+	if s.HasRelation(idx.Name) {
+		return duplicateObjectError("relation", idx.Name, "relation already exists: %s", idx.Name)
+	}
+	s.Indexes.Add(idx.Name, idx)
+	return nil
+}
+
+func (s *Schema) AddView(v *View) error {
+	if s.HasRelation(v.Name) {
+		return duplicateObjectError("relation", v.Name, "relation already exists: %s", v.Name)
+	}
+	s.Views.Add(v.Name, v)
+	return nil
+}
+
+func (s *Schema) AddSequence(seq *Sequence) error {
+	if s.HasRelation(seq.Name) {
+		return duplicateObjectError("relation", seq.Name, "relation already exists: %s", seq.Name)
+	}
+	s.Sequences.Add(seq.Name, seq)
+	return nil
+}
+
 type Table struct {
 	Name    string
 	Schema  string
 	Columns *collections.OrderedMap[string, *Column]
+	// PartitionKey is set when the table is partitioned.
+	PartitionKey *PartitionKey
+	// PartitionOf and PartitionBound are set when the table is a partition.
+	PartitionOf    *Table
+	PartitionBound *PartitionBound
+	// Inherits lists the parents given in an INHERITS clause.
+	Inherits []*Table
 }
 
 func NewTable(name, schema string) *Table {
@@ -92,7 +329,7 @@ func NewTable(name, schema string) *Table {
 func (t *Table) AddColumn(c *Column) error {
 	_, ok := t.Columns.Get(c.Name)
 	if ok {
-		return fmt.Errorf("column already exists: %s", c.Name)
+		return duplicateObjectError("column", c.Name, "column already exists: %s", c.Name)
 	}
 	t.Columns.Add(c.Name, c)
 	return nil
@@ -113,6 +350,53 @@ type Column struct {
 	Attrs *ColumnAttributes
 }
 
+// PartitionKey is the PARTITION BY clause of a partitioned table.
+type PartitionKey struct {
+	Strategy PartitionStrategy
+	Keys     []*PartitionKeyElem
+}
+
+// Depends returns every column used by the partition key.
+func (k *PartitionKey) Depends() Columns {
+
+	var ret Columns
+	for _, key := range k.Keys {
+		ret = append(ret, key.Columns...)
+	}
+	return ret
+}
+
+type PartitionKeyElem struct {
+	// Column is set when the key is a plain column reference.
+	Column *Column
+	// Expression is set when the key is an expression.
+	Expression string
+	// Columns holds the columns referenced by the key.
+	Columns Columns
+}
+
+type PartitionStrategy string
+
+const (
+	PartitionStrategyRange PartitionStrategy = "range"
+	PartitionStrategyList  PartitionStrategy = "list"
+	PartitionStrategyHash  PartitionStrategy = "hash"
+)
+
+// PartitionBound is the FOR VALUES clause of a partition.
+// Values are kept as deparsed SQL, with MINVALUE and MAXVALUE as keywords.
+type PartitionBound struct {
+	IsDefault bool
+	// In holds the values of a list partition.
+	In []string
+	// From and To hold the bounds of a range partition.
+	From []string
+	To   []string
+	// Modulus and Remainder are set for a hash partition.
+	Modulus   int
+	Remainder int
+}
+
 func (c *Column) FQName() string {
 
 	return c.Table.Schema + "." + c.Table.Name + "." + c.Name
@@ -125,19 +409,68 @@ type ColumnAttributes struct {
 	SequenceName       string
 	HasExplicitDefault bool
 	ColumnDefault      string
+	// Identity is set for GENERATED ... AS IDENTITY columns, whose
+	// values are drawn from IdentitySequence.
+	Identity         IdentityKind
+	IdentitySequence *Sequence
+	// GeneratedExpression is the deparsed expression of a
+	// GENERATED ALWAYS AS (...) STORED column.
+	GeneratedExpression string
+	// GeneratedFrom holds the columns the generation expression uses.
+	GeneratedFrom Columns
 	//ColumnDefault *pg_query.Node // TODO: parse to native type
-	// Other values include: char max length for varchar,
-	// decimal and timezone precision, etc...
+	// Modifiers holds the type's parameters, such as the
+	// max length of a varchar or the precision of a numeric.
+	Modifiers TypeModifiers
+	// Inherited is set when the column comes from a parent table.
+	// MergedLocal is also set if the table declared the column itself.
+	Inherited   bool
+	MergedLocal bool
+	// Domain is set when the column's type is a domain, whose
+	// NOT NULL and default then apply to the column.
+	Domain *PostgresType
 }
 
 func (ca ColumnAttributes) IsNotNull() bool {
 
-	return ca.NotNull || ca.Pkey
+	return ca.NotNull || ca.Pkey || (ca.Domain != nil && ca.Domain.DomainNotNull())
 }
 
 func (ca ColumnAttributes) IsRequired() bool {
 
-	return ca.IsNotNull() && !(ca.HasExplicitDefault || ca.HasSequence)
+	hasDomainDefault := ca.Domain != nil && ca.Domain.DomainDefault() != ""
+	return ca.IsNotNull() && !(ca.HasExplicitDefault || ca.HasSequence || ca.IsGenerated() || hasDomainDefault)
+}
+
+// IsGenerated returns whether the column's value is computed by Postgres,
+// either as an identity or from a generation expression.
+func (ca ColumnAttributes) IsGenerated() bool {
+
+	return ca.Identity != IdentityNone || ca.GeneratedExpression != ""
+}
+
+type IdentityKind int
+
+const (
+	IdentityNone IdentityKind = iota
+	// IdentityAlways is GENERATED ALWAYS AS IDENTITY, which rejects explicit values
+	// unless OVERRIDING SYSTEM VALUE is used.
+	IdentityAlways
+	// IdentityByDefault is GENERATED BY DEFAULT AS IDENTITY.
+	IdentityByDefault
+)
+
+func (k IdentityKind) String() string {
+
+	switch k {
+	case IdentityNone:
+		return "None"
+	case IdentityAlways:
+		return "Always"
+	case IdentityByDefault:
+		return "By Default"
+	}
+	return fmt.Sprintf("IdentityKind(%d)", int(k))
 }
 
 type Columns []*Column
@@ -168,12 +501,25 @@ func (c Columns) JoinColumnNames(sep string) string {
 	return strings.Join(c.Names(), sep)
 }
 
-func (c Columns) SingleElementOrPanic() *Column {
+func (c Columns) SingleElement() (*Column, error) {
 
 	if len(c) != 1 {
-		panic(fmt.Errorf("wrong number of columns: expected 1, got %d", len(c)))
+		return nil, fmt.Errorf("wrong number of columns: expected 1, got %d", len(c))
+	}
+	return c[0], nil
+}
+
+// SingleElementOrPanic is like SingleElement, but panics if there isn't
+// exactly one column.
+//
+// Deprecated: Use SingleElement instead.
+func (c Columns) SingleElementOrPanic() *Column {
+
+	col, err := c.SingleElement()
+	if err != nil {
+		panic(err)
 	}
-	return c[0]
+	return col
 }
 
 // IsExactlyColumn returns whether the contents of this Columns
@@ -193,9 +539,27 @@ type Constraint struct {
 	RefersTable *Table
 	Refers      Columns
 	Constrains  Columns
+	// Expression is the deparsed expression of a check constraint.
+	Expression string
+	// NoInherit marks a check constraint that doesn't apply to child tables.
+	NoInherit bool
+	// NotValid marks a constraint that existing rows haven't been checked against.
+	NotValid bool
+	// OnDelete and OnUpdate are the referential actions of a foreign key.
+	OnDelete ForeignKeyAction
+	OnUpdate ForeignKeyAction
+	// OnDeleteColumns limits ON DELETE SET NULL/SET DEFAULT to a subset of the columns.
+	OnDeleteColumns Columns
+	Match           ForeignKeyMatch
+	// Deferrable and InitiallyDeferred control when the constraint is checked.
+	Deferrable        bool
+	InitiallyDeferred bool
 	// DropBehaviour explains how this constraint should behave
 	// when one of its dependencies is dropped.
 	DropBehaviour DropBehaviour
+	// InheritedFrom is the constraint on the parent table that
+	// this constraint was copied from, if it belongs to a partition.
+	InheritedFrom *Constraint
 }
 
 func (c *Constraint) FQName() string {
@@ -238,6 +602,165 @@ func (c *Constraint) Depends() Columns {
 
 type Constraints []*Constraint
 
+type View struct {
+	Name         string
+	Schema       string
+	Materialized bool
+	// Query is the deparsed defining query.
+	Query   string
+	Columns []*ViewColumn
+	// Tables, DependsOnColumns and Views hold the objects the defining
+	// query reads from directly.
+	Tables           []*Table
+	DependsOnColumns Columns
+	Views            []*View
+}
+
+func (v *View) FQName() string {
+
+	if v.Schema == "" {
+		return v.Name
+	}
+	return v.Schema + "." + v.Name
+}
+
+func (v *View) Kind() string {
+
+	if v.Materialized {
+		return "materialized view"
+	}
+	return "view"
+}
+
+type Sequence struct {
+	Name   string
+	Schema string
+	// Type is the data type of the sequence: smallint, integer or bigint.
+	Type      *PostgresType
+	Start     int64
+	Increment int64
+	MinValue  int64
+	MaxValue  int64
+	Cache     int64
+	Cycle     bool
+	// OwnedBy is the column the sequence belongs to, if any.
+	// An owned sequence is dropped along with its column.
+	OwnedBy *Column
+}
+
+func (s *Sequence) FQName() string {
+
+	if s.Schema == "" {
+		return s.Name
+	}
+	return s.Schema + "." + s.Name
+}
+
+type ViewColumn struct {
+	Name string
+	// Type is the inferred type of the column, or nil if it could not be determined.
+	Type *PostgresType
+	// Source is the table column the value is passed through from, if any.
+	Source *Column
+}
+
+type Index struct {
+	Name string
+	// Table is the table the index is on, or nil for an index on a
+	// materialized view.
+	Table *Table
+	// View is the materialized view the index is on, if any.
+	View *View
+	// Method is the access method used by the index.
+	Method  IndexMethod
+	Unique  bool
+	Primary bool
+	// NullsNotDistinct is set for unique indexes created with NULLS NOT DISTINCT.
+	NullsNotDistinct bool
+	Keys             []*IndexKey
+	// Include holds the non-key columns of a covering index, and
+	// ViewInclude those of a covering index on a materialized view.
+	Include     Columns
+	ViewInclude []*ViewColumn
+	// Predicate is the deparsed WHERE clause of a partial index.
+	Predicate        string
+	PredicateColumns Columns
+	Concurrently     bool
+	// Constraint is set when the index was created implicitly to
+	// back a primary key or unique constraint.
+	Constraint *Constraint
+}
+
+func (i *Index) FQName() string {
+
+	if i.Schema() == "" {
+		return i.Name
+	}
+	return i.Schema() + "." + i.Name
+}
+
+// Schema returns the schema of the index, which is that of its relation.
+func (i *Index) Schema() string {
+
+	if i.View != nil {
+		return i.View.Schema
+	}
+	return i.Table.Schema
+}
+
+// RelationName returns the name of the table or materialized view the index is on.
+func (i *Index) RelationName() string {
+
+	if i.View != nil {
+		return i.View.Name
+	}
+	return i.Table.Name
+}
+
+// Depends returns every column the index depends on, whether as a key,
+// inside a key expression, as an included column or in its predicate.
+func (i *Index) Depends() Columns {
+
+	var ret Columns
+	for _, key := range i.Keys {
+		ret = append(ret, key.Columns...)
+	}
+	return slices.Concat(ret, i.Include, i.PredicateColumns)
+}
+
+type IndexKey struct {
+	// Column is set when the key is a plain column reference, and
+	// ViewColumn when it is a column of a materialized view.
+	Column     *Column
+	ViewColumn *ViewColumn
+	// Expression is set when the key is an expression.
+	Expression string
+	// Columns holds the columns referenced by the key.
+	Columns    Columns
+	Descending bool
+	NullsFirst bool
+}
+
+type IndexMethod string
+
+const (
+	IndexMethodBtree  IndexMethod = "btree"
+	IndexMethodHash   IndexMethod = "hash"
+	IndexMethodGist   IndexMethod = "gist"
+	IndexMethodSpgist IndexMethod = "spgist"
+	IndexMethodGin    IndexMethod = "gin"
+	IndexMethodBrin   IndexMethod = "brin"
+)
+
+var indexMethods = map[IndexMethod]struct{}{
+	IndexMethodBtree:  {},
+	IndexMethodHash:   {},
+	IndexMethodGist:   {},
+	IndexMethodSpgist: {},
+	IndexMethodGin:    {},
+	IndexMethodBrin:   {},
+}
+
 type DropBehaviour int
 
 const (
@@ -252,13 +775,60 @@ const (
 	DropBehaviourRestrict
 )
 
+// ForeignKeyAction is what happens to referencing rows when the referenced row changes.
+type ForeignKeyAction int
+
+const (
+	ForeignKeyActionNoAction ForeignKeyAction = iota
+	ForeignKeyActionRestrict
+	ForeignKeyActionCascade
+	ForeignKeyActionSetNull
+	ForeignKeyActionSetDefault
+)
+
+func (a ForeignKeyAction) String() string {
+
+	switch a {
+	case ForeignKeyActionNoAction:
+		return "NO ACTION"
+	case ForeignKeyActionRestrict:
+		return "RESTRICT"
+	case ForeignKeyActionCascade:
+		return "CASCADE"
+	case ForeignKeyActionSetNull:
+		return "SET NULL"
+	case ForeignKeyActionSetDefault:
+		return "SET DEFAULT"
+	}
+	return fmt.Sprintf("ForeignKeyAction(%d)", int(a))
+}
+
+// ForeignKeyMatch is how a multi-column foreign key treats null values.
+type ForeignKeyMatch int
+
+const (
+	ForeignKeyMatchSimple ForeignKeyMatch = iota
+	ForeignKeyMatchFull
+)
+
+func (m ForeignKeyMatch) String() string {
+
+	switch m {
+	case ForeignKeyMatchSimple:
+		return "SIMPLE"
+	case ForeignKeyMatchFull:
+		return "FULL"
+	}
+	return fmt.Sprintf("ForeignKeyMatch(%d)", int(m))
+}
+
 type ConstraintType int
 
 const (
 	ConstraintTypePrimary ConstraintType = iota
 	ConstraintTypeUnique
 	ConstraintTypeForeignKey
-	ConstraintTypeIdentity
+	ConstraintTypeCheck
 )
 
 func (c ConstraintType) String() string {
@@ -270,9 +840,8 @@ func (c ConstraintType) String() string {
 		return "Unique"
 	case ConstraintTypeForeignKey:
 		return "Foreign Key"
-	case ConstraintTypeIdentity:
-		return "Identity"
+	case ConstraintTypeCheck:
+		return "Check"
 	}
-	panic(c)
-
+	return fmt.Sprintf("ConstraintType(%d)", int(c))
 }
@@ -1,7 +1,11 @@
 package pgmodelparse
 
 import (
+	"errors"
+	"fmt"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/samber/lo"
@@ -17,20 +21,149 @@ type PostgresType struct {
 	EnumValues     []string
 	SimpleMatches  []string
 	PatternMatches []*regexp.Regexp
+	// ElementType and Dimensions are set for array types, which are
+	// created on demand by TypeRegistry.ArrayOf.
+	ElementType *PostgresType
+	Dimensions  int
+	// Domain is set for types created with CREATE DOMAIN.
+	Domain *Domain
+	// Composite is set for types created with CREATE TYPE ... AS (...).
+	Composite *Composite
+	// Range is set for range types, and MultirangeOf for the
+	// multirange type that is created along with each range type.
+	Range        *Range
+	MultirangeOf *PostgresType
+}
+
+func (t *PostgresType) IsArray() bool {
+	return t.ElementType != nil
+}
+
+func (t *PostgresType) IsEnum() bool {
+	return t.EnumValues != nil
+}
+
+func (t *PostgresType) IsDomain() bool {
+	return t.Domain != nil
+}
+
+func (t *PostgresType) IsComposite() bool {
+	return t.Composite != nil
+}
+
+func (t *PostgresType) IsRange() bool {
+	return t.Range != nil
+}
+
+func (t *PostgresType) IsMultirange() bool {
+	return t.MultirangeOf != nil
+}
+
+// UnderlyingType returns the type a domain is ultimately based on,
+// or the type itself if it isn't a domain.
+func (t *PostgresType) UnderlyingType() *PostgresType {
+	for t.IsDomain() {
+		t = t.Domain.BaseType
+	}
+	return t
+}
+
+// DomainNotNull reports whether the domain, or any domain it is based on, is NOT NULL.
+func (t *PostgresType) DomainNotNull() bool {
+	for ; t.IsDomain(); t = t.Domain.BaseType {
+		if t.Domain.NotNull {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainDefault returns the default of the domain, falling back
+// to the default of any domain it is based on.
+func (t *PostgresType) DomainDefault() string {
+	for ; t.IsDomain(); t = t.Domain.BaseType {
+		if t.Domain.Default != "" {
+			return t.Domain.Default
+		}
+	}
+	return ""
+}
+
+// Domain holds what a domain adds to its base type.
+type Domain struct {
+	BaseType  *PostgresType
+	Modifiers TypeModifiers
+	NotNull   bool
+	// Default is the deparsed default expression, if any.
+	Default string
+	Checks  []*DomainCheck
+}
+
+type DomainCheck struct {
+	Name string
+	// Expression is the deparsed check, which refers to the value as VALUE.
+	Expression string
+	NotValid   bool
+}
+
+// Composite holds the attributes of a composite type, in order.
+type Composite struct {
+	Attributes []*TypeAttribute
+}
+
+// Attribute returns the named attribute, or nil.
+func (c *Composite) Attribute(name string) *TypeAttribute {
+	for _, attr := range c.Attributes {
+		if attr.Name == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+type TypeAttribute struct {
+	Name      string
+	Type      *PostgresType
+	Modifiers TypeModifiers
+}
+
+// Range holds the subtype of a range type and its multirange type.
+type Range struct {
+	Subtype    *PostgresType
+	Multirange *PostgresType
+}
+
+// arrayTypeName returns the name of an array type as Postgres writes it, e.g. integer[][].
+func arrayTypeName(elem string, dims int) string {
+	return elem + strings.Repeat("[]", dims)
 }
 
 var validCasts = map[*PostgresType][]*PostgresType{
-	Bigint:      {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Bigserial:   {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Integer:     {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Serial:      {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Smallint:    {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Smallserial: {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
-	Text:        {Bytea},
-	Bytea:       {Text},
+	Bigint:           {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Bigserial:        {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Integer:          {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Serial:           {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Smallint:         {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Smallserial:      {Bigint, Bigserial, Integer, Serial, Smallint, Smallserial},
+	Text:             {Bytea, CharacterVarying, Character},
+	Bytea:            {Text},
+	CharacterVarying: {Text, Character},
+	Character:        {Text, CharacterVarying},
 }
 
 func CanCast(from, to *PostgresType) bool {
+	// Domains cast as their base types
+	from, to = from.UnderlyingType(), to.UnderlyingType()
+	if from == to {
+		return true
+	}
+	if from.IsArray() || to.IsArray() {
+		// Arrays cast element by element
+		if !from.IsArray() || !to.IsArray() {
+			return false
+		}
+		return from.ElementType == to.ElementType || CanCast(from.ElementType, to.ElementType)
+	}
 	casts, ok := validCasts[from]
 	if !ok {
 		return false
@@ -43,6 +176,90 @@ func CanCast(from, to *PostgresType) bool {
 	return false
 }
 
+// assignmentCategories groups types that Postgres can convert between when
+// assigning a value to a column. Types not listed are not checked.
+var assignmentCategories = map[*PostgresType]string{
+	Smallint: "numeric", Integer: "numeric", Bigint: "numeric",
+	Smallserial: "numeric", Serial: "numeric", Bigserial: "numeric",
+	Numeric: "numeric", Real: "numeric", Double: "numeric",
+	Boolean:   "boolean",
+	Text:      "string",
+	Character: "string", CharacterVarying: "string",
+	Date: "datetime", Timestamp: "datetime", Timestamptz: "datetime",
+}
+
+// CanAssign reports whether a value of type from may be stored in a column of type to.
+// Any type can be assigned to a string column through its text representation.
+func CanAssign(from, to *PostgresType) bool {
+	from, to = from.UnderlyingType(), to.UnderlyingType()
+	fromCat, ok := assignmentCategories[from]
+	if !ok {
+		return true
+	}
+	toCat, ok := assignmentCategories[to]
+	if !ok {
+		return true
+	}
+	return fromCat == toCat || toCat == "string"
+}
+
+// integerBits gives the size of the integer types, to check literals are in range.
+var integerBits = map[*PostgresType]int{
+	Smallint: 16, Integer: 32, Bigint: 64,
+	Smallserial: 16, Serial: 32, Bigserial: 64,
+}
+
+// checkLiteral returns an error if the untyped literal s isn't valid input
+// for type to. Only numeric and boolean types are checked.
+func checkLiteral(s string, to *PostgresType) error {
+	to = to.UnderlyingType()
+	v := strings.TrimSpace(s)
+	var err error
+	switch assignmentCategories[to] {
+	case "numeric":
+		// Postgres also accepts underscores between digits
+		v = strings.ReplaceAll(v, "_", "")
+		if bits, ok := integerBits[to]; ok {
+			_, err = strconv.ParseInt(v, 10, bits)
+			if err != nil && !errors.Is(err, strconv.ErrRange) {
+				// Hexadecimal, octal and binary integers
+				_, err = strconv.ParseInt(v, 0, bits)
+			}
+		} else {
+			_, err = strconv.ParseFloat(v, 64)
+			if to == Numeric && errors.Is(err, strconv.ErrRange) {
+				// Numeric values aren't limited to the range of a float
+				err = nil
+			}
+		}
+	case "boolean":
+		if !isBoolLiteral(strings.ToLower(v)) {
+			err = strconv.ErrSyntax
+		}
+	}
+	switch {
+	case errors.Is(err, strconv.ErrRange):
+		return fmt.Errorf("value \"%s\" is out of range for type %s", s, to.Name)
+	case err != nil:
+		return fmt.Errorf("invalid input syntax for type %s: \"%s\"", to.Name, s)
+	}
+	return nil
+}
+
+// isBoolLiteral reports whether s is one of the spellings of a boolean that
+// Postgres accepts, which include any prefix of true, false, yes and no.
+func isBoolLiteral(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, word := range []string{"true", "false", "yes", "no"} {
+		if strings.HasPrefix(word, s) {
+			return true
+		}
+	}
+	return slices.Contains([]string{"on", "of", "off", "1", "0"}, s)
+}
+
 func optionally(re string) string {
 	return "(" + re + ")?"
 }
@@ -99,13 +316,14 @@ var (
 	Character = &PostgresType{Name: "character", Aliases: "char", PatternMatches: []*regexp.Regexp{
 		regexp.MustCompile("^character" + optionally(numInBrackets) + "$"),
 		regexp.MustCompile("^char" + optionally(numInBrackets) + "$"),
+		regexp.MustCompile("^bpchar" + optionally(numInBrackets) + "$"),
 	}, Description: "fixed-length character string"}
 	CharacterVarying = &PostgresType{Name: "character varying", Aliases: "varchar", PatternMatches: []*regexp.Regexp{
 		regexp.MustCompile("^character varying" + optionally(numInBrackets) + "$"),
 		regexp.MustCompile("^varchar" + optionally(numInBrackets) + "$"),
 	}, Description: "variable-length character string"}
 	Interval = &PostgresType{Name: "interval", PatternMatches: []*regexp.Regexp{
-		regexp.MustCompile("^interval" + interval + optionally(numInBrackets) + "$"),
+		regexp.MustCompile("^interval" + optionally(interval) + optionally(numInBrackets) + "$"),
 	}, Description: "time span"}
 	Numeric = &PostgresType{Name: "numeric", Aliases: "decimal", PatternMatches: []*regexp.Regexp{
 		regexp.MustCompile("^numeric" + optionally(twoNumsInBrackets) + "$"),
@@ -129,8 +347,29 @@ var (
 	},
 		SimpleMatches: []string{"timestamptz"},
 		Description:   "date and time, including time zone"}
+
+	Int4Range      = &PostgresType{Name: "int4range", SimpleMatches: []string{"int4range"}, Description: "range of integer", Range: &Range{Subtype: Integer}}
+	Int8Range      = &PostgresType{Name: "int8range", SimpleMatches: []string{"int8range"}, Description: "range of bigint", Range: &Range{Subtype: Bigint}}
+	NumRange       = &PostgresType{Name: "numrange", SimpleMatches: []string{"numrange"}, Description: "range of numeric", Range: &Range{Subtype: Numeric}}
+	TSRange        = &PostgresType{Name: "tsrange", SimpleMatches: []string{"tsrange"}, Description: "range of timestamp without time zone", Range: &Range{Subtype: Timestamp}}
+	TSTZRange      = &PostgresType{Name: "tstzrange", SimpleMatches: []string{"tstzrange"}, Description: "range of timestamp with time zone", Range: &Range{Subtype: Timestamptz}}
+	DateRange      = &PostgresType{Name: "daterange", SimpleMatches: []string{"daterange"}, Description: "range of date", Range: &Range{Subtype: Date}}
+	Int4Multirange = &PostgresType{Name: "int4multirange", SimpleMatches: []string{"int4multirange"}, Description: "multirange of integer", MultirangeOf: Int4Range}
+	Int8Multirange = &PostgresType{Name: "int8multirange", SimpleMatches: []string{"int8multirange"}, Description: "multirange of bigint", MultirangeOf: Int8Range}
+	NumMultirange  = &PostgresType{Name: "nummultirange", SimpleMatches: []string{"nummultirange"}, Description: "multirange of numeric", MultirangeOf: NumRange}
+	TSMultirange   = &PostgresType{Name: "tsmultirange", SimpleMatches: []string{"tsmultirange"}, Description: "multirange of timestamp without time zone", MultirangeOf: TSRange}
+	TSTZMultirange = &PostgresType{Name: "tstzmultirange", SimpleMatches: []string{"tstzmultirange"}, Description: "multirange of timestamp with time zone", MultirangeOf: TSTZRange}
+	DateMultirange = &PostgresType{Name: "datemultirange", SimpleMatches: []string{"datemultirange"}, Description: "multirange of date", MultirangeOf: DateRange}
 )
 
+func init() {
+	// Ranges and multiranges refer to each other, so the links back to the
+	// multirange types can't be made in their declarations
+	for _, typ := range []*PostgresType{Int4Multirange, Int8Multirange, NumMultirange, TSMultirange, TSTZMultirange, DateMultirange} {
+		typ.MultirangeOf.Range.Multirange = typ
+	}
+}
+
 var defaultPGTypes = []*PostgresType{
 	Bigint,
 	Bigserial,
@@ -175,6 +414,18 @@ var defaultPGTypes = []*PostgresType{
 	Timetz,
 	Timestamp,
 	Timestamptz,
+	Int4Range,
+	Int8Range,
+	NumRange,
+	TSRange,
+	TSTZRange,
+	DateRange,
+	Int4Multirange,
+	Int8Multirange,
+	NumMultirange,
+	TSMultirange,
+	TSTZMultirange,
+	DateMultirange,
 }
 
 type PostgresInterval string
@@ -211,6 +462,41 @@ var intervals = map[PostgresInterval]struct{}{
 	PostgresIntervalMinuteToSecond: {},
 }
 
+// intervalFieldMasks maps the typmod bitmask the parser produces for
+// an interval's field restriction to the restriction it represents.
+var intervalFieldMasks = map[int32]PostgresInterval{
+	1 << 2:                       PostgresIntervalYear,
+	1 << 1:                       PostgresIntervalMonth,
+	1 << 3:                       PostgresIntervalDay,
+	1 << 10:                      PostgresIntervalHour,
+	1 << 11:                      PostgresIntervalMinute,
+	1 << 12:                      PostgresIntervalSecond,
+	1<<2 | 1<<1:                  PostgresIntervalYearToMonth,
+	1<<3 | 1<<10:                 PostgresIntervalDayToHour,
+	1<<3 | 1<<10 | 1<<11:         PostgresIntervalDayToMinute,
+	1<<3 | 1<<10 | 1<<11 | 1<<12: PostgresIntervalDayToSecond,
+	1<<10 | 1<<11:                PostgresIntervalHourToMinute,
+	1<<10 | 1<<11 | 1<<12:        PostgresIntervalHourToSecond,
+	1<<11 | 1<<12:                PostgresIntervalMinuteToSecond,
+}
+
+// intervalFullRange is the typmod of an interval without a field restriction.
+const intervalFullRange = 0x7FFF
+
+// TypeModifiers holds the parameters given with a type name, such as the 50 in varchar(50).
+type TypeModifiers struct {
+	// Length is the maximum length of a varchar or varbit, or the fixed length of a char or bit.
+	Length int
+	// Precision and Scale are those of numeric(p, s). For time, timestamp and interval
+	// types Precision is the number of fractional digits kept for seconds.
+	Precision int
+	Scale     int
+	// HasPrecision distinguishes an explicit precision of 0, as in timestamp(0), from none.
+	HasPrecision bool
+	// IntervalFields restricts the fields stored by an interval, e.g. DAY TO SECOND.
+	IntervalFields PostgresInterval
+}
+
 var intervalsRe = strings.Join(lo.Map(lo.Keys(intervals), func(item PostgresInterval, index int) string {
 	return strings.ToLower(string(item))
 }), "|")
@@ -0,0 +1,95 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// CreateRange registers a range type and its multirange type.
+func (c *Compiler) CreateRange(stmt *pg_query.CreateRangeStmt) error {
+
+	schema, name := ObjectNameFromNodeList(stmt.TypeName)
+	schema, err := c.CreationSchema(schema)
+	if err != nil {
+		return err
+	}
+	typeName := qualifiedTypeName(schema, name)
+	if _, ok := c.TypeRegistry.LookupType(typeName); ok {
+		return duplicateObjectError("type", typeName, "type %s already exists", typeName)
+	}
+	var subtype *PostgresType
+	var multirangeName string
+	for _, n := range stmt.Params {
+		def := n.GetDefElem()
+		switch def.Defname {
+		case "subtype":
+			{
+				if subtype != nil {
+					return fmt.Errorf("conflicting or redundant options")
+				}
+				var err error
+				subtype, err = c.FindTypeFromNode(def.Arg.GetTypeName())
+				if err != nil {
+					return err
+				}
+				if subtype.IsSerial {
+					return notFoundError("type", subtype.Name, "type %s does not exist", subtype.Name)
+				}
+			}
+		case "multirange_type_name":
+			{
+				mrSchema, mrName := ObjectNameFromNodeList(def.Arg.GetTypeName().GetNames())
+				if mrSchema != "" && mrSchema != schema {
+					return fmt.Errorf("multirange type must be in the same schema as its range type")
+				}
+				multirangeName = mrName
+			}
+		case "subtype_opclass", "collation", "canonical", "subtype_diff":
+			// These only affect how values are compared and stored
+		default:
+			return fmt.Errorf("type attribute %s not recognized", def.Defname)
+		}
+	}
+	if subtype == nil {
+		return fmt.Errorf("type attribute subtype is required")
+	}
+	if multirangeName == "" {
+		multirangeName = defaultMultirangeName(name)
+	}
+	multirangeTypeName := qualifiedTypeName(schema, multirangeName)
+	if _, ok := c.TypeRegistry.LookupType(multirangeTypeName); ok || multirangeTypeName == typeName {
+		return duplicateObjectError("type", multirangeTypeName, "type %s already exists", multirangeTypeName)
+	}
+	typ := &PostgresType{
+		Name:          typeName,
+		Schema:        schema,
+		Description:   "range of " + subtype.Name,
+		SimpleMatches: []string{typeName},
+		Range:         &Range{Subtype: subtype},
+	}
+	multirange := &PostgresType{
+		Name:          multirangeTypeName,
+		Schema:        schema,
+		Description:   "multirange of " + typeName,
+		SimpleMatches: []string{multirangeTypeName},
+		MultirangeOf:  typ,
+	}
+	typ.Range.Multirange = multirange
+	err = c.registerType(typ)
+	if err != nil {
+		return err
+	}
+	return c.registerType(multirange)
+}
+
+// defaultMultirangeName names a multirange type after its range type as
+// Postgres does, e.g. floatrange becomes floatmultirange.
+func defaultMultirangeName(rangeName string) string {
+
+	if i := strings.Index(rangeName, "range"); i >= 0 {
+		return rangeName[:i] + "multirange" + rangeName[i+len("range"):]
+	}
+	return rangeName + "_multirange"
+}
@@ -0,0 +1,331 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// Rename handles the various forms of ALTER ... RENAME.
+func (c *Compiler) Rename(stmt *pg_query.RenameStmt) error {
+
+	switch stmt.RenameType {
+	case pg_query.ObjectType_OBJECT_TABLE:
+		tab, err := c.FindTableFromRangeVar(stmt.Relation)
+		if err != nil {
+			if stmt.MissingOk {
+				return nil
+			}
+			return err
+		}
+		return c.RenameTable(tab, stmt.Newname)
+	case pg_query.ObjectType_OBJECT_COLUMN:
+		return c.RenameColumn(stmt)
+	case pg_query.ObjectType_OBJECT_TABCONSTRAINT:
+		return c.RenameConstraint(stmt)
+	case pg_query.ObjectType_OBJECT_INDEX:
+		return c.RenameIndex(stmt.Relation, stmt.Newname, stmt.MissingOk)
+	case pg_query.ObjectType_OBJECT_SEQUENCE:
+		return c.RenameSequence(stmt.Relation, stmt.Newname, stmt.MissingOk)
+	case pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_MATVIEW:
+		return c.RenameView(stmt.Relation, stmt.Newname, stmt.RenameType == pg_query.ObjectType_OBJECT_MATVIEW, stmt.MissingOk)
+	case pg_query.ObjectType_OBJECT_SCHEMA:
+		return c.RenameSchema(stmt.Subname, stmt.Newname)
+	case pg_query.ObjectType_OBJECT_TYPE, pg_query.ObjectType_OBJECT_DOMAIN:
+		return c.RenameType(stmt.Object.GetList().GetItems(), stmt.Newname)
+	case pg_query.ObjectType_OBJECT_ATTRIBUTE:
+		return c.RenameTypeAttribute(stmt)
+	case pg_query.ObjectType_OBJECT_DOMCONSTRAINT:
+		return c.RenameDomainConstraint(stmt.Object.GetList().GetItems(), stmt.Subname, stmt.Newname)
+	}
+	return c.unsupported("renaming " + objectTypeName(stmt.RenameType))
+}
+
+func (c *Compiler) RenameColumn(stmt *pg_query.RenameStmt) error {
+
+	if stmt.RelationType == pg_query.ObjectType_OBJECT_VIEW || stmt.RelationType == pg_query.ObjectType_OBJECT_MATVIEW {
+		return c.RenameViewColumn(stmt)
+	}
+	tab, err := c.FindTableFromRangeVar(stmt.Relation)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	if col, ok := tab.Columns.Get(stmt.Subname); ok && col.Attrs.Inherited {
+		return fmt.Errorf("cannot rename inherited column %s", stmt.Subname)
+	}
+	return c.renameColumn(tab, stmt.Subname, stmt.Newname)
+}
+
+// renameColumn renames the column in the table and any partitions.
+func (c *Compiler) renameColumn(tab *Table, oldName, newName string) error {
+
+	col, ok := tab.Columns.Get(oldName)
+	if !ok {
+		return notFoundInTableError("column", tab, oldName, "column %s does not exist", oldName)
+	}
+	if _, ok := tab.Columns.Get(newName); ok {
+		return duplicateObjectError("column", newName, "column %s of relation %s already exists", newName, tab.Name)
+	}
+	err := c.renameColumnRefs(col, newName)
+	if err != nil {
+		return err
+	}
+	c.changing(tab, col)
+	tab.Columns.Rekey(col.Name, newName)
+	col.Name = newName
+	for _, child := range c.Catalog.Children(tab) {
+		err := c.renameColumn(child, oldName, newName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameColumnRefs rewrites the expressions of the check constraints,
+// indexes, generated columns and partition key, and the queries of the
+// views, that use the column to refer to its new name.
+func (c *Compiler) renameColumnRefs(col *Column, newName string) error {
+
+	var err error
+	cons, _ := c.Catalog.PgConstraint.Constrains.Get(col)
+	for _, con := range cons {
+		if con.Expression != "" {
+			c.changing(con)
+			con.Expression, err = RenameColumnRefs(con.Expression, col.Name, newName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, idx := range c.Catalog.TableIndexes(col.Table) {
+		for _, key := range idx.Keys {
+			if key.Expression != "" && slices.Contains(key.Columns, col) {
+				c.changing(key)
+				key.Expression, err = RenameColumnRefs(key.Expression, col.Name, newName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if slices.Contains(idx.PredicateColumns, col) {
+			c.changing(idx)
+			idx.Predicate, err = RenameColumnRefs(idx.Predicate, col.Name, newName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, other := range generatedDependents(col) {
+		c.changing(other.Attrs)
+		other.Attrs.GeneratedExpression, err = RenameColumnRefs(other.Attrs.GeneratedExpression, col.Name, newName)
+		if err != nil {
+			return err
+		}
+	}
+	if col.Table.PartitionKey != nil {
+		for _, key := range col.Table.PartitionKey.Keys {
+			if key.Expression != "" && slices.Contains(key.Columns, col) {
+				c.changing(key)
+				key.Expression, err = RenameColumnRefs(key.Expression, col.Name, newName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, v := range c.Catalog.ColumnDependentViews(col) {
+		err = c.rewriteViewQuery(v, &queryAnalyzer{c: c, renamingColumn: col}, newName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) RenameViewColumn(stmt *pg_query.RenameStmt) error {
+
+	v, err := c.FindView(stmt.Relation.Schemaname, stmt.Relation.Relname)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	idx := slices.IndexFunc(v.Columns, func(vc *ViewColumn) bool { return vc.Name == stmt.Subname })
+	if idx < 0 {
+		return notFoundError("column", stmt.Subname, "column %s does not exist", stmt.Subname)
+	}
+	if slices.ContainsFunc(v.Columns, func(vc *ViewColumn) bool { return vc.Name == stmt.Newname }) {
+		return duplicateObjectError("column", stmt.Newname, "column %s of relation %s already exists", stmt.Newname, v.Name)
+	}
+	for _, dep := range c.Catalog.ViewDependentViews(v) {
+		err = c.rewriteViewQuery(dep, &queryAnalyzer{c: c, renamingViewColumn: v.Columns[idx]}, stmt.Newname)
+		if err != nil {
+			return err
+		}
+	}
+	for _, vidx := range c.Catalog.ViewIndexes(v) {
+		err = c.renameViewIndexRefs(vidx, stmt.Subname, stmt.Newname)
+		if err != nil {
+			return err
+		}
+	}
+	c.changing(v.Columns[idx])
+	v.Columns[idx].Name = stmt.Newname
+	return nil
+}
+
+// renameViewIndexRefs rewrites the key expressions and predicate of an index
+// on a materialized view that use the view column to refer to its new name.
+func (c *Compiler) renameViewIndexRefs(idx *Index, oldName, newName string) error {
+
+	var err error
+	for _, key := range idx.Keys {
+		if key.Expression != "" && exprUsesColumn(key.Expression, oldName) {
+			c.changing(key)
+			key.Expression, err = RenameColumnRefs(key.Expression, oldName, newName)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if idx.Predicate != "" && exprUsesColumn(idx.Predicate, oldName) {
+		c.changing(idx)
+		idx.Predicate, err = RenameColumnRefs(idx.Predicate, oldName, newName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exprUsesColumn reports whether an expression rendered by DeparseExpr refers to the column.
+func exprUsesColumn(expr, name string) bool {
+
+	n, err := ParseExpr(expr)
+	return err == nil && slices.Contains(ColumnRefNames(n), name)
+}
+
+func (c *Compiler) RenameConstraint(stmt *pg_query.RenameStmt) error {
+
+	tab, err := c.FindTableFromRangeVar(stmt.Relation)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	cons, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(tab, stmt.Subname)]
+	if !ok {
+		return notFoundInTableError("constraint", tab, stmt.Subname, "constraint %s for table %s does not exist", stmt.Subname, tab.Name)
+	}
+	if _, ok := c.Catalog.PgConstraint.ByName[ConstraintFQName(tab, stmt.Newname)]; ok {
+		return duplicateObjectError("constraint", stmt.Newname, "constraint %s for relation %s already exists", stmt.Newname, tab.Name)
+	}
+	for _, idx := range c.Catalog.TableIndexes(tab) {
+		if idx.Constraint == cons {
+			// The index backing a constraint is renamed along with it
+			return c.RenameIndex(&pg_query.RangeVar{Schemaname: tab.Schema, Relname: idx.Name}, stmt.Newname, false)
+		}
+	}
+	c.renameConstraint(cons, stmt.Newname)
+	return nil
+}
+
+// renameConstraint renames the constraint, keeping PgConstraint.ByName up to date.
+func (c *Compiler) renameConstraint(cons *Constraint, newName string) {
+
+	c.changingConstraint(cons)
+	c.changingConstraintName(ConstraintFQName(cons.Table, newName))
+	c.Catalog.PgConstraint.RenameConstraint(cons, newName)
+}
+
+// refreshConstraintNames re-keys PgConstraint.ByName after renaming a table
+// or schema.
+func (c *Compiler) refreshConstraintNames() {
+
+	c.changing(c.Catalog.PgConstraint)
+	c.Catalog.PgConstraint.RefreshNames()
+}
+
+func (c *Compiler) RenameSchema(oldName, newName string) error {
+
+	sch, ok := c.Catalog.Schemas.Get(oldName)
+	if !ok {
+		return notFoundError("schema", oldName, "schema %s does not exist", oldName)
+	}
+	if _, ok := c.Catalog.Schemas.Get(newName); ok {
+		return duplicateObjectError("schema", newName, "schema %s already exists", newName)
+	}
+	for _, v := range c.Catalog.SchemaDependentViews(oldName) {
+		err := c.rewriteViewQuery(v, &queryAnalyzer{c: c, renamingSchema: oldName}, newName)
+		if err != nil {
+			return err
+		}
+	}
+	for _, typ := range c.TypeRegistry.SchemaTypes(oldName) {
+		err := c.renameType(typ, newName, strings.TrimPrefix(typ.Name, oldName+"."))
+		if err != nil {
+			return err
+		}
+	}
+	users := make(map[*Sequence]Columns)
+	for _, seq := range c.allSequences() {
+		users[seq] = c.sequenceUsers(seq)
+	}
+	c.changing(c.Catalog, sch)
+	c.Catalog.Schemas.Rekey(oldName, newName)
+	sch.Name = newName
+	for _, tab := range sch.Tables.List() {
+		c.changing(tab)
+		tab.Schema = newName
+	}
+	for _, v := range sch.Views.List() {
+		c.changing(v)
+		v.Schema = newName
+	}
+	for _, seq := range sch.Sequences.List() {
+		c.changing(seq)
+		seq.Schema = newName
+	}
+	for seq, cols := range users {
+		c.updateSequenceReferences(seq, cols)
+	}
+	c.refreshConstraintNames()
+	return nil
+}
+
+func (c *Compiler) RenameType(names []*pg_query.Node, newName string) error {
+
+	typ, err := c.findTypeFromNameList(names)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(defaultPGTypes, typ) {
+		return fmt.Errorf("cannot rename built-in type %s", typ.Name)
+	}
+	return c.renameType(typ, typ.Schema, newName)
+}
+
+// renameType gives a user-defined type a new name and schema.
+func (c *Compiler) renameType(typ *PostgresType, schema, name string) error {
+
+	c.changingType(typ)
+	return c.TypeRegistry.RenameType(typ, schema, name)
+}
+
+// objectTypeName formats an ObjectType the way it appears in SQL, e.g. "materialized view".
+func objectTypeName(t pg_query.ObjectType) string {
+
+	name := strings.TrimPrefix(t.String(), "OBJECT_")
+	if name == "MATVIEW" {
+		return "materialized view"
+	}
+	return strings.ToLower(strings.ReplaceAll(name, "_", " "))
+}
@@ -0,0 +1,308 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+func (c *Compiler) DropSchemas(stmt *pg_query.DropStmt) error {
+
+	behav := DropBehaviourRestrict
+	if stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		behav = DropBehaviourCascade
+	}
+	for _, n := range stmt.Objects {
+		name, err := StringFromNode(n)
+		if err != nil {
+			return err
+		}
+		sch, ok := c.Catalog.Schemas.Get(name)
+		if !ok {
+			if stmt.MissingOk {
+				continue
+			}
+			return notFoundError("schema", name, "schema %s does not exist", name)
+		}
+		err = c.DropSchema(sch, behav)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropSchema removes a schema. Unless the drop cascades, the schema must be
+// empty; if it does, everything in it is dropped, along with anything in
+// other schemas that depends on those objects.
+func (c *Compiler) DropSchema(sch *Schema, behav DropBehaviour) error {
+
+	types := c.schemaTypes(sch.Name)
+	if behav != DropBehaviourCascade {
+		var kind, name string
+		switch {
+		case len(sch.Tables.List()) > 0:
+			kind, name = "table", sch.Tables.List()[0].Name
+		case len(sch.Views.List()) > 0:
+			kind, name = sch.Views.List()[0].Kind(), sch.Views.List()[0].Name
+		case len(sch.Sequences.List()) > 0:
+			kind, name = "sequence", sch.Sequences.List()[0].Name
+		case len(types) > 0:
+			kind, name = "type", types[0].Name
+		}
+		if kind != "" {
+			return dependencyError(sch.Name, name, "can't drop schema %s because %s %s depends on it and cascade was not specified",
+				sch.Name, kind, name)
+		}
+	}
+	// Each drop can cascade to objects later in the lists, so check
+	// that they still exist before dropping them
+	for _, v := range sch.Views.List() {
+		if current, ok := sch.Views.Get(v.Name); ok && current == v {
+			err := c.DropView(v, DropBehaviourCascade)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, tab := range sch.Tables.List() {
+		if current, ok := sch.Tables.Get(tab.Name); ok && current == tab {
+			err := c.DropTable(tab.Schema, tab.Name, DropBehaviourCascade)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, seq := range sch.Sequences.List() {
+		if current, ok := sch.Sequences.Get(seq.Name); ok && current == seq {
+			err := c.DropSequence(seq, DropBehaviourCascade)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, typ := range types {
+		if current, ok := c.TypeRegistry.LookupType(typ.Name); ok && current == typ {
+			err := c.DropType(typ, DropBehaviourCascade)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	c.changing(c.Catalog)
+	c.Catalog.Schemas.Remove(sch.Name)
+	return nil
+}
+
+// schemaTypes returns the types in a schema that can be dropped directly,
+// which leaves out multirange types as they go with their range types.
+func (c *Compiler) schemaTypes(schema string) []*PostgresType {
+
+	var ret []*PostgresType
+	for _, typ := range c.TypeRegistry.SchemaTypes(schema) {
+		if !typ.IsMultirange() {
+			ret = append(ret, typ)
+		}
+	}
+	return ret
+}
+
+// AlterObjectSchema handles ALTER ... SET SCHEMA.
+func (c *Compiler) AlterObjectSchema(stmt *pg_query.AlterObjectSchemaStmt) error {
+
+	sch, ok := c.Catalog.Schemas.Get(stmt.Newschema)
+	if !ok {
+		return notFoundError("schema", stmt.Newschema, "schema %s does not exist", stmt.Newschema)
+	}
+	switch stmt.ObjectType {
+	case pg_query.ObjectType_OBJECT_TABLE:
+		tab, err := c.FindTableFromRangeVar(stmt.Relation)
+		if err != nil {
+			if stmt.MissingOk {
+				return nil
+			}
+			return err
+		}
+		return c.MoveTable(tab, sch)
+	case pg_query.ObjectType_OBJECT_VIEW, pg_query.ObjectType_OBJECT_MATVIEW:
+		v, err := c.FindView(stmt.Relation.Schemaname, stmt.Relation.Relname)
+		if err != nil {
+			if stmt.MissingOk {
+				return nil
+			}
+			return err
+		}
+		return c.MoveView(v, sch)
+	case pg_query.ObjectType_OBJECT_SEQUENCE:
+		seq, err := c.FindSequence(stmt.Relation.Schemaname, stmt.Relation.Relname)
+		if err != nil {
+			if stmt.MissingOk {
+				return nil
+			}
+			return err
+		}
+		return c.MoveSequence(seq, sch)
+	case pg_query.ObjectType_OBJECT_TYPE, pg_query.ObjectType_OBJECT_DOMAIN:
+		typ, err := c.findTypeFromNameList(stmt.Object.GetList().GetItems())
+		if err != nil {
+			if stmt.MissingOk {
+				return nil
+			}
+			return err
+		}
+		return c.MoveType(typ, sch)
+	}
+	return c.unsupported("moving " + objectTypeName(stmt.ObjectType) + " to another schema")
+}
+
+// MoveTable moves a table to another schema, along with its indexes
+// and the sequences owned by its columns.
+func (c *Compiler) MoveTable(tab *Table, to *Schema) error {
+
+	if tab.Schema == to.Name {
+		return fmt.Errorf("table %s is already in schema %s", tab.Name, to.Name)
+	}
+	from, ok := c.Catalog.Schemas.Get(tab.Schema)
+	if !ok {
+		return notFoundError("schema", tab.Schema, "did not find schema %s", tab.Schema)
+	}
+	indexes := c.Catalog.TableIndexes(tab)
+	var sequences []*Sequence
+	for _, seq := range from.Sequences.List() {
+		if seq.OwnedBy != nil && seq.OwnedBy.Table == tab {
+			sequences = append(sequences, seq)
+		}
+	}
+	names := []string{tab.Name}
+	for _, idx := range indexes {
+		names = append(names, idx.Name)
+	}
+	for _, seq := range sequences {
+		names = append(names, seq.Name)
+	}
+	for _, name := range names {
+		if to.HasRelation(name) {
+			return duplicateObjectError("relation", name, "relation %s already exists in schema %s", name, to.Name)
+		}
+	}
+	for _, v := range c.Catalog.DependentViews(tab) {
+		err := c.rewriteViewQuery(v, &queryAnalyzer{c: c, movingTable: tab}, to.Name)
+		if err != nil {
+			return err
+		}
+	}
+	// References to sequences are qualified only across schemas, so any
+	// sequence used by this table, or moving with it, may need them updating
+	users := make(map[*Sequence]Columns)
+	for _, seq := range c.allSequences() {
+		users[seq] = c.sequenceUsers(seq)
+	}
+	c.changing(from, to, tab)
+	from.Tables.Remove(tab.Name)
+	to.Tables.Add(tab.Name, tab)
+	tab.Schema = to.Name
+	for _, idx := range indexes {
+		from.Indexes.Remove(idx.Name)
+		to.Indexes.Add(idx.Name, idx)
+	}
+	for _, seq := range sequences {
+		c.changing(seq)
+		from.Sequences.Remove(seq.Name)
+		to.Sequences.Add(seq.Name, seq)
+		seq.Schema = to.Name
+	}
+	for seq, cols := range users {
+		c.updateSequenceReferences(seq, cols)
+	}
+	c.refreshConstraintNames()
+	return nil
+}
+
+func (c *Compiler) MoveView(v *View, to *Schema) error {
+
+	if v.Schema == to.Name {
+		return fmt.Errorf("%s %s is already in schema %s", v.Kind(), v.Name, to.Name)
+	}
+	indexes := c.Catalog.ViewIndexes(v)
+	names := []string{v.Name}
+	for _, idx := range indexes {
+		names = append(names, idx.Name)
+	}
+	for _, name := range names {
+		if to.HasRelation(name) {
+			return duplicateObjectError("relation", name, "relation %s already exists in schema %s", name, to.Name)
+		}
+	}
+	for _, dep := range c.Catalog.ViewDependentViews(v) {
+		err := c.rewriteViewQuery(dep, &queryAnalyzer{c: c, movingView: v}, to.Name)
+		if err != nil {
+			return err
+		}
+	}
+	from, _ := c.Catalog.Schemas.Get(v.Schema) // Must be ok
+	c.changing(from, to, v)
+	from.Views.Remove(v.Name)
+	to.Views.Add(v.Name, v)
+	v.Schema = to.Name
+	for _, idx := range indexes {
+		from.Indexes.Remove(idx.Name)
+		to.Indexes.Add(idx.Name, idx)
+	}
+	return nil
+}
+
+// MoveSequence moves a sequence that isn't owned by a column to another schema.
+func (c *Compiler) MoveSequence(seq *Sequence, to *Schema) error {
+
+	if seq.OwnedBy != nil {
+		return fmt.Errorf("cannot move an owned sequence into another schema")
+	}
+	if seq.Schema == to.Name {
+		return fmt.Errorf("sequence %s is already in schema %s", seq.Name, to.Name)
+	}
+	if to.HasRelation(seq.Name) {
+		return duplicateObjectError("relation", seq.Name, "relation %s already exists in schema %s", seq.Name, to.Name)
+	}
+	users := c.sequenceUsers(seq)
+	from, _ := c.Catalog.Schemas.Get(seq.Schema) // Must be ok
+	c.changing(from, to, seq)
+	from.Sequences.Remove(seq.Name)
+	to.Sequences.Add(seq.Name, seq)
+	seq.Schema = to.Name
+	c.updateSequenceReferences(seq, users)
+	return nil
+}
+
+// MoveType moves a user-defined type to another schema, along with
+// the multirange type of a range type.
+func (c *Compiler) MoveType(typ *PostgresType, to *Schema) error {
+
+	if slices.Contains(defaultPGTypes, typ) || typ.IsArray() {
+		return fmt.Errorf("cannot move built-in type %s", typ.Name)
+	}
+	if typ.IsMultirange() {
+		return fmt.Errorf("cannot alter multirange type %s", typ.Name)
+	}
+	if typ.Schema == to.Name {
+		return fmt.Errorf("type %s is already in schema %s", typ.Name, to.Name)
+	}
+	moved := []*PostgresType{typ}
+	if typ.IsRange() {
+		moved = append(moved, typ.Range.Multirange)
+	}
+	for _, t := range moved {
+		name := qualifiedTypeName(to.Name, strings.TrimPrefix(t.Name, t.Schema+"."))
+		if _, ok := c.TypeRegistry.LookupType(name); ok {
+			return duplicateObjectError("type", name, "type %s already exists in schema %s", name, to.Name)
+		}
+	}
+	for _, t := range moved {
+		err := c.renameType(t, to.Name, strings.TrimPrefix(t.Name, t.Schema+"."))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// DefaultSchema is the schema a new catalog starts with, and the only
+// entry of the default search path.
+const DefaultSchema = "public"
+
+// SetVariable handles SET and RESET. Only search_path affects the catalog;
+// other settings are ignored.
+func (c *Compiler) SetVariable(stmt *pg_query.VariableSetStmt) error {
+
+	var path []string
+	switch stmt.Kind {
+	case pg_query.VariableSetKind_VAR_SET_VALUE:
+		if stmt.Name != "search_path" {
+			return nil
+		}
+		for _, n := range stmt.Args {
+			val, ok := n.GetAConst().GetVal().(*pg_query.A_Const_Sval)
+			if !ok {
+				return fmt.Errorf("invalid value for parameter search_path")
+			}
+			if val.Sval.Sval != "" {
+				path = append(path, val.Sval.Sval)
+			}
+		}
+	case pg_query.VariableSetKind_VAR_SET_DEFAULT, pg_query.VariableSetKind_VAR_RESET:
+		if stmt.Name != "search_path" {
+			return nil
+		}
+		path = []string{DefaultSchema}
+	case pg_query.VariableSetKind_VAR_RESET_ALL:
+		path = []string{DefaultSchema}
+	default:
+		return nil
+	}
+	c.setSearchPath(path, stmt.IsLocal)
+	return nil
+}
+
+// Select handles a top-level SELECT. Calls to set_config are applied by
+// SetConfig, and setval only changes the value of a sequence, but other
+// functions may change the database in ways the compiler can't see, so
+// calling them, or selecting anything other than constants, is unsupported.
+func (c *Compiler) Select(stmt *pg_query.SelectStmt) error {
+
+	if stmt.Op != pg_query.SetOperation_SETOP_NONE || stmt.WithClause != nil || len(stmt.FromClause) > 0 ||
+		len(stmt.ValuesLists) > 0 || stmt.WhereClause != nil || stmt.IntoClause != nil {
+		return c.unsupported("SELECT of anything other than constants and function calls")
+	}
+	for _, n := range stmt.TargetList {
+		val := n.GetResTarget().GetVal()
+		if val.GetAConst() != nil {
+			continue
+		}
+		call := val.GetFuncCall()
+		if call == nil {
+			return c.unsupported("SELECT of anything other than constants and function calls")
+		}
+		schema, name := ObjectNameFromNodeList(call.Funcname)
+		if (schema == "" || schema == "pg_catalog") && (name == "set_config" || name == "setval") {
+			continue
+		}
+		if schema != "" {
+			name = schema + "." + name
+		}
+		err := c.unsupported("SELECT calling function " + name)
+		if err != nil {
+			return err
+		}
+	}
+	return c.SetConfig(stmt)
+}
+
+// SetConfig handles calls to set_config('search_path', ...) made by a SELECT,
+// which pg_dump uses to clear the search path.
+func (c *Compiler) SetConfig(stmt *pg_query.SelectStmt) error {
+
+	for _, n := range stmt.TargetList {
+		call := n.GetResTarget().GetVal().GetFuncCall()
+		if call == nil {
+			continue
+		}
+		if _, name := ObjectNameFromNodeList(call.Funcname); name != "set_config" || len(call.Args) != 3 {
+			continue
+		}
+		setting, ok := call.Args[0].GetAConst().GetVal().(*pg_query.A_Const_Sval)
+		if !ok || setting.Sval.Sval != "search_path" {
+			continue
+		}
+		value, ok := call.Args[1].GetAConst().GetVal().(*pg_query.A_Const_Sval)
+		if !ok {
+			return fmt.Errorf("set_config is only supported with a constant search_path")
+		}
+		isLocal, ok := call.Args[2].GetAConst().GetVal().(*pg_query.A_Const_Boolval)
+		if !ok {
+			return fmt.Errorf("set_config is only supported with a constant is_local")
+		}
+		path, err := ParseSearchPath(value.Sval.Sval)
+		if err != nil {
+			return err
+		}
+		c.setSearchPath(path, isLocal.Boolval.Boolval)
+	}
+	return nil
+}
+
+// setSearchPath changes the search path. A local change lasts until the end
+// of the current transaction, and has no effect outside of one.
+func (c *Compiler) setSearchPath(path []string, local bool) {
+
+	if local {
+		if !c.inTransaction {
+			return
+		}
+		if !c.localSearchPath {
+			c.sessionSearchPath, c.localSearchPath = c.SearchPath, true
+		}
+	} else if c.localSearchPath {
+		c.sessionSearchPath = path
+	}
+	c.SearchPath = path
+}
+
+// ParseSearchPath splits a search_path setting such as `app, "My Schema", public`
+// into schema names. Unquoted names are folded to lower case.
+func ParseSearchPath(s string) ([]string, error) {
+
+	var path []string
+	for s = strings.TrimSpace(s); s != ""; {
+		var name string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid list syntax in parameter search_path")
+			}
+			name, s = s[1:end+1], strings.TrimSpace(s[end+2:])
+		} else {
+			end := strings.IndexAny(s, ", \t")
+			if end < 0 {
+				end = len(s)
+			}
+			name, s = strings.ToLower(s[:end]), strings.TrimSpace(s[end:])
+		}
+		if name != "" {
+			path = append(path, name)
+		}
+		if s == "" {
+			break
+		}
+		if !strings.HasPrefix(s, ",") {
+			return nil, fmt.Errorf("invalid list syntax in parameter search_path")
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+	return path, nil
+}
+
+// RelationSchema returns the schema to find a relation in. A qualified name
+// gives it directly; otherwise it is the first schema on the search path
+// containing a relation with the name, or failing that the first existing
+// schema on the search path, so that lookups report the relation as missing
+// from there. If no schema on the search path exists, like Postgres, it
+// reports the relation as missing.
+func (c *Compiler) RelationSchema(schema, name string) (string, error) {
+
+	if schema != "" {
+		return schema, nil
+	}
+	for _, s := range c.SearchPath {
+		if sch, ok := c.Catalog.Schemas.Get(s); ok && sch.HasRelation(name) {
+			return s, nil
+		}
+	}
+	if schema, err := c.CreationSchema(""); err == nil {
+		return schema, nil
+	}
+	return "", notFoundError("relation", name, "relation %s does not exist", name)
+}
+
+// CreationSchema returns the schema to create an object in: the given schema
+// if the name was qualified, otherwise the first existing schema on the search path.
+func (c *Compiler) CreationSchema(schema string) (string, error) {
+
+	if schema != "" {
+		return schema, nil
+	}
+	for _, s := range c.SearchPath {
+		if _, ok := c.Catalog.Schemas.Get(s); ok {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("no schema has been selected to create in")
+}
+
+// lookupType finds a type by its possibly qualified name. Like Postgres,
+// unqualified names match built-in types first and then user-defined types
+// in the schemas of the search path.
+func (c *Compiler) lookupType(schema, name string) (*PostgresType, bool) {
+
+	if schema == "" || schema == "pg_catalog" {
+		if typ, ok := c.TypeRegistry.FindType(name); ok && slices.Contains(defaultPGTypes, typ) {
+			return typ, true
+		}
+		if schema == "pg_catalog" {
+			return nil, false
+		}
+		for _, s := range c.SearchPath {
+			if typ, ok := c.TypeRegistry.LookupType(qualifiedTypeName(s, name)); ok {
+				return typ, true
+			}
+		}
+		return nil, false
+	}
+	return c.TypeRegistry.LookupType(qualifiedTypeName(schema, name))
+}
+
+// typeName returns the schema and registered name for a type being created.
+func (c *Compiler) typeName(names []*pg_query.Node) (schema, typeName string, err error) {
+
+	schema, name := ObjectNameFromNodeList(names)
+	schema, err = c.CreationSchema(schema)
+	if err != nil {
+		return "", "", err
+	}
+	return schema, qualifiedTypeName(schema, name), nil
+}
@@ -0,0 +1,489 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// sequenceTypeBounds holds the range of values each permitted sequence type can hold.
+var sequenceTypeBounds = map[*PostgresType][2]int64{
+	Smallint: {math.MinInt16, math.MaxInt16},
+	Integer:  {math.MinInt32, math.MaxInt32},
+	Bigint:   {math.MinInt64, math.MaxInt64},
+}
+
+func (c *Compiler) CreateSequence(stmt *pg_query.CreateSeqStmt) error {
+
+	schemaName, err := c.CreationSchema(stmt.Sequence.Schemaname)
+	if err != nil {
+		return err
+	}
+	sch, ok := c.Catalog.Schemas.Get(schemaName)
+	if !ok {
+		return notFoundError("schema", schemaName, "schema %s not found", schemaName)
+	}
+	if sch.HasRelation(stmt.Sequence.Relname) {
+		if stmt.IfNotExists {
+			return nil
+		}
+		return duplicateObjectError("relation", stmt.Sequence.Relname, "relation %s already exists", stmt.Sequence.Relname)
+	}
+	seq := &Sequence{Name: stmt.Sequence.Relname, Schema: schemaName}
+	err = c.ApplySequenceOptions(seq, stmt.Options)
+	if err != nil {
+		return err
+	}
+	c.changing(sch)
+	return sch.AddSequence(seq)
+}
+
+// AlterSequenceCmds handles the forms of ALTER SEQUENCE that are parsed as
+// ALTER TABLE, such as OWNER TO and SET LOGGED. None of what they change is
+// tracked, so this verifies that the sequence exists and reports anything
+// other than ownership and storage options as unsupported.
+func (c *Compiler) AlterSequenceCmds(stmt *pg_query.AlterTableStmt) error {
+
+	_, err := c.FindSequence(stmt.Relation.Schemaname, stmt.Relation.Relname)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	return c.unsupportedAlterCmds("ALTER SEQUENCE", stmt.Cmds)
+}
+
+func (c *Compiler) AlterSequence(stmt *pg_query.AlterSeqStmt) error {
+
+	seq, err := c.FindSequence(stmt.Sequence.Schemaname, stmt.Sequence.Relname)
+	if err != nil {
+		if stmt.MissingOk {
+			return nil
+		}
+		return err
+	}
+	return c.ApplySequenceOptions(seq, stmt.Options)
+}
+
+// CreateOwnedSequence creates the sequence that Postgres implicitly makes for a
+// serial or identity column, owned by that column.
+func (c *Compiler) CreateOwnedSequence(col *Column, typ *PostgresType, options []*pg_query.Node) (*Sequence, error) {
+
+	sch, ok := c.Catalog.Schemas.Get(col.Table.Schema)
+	if !ok {
+		return nil, notFoundError("schema", col.Table.Schema, "schema %s not found", col.Table.Schema)
+	}
+	seq := &Sequence{
+		Name:    c.DetermineAutomaticSequenceName(col.Table, col.Name),
+		Schema:  sch.Name,
+		Type:    typ,
+		OwnedBy: col,
+	}
+	for _, n := range options {
+		def := n.GetDefElem()
+		if def == nil || def.Defname != "sequence_name" {
+			continue
+		}
+		schema, name := ObjectNameFromNodeList(def.Arg.GetList().GetItems())
+		if schema != "" && schema != sch.Name {
+			return nil, fmt.Errorf("sequence must be in same schema as table it is linked to")
+		}
+		seq.Name = name
+	}
+	err := c.ApplySequenceOptions(seq, options)
+	if err != nil {
+		return nil, err
+	}
+	c.changing(sch)
+	return seq, sch.AddSequence(seq)
+}
+
+// ApplySequenceOptions applies the options of a CREATE SEQUENCE, ALTER SEQUENCE
+// or identity column definition to the sequence, filling in defaults for
+// anything that was not specified the way Postgres does.
+func (c *Compiler) ApplySequenceOptions(seq *Sequence, options []*pg_query.Node) error {
+
+	c.changing(seq)
+	isNew := seq.Type == nil || seq.Increment == 0
+	oldType := seq.Type
+	if seq.Type == nil {
+		seq.Type = Bigint
+	}
+	if seq.Increment == 0 {
+		seq.Increment = 1
+	}
+	var minSet, maxSet, startSet, cacheSet bool
+	// NO MINVALUE and NO MAXVALUE go back to the defaults
+	var minReset, maxReset bool
+	for _, n := range options {
+		def := n.GetDefElem()
+		if def == nil {
+			return &UnexpectedNodeError{Expected: "DefElem", Node: n}
+		}
+		var err error
+		switch def.Defname {
+		case "as":
+			var typ *PostgresType
+			typ, err = c.FindTypeFromNode(def.Arg.GetTypeName())
+			if err != nil {
+				return err
+			}
+			if _, ok := sequenceTypeBounds[typ]; !ok {
+				return fmt.Errorf("sequence type must be smallint, integer, or bigint")
+			}
+			seq.Type = typ
+		case "increment":
+			seq.Increment, err = defElemInt(def)
+			if err == nil && seq.Increment == 0 {
+				err = fmt.Errorf("INCREMENT must not be zero")
+			}
+		case "start":
+			seq.Start, err = defElemInt(def)
+			startSet = true
+		case "minvalue":
+			if def.Arg != nil {
+				seq.MinValue, err = defElemInt(def)
+				minSet = true
+			}
+			minReset = def.Arg == nil
+		case "maxvalue":
+			if def.Arg != nil {
+				seq.MaxValue, err = defElemInt(def)
+				maxSet = true
+			}
+			maxReset = def.Arg == nil
+		case "cache":
+			seq.Cache, err = defElemInt(def)
+			cacheSet = true
+		case "cycle":
+			seq.Cycle = def.Arg.GetBoolean().GetBoolval()
+		case "owned_by":
+			var names []string
+			names, err = StringsFromNodes(def.Arg.GetList().GetItems())
+			if err == nil {
+				err = c.SetSequenceOwner(seq, names)
+			}
+		case "restart", "sequence_name", "generated":
+			// Doesn't affect the definition of the sequence
+		default:
+			err = fmt.Errorf("unknown sequence option %s", def.Defname)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	bounds := sequenceTypeBounds[seq.Type]
+	ascending := seq.Increment > 0
+	defaultMin, defaultMax := int64(1), bounds[1]
+	if !ascending {
+		defaultMin, defaultMax = bounds[0], -1
+	}
+	// An existing sequence keeps its bounds, even if its direction changes,
+	// unless its type changes and they were the limits of its old type
+	if !isNew {
+		oldBounds := sequenceTypeBounds[oldType]
+		typeChanged := seq.Type != oldType
+		minSet = minSet || (!minReset && !(typeChanged && seq.MinValue == oldBounds[0]))
+		maxSet = maxSet || (!maxReset && !(typeChanged && seq.MaxValue == oldBounds[1]))
+	}
+	if !minSet {
+		seq.MinValue = defaultMin
+	}
+	if !maxSet {
+		seq.MaxValue = defaultMax
+	}
+	if isNew && !startSet {
+		seq.Start = seq.MinValue
+		if !ascending {
+			seq.Start = seq.MaxValue
+		}
+	}
+	if !cacheSet && seq.Cache == 0 {
+		seq.Cache = 1
+	}
+
+	if seq.MinValue < bounds[0] || seq.MinValue > bounds[1] {
+		return fmt.Errorf("MINVALUE (%d) is out of range for sequence data type %s", seq.MinValue, seq.Type.Name)
+	}
+	if seq.MaxValue < bounds[0] || seq.MaxValue > bounds[1] {
+		return fmt.Errorf("MAXVALUE (%d) is out of range for sequence data type %s", seq.MaxValue, seq.Type.Name)
+	}
+	if seq.MinValue >= seq.MaxValue {
+		return fmt.Errorf("MINVALUE (%d) must be less than MAXVALUE (%d)", seq.MinValue, seq.MaxValue)
+	}
+	if seq.Start < seq.MinValue {
+		return fmt.Errorf("START value (%d) cannot be less than MINVALUE (%d)", seq.Start, seq.MinValue)
+	}
+	if seq.Start > seq.MaxValue {
+		return fmt.Errorf("START value (%d) cannot be greater than MAXVALUE (%d)", seq.Start, seq.MaxValue)
+	}
+	if seq.Cache < 1 {
+		return fmt.Errorf("CACHE (%d) must be greater than zero", seq.Cache)
+	}
+	return nil
+}
+
+// SetSequenceOwner handles OWNED BY, which takes either NONE or a column reference.
+func (c *Compiler) SetSequenceOwner(seq *Sequence, names []string) error {
+
+	if len(names) == 1 && strings.EqualFold(names[0], "none") {
+		seq.OwnedBy = nil
+		return nil
+	}
+	if len(names) < 2 {
+		return fmt.Errorf("invalid OWNED BY option: %s", strings.Join(names, "."))
+	}
+	colName := names[len(names)-1]
+	schema, table := ObjectNameFromStrings(names[:len(names)-1])
+	col, err := c.FindColumn(schema, table, colName)
+	if err != nil {
+		return err
+	}
+	if col.Table.Schema != seq.Schema {
+		return fmt.Errorf("sequence must be in same schema as table it is linked to")
+	}
+	seq.OwnedBy = col
+	return nil
+}
+
+func (c *Compiler) FindSequence(schema, name string) (*Sequence, error) {
+
+	schema, err := c.RelationSchema(schema, name)
+	if err != nil {
+		return nil, err
+	}
+	sch, ok := c.Catalog.Schemas.Get(schema)
+	if !ok {
+		return nil, notFoundError("schema", schema, "schema %s not found", schema)
+	}
+	seq, ok := sch.Sequences.Get(name)
+	if !ok {
+		return nil, notFoundError("sequence", name, "sequence %s not found", name)
+	}
+	return seq, nil
+}
+
+// ColumnSequence returns the sequence that supplies a column's default, if any.
+func (c *Compiler) ColumnSequence(col *Column) *Sequence {
+
+	if !col.Attrs.HasSequence {
+		return nil
+	}
+	schema, name := ObjectNameFromStrings(strings.Split(col.Attrs.SequenceName, "."))
+	if schema == "" {
+		schema = col.Table.Schema
+	}
+	sch, ok := c.Catalog.Schemas.Get(schema)
+	if !ok {
+		return nil
+	}
+	seq, _ := sch.Sequences.Get(name)
+	return seq
+}
+
+// SequenceReference returns the name a column uses to refer to its default sequence,
+// qualified only if the sequence is in a different schema to the column's table.
+func SequenceReference(t *Table, seq *Sequence) string {
+
+	if seq.Schema == t.Schema {
+		return seq.Name
+	}
+	return seq.FQName()
+}
+
+func (c *Compiler) DropSequences(stmt *pg_query.DropStmt) error {
+
+	behaviour := DropBehaviourRestrict
+	if stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		behaviour = DropBehaviourCascade
+	}
+	for _, tgt := range stmt.Objects {
+		l, ok := tgt.Node.(*pg_query.Node_List)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "List", Node: tgt}
+		}
+		schema, name := ObjectNameFromList(l.List)
+		seq, err := c.FindSequence(schema, name)
+		if err != nil {
+			if stmt.MissingOk {
+				continue
+			}
+			return err
+		}
+		err = c.DropSequence(seq, behaviour)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropSequence removes the sequence. Column defaults that draw from it prevent
+// this unless the drop cascades, in which case the defaults are dropped too.
+func (c *Compiler) DropSequence(seq *Sequence, behav DropBehaviour) error {
+
+	if seq.OwnedBy != nil && seq.OwnedBy.Attrs.IdentitySequence == seq {
+		return dependencyError(seq.Name, seq.OwnedBy.FQName(), "can't drop sequence %s because column %s of table %s requires it",
+			seq.Name, seq.OwnedBy.Name, seq.OwnedBy.Table.Name)
+	}
+	users := c.sequenceUsers(seq)
+	if len(users) > 0 && behav != DropBehaviourCascade {
+		return dependencyError(seq.Name, users[0].FQName(), "can't drop sequence %s because default value for column %s of table %s depends on it",
+			seq.Name, users[0].Name, users[0].Table.Name)
+	}
+	for _, col := range users {
+		c.clearColumnDefault(col)
+	}
+	sch, ok := c.Catalog.Schemas.Get(seq.Schema)
+	if ok {
+		c.changing(sch)
+		sch.Sequences.Remove(seq.Name)
+	}
+	return nil
+}
+
+func (c *Compiler) RenameSequence(r *pg_query.RangeVar, newName string, missingOk bool) error {
+
+	seq, err := c.FindSequence(r.Schemaname, r.Relname)
+	if err != nil {
+		if missingOk {
+			return nil
+		}
+		return err
+	}
+	sch, ok := c.Catalog.Schemas.Get(seq.Schema)
+	if !ok {
+		return notFoundError("schema", seq.Schema, "did not find schema %s", seq.Schema)
+	}
+	if sch.HasRelation(newName) {
+		return duplicateObjectError("relation", newName, "relation %s already exists in schema %s", newName, sch.Name)
+	}
+	users := c.sequenceUsers(seq)
+	c.changing(sch, seq)
+	sch.Sequences.Rekey(seq.Name, newName)
+	seq.Name = newName
+	c.updateSequenceReferences(seq, users)
+	return nil
+}
+
+func (c *Compiler) allSequences() []*Sequence {
+
+	var seqs []*Sequence
+	for _, sch := range c.Catalog.Schemas.List() {
+		seqs = append(seqs, sch.Sequences.List()...)
+	}
+	return seqs
+}
+
+// sequenceUsers returns the columns whose defaults draw from the sequence.
+func (c *Compiler) sequenceUsers(seq *Sequence) Columns {
+
+	var users Columns
+	for _, sch := range c.Catalog.Schemas.List() {
+		for _, tab := range sch.Tables.List() {
+			for _, col := range tab.Columns.List() {
+				if c.ColumnSequence(col) == seq {
+					users = append(users, col)
+				}
+			}
+		}
+	}
+	return users
+}
+
+// updateSequenceReferences points the defaults of columns that use the sequence
+// at its new name after it, or its schema, has been renamed.
+func (c *Compiler) updateSequenceReferences(seq *Sequence, users Columns) {
+
+	for _, col := range users {
+		c.changing(col.Attrs)
+		oldRef := col.Attrs.SequenceName
+		newRef := SequenceReference(col.Table, seq)
+		col.Attrs.SequenceName = newRef
+		col.Attrs.ColumnDefault = strings.Replace(col.Attrs.ColumnDefault, `"`+oldRef+`"`, `"`+newRef+`"`, 1)
+	}
+}
+
+// dropOwnedSequences drops the sequences owned by the column, as happens when
+// the column or its table is dropped. Defaults of other columns that draw from
+// them prevent this unless the drop cascades, in which case they are dropped
+// too. The columns in dropping are going as well, so their defaults don't count.
+func (c *Compiler) dropOwnedSequences(col *Column, dropping Columns, behav DropBehaviour) error {
+
+	sch, ok := c.Catalog.Schemas.Get(col.Table.Schema)
+	if !ok {
+		return nil
+	}
+	for _, seq := range sch.Sequences.List() {
+		if seq.OwnedBy != col {
+			continue
+		}
+		users := slices.DeleteFunc(c.sequenceUsers(seq), func(user *Column) bool { return slices.Contains(dropping, user) })
+		if len(users) > 0 && behav != DropBehaviourCascade {
+			return dependencyError(seq.Name, users[0].FQName(), "can't drop sequence %s owned by column %s because default value for column %s of table %s depends on it",
+				seq.Name, col.Name, users[0].Name, users[0].Table.Name)
+		}
+		for _, user := range users {
+			c.clearColumnDefault(user)
+		}
+		c.changing(sch)
+		sch.Sequences.Remove(seq.Name)
+	}
+	return nil
+}
+
+func (c *Compiler) clearColumnDefault(col *Column) {
+
+	c.changing(col, col.Attrs)
+	col.Attrs.HasSequence = false
+	col.Attrs.SequenceName = ""
+	col.Attrs.HasExplicitDefault = false
+	col.Attrs.ColumnDefault = ""
+	if col.Type.IsSerial {
+		col.Type = col.Type.NonSerialType
+	}
+}
+
+// NextvalSequenceName returns the sequence name passed to nextval() if the
+// expression is a call to nextval with a constant argument.
+func NextvalSequenceName(n *pg_query.Node) (string, bool) {
+
+	fc := n.GetFuncCall()
+	if fc == nil || len(fc.Args) != 1 {
+		return "", false
+	}
+	names := nameStrings(fc.Funcname)
+	if names[len(names)-1] != "nextval" {
+		return "", false
+	}
+	arg := fc.Args[0]
+	if tc := arg.GetTypeCast(); tc != nil {
+		arg = tc.Arg
+	}
+	val := arg.GetAConst().GetSval()
+	if val == nil {
+		return "", false
+	}
+	return strings.ReplaceAll(val.Sval, `"`, ""), true
+}
+
+func defElemInt(def *pg_query.DefElem) (int64, error) {
+
+	switch x := def.Arg.GetNode().(type) {
+	case *pg_query.Node_Integer:
+		return int64(x.Integer.Ival), nil
+	case *pg_query.Node_Float:
+		v, err := strconv.ParseInt(x.Float.Fval, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value for %s: %s", def.Defname, x.Float.Fval)
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("%s requires a numeric value", def.Defname)
+}
@@ -0,0 +1,175 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+type savepoint struct {
+	name string
+	// mark is the point the savepoint was made at.
+	mark undoMark
+}
+
+// Transaction handles transaction control statements. Rolling back undoes
+// the changes made since the transaction or savepoint began, writing the
+// old values back into the same objects, so those obtained earlier stay valid.
+func (c *Compiler) Transaction(stmt *pg_query.TransactionStmt) error {
+
+	switch stmt.Kind {
+	case pg_query.TransactionStmtKind_TRANS_STMT_BEGIN, pg_query.TransactionStmtKind_TRANS_STMT_START:
+		if !c.inTransaction {
+			// Postgres only warns about a BEGIN inside a transaction
+			c.begin()
+		}
+	case pg_query.TransactionStmtKind_TRANS_STMT_COMMIT:
+		if !c.inTransaction {
+			return nil
+		}
+		if c.transactionAborted {
+			// Postgres rolls back an aborted transaction instead
+			c.rollback()
+			if stmt.Chain {
+				c.begin()
+			}
+			return nil
+		}
+		c.inTransaction, c.savepoints = false, nil
+		if c.localSearchPath {
+			c.SearchPath, c.sessionSearchPath, c.localSearchPath = c.sessionSearchPath, nil, false
+		}
+		if stmt.Chain {
+			c.begin()
+		}
+	case pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK:
+		if !c.inTransaction {
+			return nil
+		}
+		c.rollback()
+		if stmt.Chain {
+			c.begin()
+		}
+	case pg_query.TransactionStmtKind_TRANS_STMT_SAVEPOINT:
+		if !c.inTransaction {
+			return fmt.Errorf("SAVEPOINT can only be used in transaction blocks")
+		}
+		c.savepoints = append(c.savepoints, savepoint{name: stmt.SavepointName, mark: c.mark()})
+	case pg_query.TransactionStmtKind_TRANS_STMT_RELEASE:
+		if !c.inTransaction {
+			return fmt.Errorf("RELEASE SAVEPOINT can only be used in transaction blocks")
+		}
+		idx, err := c.findSavepoint(stmt.SavepointName)
+		if err != nil {
+			return err
+		}
+		// Releasing a savepoint releases those made after it too
+		c.savepoints = c.savepoints[:idx]
+	case pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO:
+		if !c.inTransaction {
+			return fmt.Errorf("ROLLBACK TO SAVEPOINT can only be used in transaction blocks")
+		}
+		idx, err := c.findSavepoint(stmt.SavepointName)
+		if err != nil {
+			return err
+		}
+		// The savepoint itself is kept, so it can be rolled back to again
+		c.undoTo(c.savepoints[idx].mark)
+		c.savepoints = c.savepoints[:idx+1]
+		c.transactionAborted, c.abortedBy = false, nil
+	case pg_query.TransactionStmtKind_TRANS_STMT_PREPARE:
+		return c.unsupported("PREPARE TRANSACTION")
+	case pg_query.TransactionStmtKind_TRANS_STMT_COMMIT_PREPARED:
+		return c.unsupported("COMMIT PREPARED")
+	case pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK_PREPARED:
+		return c.unsupported("ROLLBACK PREPARED")
+	}
+	return nil
+}
+
+func (c *Compiler) begin() {
+
+	c.transactionStart = c.mark()
+	c.inTransaction = true
+}
+
+// rollback undoes the changes made by the current transaction and ends it.
+func (c *Compiler) rollback() {
+
+	c.undoTo(c.transactionStart)
+	c.inTransaction, c.savepoints = false, nil
+	c.transactionAborted, c.abortedBy = false, nil
+	c.forgetChanges()
+}
+
+// endsAbortedTransaction reports whether a statement is allowed in an
+// aborted transaction, which is only so for those that roll it back.
+func endsAbortedTransaction(n *pg_query.Node) bool {
+
+	switch n.GetTransactionStmt().GetKind() {
+	case pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK, pg_query.TransactionStmtKind_TRANS_STMT_ROLLBACK_TO,
+		pg_query.TransactionStmtKind_TRANS_STMT_COMMIT:
+		return n.GetTransactionStmt() != nil
+	}
+	return false
+}
+
+// findSavepoint returns the index of the most recent savepoint with the name.
+func (c *Compiler) findSavepoint(name string) (int, error) {
+
+	for i := len(c.savepoints) - 1; i >= 0; i-- {
+		if c.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, notFoundError("savepoint", name, "savepoint %s does not exist", name)
+}
+
+// transactionBlockError returns an error for statements that
+// Postgres refuses to run inside a transaction block.
+func transactionBlockError(n *pg_query.Node) error {
+
+	var what string
+	switch p := n.Node.(type) {
+	case *pg_query.Node_IndexStmt:
+		if p.IndexStmt.Concurrent {
+			what = "CREATE INDEX CONCURRENTLY"
+		}
+	case *pg_query.Node_DropStmt:
+		if p.DropStmt.Concurrent {
+			what = "DROP INDEX CONCURRENTLY"
+		}
+	case *pg_query.Node_ReindexStmt:
+		if slices.ContainsFunc(p.ReindexStmt.Params, func(n *pg_query.Node) bool {
+			return n.GetDefElem().GetDefname() == "concurrently"
+		}) {
+			what = "REINDEX CONCURRENTLY"
+		}
+	case *pg_query.Node_AlterTableStmt:
+		for _, cmd := range p.AlterTableStmt.Cmds {
+			atc := cmd.GetAlterTableCmd()
+			if atc.GetSubtype() == pg_query.AlterTableType_AT_DetachPartition && atc.GetDef().GetPartitionCmd().GetConcurrent() {
+				what = "ALTER TABLE ... DETACH CONCURRENTLY"
+			}
+		}
+	case *pg_query.Node_VacuumStmt:
+		if p.VacuumStmt.IsVacuumcmd {
+			what = "VACUUM"
+		}
+	case *pg_query.Node_CreatedbStmt:
+		what = "CREATE DATABASE"
+	case *pg_query.Node_DropdbStmt:
+		what = "DROP DATABASE"
+	case *pg_query.Node_CreateTableSpaceStmt:
+		what = "CREATE TABLESPACE"
+	case *pg_query.Node_DropTableSpaceStmt:
+		what = "DROP TABLESPACE"
+	case *pg_query.Node_AlterSystemStmt:
+		what = "ALTER SYSTEM"
+	}
+	if what == "" {
+		return nil
+	}
+	return fmt.Errorf("%s cannot run inside a transaction block", what)
+}
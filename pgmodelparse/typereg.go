@@ -3,6 +3,7 @@ package pgmodelparse
 import (
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -10,6 +11,12 @@ type TypeRegistry struct {
 	simpleMatches  map[string]*PostgresType
 	patternMatches []patternMatch
 	casts          map[*PostgresType][]*PostgresType
+	arrays         map[arrayKey]*PostgresType
+}
+
+type arrayKey struct {
+	elem *PostgresType
+	dims int
 }
 
 type patternMatch struct {
@@ -22,6 +29,7 @@ func NewTypeRegistry() *TypeRegistry {
 	ret := &TypeRegistry{
 		simpleMatches:  make(map[string]*PostgresType),
 		patternMatches: make([]patternMatch, 0, 10),
+		arrays:         make(map[arrayKey]*PostgresType),
 	}
 	registerBasicTypes(ret)
 	return ret
@@ -52,28 +60,134 @@ func (t *TypeRegistry) RegisterType(typ *PostgresType) error {
 	return nil
 }
 
-func (t *TypeRegistry) CanCast(from, to *PostgresType) bool {
-	casts, ok := validCasts[from]
-	if !ok {
-		return false
+// LookupType finds a type by one of its exact names, without pattern matching.
+func (t *TypeRegistry) LookupType(name string) (*PostgresType, bool) {
+	typ, ok := t.simpleMatches[strings.ToLower(name)]
+	return typ, ok
+}
+
+// RenameType gives a registered user-defined type a new name and schema.
+func (t *TypeRegistry) RenameType(typ *PostgresType, schema, name string) error {
+	typeName := qualifiedTypeName(schema, name)
+	if oldTyp, ok := t.simpleMatches[typeName]; ok && oldTyp != typ {
+		return duplicateObjectError("type", typeName, "type %s already exists", typeName)
 	}
-	for _, cast := range casts {
-		if cast == to {
-			return true
+	for _, sm := range typ.SimpleMatches {
+		if t.simpleMatches[sm] == typ {
+			delete(t.simpleMatches, sm)
+		}
+	}
+	typ.Name = typeName
+	typ.Schema = schema
+	typ.SimpleMatches = []string{typeName}
+	t.simpleMatches[typeName] = typ
+	for key, arr := range t.arrays {
+		if key.elem == typ {
+			arr.Name = arrayTypeName(typeName, key.dims)
+			arr.Schema = schema
+			arr.Description = "array of " + typeName
 		}
 	}
-	return false
+	return nil
 }
 
-func (t *TypeRegistry) MatchType(s string) *PostgresType {
+// SchemaTypes returns the types registered in the schema, ordered by name.
+func (t *TypeRegistry) SchemaTypes(schema string) []*PostgresType {
+	var ret []*PostgresType
+	for _, typ := range t.simpleMatches {
+		if typ.Schema == schema && !slices.Contains(ret, typ) {
+			ret = append(ret, typ)
+		}
+	}
+	slices.SortFunc(ret, func(a, b *PostgresType) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+// Types returns every registered type, ordered by name.
+func (t *TypeRegistry) Types() []*PostgresType {
+	var ret []*PostgresType
+	for _, typ := range t.simpleMatches {
+		if !slices.Contains(ret, typ) {
+			ret = append(ret, typ)
+		}
+	}
+	for _, pm := range t.patternMatches {
+		if !slices.Contains(ret, pm.typ) {
+			ret = append(ret, pm.typ)
+		}
+	}
+	slices.SortFunc(ret, func(a, b *PostgresType) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
+
+func (t *TypeRegistry) CanCast(from, to *PostgresType) bool {
+	return CanCast(from, to)
+}
+
+// ArrayOf returns the array type with the given element type and number of
+// dimensions. The same *PostgresType is returned for repeated calls.
+func (t *TypeRegistry) ArrayOf(elem *PostgresType, dims int) *PostgresType {
+	if elem.IsArray() {
+		dims += elem.Dimensions
+		elem = elem.ElementType
+	}
+	key := arrayKey{elem: elem, dims: dims}
+	if typ, ok := t.arrays[key]; ok {
+		return typ
+	}
+	typ := &PostgresType{
+		Name:        arrayTypeName(elem.Name, dims),
+		Schema:      elem.Schema,
+		Description: "array of " + elem.Name,
+		ElementType: elem,
+		Dimensions:  dims,
+	}
+	t.arrays[key] = typ
+	return typ
+}
+
+// MatchType finds a type by name, returning a NotFoundError if there is none.
+func (t *TypeRegistry) MatchType(s string) (*PostgresType, error) {
+	typ, ok := t.FindType(s)
+	if !ok {
+		return nil, notFoundError("type", s, "type %s does not exist", s)
+	}
+	return typ, nil
+}
+
+// FindType is like MatchType, but reports whether the type exists instead of returning an error.
+func (t *TypeRegistry) FindType(s string) (*PostgresType, bool) {
 	s = strings.ToLower(s)
+	if trimmed := strings.TrimRight(s, "[] "); trimmed != s {
+		elem, ok := t.FindType(trimmed)
+		if !ok {
+			return nil, false
+		}
+		return t.ArrayOf(elem, strings.Count(s[len(trimmed):], "[")), true
+	}
 	if typ, ok := t.simpleMatches[s]; ok {
-		return typ
+		return typ, true
 	}
 	for _, p := range t.patternMatches {
 		if p.regex.MatchString(s) {
-			return p.typ
+			return p.typ, true
+		}
+	}
+	return nil, false
+}
+
+// UnregisterType removes a user-defined type, along with its array types.
+func (t *TypeRegistry) UnregisterType(typ *PostgresType) {
+	for _, sm := range typ.SimpleMatches {
+		if t.simpleMatches[sm] == typ {
+			delete(t.simpleMatches, sm)
+		}
+	}
+	// The list may be shared with a saved copy, so it isn't changed in place
+	t.patternMatches = slices.DeleteFunc(slices.Clone(t.patternMatches), func(pm patternMatch) bool { return pm.typ == typ })
+	for key := range t.arrays {
+		if key.elem == typ {
+			delete(t.arrays, key)
 		}
 	}
-	panic("didn't match")
 }
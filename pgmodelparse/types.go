@@ -0,0 +1,196 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// usesType reports whether typ is the given type or an array of it.
+func usesType(typ, used *PostgresType) bool {
+	return typ == used || (typ.IsArray() && typ.ElementType == used)
+}
+
+// typeUsers returns the columns whose type is typ or an array of it.
+func (c *Compiler) typeUsers(typ *PostgresType) Columns {
+
+	var ret Columns
+	for _, sch := range c.Catalog.Schemas.List() {
+		for _, tab := range sch.Tables.List() {
+			for _, col := range tab.Columns.List() {
+				if usesType(col.Type, typ) {
+					ret = append(ret, col)
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// dependentTypes returns the domains and range types based on typ.
+func (c *Compiler) dependentTypes(typ *PostgresType) []*PostgresType {
+
+	var ret []*PostgresType
+	for _, other := range c.TypeRegistry.Types() {
+		if other.IsDomain() && usesType(other.Domain.BaseType, typ) || other.IsRange() && usesType(other.Range.Subtype, typ) {
+			ret = append(ret, other)
+		}
+	}
+	return ret
+}
+
+// attributeUse is an attribute of a composite type that uses another type.
+type attributeUse struct {
+	composite *PostgresType
+	attr      *TypeAttribute
+}
+
+// attributeUsers returns the attributes of composite types whose type is typ or an array of it.
+func (c *Compiler) attributeUsers(typ *PostgresType) []attributeUse {
+
+	var ret []attributeUse
+	for _, other := range c.TypeRegistry.Types() {
+		if !other.IsComposite() {
+			continue
+		}
+		for _, attr := range other.Composite.Attributes {
+			if usesType(attr.Type, typ) {
+				ret = append(ret, attributeUse{composite: other, attr: attr})
+			}
+		}
+	}
+	return ret
+}
+
+// DropType removes a user-defined type, and the multirange type of a range
+// type. With CASCADE the columns, attributes and types that use it are
+// dropped too; otherwise they prevent the drop.
+func (c *Compiler) DropType(typ *PostgresType, behav DropBehaviour) error {
+
+	if slices.Contains(defaultPGTypes, typ) {
+		return fmt.Errorf("cannot drop type %s because it is required by the database system", typ.Name)
+	}
+	if typ.IsArray() {
+		return dependencyError(typ.Name, typ.ElementType.Name, "cannot drop type %s because type %s requires it", typ.Name, typ.ElementType.Name)
+	}
+	if typ.IsMultirange() {
+		return dependencyError(typ.Name, typ.MultirangeOf.Name, "cannot drop type %s because type %s requires it", typ.Name, typ.MultirangeOf.Name)
+	}
+	dropped := []*PostgresType{typ}
+	if typ.IsRange() {
+		dropped = append(dropped, typ.Range.Multirange)
+	}
+	if behav != DropBehaviourCascade {
+		for _, t := range dropped {
+			err := c.checkTypeUnused(t)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range dropped {
+		err := c.dropType(t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTypeUnused returns an error if anything depends on the type.
+func (c *Compiler) checkTypeUnused(typ *PostgresType) error {
+
+	if dependents := c.dependentTypes(typ); len(dependents) > 0 {
+		return dependencyError(typ.Name, dependents[0].Name, "can't drop type %s because type %s depends on it", typ.Name, dependents[0].Name)
+	}
+	if attrUsers := c.attributeUsers(typ); len(attrUsers) > 0 {
+		return dependencyError(typ.Name, attrUsers[0].composite.Name+"."+attrUsers[0].attr.Name, "can't drop type %s because column %s of composite type %s depends on it", typ.Name, attrUsers[0].attr.Name, attrUsers[0].composite.Name)
+	}
+	if users := c.typeUsers(typ); len(users) > 0 {
+		return dependencyError(typ.Name, users[0].FQName(), "can't drop type %s because column %s of table %s depends on it", typ.Name, users[0].Name, users[0].Table.Name)
+	}
+	return nil
+}
+
+// dropType unregisters the type, dropping everything that depends on it.
+func (c *Compiler) dropType(typ *PostgresType) error {
+
+	for _, dep := range c.dependentTypes(typ) {
+		err := c.DropType(dep, DropBehaviourCascade)
+		if err != nil {
+			return err
+		}
+	}
+	for _, use := range c.attributeUsers(typ) {
+		composite := use.composite.Composite
+		c.changing(composite)
+		composite.Attributes = slices.DeleteFunc(slices.Clone(composite.Attributes), func(attr *TypeAttribute) bool { return attr == use.attr })
+	}
+	for _, col := range c.typeUsers(typ) {
+		current, ok := col.Table.Columns.Get(col.Name)
+		if !ok || current != col || col.Attrs.Inherited {
+			// Already dropped, or dropped along with the parent's column
+			continue
+		}
+		err := c.dropColumn(col.Table, col.Name, pg_query.DropBehavior_DROP_CASCADE)
+		if err != nil {
+			return err
+		}
+	}
+	c.changingType(typ)
+	c.TypeRegistry.UnregisterType(typ)
+	return nil
+}
+
+// registerType adds a user-defined type to the registry.
+func (c *Compiler) registerType(typ *PostgresType) error {
+
+	c.changing(c.TypeRegistry)
+	return c.TypeRegistry.RegisterType(typ)
+}
+
+func (c *Compiler) DropTypes(stmt *pg_query.DropStmt) error {
+
+	behav := DropBehaviourRestrict
+	if stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		behav = DropBehaviourCascade
+	}
+	for _, n := range stmt.Objects {
+		typ, err := c.FindTypeFromNode(n.GetTypeName())
+		if err != nil {
+			if stmt.MissingOk {
+				continue
+			}
+			return err
+		}
+		err = c.DropType(typ, behav)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findTypeFromNameList looks up a type from the qualified name used by
+// statements such as ALTER DOMAIN.
+func (c *Compiler) findTypeFromNameList(names []*pg_query.Node) (*PostgresType, error) {
+
+	schema, name := ObjectNameFromNodeList(names)
+	typ, ok := c.lookupType(schema, name)
+	if !ok {
+		typeName := qualifiedTypeName(schema, name)
+		return nil, notFoundError("type", typeName, "type %s does not exist", typeName)
+	}
+	return typ, nil
+}
+
+// qualifiedTypeName returns the name a user-defined type is registered under.
+// Types in the default schema are registered under their bare names.
+func qualifiedTypeName(schema, name string) string {
+
+	if schema == "" || schema == DefaultSchema {
+		return name
+	}
+	return schema + "." + name
+}
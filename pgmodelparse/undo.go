@@ -0,0 +1,290 @@
+package pgmodelparse
+
+import (
+	"slices"
+
+	"github.com/alexrjones/pgmodelparse/collections"
+)
+
+// undoLog records the values objects had before they were changed, so that
+// the changes made since a mark can be undone by writing them back into the
+// same objects, keeping pointers to them valid.
+//
+// Saving an object copies its value, with its own copies of the collections
+// and maps it holds, as those are changed in place. Slices are shared, so
+// they must only ever be replaced or appended to, never changed in place.
+// The registry's array types are left alone, as they are only a cache.
+type undoLog struct {
+	entries []undoEntry
+	// saved holds the objects saved since the last mark. Undoing to the mark
+	// restores the value an object was first saved with, so it isn't saved again.
+	saved map[any]bool
+}
+
+type undoEntry interface {
+	undo()
+	// copy returns the entry translated by cp, to undo the changes to the
+	// objects cp has copied.
+	copy(cp *copier) undoEntry
+}
+
+// undoMark is a point to undo changes back to, along with the search path
+// at that point.
+type undoMark struct {
+	entries           int
+	searchPath        []string
+	sessionSearchPath []string
+	localSearchPath   bool
+}
+
+// save records the value of obj before it is changed. fill is the function
+// that copies the collections and maps of an object of its type.
+func save[T any](u *undoLog, obj *T, fill func(cp *copier, v *T)) {
+
+	if obj == nil || u.saved[obj] {
+		return
+	}
+	u.remember(obj)
+	s := &savedValue[T]{obj: obj, val: *obj, fill: fill}
+	fill(keep, &s.val)
+	u.entries = append(u.entries, s)
+}
+
+func (u *undoLog) remember(key any) {
+
+	if u.saved == nil {
+		u.saved = make(map[any]bool)
+	}
+	u.saved[key] = true
+}
+
+// copy returns the log translated by cp.
+func (u *undoLog) copy(cp *copier) undoLog {
+
+	ret := undoLog{entries: make([]undoEntry, 0, len(u.entries))}
+	for _, e := range u.entries {
+		ret.entries = append(ret.entries, e.copy(cp))
+	}
+	return ret
+}
+
+type savedValue[T any] struct {
+	obj  *T
+	val  T
+	fill func(cp *copier, v *T)
+}
+
+func (s *savedValue[T]) undo() {
+
+	*s.obj = s.val
+}
+
+func (s *savedValue[T]) copy(cp *copier) undoEntry {
+
+	ret := &savedValue[T]{obj: copyObject(cp, s.obj, s.fill), val: s.val, fill: s.fill}
+	s.fill(cp, &ret.val)
+	return ret
+}
+
+// savedConstraintName holds the constraint PgConstraint.ByName had under a
+// name, or nil if it had none.
+type savedConstraintName struct {
+	pg   *PgConstraint
+	name string
+	con  *Constraint
+}
+
+func (s *savedConstraintName) undo() {
+
+	if s.con == nil {
+		delete(s.pg.ByName, s.name)
+		return
+	}
+	s.pg.ByName[s.name] = s.con
+}
+
+func (s *savedConstraintName) copy(cp *copier) undoEntry {
+
+	return &savedConstraintName{pg: copyObject(cp, s.pg, fillPgConstraint), name: s.name, con: cp.constraint(s.con)}
+}
+
+// savedColumnConstraints holds the constraints PgConstraint had for a column.
+type savedColumnConstraints struct {
+	pg         *PgConstraint
+	col        *Column
+	byColumn   []*Constraint
+	constrains []*Constraint
+	refers     []*Constraint
+}
+
+func (s *savedColumnConstraints) undo() {
+
+	restoreValues(s.pg.ByColumn, s.col, s.byColumn)
+	restoreValues(s.pg.Constrains, s.col, s.constrains)
+	restoreValues(s.pg.Refers, s.col, s.refers)
+}
+
+func restoreValues(m *collections.Multimap[*Column, *Constraint], col *Column, values []*Constraint) {
+
+	m.Remove(col)
+	if len(values) > 0 {
+		m.AddAll(col, values...)
+	}
+}
+
+func (s *savedColumnConstraints) copy(cp *copier) undoEntry {
+
+	return &savedColumnConstraints{
+		pg:         copyObject(cp, s.pg, fillPgConstraint),
+		col:        cp.column(s.col),
+		byColumn:   copyAll(cp, s.byColumn, fillConstraint),
+		constrains: copyAll(cp, s.constrains, fillConstraint),
+		refers:     copyAll(cp, s.refers, fillConstraint),
+	}
+}
+
+// constraintKey identifies what is saved of PgConstraint's indexes: the
+// constraints under a name, or those for a column.
+type constraintKey struct {
+	pg   *PgConstraint
+	name string
+	col  *Column
+}
+
+// mark returns a point to undo back to.
+func (c *Compiler) mark() undoMark {
+
+	c.undo.saved = nil
+	return undoMark{
+		entries:           len(c.undo.entries),
+		searchPath:        slices.Clone(c.SearchPath),
+		sessionSearchPath: slices.Clone(c.sessionSearchPath),
+		localSearchPath:   c.localSearchPath,
+	}
+}
+
+// undoTo undoes the changes made since the mark, in reverse order.
+func (c *Compiler) undoTo(m undoMark) {
+
+	for i := len(c.undo.entries) - 1; i >= m.entries; i-- {
+		c.undo.entries[i].undo()
+		c.undo.entries[i] = nil
+	}
+	c.undo.entries = c.undo.entries[:min(m.entries, len(c.undo.entries))]
+	c.undo.saved = nil
+	c.SearchPath = slices.Clone(m.searchPath)
+	c.sessionSearchPath = slices.Clone(m.sessionSearchPath)
+	c.localSearchPath = m.localSearchPath
+}
+
+// forgetChanges empties the undo log once nothing can be undone any more.
+func (c *Compiler) forgetChanges() {
+
+	clear(c.undo.entries)
+	c.undo.entries = c.undo.entries[:0]
+	c.undo.saved = nil
+}
+
+// undoable is implemented by the objects that changing can save.
+type undoable interface {
+	saveTo(u *undoLog)
+}
+
+func (o *Catalog) saveTo(u *undoLog)          { save(u, o, fillCatalog) }
+func (o *PgConstraint) saveTo(u *undoLog)     { save(u, o, fillPgConstraint) }
+func (o *Schema) saveTo(u *undoLog)           { save(u, o, fillSchema) }
+func (o *Table) saveTo(u *undoLog)            { save(u, o, fillTable) }
+func (o *Column) saveTo(u *undoLog)           { save(u, o, fillColumn) }
+func (o *ColumnAttributes) saveTo(u *undoLog) { save(u, o, fillColumnAttributes) }
+func (o *PartitionKey) saveTo(u *undoLog)     { save(u, o, fillPartitionKey) }
+func (o *PartitionKeyElem) saveTo(u *undoLog) { save(u, o, fillPartitionKeyElem) }
+func (o *PartitionBound) saveTo(u *undoLog)   { save(u, o, fillPartitionBound) }
+func (o *Constraint) saveTo(u *undoLog)       { save(u, o, fillConstraint) }
+func (o *Index) saveTo(u *undoLog)            { save(u, o, fillIndex) }
+func (o *IndexKey) saveTo(u *undoLog)         { save(u, o, fillIndexKey) }
+func (o *View) saveTo(u *undoLog)             { save(u, o, fillView) }
+func (o *ViewColumn) saveTo(u *undoLog)       { save(u, o, fillViewColumn) }
+func (o *Sequence) saveTo(u *undoLog)         { save(u, o, fillSequence) }
+func (o *TypeRegistry) saveTo(u *undoLog)     { save(u, o, fillTypeRegistry) }
+func (o *PostgresType) saveTo(u *undoLog)     { save(u, o, fillPostgresType) }
+func (o *Domain) saveTo(u *undoLog)           { save(u, o, fillDomain) }
+func (o *DomainCheck) saveTo(u *undoLog)      { save(u, o, fillDomainCheck) }
+func (o *Composite) saveTo(u *undoLog)        { save(u, o, fillComposite) }
+func (o *TypeAttribute) saveTo(u *undoLog)    { save(u, o, fillTypeAttribute) }
+func (o *Range) saveTo(u *undoLog)            { save(u, o, fillRange) }
+
+// changing saves objects before they are changed, so that the change can be
+// undone. Objects created by the current statement needn't be saved.
+func (c *Compiler) changing(objs ...undoable) {
+
+	for _, obj := range objs {
+		obj.saveTo(&c.undo)
+	}
+}
+
+// changingConstraintName saves the constraint under the name in
+// PgConstraint.ByName before it is changed.
+func (c *Compiler) changingConstraintName(name string) {
+
+	pg := c.Catalog.PgConstraint
+	key := constraintKey{pg: pg, name: name}
+	if c.undo.saved[key] {
+		return
+	}
+	c.undo.remember(key)
+	c.undo.entries = append(c.undo.entries, &savedConstraintName{pg: pg, name: name, con: pg.ByName[name]})
+}
+
+// changingColumnConstraints saves the constraints PgConstraint has for the
+// column before they are changed.
+func (c *Compiler) changingColumnConstraints(col *Column) {
+
+	pg := c.Catalog.PgConstraint
+	key := constraintKey{pg: pg, col: col}
+	if c.undo.saved[key] {
+		return
+	}
+	c.undo.remember(key)
+	s := &savedColumnConstraints{pg: pg, col: col}
+	s.byColumn, _ = pg.ByColumn.Get(col)
+	s.constrains, _ = pg.Constrains.Get(col)
+	s.refers, _ = pg.Refers.Get(col)
+	c.undo.entries = append(c.undo.entries, s)
+}
+
+// changingConstraint saves the constraint, and how PgConstraint indexes it,
+// before it is added, removed or renamed.
+func (c *Compiler) changingConstraint(con *Constraint) {
+
+	c.changing(con)
+	c.changingConstraintName(con.FQName())
+	for _, col := range con.Constrains {
+		c.changingColumnConstraints(col)
+		// Adding or removing a primary key changes its columns
+		c.changing(col.Attrs)
+	}
+	for _, col := range con.Refers {
+		c.changingColumnConstraints(col)
+	}
+}
+
+// changingSchema saves the schema with the name, if there is one, before
+// relations are added to or removed from it.
+func (c *Compiler) changingSchema(name string) {
+
+	if sch, ok := c.Catalog.Schemas.Get(name); ok {
+		c.changing(sch)
+	}
+}
+
+// changingType saves a user-defined type, along with its array types and
+// the registry, before it is renamed or dropped.
+func (c *Compiler) changingType(typ *PostgresType) {
+
+	c.changing(c.TypeRegistry, typ)
+	for key, arr := range c.TypeRegistry.arrays {
+		if key.elem == typ {
+			c.changing(arr)
+		}
+	}
+}
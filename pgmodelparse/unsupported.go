@@ -0,0 +1,129 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+// UnsupportedPolicy says what to do with statements, and subcommands of
+// ALTER statements, that the compiler doesn't know how to apply to the catalog.
+type UnsupportedPolicy int
+
+const (
+	// IgnoreUnsupported skips them. They are still listed in Compiler.Skipped.
+	IgnoreUnsupported UnsupportedPolicy = iota
+	// WarnUnsupported skips them, adding a warning to Compiler.Diagnostics.
+	WarnUnsupported
+	// FailUnsupported fails the statement with an UnsupportedError.
+	FailUnsupported
+)
+
+// ignoredAlterTableTypes are the ALTER TABLE subcommands that change
+// nothing in the catalog, so aren't reported as skipped.
+var ignoredAlterTableTypes = []pg_query.AlterTableType{
+	pg_query.AlterTableType_AT_SetStatistics,
+	pg_query.AlterTableType_AT_SetOptions,
+	pg_query.AlterTableType_AT_ResetOptions,
+	pg_query.AlterTableType_AT_SetStorage,
+	pg_query.AlterTableType_AT_SetCompression,
+	pg_query.AlterTableType_AT_ClusterOn,
+	pg_query.AlterTableType_AT_DropCluster,
+	pg_query.AlterTableType_AT_SetAccessMethod,
+	pg_query.AlterTableType_AT_SetTableSpace,
+	pg_query.AlterTableType_AT_SetRelOptions,
+	pg_query.AlterTableType_AT_ResetRelOptions,
+	pg_query.AlterTableType_AT_ReplaceRelOptions,
+	pg_query.AlterTableType_AT_ChangeOwner,
+	pg_query.AlterTableType_AT_EnableTrig,
+	pg_query.AlterTableType_AT_EnableAlwaysTrig,
+	pg_query.AlterTableType_AT_EnableReplicaTrig,
+	pg_query.AlterTableType_AT_DisableTrig,
+	pg_query.AlterTableType_AT_EnableTrigAll,
+	pg_query.AlterTableType_AT_DisableTrigAll,
+	pg_query.AlterTableType_AT_EnableTrigUser,
+	pg_query.AlterTableType_AT_DisableTrigUser,
+	pg_query.AlterTableType_AT_EnableRule,
+	pg_query.AlterTableType_AT_EnableAlwaysRule,
+	pg_query.AlterTableType_AT_EnableReplicaRule,
+	pg_query.AlterTableType_AT_DisableRule,
+	pg_query.AlterTableType_AT_ReplicaIdentity,
+	pg_query.AlterTableType_AT_EnableRowSecurity,
+	pg_query.AlterTableType_AT_DisableRowSecurity,
+	pg_query.AlterTableType_AT_ForceRowSecurity,
+	pg_query.AlterTableType_AT_NoForceRowSecurity,
+}
+
+// unsupportedAlterCmds handles the subcommands of an ALTER statement whose
+// only supported subcommands are those that change nothing in the catalog.
+func (c *Compiler) unsupportedAlterCmds(statement string, cmds []*pg_query.Node) error {
+
+	for _, n := range cmds {
+		atc := n.GetAlterTableCmd()
+		if atc == nil {
+			return &UnexpectedNodeError{Expected: "AlterTableCmd", Node: n}
+		}
+		if slices.Contains(ignoredAlterTableTypes, atc.Subtype) {
+			continue
+		}
+		err := c.unsupported(statement + " subcommand " + strings.TrimPrefix(atc.Subtype.String(), "AT_"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isIgnoredStatement reports whether a statement changes nothing in the
+// catalog, so isn't reported as skipped.
+func isIgnoredStatement(n *pg_query.Node) bool {
+
+	switch n.Node.(type) {
+	case *pg_query.Node_InsertStmt, *pg_query.Node_UpdateStmt, *pg_query.Node_DeleteStmt, *pg_query.Node_MergeStmt,
+		*pg_query.Node_CopyStmt, *pg_query.Node_TruncateStmt, *pg_query.Node_LockStmt, *pg_query.Node_ExplainStmt,
+		*pg_query.Node_VariableShowStmt, *pg_query.Node_ConstraintsSetStmt, *pg_query.Node_DiscardStmt,
+		*pg_query.Node_PrepareStmt, *pg_query.Node_ExecuteStmt, *pg_query.Node_DeallocateStmt,
+		*pg_query.Node_DeclareCursorStmt, *pg_query.Node_FetchStmt, *pg_query.Node_ClosePortalStmt,
+		*pg_query.Node_NotifyStmt, *pg_query.Node_ListenStmt, *pg_query.Node_UnlistenStmt,
+		*pg_query.Node_VacuumStmt, *pg_query.Node_ClusterStmt, *pg_query.Node_CheckPointStmt,
+		*pg_query.Node_RefreshMatViewStmt, *pg_query.Node_CommentStmt, *pg_query.Node_SecLabelStmt,
+		*pg_query.Node_GrantStmt, *pg_query.Node_GrantRoleStmt, *pg_query.Node_AlterDefaultPrivilegesStmt,
+		*pg_query.Node_CreateRoleStmt, *pg_query.Node_AlterRoleStmt, *pg_query.Node_AlterRoleSetStmt,
+		*pg_query.Node_DropRoleStmt, *pg_query.Node_AlterOwnerStmt, *pg_query.Node_ReassignOwnedStmt:
+		return true
+	}
+	return false
+}
+
+// statementKind names the kind of a statement's parse tree node, e.g. CreateFunctionStmt.
+func statementKind(n *pg_query.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", n.Node), "*pg_query.Node_")
+}
+
+// unsupported handles something the compiler can't apply according to the
+// policy, returning an error if the statement should fail.
+func (c *Compiler) unsupported(what string) error {
+
+	err := &UnsupportedError{What: what}
+	if c.Unsupported == FailUnsupported {
+		return err
+	}
+	c.skipped = append(c.skipped, err)
+	return nil
+}
+
+// reportSkipped records what was skipped while applying the last statement.
+func (c *Compiler) reportSkipped(locate func(err error) *Diagnostic) {
+
+	for _, err := range c.skipped {
+		d := locate(err)
+		d.Severity = SeverityWarning
+		c.Skipped = append(c.Skipped, d)
+		if c.Unsupported == WarnUnsupported {
+			c.Diagnostics = append(c.Diagnostics, d)
+		}
+	}
+	c.skipped = nil
+}
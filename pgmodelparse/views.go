@@ -0,0 +1,1138 @@
+package pgmodelparse
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+func (c *Compiler) CreateView(stmt *pg_query.ViewStmt) error {
+
+	schemaName, err := c.CreationSchema(stmt.View.Schemaname)
+	if err != nil {
+		return err
+	}
+	aliases, err := StringsFromNodes(stmt.Aliases)
+	if err != nil {
+		return err
+	}
+	view, err := c.AnalyzeView(schemaName, stmt.View.Relname, stmt.Query, aliases)
+	if err != nil {
+		return err
+	}
+	return c.addOrReplaceView(view, stmt.Replace, false)
+}
+
+func (c *Compiler) CreateTableAs(stmt *pg_query.CreateTableAsStmt) error {
+
+	schemaName, err := c.CreationSchema(stmt.Into.Rel.Schemaname)
+	if err != nil {
+		return err
+	}
+	name := stmt.Into.Rel.Relname
+	aliases, err := StringsFromNodes(stmt.Into.ColNames)
+	if err != nil {
+		return err
+	}
+	view, err := c.AnalyzeView(schemaName, name, stmt.Query, aliases)
+	if err != nil {
+		return err
+	}
+	switch stmt.Objtype {
+	case pg_query.ObjectType_OBJECT_MATVIEW:
+		view.Materialized = true
+		return c.addOrReplaceView(view, false, stmt.IfNotExists)
+	case pg_query.ObjectType_OBJECT_TABLE:
+		sch, ok := c.Catalog.Schemas.Get(schemaName)
+		if !ok {
+			return notFoundError("schema", schemaName, "schema %s not found", schemaName)
+		}
+		if stmt.IfNotExists && sch.HasRelation(name) {
+			return nil
+		}
+		table := NewTable(name, schemaName)
+		for _, vc := range view.Columns {
+			if vc.Type == nil {
+				return fmt.Errorf("could not determine the type of column %s", vc.Name)
+			}
+			err = table.AddColumn(&Column{Table: table, Name: vc.Name, Type: vc.Type, Attrs: &ColumnAttributes{}})
+			if err != nil {
+				return err
+			}
+		}
+		c.changing(sch)
+		return c.Catalog.AddTable(table)
+	default:
+		return fmt.Errorf("unknown how to create %s from a query", stmt.Objtype)
+	}
+}
+
+func (c *Compiler) addOrReplaceView(view *View, replace, ifNotExists bool) error {
+
+	sch, ok := c.Catalog.Schemas.Get(view.Schema)
+	if !ok {
+		return notFoundError("schema", view.Schema, "schema %s not found", view.Schema)
+	}
+	existing, ok := sch.Views.Get(view.Name)
+	if !ok || !replace {
+		if ifNotExists && sch.HasRelation(view.Name) {
+			return nil
+		}
+		c.changing(sch)
+		return sch.AddView(view)
+	}
+	if existing.Materialized {
+		return fmt.Errorf("%s is not a view", existing.Name)
+	}
+	if len(view.Columns) < len(existing.Columns) {
+		return fmt.Errorf("cannot drop columns from view %s", existing.Name)
+	}
+	for i, old := range existing.Columns {
+		col := view.Columns[i]
+		if col.Name != old.Name {
+			return fmt.Errorf("cannot change name of view column %s to %s", old.Name, col.Name)
+		}
+		if col.Type != old.Type {
+			return fmt.Errorf("cannot change data type of view column %s", old.Name)
+		}
+	}
+	// Replace in place so that dependent views keep pointing at this one
+	c.changing(existing)
+	*existing = *view
+	return nil
+}
+
+// AnalyzeView resolves a view's defining query against the catalog, inferring the
+// names and types of its columns and recording the relations it depends on.
+func (c *Compiler) AnalyzeView(schema, name string, query *pg_query.Node, aliases []string) (*View, error) {
+
+	sel := query.GetSelectStmt()
+	if sel == nil {
+		return nil, fmt.Errorf("view %s must be defined by a SELECT query", name)
+	}
+	a := &queryAnalyzer{c: c}
+	cols, err := a.analyzeSelect(sel, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(aliases) > len(cols) {
+		return nil, fmt.Errorf("view %s specifies more column names than columns", name)
+	}
+	view := &View{
+		Name:             name,
+		Schema:           schema,
+		Tables:           a.tables,
+		DependsOnColumns: a.columns,
+		Views:            a.views,
+	}
+	for i, col := range cols {
+		colName := col.name
+		if i < len(aliases) {
+			colName = aliases[i]
+		}
+		if slices.ContainsFunc(view.Columns, func(vc *ViewColumn) bool { return vc.Name == colName }) {
+			return nil, fmt.Errorf("column %s specified more than once", colName)
+		}
+		view.Columns = append(view.Columns, &ViewColumn{Name: colName, Type: col.typ, Source: col.source})
+	}
+	view.Query, err = pg_query.Deparse(&pg_query.ParseResult{Stmts: []*pg_query.RawStmt{{Stmt: query}}})
+	if err != nil {
+		return nil, fmt.Errorf("deparsing query of view %s: %w", name, err)
+	}
+	return view, nil
+}
+
+// rewriteViewQuery analyzes the query of an existing view again with a,
+// which collects the names in it to rewrite, and replaces them with newName.
+func (c *Compiler) rewriteViewQuery(v *View, a *queryAnalyzer, newName string) error {
+
+	parsed, err := pg_query.Parse(v.Query)
+	if err != nil {
+		return fmt.Errorf("parsing query of view %s: %w", v.Name, err)
+	}
+	_, err = a.analyzeSelect(parsed.Stmts[0].Stmt.GetSelectStmt(), nil)
+	if err != nil {
+		return fmt.Errorf("analyzing query of view %s: %w", v.Name, err)
+	}
+	if len(a.renamed) == 0 {
+		return nil
+	}
+	for _, name := range a.renamed {
+		*name = newName
+	}
+	query, err := pg_query.Deparse(parsed)
+	if err != nil {
+		return fmt.Errorf("deparsing query of view %s: %w", v.Name, err)
+	}
+	c.changing(v)
+	v.Query = query
+	return nil
+}
+
+func (c *Compiler) FindView(schema, name string) (*View, error) {
+
+	schema, err := c.RelationSchema(schema, name)
+	if err != nil {
+		return nil, err
+	}
+	sch, ok := c.Catalog.Schemas.Get(schema)
+	if !ok {
+		return nil, notFoundError("schema", schema, "schema %s not found", schema)
+	}
+	v, ok := sch.Views.Get(name)
+	if !ok {
+		return nil, notFoundError("view", name, "view %s not found", name)
+	}
+	return v, nil
+}
+
+func (c *Compiler) DropViews(stmt *pg_query.DropStmt) error {
+
+	materialized := stmt.RemoveType == pg_query.ObjectType_OBJECT_MATVIEW
+	behaviour := DropBehaviourRestrict
+	if stmt.Behavior == pg_query.DropBehavior_DROP_CASCADE {
+		behaviour = DropBehaviourCascade
+	}
+	for _, tgt := range stmt.Objects {
+		l, ok := tgt.Node.(*pg_query.Node_List)
+		if !ok {
+			return &UnexpectedNodeError{Expected: "List", Node: tgt}
+		}
+		schema, name := ObjectNameFromList(l.List)
+		v, err := c.FindView(schema, name)
+		if err != nil {
+			if stmt.MissingOk {
+				continue
+			}
+			return err
+		}
+		if v.Materialized != materialized {
+			if materialized {
+				return fmt.Errorf("%s is not a materialized view", v.Name)
+			}
+			return fmt.Errorf("%s is not a view", v.Name)
+		}
+		err = c.DropView(v, behaviour)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) DropView(v *View, behav DropBehaviour) error {
+
+	err := c.dropDependentViews(v.Kind()+" "+v.Name, c.Catalog.ViewDependentViews(v), behav)
+	if err != nil {
+		return err
+	}
+	for _, idx := range c.Catalog.ViewIndexes(v) {
+		c.removeIndex(idx)
+	}
+	sch, ok := c.Catalog.Schemas.Get(v.Schema)
+	if ok {
+		c.changing(sch)
+		sch.Views.Remove(v.Name)
+	}
+	return nil
+}
+
+func (c *Compiler) RenameView(r *pg_query.RangeVar, newName string, materialized, missingOk bool) error {
+
+	v, err := c.FindView(r.Schemaname, r.Relname)
+	if err != nil {
+		if missingOk {
+			return nil
+		}
+		return err
+	}
+	if v.Materialized != materialized {
+		if materialized {
+			return fmt.Errorf("%s is not a materialized view", v.Name)
+		}
+		return fmt.Errorf("%s is not a view", v.Name)
+	}
+	sch, ok := c.Catalog.Schemas.Get(v.Schema)
+	if !ok {
+		return notFoundError("schema", v.Schema, "did not find schema %s", v.Schema)
+	}
+	if sch.HasRelation(newName) {
+		return duplicateObjectError("relation", newName, "relation %s already exists in schema %s", newName, sch.Name)
+	}
+	for _, dep := range c.Catalog.ViewDependentViews(v) {
+		err := c.rewriteViewQuery(dep, &queryAnalyzer{c: c, renamingView: v}, newName)
+		if err != nil {
+			return err
+		}
+	}
+	c.changing(sch, v)
+	sch.Views.Rekey(v.Name, newName)
+	v.Name = newName
+	return nil
+}
+
+// dropDependentViews drops the given views (and anything depending on them) if
+// the drop behaviour is CASCADE, and otherwise fails if there are any.
+func (c *Compiler) dropDependentViews(object string, views []*View, behav DropBehaviour) error {
+
+	if len(views) > 0 && behav != DropBehaviourCascade {
+		return dependencyError(object, views[0].Name, "can't drop %s because %s %s depends on it and cascade was not specified",
+			object, views[0].Kind(), views[0].Name)
+	}
+	for _, v := range views {
+		err := c.DropView(v, DropBehaviourCascade)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryScope holds the relations visible to a query, and links to the
+// scope of the enclosing query, if any.
+type queryScope struct {
+	parent  *queryScope
+	ctes    map[string][]*scopeColumn
+	entries []*rangeEntry
+}
+
+func (s *queryScope) findCTE(name string) ([]*scopeColumn, bool) {
+
+	for ; s != nil; s = s.parent {
+		if cols, ok := s.ctes[name]; ok {
+			return cols, true
+		}
+	}
+	return nil, false
+}
+
+// rangeEntry is an item in a query's FROM list.
+type rangeEntry struct {
+	name    string
+	schema  string
+	columns []*scopeColumn
+	// opaque entries, such as set-returning functions, have columns that
+	// can't be known in advance; references to them resolve to untyped columns.
+	opaque bool
+	// renamed is set for the relation being renamed, read by its own name,
+	// and schemaRenamed for a relation whose schema is being renamed or
+	// which is moving to another schema.
+	renamed       bool
+	schemaRenamed bool
+}
+
+func (e *rangeEntry) column(name string) *scopeColumn {
+
+	for _, col := range e.columns {
+		if col.name == name {
+			return col
+		}
+	}
+	if e.opaque {
+		return &scopeColumn{name: name}
+	}
+	return nil
+}
+
+type scopeColumn struct {
+	name   string
+	typ    *PostgresType
+	source *Column
+	// tableColumn and viewColumn are set when the column is read directly
+	// from a table or view.
+	tableColumn *Column
+	viewColumn  *ViewColumn
+}
+
+// queryAnalyzer resolves a query against the catalog, inferring its output
+// columns and recording the objects it reads from.
+type queryAnalyzer struct {
+	c       *Compiler
+	tables  []*Table
+	views   []*View
+	columns Columns
+	// renamingColumn, renamingViewColumn, renamingTable and renamingView
+	// are a column or relation about to be renamed. The names in the query
+	// that refer to it are collected in renamed, to be rewritten.
+	renamingColumn     *Column
+	renamingViewColumn *ViewColumn
+	renamingTable      *Table
+	renamingView       *View
+	// renamingSchema is a schema about to be renamed, and movingTable and
+	// movingView a relation about to move to another schema. The schema
+	// names in references to relations in it are collected in renamed.
+	renamingSchema string
+	movingTable    *Table
+	movingView     *View
+	renamed        []*string
+}
+
+func (a *queryAnalyzer) useColumn(col *scopeColumn) {
+
+	if col.tableColumn != nil && !slices.Contains(a.columns, col.tableColumn) {
+		a.columns = append(a.columns, col.tableColumn)
+	}
+}
+
+// renames reports whether col is the column being renamed, read by its own
+// name rather than through an alias.
+func (a *queryAnalyzer) renames(col *scopeColumn) bool {
+
+	switch {
+	case a.renamingColumn != nil:
+		return col.tableColumn == a.renamingColumn && col.name == a.renamingColumn.Name
+	case a.renamingViewColumn != nil:
+		return col.viewColumn == a.renamingViewColumn && col.name == a.renamingViewColumn.Name
+	}
+	return false
+}
+
+func (a *queryAnalyzer) analyzeSelect(stmt *pg_query.SelectStmt, parent *queryScope) ([]*scopeColumn, error) {
+
+	scope := &queryScope{parent: parent, ctes: make(map[string][]*scopeColumn)}
+	if stmt.WithClause != nil {
+		for _, n := range stmt.WithClause.Ctes {
+			err := a.analyzeCTE(n.GetCommonTableExpr(), scope)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if stmt.Op != pg_query.SetOperation_SETOP_NONE {
+		left, err := a.analyzeSelect(stmt.Larg, scope)
+		if err != nil {
+			return nil, err
+		}
+		right, err := a.analyzeSelect(stmt.Rarg, scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(left) != len(right) {
+			return nil, fmt.Errorf("each %s query must have the same number of columns",
+				strings.TrimPrefix(stmt.Op.String(), "SETOP_"))
+		}
+		ret := make([]*scopeColumn, 0, len(left))
+		for i, l := range left {
+			col := &scopeColumn{name: l.name, typ: l.typ}
+			if col.typ == nil {
+				col.typ = right[i].typ
+			}
+			ret = append(ret, col)
+		}
+		return ret, nil
+	}
+
+	if len(stmt.ValuesLists) > 0 {
+		var ret []*scopeColumn
+		for i, row := range stmt.ValuesLists {
+			for j, item := range row.GetList().GetItems() {
+				typ, err := a.exprType(item, scope)
+				if err != nil {
+					return nil, err
+				}
+				if i == 0 {
+					ret = append(ret, &scopeColumn{name: fmt.Sprintf("column%d", j+1), typ: typ})
+				}
+			}
+		}
+		return ret, nil
+	}
+
+	for _, n := range stmt.FromClause {
+		entries, err := a.rangeEntries(n, scope)
+		if err != nil {
+			return nil, err
+		}
+		scope.entries = append(scope.entries, entries...)
+	}
+
+	var ret []*scopeColumn
+	var targets []*pg_query.Node
+	for _, n := range stmt.TargetList {
+		rt := n.GetResTarget()
+		if ref := rt.GetVal().GetColumnRef(); ref != nil && isStarRef(ref) {
+			entries, err := a.starEntries(ref, scope)
+			if err != nil {
+				return nil, err
+			}
+			cols, err := a.expandStar(entries)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, cols...)
+			targets = append(targets, a.starTargets(n, entries)...)
+			continue
+		}
+		targets = append(targets, n)
+		typ, err := a.exprType(rt.Val, scope)
+		if err != nil {
+			return nil, err
+		}
+		col := &scopeColumn{name: rt.Name, typ: typ}
+		if ref := rt.Val.GetColumnRef(); ref != nil {
+			resolved, err := a.resolveColumnRef(ref, scope)
+			if err != nil {
+				return nil, err
+			}
+			col.source = resolved.source
+			if col.name == "" && a.renames(resolved) {
+				// The output column keeps its name
+				rt.Name = resolved.name
+				col.name = rt.Name
+			}
+		}
+		if col.name == "" {
+			col.name = figureColumnName(rt.Val)
+		}
+		if col.name == "" {
+			col.name = "?column?"
+		}
+		ret = append(ret, col)
+	}
+	stmt.TargetList = targets
+
+	err := a.resolveRefs(stmt.WhereClause, scope, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = a.resolveRefs(stmt.HavingClause, scope, nil)
+	if err != nil {
+		return nil, err
+	}
+	// GROUP BY and ORDER BY may also refer to output columns by name
+	for _, n := range slices.Concat(stmt.GroupClause, stmt.SortClause, stmt.DistinctClause) {
+		err = a.resolveRefs(n, scope, ret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func (a *queryAnalyzer) analyzeCTE(cte *pg_query.CommonTableExpr, scope *queryScope) error {
+
+	sel := cte.GetCtequery().GetSelectStmt()
+	if sel == nil {
+		return fmt.Errorf("only SELECT is supported in WITH query %s", cte.Ctename)
+	}
+	aliases, err := StringsFromNodes(cte.Aliascolnames)
+	if err != nil {
+		return err
+	}
+	rename := func(cols []*scopeColumn) []*scopeColumn {
+		ret := make([]*scopeColumn, 0, len(cols))
+		for i, col := range cols {
+			renamed := *col
+			if i < len(aliases) {
+				renamed.name = aliases[i]
+			}
+			ret = append(ret, &renamed)
+		}
+		return ret
+	}
+	if cte.Cterecursive && sel.Op != pg_query.SetOperation_SETOP_NONE {
+		// The non-recursive term determines the columns
+		cols, err := a.analyzeSelect(sel.Larg, scope)
+		if err != nil {
+			return err
+		}
+		scope.ctes[cte.Ctename] = rename(cols)
+	}
+	cols, err := a.analyzeSelect(sel, scope)
+	if err != nil {
+		return err
+	}
+	scope.ctes[cte.Ctename] = rename(cols)
+	return nil
+}
+
+func (a *queryAnalyzer) rangeEntries(n *pg_query.Node, scope *queryScope) ([]*rangeEntry, error) {
+
+	switch x := n.Node.(type) {
+	case *pg_query.Node_RangeVar:
+		entry, err := a.relationEntry(x.RangeVar, scope)
+		if err != nil {
+			return nil, err
+		}
+		return []*rangeEntry{entry}, nil
+	case *pg_query.Node_JoinExpr:
+		left, err := a.rangeEntries(x.JoinExpr.Larg, scope)
+		if err != nil {
+			return nil, err
+		}
+		right, err := a.rangeEntries(x.JoinExpr.Rarg, scope)
+		if err != nil {
+			return nil, err
+		}
+		entries := slices.Concat(left, right)
+		joinScope := &queryScope{parent: scope, entries: entries}
+		err = a.resolveRefs(x.JoinExpr.Quals, joinScope, nil)
+		if err != nil {
+			return nil, err
+		}
+		if x.JoinExpr.Alias != nil {
+			joined := &rangeEntry{name: x.JoinExpr.Alias.Aliasname}
+			for _, e := range entries {
+				joined.columns = append(joined.columns, e.columns...)
+			}
+			return []*rangeEntry{joined}, nil
+		}
+		return entries, nil
+	case *pg_query.Node_RangeSubselect:
+		sel := x.RangeSubselect.GetSubquery().GetSelectStmt()
+		if sel == nil {
+			return nil, &UnexpectedNodeError{Expected: "SELECT in subquery", Node: x.RangeSubselect.GetSubquery()}
+		}
+		cols, err := a.analyzeSelect(sel, scope)
+		if err != nil {
+			return nil, err
+		}
+		entry := &rangeEntry{columns: derivedColumns(cols)}
+		applyAlias(entry, x.RangeSubselect.Alias)
+		return []*rangeEntry{entry}, nil
+	case *pg_query.Node_RangeFunction:
+		entry := &rangeEntry{opaque: true}
+		for _, fn := range x.RangeFunction.Functions {
+			err := a.resolveRefs(fn, scope, nil)
+			if err != nil {
+				return nil, err
+			}
+			if entry.name == "" {
+				WalkNodes(fn, func(n *pg_query.Node) bool {
+					if fc := n.GetFuncCall(); fc != nil {
+						entry.name = figureColumnName(n)
+						return false
+					}
+					return true
+				})
+			}
+		}
+		applyAlias(entry, x.RangeFunction.Alias)
+		return []*rangeEntry{entry}, nil
+	default:
+		return nil, fmt.Errorf("unknown how to resolve FROM item %T", n.Node)
+	}
+}
+
+func (a *queryAnalyzer) relationEntry(rv *pg_query.RangeVar, scope *queryScope) (*rangeEntry, error) {
+
+	entry := &rangeEntry{name: rv.Relname, schema: rv.Schemaname}
+	moving := false
+	cteCols, isCTE := scope.findCTE(rv.Relname)
+	switch {
+	case rv.Schemaname == "" && isCTE:
+		entry.columns = derivedColumns(cteCols)
+	default:
+		if tab, err := a.c.FindTable(rv.Schemaname, rv.Relname); err == nil {
+			entry.schema = tab.Schema
+			moving = tab == a.movingTable
+			if tab == a.renamingTable {
+				a.renamed = append(a.renamed, &rv.Relname)
+				entry.renamed = rv.Alias == nil
+			}
+			for _, col := range tab.Columns.List() {
+				// A serial column reads as the integer type underneath it
+				entry.columns = append(entry.columns, &scopeColumn{name: col.Name, typ: nonSerialType(col.Type), source: col, tableColumn: col})
+			}
+			if !slices.Contains(a.tables, tab) {
+				a.tables = append(a.tables, tab)
+			}
+			break
+		}
+		view, err := a.c.FindView(rv.Schemaname, rv.Relname)
+		if err != nil {
+			return nil, notFoundError("relation", rv.Relname, "relation %s does not exist", rv.Relname)
+		}
+		entry.schema = view.Schema
+		moving = view == a.movingView
+		if view == a.renamingView {
+			a.renamed = append(a.renamed, &rv.Relname)
+			entry.renamed = rv.Alias == nil
+		}
+		for _, col := range view.Columns {
+			entry.columns = append(entry.columns, &scopeColumn{name: col.Name, typ: col.Type, source: col.Source, viewColumn: col})
+		}
+		if !slices.Contains(a.views, view) {
+			a.views = append(a.views, view)
+		}
+	}
+	if moving || (a.renamingSchema != "" && entry.schema == a.renamingSchema) {
+		// The reference is qualified even if it wasn't, as the search
+		// path may still name the old schema
+		a.renamed = append(a.renamed, &rv.Schemaname)
+		entry.schemaRenamed = rv.Alias == nil
+	}
+	applyAlias(entry, rv.Alias)
+	return entry, nil
+}
+
+// derivedColumns copies the output columns of a subquery for use in an outer query.
+// Dependencies on their tables are recorded by the subquery itself.
+func derivedColumns(cols []*scopeColumn) []*scopeColumn {
+
+	ret := make([]*scopeColumn, 0, len(cols))
+	for _, col := range cols {
+		ret = append(ret, &scopeColumn{name: col.name, typ: col.typ, source: col.source})
+	}
+	return ret
+}
+
+func applyAlias(entry *rangeEntry, alias *pg_query.Alias) {
+
+	if alias == nil {
+		return
+	}
+	entry.name = alias.Aliasname
+	entry.schema = ""
+	for i, name := range nameStrings(alias.Colnames) {
+		if i < len(entry.columns) {
+			renamed := *entry.columns[i]
+			renamed.name = name
+			entry.columns[i] = &renamed
+		}
+	}
+}
+
+func isStarRef(ref *pg_query.ColumnRef) bool {
+
+	if len(ref.Fields) == 0 {
+		return false
+	}
+	return ref.Fields[len(ref.Fields)-1].GetAStar() != nil
+}
+
+// starEntries returns the FROM items a * or qualified .* reads.
+func (a *queryAnalyzer) starEntries(ref *pg_query.ColumnRef, scope *queryScope) ([]*rangeEntry, error) {
+
+	if len(ref.Fields) == 1 {
+		return scope.entries, nil
+	}
+	qualifier, err := StringsFromNodes(ref.Fields[:len(ref.Fields)-1])
+	if err != nil {
+		return nil, err
+	}
+	entry := scope.findEntry(qualifier)
+	if entry == nil {
+		return nil, fmt.Errorf("missing FROM-clause entry for table %s", strings.Join(qualifier, "."))
+	}
+	a.noteQualifier(ref, entry)
+	return []*rangeEntry{entry}, nil
+}
+
+func (a *queryAnalyzer) expandStar(entries []*rangeEntry) ([]*scopeColumn, error) {
+
+	var ret []*scopeColumn
+	for _, e := range entries {
+		if e.opaque {
+			return nil, fmt.Errorf("can't determine the columns of %s", e.name)
+		}
+		for _, col := range e.columns {
+			a.useColumn(col)
+			ret = append(ret, &scopeColumn{name: col.name, typ: col.typ, source: col.source})
+		}
+	}
+	return ret, nil
+}
+
+// starTargets returns the target list entries for a * reading the entries.
+// If it reads the column being renamed, it is spelled out column by column,
+// as Postgres does, so that the column keeps its name in the output.
+func (a *queryAnalyzer) starTargets(target *pg_query.Node, entries []*rangeEntry) []*pg_query.Node {
+
+	if !slices.ContainsFunc(entries, func(e *rangeEntry) bool { return slices.ContainsFunc(e.columns, a.renames) }) {
+		return []*pg_query.Node{target}
+	}
+	location := target.GetResTarget().Location
+	var ret []*pg_query.Node
+	for _, e := range entries {
+		for _, col := range e.columns {
+			var fields []*pg_query.Node
+			if e.name != "" {
+				fields = append(fields, pg_query.MakeStrNode(e.name))
+			}
+			field := pg_query.MakeStrNode(col.name)
+			fields = append(fields, field)
+			ref := pg_query.MakeColumnRefNode(fields, location)
+			if a.renames(col) {
+				a.renamed = append(a.renamed, &field.GetString_().Sval)
+				ret = append(ret, pg_query.MakeResTargetNodeWithNameAndVal(col.name, ref, location))
+				continue
+			}
+			ret = append(ret, pg_query.MakeResTargetNodeWithVal(ref, location))
+		}
+	}
+	return ret
+}
+
+// findEntry looks up a FROM item by its (possibly schema-qualified) name,
+// searching enclosing scopes if necessary.
+func (s *queryScope) findEntry(qualifier []string) *rangeEntry {
+
+	for ; s != nil; s = s.parent {
+		for _, e := range s.entries {
+			switch len(qualifier) {
+			case 1:
+				if e.name == qualifier[0] {
+					return e
+				}
+			case 2:
+				if e.schema == qualifier[0] && e.name == qualifier[1] {
+					return e
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (a *queryAnalyzer) resolveColumnRef(ref *pg_query.ColumnRef, scope *queryScope) (*scopeColumn, error) {
+
+	fields, err := StringsFromNodes(ref.Fields)
+	if err != nil {
+		return nil, err
+	}
+	name := fields[len(fields)-1]
+	if len(fields) > 1 {
+		qualifier := fields[:len(fields)-1]
+		entry := scope.findEntry(qualifier)
+		if entry == nil {
+			return nil, fmt.Errorf("missing FROM-clause entry for table %s", strings.Join(qualifier, "."))
+		}
+		col := entry.column(name)
+		if col == nil {
+			return nil, notFoundError("column", strings.Join(fields, "."), "column %s does not exist", strings.Join(fields, "."))
+		}
+		a.useColumn(col)
+		a.noteRename(ref, col)
+		a.noteQualifier(ref, entry)
+		return col, nil
+	}
+	for s := scope; s != nil; s = s.parent {
+		var found *scopeColumn
+		for _, e := range s.entries {
+			if e.opaque {
+				continue
+			}
+			if col := e.column(name); col != nil {
+				if found != nil {
+					return nil, fmt.Errorf("column reference %s is ambiguous", name)
+				}
+				found = col
+			}
+		}
+		if found != nil {
+			a.useColumn(found)
+			a.noteRename(ref, found)
+			return found, nil
+		}
+		for _, e := range s.entries {
+			if e.opaque {
+				return e.column(name), nil
+			}
+		}
+	}
+	return nil, notFoundError("column", name, "column %s does not exist", name)
+}
+
+// noteRename collects the name in a reference to the column being renamed.
+func (a *queryAnalyzer) noteRename(ref *pg_query.ColumnRef, col *scopeColumn) {
+
+	if a.renames(col) {
+		a.renamed = append(a.renamed, &ref.Fields[len(ref.Fields)-1].GetString_().Sval)
+	}
+}
+
+// noteQualifier collects the relation name in a reference qualified by the
+// name of the relation being renamed, and the schema name in a reference
+// qualified by the name of a schema being renamed or moved out of.
+func (a *queryAnalyzer) noteQualifier(ref *pg_query.ColumnRef, entry *rangeEntry) {
+
+	if entry.renamed {
+		a.renamed = append(a.renamed, &ref.Fields[len(ref.Fields)-2].GetString_().Sval)
+	}
+	if entry.schemaRenamed && len(ref.Fields) > 2 {
+		a.renamed = append(a.renamed, &ref.Fields[len(ref.Fields)-3].GetString_().Sval)
+	}
+}
+
+// resolveRefs resolves every column reference in the expression, recording
+// dependencies. References matching one of the outputs are also accepted.
+func (a *queryAnalyzer) resolveRefs(n *pg_query.Node, scope *queryScope, outputs []*scopeColumn) error {
+
+	if n == nil {
+		return nil
+	}
+	var err error
+	WalkNodes(n, func(n *pg_query.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch x := n.Node.(type) {
+		case *pg_query.Node_ColumnRef:
+			if isStarRef(x.ColumnRef) {
+				return false
+			}
+			_, err = a.resolveColumnRef(x.ColumnRef, scope)
+			if err != nil && len(x.ColumnRef.Fields) == 1 {
+				name := nameStrings(x.ColumnRef.Fields)[0]
+				if slices.ContainsFunc(outputs, func(col *scopeColumn) bool { return col.name == name }) {
+					err = nil
+				}
+			}
+			return false
+		case *pg_query.Node_SubLink:
+			err = a.resolveRefs(x.SubLink.Testexpr, scope, nil)
+			if err == nil {
+				_, err = a.analyzeSelect(x.SubLink.GetSubselect().GetSelectStmt(), scope)
+			}
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// exprType infers the type of an expression, returning nil if it can't be determined.
+func (a *queryAnalyzer) exprType(n *pg_query.Node, scope *queryScope) (*PostgresType, error) {
+
+	err := a.resolveRefs(n, scope, nil)
+	if err != nil {
+		return nil, err
+	}
+	return a.inferType(n, scope), nil
+}
+
+func (a *queryAnalyzer) inferType(n *pg_query.Node, scope *queryScope) *PostgresType {
+
+	if n == nil {
+		return nil
+	}
+	switch x := n.Node.(type) {
+	case *pg_query.Node_ColumnRef:
+		col, err := a.resolveColumnRef(x.ColumnRef, scope)
+		if err != nil {
+			return nil
+		}
+		return col.typ
+	case *pg_query.Node_AConst:
+		return constType(x.AConst)
+	case *pg_query.Node_TypeCast:
+		typ, err := a.c.FindTypeFromNode(x.TypeCast.TypeName)
+		if err != nil {
+			return nil
+		}
+		return typ
+	case *pg_query.Node_FuncCall:
+		return a.functionType(x.FuncCall, scope)
+	case *pg_query.Node_SqlvalueFunction:
+		return sqlValueFunctionType(x.SqlvalueFunction.Op)
+	case *pg_query.Node_AExpr:
+		return a.operatorType(x.AExpr, scope)
+	case *pg_query.Node_BoolExpr, *pg_query.Node_NullTest, *pg_query.Node_BooleanTest:
+		return Boolean
+	case *pg_query.Node_SubLink:
+		switch x.SubLink.SubLinkType {
+		case pg_query.SubLinkType_EXPR_SUBLINK:
+			cols, err := a.analyzeSelect(x.SubLink.GetSubselect().GetSelectStmt(), scope)
+			if err != nil || len(cols) == 0 {
+				return nil
+			}
+			return cols[0].typ
+		case pg_query.SubLinkType_EXISTS_SUBLINK, pg_query.SubLinkType_ANY_SUBLINK, pg_query.SubLinkType_ALL_SUBLINK:
+			return Boolean
+		}
+	case *pg_query.Node_CaseExpr:
+		for _, w := range x.CaseExpr.Args {
+			if typ := a.inferType(w.GetCaseWhen().GetResult(), scope); typ != nil {
+				return typ
+			}
+		}
+		return a.inferType(x.CaseExpr.Defresult, scope)
+	case *pg_query.Node_CoalesceExpr:
+		return a.firstArgType(x.CoalesceExpr.Args, scope)
+	case *pg_query.Node_AArrayExpr:
+		if elemType := a.firstArgType(x.AArrayExpr.Elements, scope); elemType != nil {
+			return a.c.TypeRegistry.ArrayOf(elemType, 1)
+		}
+	case *pg_query.Node_AIndirection:
+		typ := a.inferType(x.AIndirection.Arg, scope)
+		if typ == nil || !typ.IsArray() {
+			return nil
+		}
+		for _, ind := range x.AIndirection.Indirection {
+			idx := ind.GetAIndices()
+			if idx == nil {
+				return nil
+			}
+			if idx.IsSlice {
+				// Slicing an array gives an array of the same type
+				return typ
+			}
+		}
+		return typ.ElementType
+	case *pg_query.Node_MinMaxExpr:
+		return a.firstArgType(x.MinMaxExpr.Args, scope)
+	}
+	return nil
+}
+
+func (a *queryAnalyzer) firstArgType(args []*pg_query.Node, scope *queryScope) *PostgresType {
+
+	for _, arg := range args {
+		if typ := a.inferType(arg, scope); typ != nil {
+			return typ
+		}
+	}
+	return nil
+}
+
+func constType(c *pg_query.A_Const) *PostgresType {
+
+	switch c.Val.(type) {
+	case *pg_query.A_Const_Ival:
+		return Integer
+	case *pg_query.A_Const_Fval:
+		return Numeric
+	case *pg_query.A_Const_Boolval:
+		return Boolean
+	case *pg_query.A_Const_Bsval:
+		return Bit
+	}
+	// String literals and NULL are resolved as text
+	return Text
+}
+
+func sqlValueFunctionType(op pg_query.SQLValueFunctionOp) *PostgresType {
+
+	switch op {
+	case pg_query.SQLValueFunctionOp_SVFOP_CURRENT_DATE:
+		return Date
+	case pg_query.SQLValueFunctionOp_SVFOP_CURRENT_TIME, pg_query.SQLValueFunctionOp_SVFOP_CURRENT_TIME_N:
+		return Timetz
+	case pg_query.SQLValueFunctionOp_SVFOP_CURRENT_TIMESTAMP, pg_query.SQLValueFunctionOp_SVFOP_CURRENT_TIMESTAMP_N:
+		return Timestamptz
+	case pg_query.SQLValueFunctionOp_SVFOP_LOCALTIME, pg_query.SQLValueFunctionOp_SVFOP_LOCALTIME_N:
+		return Time
+	case pg_query.SQLValueFunctionOp_SVFOP_LOCALTIMESTAMP, pg_query.SQLValueFunctionOp_SVFOP_LOCALTIMESTAMP_N:
+		return Timestamp
+	}
+	return Text
+}
+
+var comparisonOperators = []string{"=", "<>", "!=", "<", ">", "<=", ">=", "~", "~*", "!~", "!~*", "@>", "<@", "&&", "?", "?|", "?&"}
+
+func (a *queryAnalyzer) operatorType(x *pg_query.A_Expr, scope *queryScope) *PostgresType {
+
+	switch x.Kind {
+	case pg_query.A_Expr_Kind_AEXPR_OP:
+		op := strings.Join(nameStrings(x.Name), ".")
+		if slices.Contains(comparisonOperators, op) {
+			return Boolean
+		}
+		if op == "||" {
+			return Text
+		}
+		if typ := a.inferType(x.Lexpr, scope); typ != nil {
+			return typ
+		}
+		return a.inferType(x.Rexpr, scope)
+	case pg_query.A_Expr_Kind_AEXPR_NULLIF:
+		return a.inferType(x.Lexpr, scope)
+	}
+	// ANY/ALL, DISTINCT, IN, LIKE, BETWEEN and friends are all predicates
+	return Boolean
+}
+
+// functionResultTypes holds the result types of common functions whose
+// result type doesn't depend on their arguments.
+var functionResultTypes = map[string]*PostgresType{
+	"count":                 Bigint,
+	"row_number":            Bigint,
+	"rank":                  Bigint,
+	"dense_rank":            Bigint,
+	"length":                Integer,
+	"char_length":           Integer,
+	"octet_length":          Integer,
+	"avg":                   Numeric,
+	"random":                Double,
+	"now":                   Timestamptz,
+	"clock_timestamp":       Timestamptz,
+	"statement_timestamp":   Timestamptz,
+	"transaction_timestamp": Timestamptz,
+	"to_timestamp":          Timestamptz,
+	"age":                   Interval,
+	"lower":                 Text,
+	"upper":                 Text,
+	"initcap":               Text,
+	"concat":                Text,
+	"concat_ws":             Text,
+	"btrim":                 Text,
+	"ltrim":                 Text,
+	"rtrim":                 Text,
+	"substring":             Text,
+	"substr":                Text,
+	"replace":               Text,
+	"format":                Text,
+	"string_agg":            Text,
+	"to_char":               Text,
+	"md5":                   Text,
+	"bool_and":              Boolean,
+	"bool_or":               Boolean,
+	"every":                 Boolean,
+	"gen_random_uuid":       UUID,
+	"to_json":               JSON,
+	"json_agg":              JSON,
+	"json_build_object":     JSON,
+	"to_jsonb":              JSONB,
+	"jsonb_agg":             JSONB,
+	"jsonb_build_object":    JSONB,
+}
+
+// passThroughFunctions return a value of the same type as their first argument.
+var passThroughFunctions = []string{"min", "max", "abs", "first_value", "last_value", "lag", "lead", "nullif"}
+
+func (a *queryAnalyzer) functionType(fc *pg_query.FuncCall, scope *queryScope) *PostgresType {
+
+	names := nameStrings(fc.Funcname)
+	name := names[len(names)-1]
+	if typ, ok := functionResultTypes[name]; ok {
+		return typ
+	}
+	if slices.Contains(passThroughFunctions, name) && len(fc.Args) > 0 {
+		return a.inferType(fc.Args[0], scope)
+	}
+	switch name {
+	case "sum":
+		if len(fc.Args) == 0 {
+			return nil
+		}
+		switch argType := a.inferType(fc.Args[0], scope); argType {
+		case Smallint, Integer, Serial, Smallserial:
+			return Bigint
+		case Bigint, Bigserial, Numeric:
+			return Numeric
+		default:
+			return argType
+		}
+	case "date_trunc":
+		if len(fc.Args) == 2 {
+			return a.inferType(fc.Args[1], scope)
+		}
+	case "array_agg":
+		if len(fc.Args) == 1 {
+			if argType := a.inferType(fc.Args[0], scope); argType != nil {
+				return a.c.TypeRegistry.ArrayOf(argType, 1)
+			}
+		}
+	case "unnest":
+		if len(fc.Args) == 1 {
+			if argType := a.inferType(fc.Args[0], scope); argType != nil && argType.IsArray() {
+				return argType.ElementType
+			}
+		}
+	}
+	return nil
+}